@@ -0,0 +1,86 @@
+// Package apperror describes the errors the API reports to clients. Each
+// carries the HTTP status it is answered with and a stable code clients can
+// branch on, while its message is meant for people and may be reworded.
+package apperror
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// Error is an error reported to clients. Fields point at the parts of the
+// request that failed validation, when the error is about them.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+
+	base *Error
+}
+
+// FieldError describes why a single request field was rejected. Field is
+// the dotted path to it, such as "emails.0.value", or the name of a query
+// parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrInternal is reported in place of errors that are not application
+// errors, so their details do not reach clients.
+var ErrInternal = New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error WithFields or WithMessage was called on, so
+// errors.Is still matches it.
+func (e *Error) Unwrap() error {
+	if e.base == nil {
+		return nil
+	}
+
+	return e.base
+}
+
+// WithFields returns a copy of the error pointing at the request fields
+// that failed validation.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	withFields := *e
+	withFields.Fields = append(slices.Clone(e.Fields), fields...)
+	withFields.base = e
+
+	return &withFields
+}
+
+// WithMessage returns a copy of the error explaining it with message.
+func (e *Error) WithMessage(message string) *Error {
+	withMessage := *e
+	withMessage.Message = message
+	withMessage.base = e
+
+	return &withMessage
+}
+
+// From returns the application error in err's chain, or ErrInternal when
+// there is none.
+func From(err error) *Error {
+	var appError *Error
+	if errors.As(err, &appError) {
+		return appError
+	}
+
+	return ErrInternal
+}
@@ -0,0 +1,64 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"url-short/internal/logging"
+)
+
+// RunAccountPurge purges users whose account deletion grace period is over
+// every PurgeInterval until ctx is done.
+func (a *Application) RunAccountPurge(ctx context.Context) {
+	ticker := time.NewTicker(a.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.AccountService.PurgeDeletedUsers(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error("could not purge deleted users", "error", err)
+		}
+
+		if purged > 0 {
+			logging.FromContext(ctx).Info("purged deleted users", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// clickFlushInterval is how often buffered clicks are stored, it bounds the
+// clicks lost when the process dies without shutting down. The clicks
+// counted towards plans in Redis are stored in Postgres as often.
+const clickFlushInterval = 10 * time.Second
+
+// RunClickFlush stores buffered clicks and the clicks counted towards plans
+// every clickFlushInterval until ctx is done, Shutdown flushes what is left.
+func (a *Application) RunClickFlush(ctx context.Context) {
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		a.flushClicks(ctx)
+	}
+}
+
+func (a *Application) flushClicks(ctx context.Context) {
+	if _, err := a.clicks.Flush(ctx); err != nil {
+		logging.FromContext(ctx).Error("could not store clicks", "error", err)
+	}
+
+	if _, err := a.quotas.FlushClicks(ctx); err != nil {
+		logging.FromContext(ctx).Error("could not store clicks counted towards plans", "error", err)
+	}
+}
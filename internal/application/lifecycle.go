@@ -0,0 +1,120 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Start serves the API and the metrics and starts the background workers.
+// It returns once they are running, errors that stop a server early are sent
+// on the returned channel.
+func (a *Application) Start() <-chan error {
+	errs := make(chan error, 2)
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	a.stopWorkers = stopWorkers
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.RunAccountPurge(workerCtx)
+	}()
+
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		a.RunClickFlush(workerCtx)
+	}()
+
+	serve := func(name string, server *http.Server) {
+		slog.Info("serving "+name, "address", server.Addr)
+
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}
+
+	if a.MetricsServer != nil {
+		go serve("metrics", a.MetricsServer)
+	}
+
+	go serve("api", a.Server)
+
+	a.ready.Store(true)
+
+	return errs
+}
+
+// Ready reports whether the application takes requests, it stops being
+// ready as soon as it starts shutting down.
+func (a *Application) Ready() bool {
+	return a.ready.Load()
+}
+
+// Shutdown stops the application in order: it reports itself as not ready
+// and gives load balancers ShutdownDelay to stop sending requests, drains the
+// requests in flight and the tasks they started in the background, stops the
+// background workers, stores buffered clicks, flushes buffered spans and
+// closes the connections to Postgres and Redis. Whatever is left when ctx
+// is done is cut off.
+func (a *Application) Shutdown(ctx context.Context) error {
+	a.ready.Store(false)
+	slog.Info("shutting down")
+
+	select {
+	case <-time.After(a.ShutdownDelay):
+	case <-ctx.Done():
+	}
+
+	errs := []error{}
+
+	if err := a.Server.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.background.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if a.stopWorkers != nil {
+		a.stopWorkers()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("background workers did not stop in time"))
+	}
+
+	// the requests are drained, so no clicks are added after this
+	a.flushClicks(ctx)
+
+	if err := a.TracerProvider.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if a.MetricsServer != nil {
+		if err := a.MetricsServer.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := a.sqlDB.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := a.Cache.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,108 +1,847 @@
 package application
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/lib/pq"
 
+	"github.com/pressly/goose/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"url-short/internal/configuration"
 	"url-short/internal/database"
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/ratelimit"
+	"url-short/internal/domain/user"
+	"url-short/internal/mailer"
+	"url-short/internal/metrics"
+	"url-short/internal/password"
 	"url-short/internal/repository"
 	"url-short/internal/service"
+	"url-short/internal/tracing"
 	"url-short/internal/transport/http/api"
 )
 
 type Application struct {
-	Server    *http.Server
-	DB        *database.Queries
-	Cache     *redis.Client
-	JWTSecret string
+	Server         *http.Server
+	MetricsServer  *http.Server
+	TracerProvider *sdktrace.TracerProvider
+	DB             *database.Queries
+	Cache          *redis.Client
+	JWTKeys        *service.JWTKeys
+	AccountService service.AccountService
+	PurgeInterval  time.Duration
+	ShutdownDelay  time.Duration
+
+	routes      []string
+	sqlDB       *sql.DB
+	ready       atomic.Bool
+	background  *service.Background
+	clicks      *service.ClickBuffer
+	quotas      service.QuotaService
+	workers     sync.WaitGroup
+	stopWorkers context.CancelFunc
 }
 
-func NewApplication(s *configuration.ApplicationSettings) (*Application, error) {
+// NewApplication builds the application from its settings, schema holds the
+// migrations the database is expected to have applied.
+func NewApplication(s *configuration.ApplicationSettings, schema fs.FS) (*Application, error) {
+	logger := NewLogger(s.Log)
+	slog.SetDefault(logger)
+
+	tracerProvider, err := NewTracerProvider(s.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
 	db, err := sql.Open("postgres", s.Database.GetPostgresDSN())
 	if err != nil {
 		return nil, err
 	}
 
-	dbQueries := database.New(db)
+	dbQueries := database.New(tracing.NewDB(db))
 
-	mux := http.NewServeMux()
+	passwords, err := NewPasswords(s.Passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	opt, err := redis.ParseURL(s.Cache.GetCacheURL())
+	if err != nil {
+		return nil, err
+	}
+
+	redisClient := redis.NewClient(opt)
+
+	pools, err := metrics.NewPoolRegistry(db, redisClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := redisotel.InstrumentTracing(redisClient); err != nil {
+		return nil, err
+	}
+
+	rateLimiter, err := NewRateLimiter(s.RateLimit, redisClient)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimits := api.NewRateLimitHandler(rateLimiter)
+
+	mux := newRouter()
+
+	var handler http.Handler = rateLimits.GlobalRateLimitMiddleware(mux)
+	if s.Server.ValidateAPI {
+		validator, err := api.NewOpenAPIValidator()
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Warn("validating requests and responses against the OpenAPI document")
+		handler = validator.ValidationMiddleware(handler)
+	}
 
 	server := &http.Server{
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 		IdleTimeout:  120 * time.Second,
 		Addr:         ":" + s.Server.Port,
-		Handler:      mux,
+		Handler: api.TracingMiddleware(mux.ServeMux, api.LoggingMiddleware(logger, mux.ServeMux, api.MetricsMiddleware(
+			mux.ServeMux,
+			api.ClientMiddleware(handler),
+		))),
 	}
 
-	opt, err := redis.ParseURL(s.Cache.GetCacheURL())
+	jwtKeys, err := NewJWTKeys(s.JWT)
 	if err != nil {
 		return nil, err
 	}
 
-	redisClient := redis.NewClient(opt)
-
 	a := &Application{
-		Server:    server,
-		DB:        dbQueries,
-		Cache:     redisClient,
-		JWTSecret: s.Server.JwtSecret,
+		Server:         server,
+		MetricsServer:  NewMetricsServer(s.Server, pools),
+		TracerProvider: tracerProvider,
+		DB:             dbQueries,
+		Cache:          redisClient,
+		JWTKeys:        jwtKeys,
+		PurgeInterval:  s.Users.PurgeInterval,
+		ShutdownDelay:  s.Server.ShutdownDelay,
+		sqlDB:          db,
+		background:     service.NewBackground(),
 	}
 
 	databaseRepo := repository.NewPostgresURLRepository(dbQueries)
 	cacheRepo := repository.NewCacheRedis(redisClient)
 	userRepo := repository.NewPostgresUserRepository(dbQueries)
+	refreshTokenRepo := repository.NewPostgresRefreshTokenRepository(dbQueries)
+	identityRepo := repository.NewPostgresIdentityRepository(dbQueries)
+	scimRepo := repository.NewPostgresSCIMRepository(dbQueries)
+	workspaceRepo := repository.NewPostgresWorkspaceRepository(dbQueries)
+	tokenDenylist := service.NewAccessTokenDenylist(
+		repository.NewRedisTokenDenylist(redisClient),
+		repository.NewLocalTokenDenylist(),
+		s.JWT.DenylistFailClosed,
+	)
+
+	userMailer, err := NewMailer(s.Mailer)
+	if err != nil {
+		return nil, err
+	}
+
+	plans, err := NewPlanCatalog(s.Plans)
+	if err != nil {
+		return nil, err
+	}
+
+	AuditService := service.NewAuditServiceImpl(repository.NewPostgresAuditRepository(dbQueries))
+	QuotaService := service.NewQuotaServiceImpl(
+		repository.NewPostgresQuotaRepository(dbQueries),
+		repository.NewRedisQuotaCounterRepository(redisClient),
+		workspaceRepo,
+		plans,
+	)
+	a.quotas = QuotaService
+	a.clicks = service.NewClickBuffer(databaseRepo)
+	URLservice := service.NewURLServiceImpl(databaseRepo, cacheRepo, workspaceRepo, AuditService, QuotaService, a.clicks)
+	unverifiedUserPolicy, err := user.NewUnverifiedUserPolicy(s.Users.UnverifiedUserPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	attemptCounter := repository.NewRedisAttemptCounter(redisClient)
+
+	EmailVerificationService := service.NewEmailVerificationServiceImpl(
+		userRepo,
+		repository.NewPostgresEmailVerificationRepository(dbQueries),
+		attemptCounter,
+		userMailer,
+		a.background,
+		s.Server.PublicURL+"/verify-email",
+	)
+	totpCipher, err := NewTOTPCipher(s.Users)
+	if err != nil {
+		return nil, err
+	}
+
+	TwoFactorService := service.NewTwoFactorServiceImpl(
+		repository.NewPostgresTwoFactorRepository(dbQueries),
+		attemptCounter,
+		totpCipher,
+	)
+	loginThrottle := service.NewLoginThrottle(repository.NewRedisLoginAttemptRepository(redisClient), AuditService)
+	a.AccountService = service.NewAccountServiceImpl(
+		userRepo,
+		databaseRepo,
+		refreshTokenRepo,
+		identityRepo,
+		repository.NewPostgresUserDeletionRepository(dbQueries),
+		cacheRepo,
+		workspaceRepo,
+		TwoFactorService,
+		EmailVerificationService,
+		tokenDenylist,
+		loginThrottle,
+		passwords,
+		AuditService,
+		s.Users.DeletionGracePeriod,
+	)
+	UserService := service.NewUserServiceImpl(
+		userRepo,
+		refreshTokenRepo,
+		a.JWTKeys,
+		tokenDenylist,
+		EmailVerificationService,
+		TwoFactorService,
+		loginThrottle,
+		passwords,
+		a.AccountService,
+		unverifiedUserPolicy,
+		AuditService,
+	)
+	OIDCService := service.NewOIDCServiceImpl(
+		NewOIDCProviders(s),
+		UserService,
+		userRepo,
+		identityRepo,
+		scimRepo,
+		repository.NewRedisOIDCStateRepository(redisClient),
+		refreshTokenRepo,
+		tokenDenylist,
+		passwords,
+	)
+	PasswordResetService := service.NewPasswordResetServiceImpl(
+		userRepo,
+		repository.NewPostgresPasswordResetRepository(dbQueries),
+		refreshTokenRepo,
+		attemptCounter,
+		tokenDenylist,
+		userMailer,
+		AuditService,
+		a.background,
+		passwords,
+		s.Server.PublicURL+"/password-reset",
+	)
+
+	WorkspaceService := service.NewWorkspaceServiceImpl(
+		workspaceRepo,
+		databaseRepo,
+		userMailer,
+		s.Server.PublicURL+"/workspace-invite",
+	)
 
-	URLservice := service.NewURLServiceImpl(databaseRepo, cacheRepo)
-	UserService := service.NewUserServiceImpl(userRepo, a.JWTSecret)
+	SCIMService := service.NewSCIMServiceImpl(
+		scimRepo,
+		userRepo,
+		workspaceRepo,
+		refreshTokenRepo,
+		tokenDenylist,
+		AuditService,
+		passwords,
+	)
+
+	AdminService := service.NewAdminServiceImpl(
+		userRepo,
+		databaseRepo,
+		refreshTokenRepo,
+		cacheRepo,
+		tokenDenylist,
+		AuditService,
+		QuotaService,
+	)
 
 	users := api.NewUserHandler(UserService)
+	accounts := api.NewAccountHandler(a.AccountService)
 	auth := api.NewAuthHandler(UserService)
 	urls := api.NewShortUrlHandler(URLservice)
+	jwks := api.NewJWKSHandler(a.JWTKeys)
+	passwordResets := api.NewPasswordResetHandler(PasswordResetService)
+	verifications := api.NewEmailVerificationHandler(EmailVerificationService)
+	twoFactor := api.NewTwoFactorHandler(TwoFactorService)
+	oidc := api.NewOIDCHandler(OIDCService)
+	admin := api.NewAdminHandler(AdminService)
+	workspaces := api.NewWorkspaceHandler(WorkspaceService)
+	provisioning := api.NewSCIMHandler(SCIMService)
+	auditLog := api.NewAuditHandler(AuditService)
+	usage := api.NewUsageHandler(QuotaService)
+	idempotent := api.NewIdempotencyHandler(
+		service.NewIdempotencyKeys(repository.NewRedisIdempotencyRepository(redisClient)),
+	)
+
+	readiness, err := NewReadiness(s.Readiness, db, redisClient, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	health := api.NewHealthHandler(a.Ready, readiness)
+	openAPI := api.NewOpenAPIHandler()
 
-	mux.HandleFunc("GET /api/v1/healthz", api.GetHealth)
+	mux.HandleFunc("GET /livez", health.GetLiveness)
+	mux.HandleFunc("GET /readyz", health.GetReadiness)
+	mux.HandleFunc("GET /api/v1/healthz", health.GetLiveness)
+	mux.HandleFunc("GET /.well-known/jwks.json", jwks.GetJWKS)
+	mux.HandleFunc("GET /api/v1/openapi.json", openAPI.GetSpec)
+	mux.HandleFunc("GET /api/v1/docs", openAPI.GetDocs)
 
 	// url management endpoints
 	mux.HandleFunc(
 		"POST /api/v1/urls",
-		auth.AuthenticationMiddleware(urls.CreateShortURL),
+		auth.AuthenticationMiddleware(
+			rateLimits.UserRateLimitMiddleware(
+				ratelimit.GroupURLs,
+				auth.VerifiedEmailMiddleware(idempotent.IdempotencyMiddleware(urls.CreateShortURL)),
+			),
+		),
 	)
 	mux.HandleFunc(
 		"GET /api/v1/urls/{shortUrl}",
-		urls.GetShortURL,
+		rateLimits.RateLimitMiddleware(ratelimit.GroupRedirect, urls.GetShortURL),
 	)
 	mux.HandleFunc(
 		"DELETE /api/v1/urls/{shortUrl}",
-		auth.AuthenticationMiddleware(urls.DeleteShortURL),
+		auth.AuthenticationMiddleware(rateLimits.UserRateLimitMiddleware(ratelimit.GroupURLs, urls.DeleteShortURL)),
 	)
 	mux.HandleFunc(
-		"PUT /api/v1/urls{shortUrl}",
-		auth.AuthenticationMiddleware(urls.UpdateShortURL),
+		"PUT /api/v1/urls/{shortUrl}",
+		auth.AuthenticationMiddleware(
+			rateLimits.UserRateLimitMiddleware(ratelimit.GroupURLs, auth.VerifiedEmailMiddleware(urls.UpdateShortURL)),
+		),
 	)
 
 	// user management endpoints
 	mux.HandleFunc(
 		"POST /api/v1/users",
-		users.CreateUser,
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, users.CreateUser),
 	)
+	// changes confirmed with the current password are limited like logins
 	mux.HandleFunc(
 		"PUT /api/v1/users",
-		auth.AuthenticationMiddleware(users.UpdateUser),
+		auth.AuthenticationMiddleware(rateLimits.UserRateLimitMiddleware(ratelimit.GroupAuth, users.UpdateUser)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/users/me",
+		auth.AuthenticationMiddleware(accounts.GetProfile),
+	)
+	mux.HandleFunc(
+		"PATCH /api/v1/users/me",
+		auth.AuthenticationMiddleware(rateLimits.UserRateLimitMiddleware(ratelimit.GroupAuth, accounts.UpdateProfile)),
+	)
+	mux.HandleFunc(
+		"DELETE /api/v1/users/me",
+		auth.AuthenticationMiddleware(rateLimits.UserRateLimitMiddleware(ratelimit.GroupAuth, accounts.DeleteUser)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/users/me/export",
+		auth.AuthenticationMiddleware(accounts.ExportUserData),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/users/me/audit",
+		auth.AuthenticationMiddleware(auditLog.ListUserEvents),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/users/me/usage",
+		auth.AuthenticationMiddleware(usage.GetUserUsage),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/users/verify",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, verifications.VerifyEmail),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/users/verify/resend",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, verifications.ResendVerificationEmail),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/users/2fa",
+		auth.AuthenticationMiddleware(twoFactor.EnrollTOTP),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/users/2fa/confirm",
+		auth.AuthenticationMiddleware(twoFactor.ConfirmTOTP),
 	)
 	mux.HandleFunc(
 		"POST /api/v1/login",
-		users.LoginUser,
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, users.LoginUser),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/login/2fa",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, users.LoginUserWithTwoFactor),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/auth/oidc/{provider}/start",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, oidc.StartLogin),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/auth/oidc/{provider}/callback",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, oidc.CompleteLogin),
 	)
 	mux.HandleFunc(
 		"POST /api/v1/refresh",
-		users.RefreshAccessToken,
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, users.RefreshAccessToken),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/logout",
+		auth.AuthenticationMiddleware(users.LogoutUser),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/password-reset",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, passwordResets.RequestPasswordReset),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/password-reset/confirm",
+		rateLimits.RateLimitMiddleware(ratelimit.GroupAuth, passwordResets.ConfirmPasswordReset),
 	)
 
+	// workspace endpoints
+	mux.HandleFunc(
+		"GET /api/v1/workspaces",
+		auth.AuthenticationMiddleware(workspaces.ListWorkspaces),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/workspaces",
+		auth.AuthenticationMiddleware(idempotent.IdempotencyMiddleware(workspaces.CreateWorkspace)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/workspaces/{id}/urls",
+		auth.AuthenticationMiddleware(workspaces.ListURLs),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/workspaces/{id}/usage",
+		auth.AuthenticationMiddleware(usage.GetWorkspaceUsage),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/workspaces/{id}/members",
+		auth.AuthenticationMiddleware(workspaces.ListMembers),
+	)
+	mux.HandleFunc(
+		"PUT /api/v1/workspaces/{id}/members/{userId}",
+		auth.AuthenticationMiddleware(workspaces.SetMemberRole),
+	)
+	mux.HandleFunc(
+		"DELETE /api/v1/workspaces/{id}/members/{userId}",
+		auth.AuthenticationMiddleware(workspaces.RemoveMember),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/workspaces/{id}/invites",
+		auth.AuthenticationMiddleware(idempotent.IdempotencyMiddleware(workspaces.InviteMember)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/workspaces/invites/accept",
+		auth.AuthenticationMiddleware(workspaces.AcceptInvite),
+	)
+
+	// scim token responses carry the token, so they are never stored for
+	// idempotent replays
+	mux.HandleFunc(
+		"POST /api/v1/workspaces/{id}/scim-tokens",
+		auth.AuthenticationMiddleware(provisioning.CreateToken),
+	)
+	mux.HandleFunc(
+		"DELETE /api/v1/workspaces/{id}/scim-tokens/{tokenId}",
+		auth.AuthenticationMiddleware(provisioning.RevokeToken),
+	)
+
+	// scim provisioning endpoints, authenticated with a workspace scim token
+	mux.HandleFunc(
+		"GET /scim/v2/ServiceProviderConfig",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.GetServiceProviderConfig),
+	)
+	mux.HandleFunc(
+		"GET /scim/v2/Users",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.ListUsers),
+	)
+	mux.HandleFunc(
+		"POST /scim/v2/Users",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.CreateUser),
+	)
+	mux.HandleFunc(
+		"GET /scim/v2/Users/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.GetUser),
+	)
+	mux.HandleFunc(
+		"PUT /scim/v2/Users/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.ReplaceUser),
+	)
+	mux.HandleFunc(
+		"PATCH /scim/v2/Users/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.PatchUser),
+	)
+	mux.HandleFunc(
+		"DELETE /scim/v2/Users/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.DeleteUser),
+	)
+	mux.HandleFunc(
+		"GET /scim/v2/Groups",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.ListGroups),
+	)
+	mux.HandleFunc(
+		"POST /scim/v2/Groups",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.CreateGroup),
+	)
+	mux.HandleFunc(
+		"GET /scim/v2/Groups/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.GetGroup),
+	)
+	mux.HandleFunc(
+		"PUT /scim/v2/Groups/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.ReplaceGroup),
+	)
+	mux.HandleFunc(
+		"PATCH /scim/v2/Groups/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.PatchGroup),
+	)
+	mux.HandleFunc(
+		"DELETE /scim/v2/Groups/{id}",
+		provisioning.SCIMAuthenticationMiddleware(provisioning.DeleteGroup),
+	)
+
+	// admin endpoints
+	mux.HandleFunc(
+		"GET /api/v1/admin/users",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.ListUsers)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/admin/users/{id}/disable",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.DisableUser)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/admin/users/{id}/enable",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.EnableUser)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/admin/users/{id}/logout",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.LogoutUser)),
+	)
+	mux.HandleFunc(
+		"PUT /api/v1/admin/users/{id}/role",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.SetUserRole)),
+	)
+	mux.HandleFunc(
+		"PUT /api/v1/admin/users/{id}/plan",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.SetUserPlan)),
+	)
+	mux.HandleFunc(
+		"PUT /api/v1/admin/workspaces/{id}/plan",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.SetWorkspacePlan)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/admin/urls",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.ListURLs)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/admin/urls/{shortUrl}/disable",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.DisableURL)),
+	)
+	mux.HandleFunc(
+		"POST /api/v1/admin/urls/{shortUrl}/enable",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.EnableURL)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/admin/audit",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.ListAuditEvents)),
+	)
+	mux.HandleFunc(
+		"GET /api/v1/admin/audit/verify",
+		auth.AuthenticationMiddleware(auth.AuthorizationMiddleware(user.RoleAdmin, admin.VerifyAuditChain)),
+	)
+
+	a.routes = mux.patterns
+
 	return a, nil
 }
+
+// NewLogger writes log lines at or above the configured level to standard
+// output, as text or as JSON.
+func NewLogger(s *configuration.LogSettings) *slog.Logger {
+	options := &slog.HandlerOptions{Level: s.Level}
+
+	if s.Format == configuration.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(os.Stdout, options))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stdout, options))
+}
+
+// NewTracerProvider samples the configured share of new traces, and every
+// trace a caller already sampled, and exports their spans in batches.
+func NewTracerProvider(s *configuration.TracingSettings) (*sdktrace.TracerProvider, error) {
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(s.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(s.ServiceName))),
+	}
+
+	switch s.Exporter {
+	case configuration.TracingExporterOTLP:
+		exporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case configuration.TracingExporterStdout:
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// NewReadiness checks that Postgres answers and has every migration of
+// schema applied, and that Redis answers. Redis is optional as redirects fall
+// back to Postgres while it is down.
+func NewReadiness(
+	s *configuration.ReadinessSettings,
+	db *sql.DB,
+	c *redis.Client,
+	schema fs.FS,
+) (*service.Readiness, error) {
+	migrations, err := goose.NewProvider(goose.DialectPostgres, db, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []service.ReadinessCheck{
+		{
+			Name:     "postgres",
+			Required: true,
+			Check:    db.PingContext,
+		},
+		{
+			Name:     "migrations",
+			Required: true,
+			Check: func(ctx context.Context) error {
+				return checkSchemaVersion(ctx, migrations)
+			},
+		},
+		{
+			Name: "redis",
+			Check: func(ctx context.Context) error {
+				return c.Ping(ctx).Err()
+			},
+		},
+	}
+
+	return service.NewReadiness(checks, s.CheckTimeout, s.CacheTTL), nil
+}
+
+// checkSchemaVersion fails while the database is behind the newest
+// migration, a database ahead of it is fine as it is migrated before new
+// builds are rolled out.
+func checkSchemaVersion(ctx context.Context, migrations *goose.Provider) error {
+	current, err := migrations.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	sources := migrations.ListSources()
+	expected := sources[len(sources)-1].Version
+
+	if current < expected {
+		return fmt.Errorf("database schema is at version %d, expected %d", current, expected)
+	}
+
+	return nil
+}
+
+// NewMetricsServer serves the metrics, along with those in pools, at /metrics
+// on their own port, so they are not exposed with the API. It returns nil
+// when no port is configured.
+func NewMetricsServer(s *configuration.ServerSettings, pools prometheus.Gatherer) *http.Server {
+	if s.MetricsPort == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler(pools))
+
+	return &http.Server{
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+		Addr:         ":" + s.MetricsPort,
+		Handler:      mux,
+	}
+}
+
+// NewJWTKeys loads the signing and verification keys named in the settings,
+// falling back to the shared HS256 secret when no signing key file is set.
+func NewJWTKeys(s *configuration.JWTSettings) (*service.JWTKeys, error) {
+	if !s.IsAsymmetric() {
+		return service.NewHMACJWTKeys(s.Secret), nil
+	}
+
+	signingKey, err := os.ReadFile(s.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := [][]byte{}
+	for _, keyFile := range s.VerificationKeyFiles {
+		verificationKey, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		verificationKeys = append(verificationKeys, verificationKey)
+	}
+
+	return service.NewJWTKeys(signingKey, verificationKeys, s.Secret)
+}
+
+func NewMailer(s *configuration.MailerSettings) (mailer.Mailer, error) {
+	switch s.Driver {
+	case configuration.MailerDriverSMTP:
+		return mailer.NewSMTPMailer(s.SMTPHost, s.SMTPPort, s.SMTPUsername, s.SMTPPassword, s.From), nil
+	case configuration.MailerDriverFile:
+		return mailer.NewFileMailer(s.FilePath)
+	default:
+		return mailer.NewLogMailer(), nil
+	}
+}
+
+// NewTOTPCipher returns the cipher two factor secrets are stored with, or nil
+// when no key is configured.
+func NewTOTPCipher(s *configuration.UserSettings) (*service.SecretCipher, error) {
+	if len(s.TOTPEncryptionKey) == 0 {
+		return nil, nil
+	}
+
+	return service.NewSecretCipher(s.TOTPEncryptionKey)
+}
+
+// NewOIDCProviders builds the configured identity providers, each one sends
+// users back to its callback endpoint under APP_PUBLIC_URL.
+func NewOIDCProviders(s *configuration.ApplicationSettings) []*service.OIDCProvider {
+	providers := []*service.OIDCProvider{}
+
+	for _, provider := range s.OIDC.Providers {
+		providers = append(providers, service.NewOIDCProvider(service.OIDCProviderConfig{
+			Name:                provider.Name,
+			Issuer:              provider.Issuer,
+			ClientID:            provider.ClientID,
+			ClientSecret:        provider.ClientSecret,
+			RedirectURL:         s.Server.PublicURL + "/api/v1/auth/oidc/" + provider.Name + "/callback",
+			Scopes:              provider.Scopes,
+			AllowedEmailDomains: provider.AllowedEmailDomains,
+		}))
+	}
+
+	return providers
+}
+
+// NewRateLimiter limits requests in Redis, falling back to limiting them in
+// memory while Redis is unavailable.
+func NewRateLimiter(s *configuration.RateLimitSettings, c *redis.Client) (*service.RateLimiter, error) {
+	allowlist, err := ratelimit.NewAllowlist(s.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := map[ratelimit.Group]ratelimit.Limit{}
+	for _, group := range s.Groups {
+		limits[ratelimit.Group(group.Name)] = ratelimit.Limit{
+			Requests: group.Requests,
+			Period:   group.Period,
+		}
+	}
+
+	return service.NewRateLimiter(
+		repository.NewRedisRateLimiter(c),
+		repository.NewLocalRateLimiter(),
+		limits,
+		allowlist,
+	), nil
+}
+
+// NewPlanCatalog builds the configured plans.
+func NewPlanCatalog(s *configuration.PlanSettings) (*plan.Catalog, error) {
+	plans := []plan.Plan{}
+
+	for _, p := range s.Plans {
+		plans = append(plans, plan.Plan{
+			Name: p.Name,
+			Limits: plan.Limits{
+				MaxActiveLinks:   int64(p.MaxActiveLinks),
+				MaxCustomAliases: int64(p.MaxCustomAliases),
+				MaxMonthlyClicks: int64(p.MaxMonthlyClicks),
+				MaxAPIKeys:       int64(p.MaxAPIKeys),
+				MaxBatchSize:     int64(p.MaxBatchSize),
+			},
+		})
+	}
+
+	return plan.NewCatalog(plans, s.DefaultPlan)
+}
+
+// NewPasswords hashes passwords with the configured cost and checks new
+// passwords against the configured policy.
+func NewPasswords(s *configuration.PasswordSettings) (*user.Passwords, error) {
+	var breached user.BreachedPasswordChecker
+
+	if s.BreachedHashesDir != "" {
+		directory, err := password.NewBreachedPasswordDirectory(s.BreachedHashesDir)
+		if err != nil {
+			return nil, err
+		}
+
+		breached = directory
+	}
+
+	hasher := password.NewHasher(password.Argon2idParams{
+		Memory:      s.Argon2Memory,
+		Iterations:  s.Argon2Iterations,
+		Parallelism: s.Argon2Parallelism,
+		SaltLength:  password.DefaultArgon2idParams.SaltLength,
+		KeyLength:   password.DefaultArgon2idParams.KeyLength,
+	})
+
+	return user.NewPasswords(hasher, user.NewPasswordPolicy(s.MinLength, breached))
+}
@@ -0,0 +1,54 @@
+package application
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"url-short/internal/configuration"
+	"url-short/internal/transport/http/api"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	settings, err := configuration.NewApplicationSettings()
+	if err != nil {
+		t.Fatalf("could not build settings %q", err)
+	}
+
+	app, err := NewApplication(settings, os.DirFS("../../sql/schema"))
+	if err != nil {
+		t.Fatalf("could not build application %q", err)
+	}
+
+	validator, err := api.NewOpenAPIValidator()
+	if err != nil {
+		t.Fatalf("could not build validator from the OpenAPI document %q", err)
+	}
+
+	documented := validator.Patterns()
+
+	for _, route := range app.routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("route %q is registered but missing from the OpenAPI document", route)
+		}
+	}
+
+	for _, operation := range documented {
+		if !slices.Contains(app.routes, operation) {
+			t.Errorf("operation %q is documented but no route is registered for it", operation)
+		}
+	}
+}
+
+func TestApplicationCanBeBuiltTwice(t *testing.T) {
+	settings, err := configuration.NewApplicationSettings()
+	if err != nil {
+		t.Fatalf("could not build settings %q", err)
+	}
+
+	for range 2 {
+		if _, err := NewApplication(settings, os.DirFS("../../sql/schema")); err != nil {
+			t.Fatalf("could not build application %q", err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package application
+
+import "net/http"
+
+// router is a ServeMux that remembers the patterns registered on it, so
+// tests can check each route is in the OpenAPI document.
+type router struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouter() *router {
+	return &router{ServeMux: http.NewServeMux()}
+}
+
+func (r *router) Handle(pattern string, handler http.Handler) {
+	r.ServeMux.Handle(pattern, handler)
+	r.patterns = append(r.patterns, pattern)
+}
+
+func (r *router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.ServeMux.HandleFunc(pattern, handler)
+	r.patterns = append(r.patterns, pattern)
+}
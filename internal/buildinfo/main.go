@@ -0,0 +1,47 @@
+// Package buildinfo describes the running build, so probes and logs can tell
+// which version of the application answered.
+package buildinfo
+
+import (
+	"runtime/debug"
+)
+
+// Version is set at build time with
+// -ldflags "-X url-short/internal/buildinfo.Version=<version>".
+var Version = "dev"
+
+type Info struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// Read returns the version and the commit the binary was built from, the
+// commit is only known when it was built from a git checkout.
+func Read() Info {
+	info := Info{
+		Version: Version,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = build.GoVersion
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.CommitTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
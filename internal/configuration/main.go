@@ -1,15 +1,31 @@
 package configuration
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ApplicationSettings struct {
-	Server   *ServerSettings
-	Database *DatabaseSettings
-	Cache    *CacheSettings
+	Server    *ServerSettings
+	JWT       *JWTSettings
+	Database  *DatabaseSettings
+	Cache     *CacheSettings
+	Mailer    *MailerSettings
+	Users     *UserSettings
+	OIDC      *OIDCSettings
+	Passwords *PasswordSettings
+	Plans     *PlanSettings
+	RateLimit *RateLimitSettings
+	Log       *LogSettings
+	Tracing   *TracingSettings
+	Readiness *ReadinessSettings
 }
 
 func NewApplicationSettings() (*ApplicationSettings, error) {
@@ -17,6 +33,10 @@ func NewApplicationSettings() (*ApplicationSettings, error) {
 	if err != nil {
 		return nil, err
 	}
+	jwtSettings, err := newJWTSettings()
+	if err != nil {
+		return nil, err
+	}
 	databaseSettings, err := newDatabaseSettings()
 	if err != nil {
 		return nil, err
@@ -25,17 +45,73 @@ func NewApplicationSettings() (*ApplicationSettings, error) {
 	if err != nil {
 		return nil, err
 	}
+	mailerSettings, err := newMailerSettings()
+	if err != nil {
+		return nil, err
+	}
+	userSettings, err := newUserSettings()
+	if err != nil {
+		return nil, err
+	}
+	oidcSettings, err := newOIDCSettings()
+	if err != nil {
+		return nil, err
+	}
+	passwordSettings, err := newPasswordSettings()
+	if err != nil {
+		return nil, err
+	}
+	planSettings, err := newPlanSettings()
+	if err != nil {
+		return nil, err
+	}
+	rateLimitSettings, err := newRateLimitSettings()
+	if err != nil {
+		return nil, err
+	}
+	logSettings, err := newLogSettings()
+	if err != nil {
+		return nil, err
+	}
+	tracingSettings, err := newTracingSettings()
+	if err != nil {
+		return nil, err
+	}
+	readinessSettings, err := newReadinessSettings()
+	if err != nil {
+		return nil, err
+	}
 
 	return &ApplicationSettings{
-		Server:   serverSettings,
-		Database: databaseSettings,
-		Cache:    cacheSettings,
+		Server:    serverSettings,
+		JWT:       jwtSettings,
+		Database:  databaseSettings,
+		Cache:     cacheSettings,
+		Mailer:    mailerSettings,
+		Users:     userSettings,
+		OIDC:      oidcSettings,
+		Passwords: passwordSettings,
+		Plans:     planSettings,
+		RateLimit: rateLimitSettings,
+		Log:       logSettings,
+		Tracing:   tracingSettings,
+		Readiness: readinessSettings,
 	}, nil
 }
 
+// ServerSettings configure the API listener, and the separate listener
+// metrics are served from unless MetricsPort is empty. On shutdown the
+// server reports itself as not ready for ShutdownDelay before it stops
+// taking requests, and has until ShutdownTimeout to drain them.
+// ValidateAPI checks every request and response against the OpenAPI
+// document, it is meant for tests.
 type ServerSettings struct {
-	Port      string
-	JwtSecret string
+	Port            string
+	PublicURL       string
+	MetricsPort     string
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+	ValidateAPI     bool
 }
 
 func newServerSettings() (*ServerSettings, error) {
@@ -46,22 +122,91 @@ func newServerSettings() (*ServerSettings, error) {
 		)
 	}
 
-	jwtSecret, found := os.LookupEnv("APP_JWT_SECRET")
+	// an empty APP_METRICS_PORT turns the metrics listener off
+	metricsPort, found := os.LookupEnv("APP_METRICS_PORT")
 	if !found {
-		return nil,
-			errors.New(
-				"could not build server settings: not found APP_JWT_SECRET",
-			)
+		metricsPort = "9090"
+	}
+
+	shutdownDelay, err := lookupEnvDuration("APP_SHUTDOWN_DELAY", 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not build server settings: %w", err)
+	}
+
+	shutdownTimeout, err := lookupEnvDuration("APP_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not build server settings: %w", err)
+	}
+
+	if shutdownDelay < 0 || shutdownTimeout <= shutdownDelay {
+		return nil, errors.New(
+			"could not build server settings: APP_SHUTDOWN_TIMEOUT must be longer than APP_SHUTDOWN_DELAY",
+		)
+	}
+
+	validateAPI, err := lookupEnvBool("APP_OPENAPI_VALIDATION", false)
+	if err != nil {
+		return nil, fmt.Errorf("could not build server settings: %w", err)
 	}
 
 	serverSettings := ServerSettings{
-		Port:      serverPort,
-		JwtSecret: jwtSecret,
+		Port:            serverPort,
+		PublicURL:       strings.TrimSuffix(lookupEnvDefault("APP_PUBLIC_URL", "http://localhost:"+serverPort), "/"),
+		MetricsPort:     metricsPort,
+		ShutdownDelay:   shutdownDelay,
+		ShutdownTimeout: shutdownTimeout,
+		ValidateAPI:     validateAPI,
+	}
+
+	if metricsPort == serverPort {
+		return nil, errors.New(
+			"could not build server settings: APP_METRICS_PORT must differ from APP_SERVER_PORT",
+		)
 	}
 
 	return &serverSettings, nil
 }
 
+// JWTSettings selects how access tokens are signed. When a signing key file
+// is set tokens are signed with that RSA or Ed25519 key and the secret, if
+// also set, is only used to verify HS256 tokens issued before the switch.
+type JWTSettings struct {
+	Secret               string
+	SigningKeyFile       string
+	VerificationKeyFiles []string
+	DenylistFailClosed   bool
+}
+
+func newJWTSettings() (*JWTSettings, error) {
+	jwtSecret, _ := os.LookupEnv("APP_JWT_SECRET")
+	signingKeyFile, _ := os.LookupEnv("APP_JWT_SIGNING_KEY_FILE")
+	verificationKeyFiles, _ := os.LookupEnv("APP_JWT_VERIFICATION_KEY_FILES")
+
+	if jwtSecret == "" && signingKeyFile == "" {
+		return nil, errors.New(
+			"could not build jwt settings: not found APP_JWT_SECRET or APP_JWT_SIGNING_KEY_FILE",
+		)
+	}
+
+	denylistFailClosed, err := lookupEnvBool("APP_JWT_DENYLIST_FAIL_CLOSED", false)
+	if err != nil {
+		return nil, fmt.Errorf("could not build jwt settings: %w", err)
+	}
+
+	jwtSettings := JWTSettings{
+		Secret:               jwtSecret,
+		SigningKeyFile:       signingKeyFile,
+		VerificationKeyFiles: splitList(verificationKeyFiles),
+		DenylistFailClosed:   denylistFailClosed,
+	}
+
+	return &jwtSettings, nil
+}
+
+func (j *JWTSettings) IsAsymmetric() bool {
+	return j.SigningKeyFile != ""
+}
+
 type DatabaseSettings struct {
 	host         string
 	port         string
@@ -182,3 +327,530 @@ func newCacheSettings() (*CacheSettings, error) {
 func (c *CacheSettings) GetCacheURL() string {
 	return fmt.Sprintf("redis://%v:%v/%v", c.host, c.port, c.databaseId)
 }
+
+const (
+	MailerDriverLog  = "log"
+	MailerDriverFile = "file"
+	MailerDriverSMTP = "smtp"
+)
+
+// MailerSettings selects where emails to users go. The log and file drivers
+// never deliver anything and are meant for local development and tests.
+type MailerSettings struct {
+	Driver       string
+	From         string
+	FilePath     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+func newMailerSettings() (*MailerSettings, error) {
+	// there is no default driver, a deployment that forgot to pick one would
+	// otherwise write live reset and verification links to its log
+	driver, found := os.LookupEnv("APP_MAILER_DRIVER")
+	if !found {
+		return nil, errors.New(
+			"could not build mailer settings: not found APP_MAILER_DRIVER",
+		)
+	}
+
+	mailerSettings := MailerSettings{
+		Driver:       driver,
+		From:         lookupEnvDefault("APP_MAILER_FROM", "no-reply@localhost"),
+		FilePath:     lookupEnvDefault("APP_MAILER_FILE_PATH", "mail.log"),
+		SMTPHost:     lookupEnvDefault("APP_SMTP_HOST", ""),
+		SMTPPort:     lookupEnvDefault("APP_SMTP_PORT", "587"),
+		SMTPUsername: lookupEnvDefault("APP_SMTP_USERNAME", ""),
+		SMTPPassword: lookupEnvDefault("APP_SMTP_PASSWORD", ""),
+	}
+
+	switch mailerSettings.Driver {
+	case MailerDriverLog, MailerDriverFile:
+	case MailerDriverSMTP:
+		if mailerSettings.SMTPHost == "" {
+			return nil, errors.New(
+				"could not build mailer settings: not found APP_SMTP_HOST",
+			)
+		}
+	default:
+		return nil, fmt.Errorf(
+			"could not build mailer settings: unknown APP_MAILER_DRIVER %q",
+			mailerSettings.Driver,
+		)
+	}
+
+	return &mailerSettings, nil
+}
+
+type UserSettings struct {
+	// UnverifiedUserPolicy is one of "none", "login" or "login_and_links"
+	// and decides what users can do before verifying their email.
+	UnverifiedUserPolicy string
+	// TOTPEncryptionKey encrypts two factor secrets at rest, two factor
+	// authentication is unavailable when it is not set.
+	TOTPEncryptionKey []byte
+	// DeletionGracePeriod is how long after asking for their account to be
+	// deleted a user is purged, PurgeInterval is how often that is checked.
+	DeletionGracePeriod time.Duration
+	PurgeInterval       time.Duration
+}
+
+func newUserSettings() (*UserSettings, error) {
+	totpEncryptionKey := []byte{}
+
+	encodedKey, _ := os.LookupEnv("APP_TOTP_ENCRYPTION_KEY")
+	if encodedKey != "" {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New(
+				"could not build user settings: APP_TOTP_ENCRYPTION_KEY must be 32 base64 encoded bytes",
+			)
+		}
+
+		totpEncryptionKey = key
+	}
+
+	deletionGracePeriod, err := lookupEnvDuration("APP_ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("could not build user settings: %w", err)
+	}
+
+	purgeInterval, err := lookupEnvDuration("APP_ACCOUNT_PURGE_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("could not build user settings: %w", err)
+	}
+
+	if deletionGracePeriod < 0 || purgeInterval <= 0 {
+		return nil, errors.New("could not build user settings: account deletion settings are out of range")
+	}
+
+	return &UserSettings{
+		UnverifiedUserPolicy: lookupEnvDefault("APP_UNVERIFIED_USER_POLICY", "login"),
+		TOTPEncryptionKey:    totpEncryptionKey,
+		DeletionGracePeriod:  deletionGracePeriod,
+		PurgeInterval:        purgeInterval,
+	}, nil
+}
+
+// OIDCSettings lists the OpenID Connect identity providers users can sign in
+// with. Providers are named in APP_OIDC_PROVIDERS and each one is configured
+// through variables prefixed with its upper cased name, for example
+// APP_OIDC_CORP_ISSUER for a provider named corp.
+type OIDCSettings struct {
+	Providers []OIDCProviderSettings
+}
+
+type OIDCProviderSettings struct {
+	Name                string
+	Issuer              string
+	ClientID            string
+	ClientSecret        string
+	Scopes              []string
+	AllowedEmailDomains []string
+}
+
+func newOIDCSettings() (*OIDCSettings, error) {
+	oidcSettings := OIDCSettings{
+		Providers: []OIDCProviderSettings{},
+	}
+
+	providerNames, _ := os.LookupEnv("APP_OIDC_PROVIDERS")
+
+	for _, name := range splitList(providerNames) {
+		prefix := "APP_OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := OIDCProviderSettings{
+			Name:                name,
+			Issuer:              lookupEnvDefault(prefix+"ISSUER", ""),
+			ClientID:            lookupEnvDefault(prefix+"CLIENT_ID", ""),
+			ClientSecret:        lookupEnvDefault(prefix+"CLIENT_SECRET", ""),
+			Scopes:              splitList(lookupEnvDefault(prefix+"SCOPES", "openid,email,profile")),
+			AllowedEmailDomains: splitList(lookupEnvDefault(prefix+"ALLOWED_EMAIL_DOMAINS", "")),
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf(
+				"could not build oidc settings: not found %sISSUER or %sCLIENT_ID",
+				prefix,
+				prefix,
+			)
+		}
+
+		oidcSettings.Providers = append(oidcSettings.Providers, provider)
+	}
+
+	return &oidcSettings, nil
+}
+
+// PasswordSettings select the argon2id cost of new password hashes and the
+// policy new passwords must meet. BreachedHashesDir is optional and holds a
+// local copy of the Pwned Passwords range files.
+type PasswordSettings struct {
+	MinLength         int
+	BreachedHashesDir string
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+func newPasswordSettings() (*PasswordSettings, error) {
+	minLength, err := lookupEnvInt("APP_PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return nil, fmt.Errorf("could not build password settings: %w", err)
+	}
+
+	argon2Memory, err := lookupEnvInt("APP_ARGON2_MEMORY_KIB", 64*1024)
+	if err != nil {
+		return nil, fmt.Errorf("could not build password settings: %w", err)
+	}
+
+	argon2Iterations, err := lookupEnvInt("APP_ARGON2_ITERATIONS", 3)
+	if err != nil {
+		return nil, fmt.Errorf("could not build password settings: %w", err)
+	}
+
+	argon2Parallelism, err := lookupEnvInt("APP_ARGON2_PARALLELISM", 2)
+	if err != nil {
+		return nil, fmt.Errorf("could not build password settings: %w", err)
+	}
+
+	if minLength < 1 || argon2Memory < 8*argon2Parallelism || argon2Iterations < 1 ||
+		argon2Parallelism < 1 || argon2Parallelism > 255 {
+		return nil, errors.New("could not build password settings: password settings are out of range")
+	}
+
+	passwordSettings := PasswordSettings{
+		MinLength:         minLength,
+		BreachedHashesDir: lookupEnvDefault("APP_PASSWORD_BREACHED_HASHES_DIR", ""),
+		Argon2Memory:      uint32(argon2Memory),
+		Argon2Iterations:  uint32(argon2Iterations),
+		Argon2Parallelism: uint8(argon2Parallelism),
+	}
+
+	return &passwordSettings, nil
+}
+
+// PlanSettings lists the plans workspaces can be on. Plans are named in
+// APP_PLANS and their limits are set through variables prefixed with the
+// upper cased name, for example APP_PLAN_FREE_MAX_ACTIVE_LINKS for a plan
+// named free. A limit that is not set or zero is unlimited. Workspaces that
+// were not given a plan are on DefaultPlan.
+type PlanSettings struct {
+	Plans       []PlanLimitsSettings
+	DefaultPlan string
+}
+
+type PlanLimitsSettings struct {
+	Name             string
+	MaxActiveLinks   int
+	MaxCustomAliases int
+	MaxMonthlyClicks int
+	MaxAPIKeys       int
+	MaxBatchSize     int
+}
+
+func newPlanSettings() (*PlanSettings, error) {
+	planSettings := PlanSettings{
+		Plans:       []PlanLimitsSettings{},
+		DefaultPlan: lookupEnvDefault("APP_DEFAULT_PLAN", "free"),
+	}
+
+	planNames := splitList(lookupEnvDefault("APP_PLANS", "free"))
+
+	for _, name := range planNames {
+		prefix := "APP_PLAN_" + strings.ToUpper(name) + "_"
+		limits := map[string]int{}
+
+		for _, limit := range []string{
+			"MAX_ACTIVE_LINKS",
+			"MAX_CUSTOM_ALIASES",
+			"MAX_MONTHLY_CLICKS",
+			"MAX_API_KEYS",
+			"MAX_BATCH_SIZE",
+		} {
+			value, err := lookupEnvInt(prefix+limit, 0)
+			if err != nil {
+				return nil, fmt.Errorf("could not build plan settings: %w", err)
+			}
+
+			if value < 0 {
+				return nil, fmt.Errorf("could not build plan settings: %s%s is out of range", prefix, limit)
+			}
+
+			limits[limit] = value
+		}
+
+		planSettings.Plans = append(planSettings.Plans, PlanLimitsSettings{
+			Name:             name,
+			MaxActiveLinks:   limits["MAX_ACTIVE_LINKS"],
+			MaxCustomAliases: limits["MAX_CUSTOM_ALIASES"],
+			MaxMonthlyClicks: limits["MAX_MONTHLY_CLICKS"],
+			MaxAPIKeys:       limits["MAX_API_KEYS"],
+			MaxBatchSize:     limits["MAX_BATCH_SIZE"],
+		})
+	}
+
+	if !slices.Contains(planNames, planSettings.DefaultPlan) {
+		return nil, fmt.Errorf(
+			"could not build plan settings: APP_DEFAULT_PLAN %q is not in APP_PLANS",
+			planSettings.DefaultPlan,
+		)
+	}
+
+	return &planSettings, nil
+}
+
+// RateLimitSettings limit how many requests a client makes to each group of
+// routes. A group's limit is set through APP_RATE_LIMIT_<GROUP>_REQUESTS and
+// APP_RATE_LIMIT_<GROUP>_PERIOD, zero requests turns the group's limit off.
+// Callers from the networks in Allowlist are never limited.
+type RateLimitSettings struct {
+	Groups    []RateLimitGroupSettings
+	Allowlist []string
+}
+
+type RateLimitGroupSettings struct {
+	Name     string
+	Requests int
+	Period   time.Duration
+}
+
+// defaultRateLimits are the groups of routes with their default limits.
+var defaultRateLimits = []RateLimitGroupSettings{
+	{Name: "default", Requests: 300, Period: time.Minute},
+	{Name: "auth", Requests: 20, Period: time.Minute},
+	{Name: "urls", Requests: 60, Period: time.Minute},
+	{Name: "redirect", Requests: 600, Period: time.Minute},
+}
+
+func newRateLimitSettings() (*RateLimitSettings, error) {
+	rateLimitSettings := RateLimitSettings{
+		Groups:    []RateLimitGroupSettings{},
+		Allowlist: splitList(lookupEnvDefault("APP_RATE_LIMIT_ALLOWLIST", "")),
+	}
+
+	for _, group := range defaultRateLimits {
+		prefix := "APP_RATE_LIMIT_" + strings.ToUpper(group.Name) + "_"
+
+		requests, err := lookupEnvInt(prefix+"REQUESTS", group.Requests)
+		if err != nil {
+			return nil, fmt.Errorf("could not build rate limit settings: %w", err)
+		}
+
+		period, err := lookupEnvDuration(prefix+"PERIOD", group.Period)
+		if err != nil {
+			return nil, fmt.Errorf("could not build rate limit settings: %w", err)
+		}
+
+		if requests < 0 || period <= 0 {
+			return nil, fmt.Errorf("could not build rate limit settings: %s limit is out of range", group.Name)
+		}
+
+		rateLimitSettings.Groups = append(rateLimitSettings.Groups, RateLimitGroupSettings{
+			Name:     group.Name,
+			Requests: requests,
+			Period:   period,
+		})
+	}
+
+	return &rateLimitSettings, nil
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogSettings select the lowest level logged and whether lines are written
+// as logfmt style text or as JSON objects.
+type LogSettings struct {
+	Level  slog.Level
+	Format string
+}
+
+func newLogSettings() (*LogSettings, error) {
+	logSettings := LogSettings{
+		Format: lookupEnvDefault("APP_LOG_FORMAT", LogFormatText),
+	}
+
+	err := logSettings.Level.UnmarshalText([]byte(lookupEnvDefault("APP_LOG_LEVEL", "info")))
+	if err != nil {
+		return nil, fmt.Errorf("could not build log settings: invalid APP_LOG_LEVEL: %w", err)
+	}
+
+	switch logSettings.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf(
+			"could not build log settings: unknown APP_LOG_FORMAT %q",
+			logSettings.Format,
+		)
+	}
+
+	return &logSettings, nil
+}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// TracingSettings select where spans are exported and which share of traces
+// is sampled. The OTLP exporter is configured through the standard
+// OTEL_EXPORTER_OTLP_* variables.
+type TracingSettings struct {
+	Exporter    string
+	ServiceName string
+	SampleRatio float64
+}
+
+func newTracingSettings() (*TracingSettings, error) {
+	sampleRatio, err := lookupEnvFloat("APP_TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, fmt.Errorf("could not build tracing settings: %w", err)
+	}
+
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, errors.New(
+			"could not build tracing settings: APP_TRACING_SAMPLE_RATIO must be between 0 and 1",
+		)
+	}
+
+	tracingSettings := TracingSettings{
+		Exporter:    lookupEnvDefault("APP_TRACING_EXPORTER", TracingExporterNone),
+		ServiceName: lookupEnvDefault("APP_TRACING_SERVICE_NAME", "url-short"),
+		SampleRatio: sampleRatio,
+	}
+
+	switch tracingSettings.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		return nil, fmt.Errorf(
+			"could not build tracing settings: unknown APP_TRACING_EXPORTER %q",
+			tracingSettings.Exporter,
+		)
+	}
+
+	return &tracingSettings, nil
+}
+
+// ReadinessSettings bound how long each readiness check may take and how
+// long its result is reused for later probes.
+type ReadinessSettings struct {
+	CheckTimeout time.Duration
+	CacheTTL     time.Duration
+}
+
+func newReadinessSettings() (*ReadinessSettings, error) {
+	checkTimeout, err := lookupEnvDuration("APP_READINESS_CHECK_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not build readiness settings: %w", err)
+	}
+
+	cacheTTL, err := lookupEnvDuration("APP_READINESS_CACHE_TTL", 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not build readiness settings: %w", err)
+	}
+
+	if checkTimeout <= 0 || cacheTTL < 0 {
+		return nil, errors.New("could not build readiness settings: durations are out of range")
+	}
+
+	return &ReadinessSettings{
+		CheckTimeout: checkTimeout,
+		CacheTTL:     cacheTTL,
+	}, nil
+}
+
+// lookupEnvDefault reads an optional environment variable, returning fallback
+// when it is not set.
+func lookupEnvDefault(key, fallback string) string {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// splitList parses a comma separated environment variable, ignoring empty
+// entries and surrounding whitespace.
+func splitList(value string) []string {
+	items := []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// lookupEnvBool reads an optional boolean environment variable, returning
+// fallback when it is not set.
+func lookupEnvBool(key string, fallback bool) (bool, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// lookupEnvInt reads an optional integer environment variable, returning
+// fallback when it is not set.
+func lookupEnvInt(key string, fallback int) (int, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// lookupEnvFloat reads an optional decimal environment variable, returning
+// fallback when it is not set.
+func lookupEnvFloat(key string, fallback float64) (float64, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// lookupEnvDuration reads an optional duration environment variable such as
+// "720h", returning fallback when it is not set.
+func lookupEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
@@ -6,24 +6,168 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
-type Url struct {
+type AuditEvent struct {
+	ID         int64
+	EventType  string
+	UserID     sql.NullInt32
+	IpAddress  string
+	Details    json.RawMessage
+	CreatedAt  time.Time
+	ActorID    sql.NullInt32
+	UserAgent  string
+	TargetType string
+	TargetID   string
+	Diff       json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
+type EmailVerificationToken struct {
 	ID        int32
-	ShortUrl  string
-	LongUrl   string
+	UserID    int32
+	Email     string
+	TokenHash string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	ID        int32
 	UserID    int32
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	ID        int32
+	UserID    int32
+	FamilyID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+type ScimToken struct {
+	ID          int32
+	WorkspaceID int32
+	TokenHash   string
+	CreatedBy   sql.NullInt32
+	CreatedAt   time.Time
+	RevokedAt   sql.NullTime
+}
+
+type ScimUser struct {
+	UserID      int32
+	WorkspaceID int32
+	ExternalID  sql.NullString
+	CreatedAt   time.Time
+}
+
+type Url struct {
+	ID             int32
+	ShortUrl       string
+	LongUrl        string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UserID         sql.NullInt32
+	DisabledAt     sql.NullTime
+	DisabledReason sql.NullString
+	WorkspaceID    int32
+}
+
+type UrlClick struct {
+	UrlID  int32
+	Day    time.Time
+	Clicks int64
 }
 
 type User struct {
-	ID                     int32
-	Email                  string
-	Password               string
-	CreatedAt              time.Time
-	UpdatedAt              time.Time
-	RefreshToken           sql.NullString
-	RefreshTokenRevokeDate sql.NullTime
+	ID              int32
+	Email           string
+	Password        string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt sql.NullTime
+	Role            string
+	DisabledAt      sql.NullTime
+	DisabledBy      sql.NullString
+}
+
+type UserDeletion struct {
+	UserID      int32
+	RequestedAt time.Time
+	PurgeAfter  time.Time
+}
+
+type UserIdentity struct {
+	ID        int32
+	UserID    int32
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type UserRecoveryCode struct {
+	ID        int32
+	UserID    int32
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type UserTotp struct {
+	UserID          int32
+	EncryptedSecret string
+	LastUsedStep    int64
+	CreatedAt       time.Time
+	ConfirmedAt     sql.NullTime
+}
+
+type Workspace struct {
+	ID             int32
+	Name           string
+	PersonalUserID sql.NullInt32
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type WorkspaceInvite struct {
+	ID          int32
+	WorkspaceID int32
+	Email       string
+	Role        string
+	TokenHash   string
+	InvitedBy   sql.NullInt32
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	AcceptedAt  sql.NullTime
+}
+
+type WorkspaceMember struct {
+	WorkspaceID int32
+	UserID      int32
+	Role        string
+	CreatedAt   time.Time
+}
+
+type WorkspaceMonthlyClick struct {
+	WorkspaceID int32
+	Month       time.Time
+	Clicks      int64
+}
+
+type WorkspaceQuota struct {
+	WorkspaceID int32
+	Plan        string
+	ActiveLinks int64
 }
@@ -7,25 +7,61 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
+const countUserURLs = `-- name: CountUserURLs :one
+SELECT COUNT(*) AS links, COUNT(disabled_at) AS disabled_links
+FROM urls
+WHERE user_id = $1
+`
+
+type CountUserURLsRow struct {
+	Links         int64
+	DisabledLinks int64
+}
+
+func (q *Queries) CountUserURLs(ctx context.Context, userID sql.NullInt32) (CountUserURLsRow, error) {
+	row := q.db.QueryRowContext(ctx, countUserURLs, userID)
+	var i CountUserURLsRow
+	err := row.Scan(&i.Links, &i.DisabledLinks)
+	return i, err
+}
+
 const createURL = `-- name: CreateURL :one
-INSERT INTO urls (short_url, long_url, created_at, updated_at, user_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, short_url, long_url, created_at, updated_at, user_id
+WITH quota AS (
+	SELECT workspace_id
+	FROM workspace_quotas
+	WHERE workspace_id = $1 AND
+	($2::bigint = 0 OR active_links < $2::bigint)
+	FOR UPDATE
+)
+INSERT INTO urls (short_url, long_url, created_at, updated_at, user_id, workspace_id)
+SELECT $3::text, $4::text, $5::timestamp,
+$6::timestamp, workspace_members.user_id, workspace_members.workspace_id
+FROM workspace_members
+JOIN quota ON quota.workspace_id = workspace_members.workspace_id
+WHERE workspace_members.workspace_id = $1 AND
+workspace_members.user_id = $7 AND
+workspace_members.role IN ('owner', 'admin', 'editor')
+RETURNING id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
 `
 
 type CreateURLParams struct {
-	ShortUrl  string
-	LongUrl   string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    int32
+	WorkspaceID    int32
+	MaxActiveLinks int64
+	ShortUrl       string
+	LongUrl        string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UserID         int32
 }
 
 func (q *Queries) CreateURL(ctx context.Context, arg CreateURLParams) (Url, error) {
 	row := q.db.QueryRowContext(ctx, createURL,
+		arg.WorkspaceID,
+		arg.MaxActiveLinks,
 		arg.ShortUrl,
 		arg.LongUrl,
 		arg.CreatedAt,
@@ -40,28 +76,118 @@ func (q *Queries) CreateURL(ctx context.Context, arg CreateURLParams) (Url, erro
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
-const deleteURL = `-- name: DeleteURL :exec
+const deleteURL = `-- name: DeleteURL :one
 DELETE FROM urls
-WHERE user_id = $1 AND 
-short_url = $2
+WHERE short_url = $1 AND
+workspace_id IN (
+	SELECT workspace_id
+	FROM workspace_members
+	WHERE user_id = $2 AND
+	role IN ('owner', 'admin', 'editor')
+)
+RETURNING id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
 `
 
 type DeleteURLParams struct {
+	ShortUrl string
 	UserID   int32
+}
+
+func (q *Queries) DeleteURL(ctx context.Context, arg DeleteURLParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, deleteURL, arg.ShortUrl, arg.UserID)
+	var i Url
+	err := row.Scan(
+		&i.ID,
+		&i.ShortUrl,
+		&i.LongUrl,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const recordURLClicks = `-- name: RecordURLClicks :exec
+INSERT INTO url_clicks (url_id, day, clicks)
+SELECT id, $1::date, $2::bigint
+FROM urls
+WHERE short_url = $3
+ON CONFLICT (url_id, day) DO UPDATE
+SET clicks = url_clicks.clicks + EXCLUDED.clicks
+`
+
+type RecordURLClicksParams struct {
+	Day      time.Time
+	Clicks   int64
 	ShortUrl string
 }
 
-func (q *Queries) DeleteURL(ctx context.Context, arg DeleteURLParams) error {
-	_, err := q.db.ExecContext(ctx, deleteURL, arg.UserID, arg.ShortUrl)
+func (q *Queries) RecordURLClicks(ctx context.Context, arg RecordURLClicksParams) error {
+	_, err := q.db.ExecContext(ctx, recordURLClicks, arg.Day, arg.Clicks, arg.ShortUrl)
 	return err
 }
 
+const searchURLs = `-- name: SearchURLs :many
+SELECT id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
+FROM urls
+WHERE $1::text = '' OR
+short_url ILIKE '%' || $1::text || '%' OR
+long_url ILIKE '%' || $1::text || '%'
+ORDER BY id
+LIMIT $2 OFFSET $3
+`
+
+type SearchURLsParams struct {
+	Query     string
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) SearchURLs(ctx context.Context, arg SearchURLsParams) ([]Url, error) {
+	rows, err := q.db.QueryContext(ctx, searchURLs, arg.Query, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShortUrl,
+			&i.LongUrl,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.DisabledAt,
+			&i.DisabledReason,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const selectURL = `-- name: SelectURL :one
-SELECT id, short_url, long_url, created_at, updated_at, user_id 
+SELECT id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id 
 FROM urls
 WHERE short_url = $1
 `
@@ -76,6 +202,167 @@ func (q *Queries) SelectURL(ctx context.Context, shortUrl string) (Url, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const selectUserURLClicks = `-- name: SelectUserURLClicks :many
+SELECT urls.short_url, url_clicks.day, url_clicks.clicks
+FROM url_clicks
+JOIN urls ON urls.id = url_clicks.url_id
+WHERE urls.user_id = $1
+ORDER BY urls.short_url, url_clicks.day
+`
+
+type SelectUserURLClicksRow struct {
+	ShortUrl string
+	Day      time.Time
+	Clicks   int64
+}
+
+func (q *Queries) SelectUserURLClicks(ctx context.Context, userID sql.NullInt32) ([]SelectUserURLClicksRow, error) {
+	rows, err := q.db.QueryContext(ctx, selectUserURLClicks, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SelectUserURLClicksRow
+	for rows.Next() {
+		var i SelectUserURLClicksRow
+		if err := rows.Scan(&i.ShortUrl, &i.Day, &i.Clicks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectUserURLs = `-- name: SelectUserURLs :many
+SELECT id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
+FROM urls
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) SelectUserURLs(ctx context.Context, userID sql.NullInt32) ([]Url, error) {
+	rows, err := q.db.QueryContext(ctx, selectUserURLs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShortUrl,
+			&i.LongUrl,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.DisabledAt,
+			&i.DisabledReason,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectWorkspaceURLs = `-- name: SelectWorkspaceURLs :many
+SELECT id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
+FROM urls
+WHERE workspace_id = $1 AND
+EXISTS (
+	SELECT 1
+	FROM workspace_members
+	WHERE workspace_id = $1 AND
+	user_id = $2
+)
+ORDER BY created_at
+`
+
+type SelectWorkspaceURLsParams struct {
+	WorkspaceID int32
+	UserID      int32
+}
+
+func (q *Queries) SelectWorkspaceURLs(ctx context.Context, arg SelectWorkspaceURLsParams) ([]Url, error) {
+	rows, err := q.db.QueryContext(ctx, selectWorkspaceURLs, arg.WorkspaceID, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShortUrl,
+			&i.LongUrl,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.DisabledAt,
+			&i.DisabledReason,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setURLDisabled = `-- name: SetURLDisabled :one
+UPDATE urls
+SET disabled_at = $1, disabled_reason = $2
+WHERE short_url = $3
+RETURNING id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
+`
+
+type SetURLDisabledParams struct {
+	DisabledAt     sql.NullTime
+	DisabledReason sql.NullString
+	ShortUrl       string
+}
+
+func (q *Queries) SetURLDisabled(ctx context.Context, arg SetURLDisabledParams) (Url, error) {
+	row := q.db.QueryRowContext(ctx, setURLDisabled, arg.DisabledAt, arg.DisabledReason, arg.ShortUrl)
+	var i Url
+	err := row.Scan(
+		&i.ID,
+		&i.ShortUrl,
+		&i.LongUrl,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
@@ -83,24 +370,29 @@ func (q *Queries) SelectURL(ctx context.Context, shortUrl string) (Url, error) {
 const updateShortURL = `-- name: UpdateShortURL :one
 UPDATE urls
 SET long_url = $1, updated_at = $2
-WHERE user_id = $3 AND 
-short_url = $4
-RETURNING id, short_url, long_url, created_at, updated_at, user_id
+WHERE short_url = $3 AND
+workspace_id IN (
+	SELECT workspace_id
+	FROM workspace_members
+	WHERE user_id = $4 AND
+	role IN ('owner', 'admin', 'editor')
+)
+RETURNING id, short_url, long_url, created_at, updated_at, user_id, disabled_at, disabled_reason, workspace_id
 `
 
 type UpdateShortURLParams struct {
 	LongUrl   string
 	UpdatedAt time.Time
-	UserID    int32
 	ShortUrl  string
+	UserID    int32
 }
 
 func (q *Queries) UpdateShortURL(ctx context.Context, arg UpdateShortURLParams) (Url, error) {
 	row := q.db.QueryRowContext(ctx, updateShortURL,
 		arg.LongUrl,
 		arg.UpdatedAt,
-		arg.UserID,
 		arg.ShortUrl,
+		arg.UserID,
 	)
 	var i Url
 	err := row.Scan(
@@ -110,6 +402,9 @@ func (q *Queries) UpdateShortURL(ctx context.Context, arg UpdateShortURLParams)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
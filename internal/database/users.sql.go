@@ -12,9 +12,22 @@ import (
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (email, password, created_at, updated_at)
-VALUES ($1, $2, $3, $4)
-RETURNING id, email, password, created_at, updated_at, refresh_token, refresh_token_revoke_date
+WITH new_user AS (
+	INSERT INTO users (email, password, created_at, updated_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+), personal_workspace AS (
+	INSERT INTO workspaces (name, personal_user_id, created_at, updated_at)
+	SELECT 'Personal', id, created_at, created_at
+	FROM new_user
+	RETURNING id, personal_user_id, created_at
+), personal_membership AS (
+	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+	SELECT id, personal_user_id, 'owner', created_at
+	FROM personal_workspace
+)
+SELECT id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+FROM new_user
 `
 
 type CreateUserParams struct {
@@ -24,13 +37,59 @@ type CreateUserParams struct {
 	UpdatedAt time.Time
 }
 
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+type CreateUserRow struct {
+	ID              int32
+	Email           string
+	Password        string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt sql.NullTime
+	Role            string
+	DisabledAt      sql.NullTime
+	DisabledBy      sql.NullString
+}
+
+// every user is created with a personal workspace they own
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
 	row := q.db.QueryRowContext(ctx, createUser,
 		arg.Email,
 		arg.Password,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 	)
+	var i CreateUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
+	)
+	return i, err
+}
+
+const disableUserBy = `-- name: DisableUserBy :one
+UPDATE users
+SET disabled_at = COALESCE(disabled_at, $1),
+disabled_by = COALESCE(disabled_by, $2),
+updated_at = $1
+WHERE id = $3
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+`
+
+type DisableUserByParams struct {
+	DisabledAt sql.NullTime
+	DisabledBy sql.NullString
+	ID         int32
+}
+
+// users who are already disabled stay disabled by whoever disabled them
+func (q *Queries) DisableUserBy(ctx context.Context, arg DisableUserByParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, disableUserBy, arg.DisabledAt, arg.DisabledBy, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -38,14 +97,127 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Password,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.RefreshToken,
-		&i.RefreshTokenRevokeDate,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
 	return i, err
 }
 
+const enableUserDisabledBy = `-- name: EnableUserDisabledBy :one
+UPDATE users
+SET disabled_at = NULL, disabled_by = NULL, updated_at = $1
+WHERE id = $2 AND
+(disabled_by IS NULL OR disabled_by = $3)
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+`
+
+type EnableUserDisabledByParams struct {
+	UpdatedAt  time.Time
+	ID         int32
+	DisabledBy sql.NullString
+}
+
+// users disabled by someone else stay disabled
+func (q *Queries) EnableUserDisabledBy(ctx context.Context, arg EnableUserDisabledByParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, enableUserDisabledBy, arg.UpdatedAt, arg.ID, arg.DisabledBy)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
+	)
+	return i, err
+}
+
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :one
+UPDATE users
+SET email_verified_at = $1
+WHERE id = $2 AND
+email = $3
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+`
+
+type MarkUserEmailVerifiedParams struct {
+	EmailVerifiedAt sql.NullTime
+	ID              int32
+	Email           string
+}
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, arg MarkUserEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markUserEmailVerified, arg.EmailVerifiedAt, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+FROM users
+WHERE $1::text = '' OR
+email ILIKE '%' || $1::text || '%'
+ORDER BY id
+LIMIT $2 OFFSET $3
+`
+
+type SearchUsersParams struct {
+	Query     string
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Query, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Password,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EmailVerifiedAt,
+			&i.Role,
+			&i.DisabledAt,
+			&i.DisabledBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const selectUser = `-- name: SelectUser :one
-SELECT id, email, password, created_at, updated_at, refresh_token, refresh_token_revoke_date
+SELECT id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
 FROM users
 WHERE email = $1
 `
@@ -59,14 +231,16 @@ func (q *Queries) SelectUser(ctx context.Context, email string) (User, error) {
 		&i.Password,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.RefreshToken,
-		&i.RefreshTokenRevokeDate,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
 	return i, err
 }
 
 const selectUserByID = `-- name: SelectUserByID :one
-SELECT id, email, password, created_at, updated_at, refresh_token, refresh_token_revoke_date
+SELECT id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
 FROM users
 WHERE id = $1
 `
@@ -80,20 +254,35 @@ func (q *Queries) SelectUserByID(ctx context.Context, id int32) (User, error) {
 		&i.Password,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.RefreshToken,
-		&i.RefreshTokenRevokeDate,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
 	return i, err
 }
 
-const selectUserByRefreshToken = `-- name: SelectUserByRefreshToken :one
-SELECT id, email, password, created_at, updated_at, refresh_token, refresh_token_revoke_date
-FROM users
-WHERE refresh_token = $1
+const setUserDisabledAt = `-- name: SetUserDisabledAt :one
+UPDATE users
+SET disabled_at = $1, disabled_by = $2, updated_at = $3
+WHERE id = $4
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
 `
 
-func (q *Queries) SelectUserByRefreshToken(ctx context.Context, refreshToken sql.NullString) (User, error) {
-	row := q.db.QueryRowContext(ctx, selectUserByRefreshToken, refreshToken)
+type SetUserDisabledAtParams struct {
+	DisabledAt sql.NullTime
+	DisabledBy sql.NullString
+	UpdatedAt  time.Time
+	ID         int32
+}
+
+func (q *Queries) SetUserDisabledAt(ctx context.Context, arg SetUserDisabledAtParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserDisabledAt,
+		arg.DisabledAt,
+		arg.DisabledBy,
+		arg.UpdatedAt,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -101,33 +290,60 @@ func (q *Queries) SelectUserByRefreshToken(ctx context.Context, refreshToken sql
 		&i.Password,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.RefreshToken,
-		&i.RefreshTokenRevokeDate,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const setUserRole = `-- name: SetUserRole :one
 UPDATE users
-SET email = $1, password = $2, updated_at = $3
-WHERE id = $4
-RETURNING id, email, password, created_at, updated_at, refresh_token, refresh_token_revoke_date
+SET role = $1, updated_at = $2
+WHERE id = $3
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
 `
 
-type UpdateUserParams struct {
-	Email     string
-	Password  string
+type SetUserRoleParams struct {
+	Role      string
 	UpdatedAt time.Time
 	ID        int32
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser,
-		arg.Email,
-		arg.Password,
-		arg.UpdatedAt,
-		arg.ID,
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.UpdatedAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
+	return i, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users
+SET email = $1, updated_at = $2,
+email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END
+WHERE id = $3
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
+`
+
+type UpdateUserEmailParams struct {
+	Email     string
+	UpdatedAt time.Time
+	ID        int32
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.Email, arg.UpdatedAt, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -135,25 +351,40 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Password,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.RefreshToken,
-		&i.RefreshTokenRevokeDate,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
 	)
 	return i, err
 }
 
-const userTokenRefresh = `-- name: UserTokenRefresh :exec
+const updateUserPassword = `-- name: UpdateUserPassword :one
 UPDATE users
-SET refresh_token = $1, refresh_token_revoke_date = $2
+SET password = $1, updated_at = $2
 WHERE id = $3
+RETURNING id, email, password, created_at, updated_at, email_verified_at, role, disabled_at, disabled_by
 `
 
-type UserTokenRefreshParams struct {
-	RefreshToken           sql.NullString
-	RefreshTokenRevokeDate sql.NullTime
-	ID                     int32
+type UpdateUserPasswordParams struct {
+	Password  string
+	UpdatedAt time.Time
+	ID        int32
 }
 
-func (q *Queries) UserTokenRefresh(ctx context.Context, arg UserTokenRefreshParams) error {
-	_, err := q.db.ExecContext(ctx, userTokenRefresh, arg.RefreshToken, arg.RefreshTokenRevokeDate, arg.ID)
-	return err
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.Password, arg.UpdatedAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.DisabledAt,
+		&i.DisabledBy,
+	)
+	return i, err
 }
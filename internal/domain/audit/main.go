@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-short/internal/apperror"
+	"url-short/internal/domain/user"
+)
+
+var (
+	ErrInvalidListRequest = apperror.New(http.StatusBadRequest, "invalid_audit_list_request", "user_id and actor_id must be user ids and since and until RFC 3339 times")
+	ErrUnexpectedError    = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+)
+
+type EventType string
+
+const (
+	EventLoginSucceeded       EventType = "login.succeeded"
+	EventLoginFailed          EventType = "login.failed"
+	EventLoginTwoFactorFailed EventType = "login.two_factor_failed"
+	EventLoginLocked          EventType = "login.locked"
+	EventLoginUnlocked        EventType = "login.unlocked"
+	EventLoginIPLocked        EventType = "login.ip_locked"
+
+	EventTokenRefreshed     EventType = "token.refreshed"
+	EventTokenReuseDetected EventType = "token.reuse_detected"
+
+	EventUserCreated         EventType = "user.created"
+	EventUserLoggedOut       EventType = "user.logged_out"
+	EventUserEmailChanged    EventType = "user.email_changed"
+	EventUserPasswordChanged EventType = "user.password_changed"
+
+	EventURLCreated EventType = "url.created"
+	EventURLUpdated EventType = "url.updated"
+	EventURLDeleted EventType = "url.deleted"
+
+	EventUserDeletionScheduled EventType = "user.deletion_scheduled"
+	EventUserDeletionCancelled EventType = "user.deletion_cancelled"
+	EventUserPurged            EventType = "user.purged"
+
+	EventAdminUsersListed      EventType = "admin.users_listed"
+	EventAdminUserDisabled     EventType = "admin.user_disabled"
+	EventAdminUserEnabled      EventType = "admin.user_enabled"
+	EventAdminUserLoggedOut    EventType = "admin.user_logged_out"
+	EventAdminUserRoleSet      EventType = "admin.user_role_set"
+	EventAdminUserPlanSet      EventType = "admin.user_plan_set"
+	EventAdminURLsListed       EventType = "admin.urls_listed"
+	EventAdminURLDisabled      EventType = "admin.url_disabled"
+	EventAdminURLEnabled       EventType = "admin.url_enabled"
+	EventAdminWorkspacePlanSet EventType = "admin.workspace_plan_set"
+	EventAdminAuditListed      EventType = "admin.audit_listed"
+	EventAdminAuditVerified    EventType = "admin.audit_verified"
+	EventSCIMTokenCreated      EventType = "scim.token_created"
+	EventSCIMTokenRevoked      EventType = "scim.token_revoked"
+	EventSCIMUserProvisioned   EventType = "scim.user_provisioned"
+	EventSCIMUserDeprovisioned EventType = "scim.user_deprovisioned"
+	EventSCIMUserReactivated   EventType = "scim.user_reactivated"
+	EventSCIMUserDeleted       EventType = "scim.user_deleted"
+	EventSCIMUserRoleSet       EventType = "scim.user_role_set"
+)
+
+type TargetType string
+
+const (
+	TargetUser      TargetType = "user"
+	TargetURL       TargetType = "url"
+	TargetWorkspace TargetType = "workspace"
+	TargetSCIMToken TargetType = "scim_token"
+)
+
+// Target is what an event acted on, it is empty when the event is only about
+// the user.
+type Target struct {
+	Type TargetType
+	ID   string
+}
+
+func NewTarget(targetType TargetType, id string) Target {
+	return Target{
+		Type: targetType,
+		ID:   id,
+	}
+}
+
+// NewUserTarget targets the user with userID.
+func NewUserTarget(userID int32) Target {
+	return NewTarget(TargetUser, strconv.Itoa(int(userID)))
+}
+
+// Change is the value of a field before and after an action, From is nil
+// when the field was created and To when it was removed.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff holds the fields an action changed. Secrets such as passwords are
+// never put in a diff, their events only say that they changed.
+type Diff map[string]Change
+
+// Add records field when from and to differ.
+func (d Diff) Add(field string, from, to any) Diff {
+	if from != to {
+		d[field] = Change{From: from, To: to}
+	}
+
+	return d
+}
+
+// Event records something security relevant that happened. UserID is who
+// the event is about and ActorID who caused it, either is zero when unknown
+// and ActorID is zero for the system and for directories. Each event's Hash
+// covers its contents and PrevHash, the hash of the event before it.
+type Event struct {
+	ID        int64
+	Type      EventType
+	UserID    int32
+	ActorID   int32
+	IPAddress string
+	UserAgent string
+	Target    Target
+	Details   map[string]any
+	Diff      Diff
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// Actor is the user who performed an action and the address they did it
+// from.
+type Actor struct {
+	UserID    int32
+	IPAddress string
+}
+
+func NewActor(userID int32, ipAddress string) *Actor {
+	return &Actor{
+		UserID:    userID,
+		IPAddress: ipAddress,
+	}
+}
+
+// Client is where a request came from. It is carried in the request's
+// context so events record it without every service passing it along.
+type Client struct {
+	IPAddress string
+	UserAgent string
+}
+
+type clientContextKey struct{}
+
+func ContextWithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext returns the client of the request ctx belongs to, or an
+// empty client outside of a request.
+func ClientFromContext(ctx context.Context) Client {
+	client, _ := ctx.Value(clientContextKey{}).(Client)
+
+	return client
+}
+
+// CreateEventRequest is acted on by the user it is about unless ActorID is
+// changed. An empty IPAddress or UserAgent is taken from the request's client.
+type CreateEventRequest struct {
+	Type      EventType
+	UserID    int32
+	ActorID   int32
+	IPAddress string
+	UserAgent string
+	Target    Target
+	Details   map[string]any
+	Diff      Diff
+}
+
+func NewCreateEventRequest(
+	eventType EventType,
+	userID int32,
+	ipAddress string,
+	details map[string]any,
+) *CreateEventRequest {
+	if details == nil {
+		details = map[string]any{}
+	}
+
+	return &CreateEventRequest{
+		Type:      eventType,
+		UserID:    userID,
+		ActorID:   userID,
+		IPAddress: ipAddress,
+		Details:   details,
+		Diff:      Diff{},
+	}
+}
+
+// ListEventsRequest filters events by the user they are about, who caused
+// them, their type and when they happened. Zero values match every event.
+type ListEventsRequest struct {
+	UserID  int32
+	ActorID int32
+	Type    EventType
+	Since   time.Time
+	Until   time.Time
+	Limit   int32
+	Offset  int32
+}
+
+// NewListEventsRequest takes its arguments as given in a query string, since
+// is inclusive and until exclusive.
+func NewListEventsRequest(userID, actorID, eventType, since, until, limit, offset string) (*ListEventsRequest, error) {
+	parsedLimit, parsedOffset, err := user.ParsePage(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &ListEventsRequest{
+		Type:   EventType(eventType),
+		Limit:  parsedLimit,
+		Offset: parsedOffset,
+	}
+
+	if userID != "" {
+		if request.UserID, err = user.NewUserID(userID); err != nil {
+			return nil, ErrInvalidListRequest
+		}
+	}
+
+	if actorID != "" {
+		if request.ActorID, err = user.NewUserID(actorID); err != nil {
+			return nil, ErrInvalidListRequest
+		}
+	}
+
+	if since != "" {
+		if request.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return nil, ErrInvalidListRequest
+		}
+	}
+
+	if until != "" {
+		if request.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, ErrInvalidListRequest
+		}
+	}
+
+	return request, nil
+}
+
+// ChainVerification is the result of checking every event's hash. The chain
+// is intact when FirstBrokenID is zero, HeadHash can be kept elsewhere to
+// later show that no events were removed from the end.
+type ChainVerification struct {
+	Events        int64
+	HeadHash      string
+	FirstBrokenID int64
+}
+
+func (v ChainVerification) Intact() bool {
+	return v.FirstBrokenID == 0
+}
@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+const (
+	// Header carries the key clients pick for a request they may retry.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from a stored record.
+	ReplayedHeader = "Idempotency-Replayed"
+
+	MaxKeyLength = 255
+	// Retention is how long the first response to a key is replayed for.
+	Retention = 24 * time.Hour
+)
+
+var (
+	ErrInvalidKey = apperror.New(
+		http.StatusBadRequest,
+		"invalid_idempotency_key",
+		"Idempotency-Key must be 1 to 255 printable ASCII characters",
+	)
+	ErrRequestInProgress = apperror.New(
+		http.StatusConflict,
+		"idempotency_request_in_progress",
+		"a request with this Idempotency-Key is still being processed, retry it later",
+	)
+	ErrKeyReused = apperror.New(
+		http.StatusUnprocessableEntity,
+		"idempotency_key_reused",
+		"Idempotency-Key was already used for a different request",
+	)
+)
+
+// Record is kept under an idempotency key. It holds the fingerprint of the
+// first request made with the key and, once that request is answered, its
+// response.
+type Record struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+func ValidateKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return ErrInvalidKey
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
+
+// Fingerprint identifies a request, a key may only be reused for requests
+// with the same fingerprint.
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// HashKey shortens a key to a fixed length so it can be stored.
+func HashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
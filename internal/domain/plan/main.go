@@ -0,0 +1,194 @@
+package plan
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrQuotaExceeded   = apperror.New(http.StatusPaymentRequired, "quota_exceeded", "your plan does not allow this")
+	ErrUnknownPlan     = apperror.New(http.StatusBadRequest, "unknown_plan", "plan is not one of the configured plans")
+	ErrUnexpectedError = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+)
+
+// Quota is something a plan limits.
+type Quota string
+
+const (
+	QuotaActiveLinks   Quota = "active_links"
+	QuotaCustomAliases Quota = "custom_aliases"
+	QuotaMonthlyClicks Quota = "monthly_clicks"
+	QuotaAPIKeys       Quota = "api_keys"
+	QuotaBatchSize     Quota = "batch_size"
+)
+
+// QuotaExceededError is returned when an action would take a workspace over
+// one of its plan's limits.
+type QuotaExceededError struct {
+	Plan  string
+	Quota Quota
+	Limit int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: the %s plan allows at most %d %s", ErrQuotaExceeded, e.Plan, e.Limit, e.Quota)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Limits are the most a workspace on a plan can have of each quota, zero is
+// unlimited. MaxMonthlyClicks does not stop redirects, clicks over the limit
+// are just not tracked.
+type Limits struct {
+	MaxActiveLinks   int64
+	MaxCustomAliases int64
+	MaxMonthlyClicks int64
+	MaxAPIKeys       int64
+	MaxBatchSize     int64
+}
+
+// Limit returns the most the limits allow of the quota, zero is unlimited.
+func (l Limits) Limit(quota Quota) int64 {
+	switch quota {
+	case QuotaActiveLinks:
+		return l.MaxActiveLinks
+	case QuotaCustomAliases:
+		return l.MaxCustomAliases
+	case QuotaMonthlyClicks:
+		return l.MaxMonthlyClicks
+	case QuotaAPIKeys:
+		return l.MaxAPIKeys
+	case QuotaBatchSize:
+		return l.MaxBatchSize
+	}
+
+	return 0
+}
+
+type Plan struct {
+	Name   string
+	Limits Limits
+}
+
+// Check returns a QuotaExceededError when adding to what a workspace already
+// uses of the quota would go over the plan's limit.
+func (p *Plan) Check(quota Quota, used, adding int64) error {
+	limit := p.Limits.Limit(quota)
+	if limit > 0 && used+adding > limit {
+		return &QuotaExceededError{Plan: p.Name, Quota: quota, Limit: limit}
+	}
+
+	return nil
+}
+
+// TracksClick reports whether a click is tracked when it is the nth click of
+// the month.
+func (p *Plan) TracksClick(n int64) bool {
+	return p.Limits.MaxMonthlyClicks == 0 || n <= p.Limits.MaxMonthlyClicks
+}
+
+// Catalog holds the configured plans. Workspaces without a plan, or with a
+// plan that is no longer configured, are on the default plan.
+type Catalog struct {
+	plans       map[string]Plan
+	defaultPlan string
+}
+
+func NewCatalog(plans []Plan, defaultPlan string) (*Catalog, error) {
+	catalog := &Catalog{
+		plans:       map[string]Plan{},
+		defaultPlan: defaultPlan,
+	}
+
+	for _, p := range plans {
+		catalog.plans[p.Name] = p
+	}
+
+	if _, ok := catalog.plans[defaultPlan]; !ok {
+		return nil, ErrUnknownPlan
+	}
+
+	return catalog, nil
+}
+
+// Lookup returns the plan with the exact name.
+func (c *Catalog) Lookup(name string) (*Plan, error) {
+	p, ok := c.plans[name]
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+
+	return &p, nil
+}
+
+// Plan returns the plan a workspace with the plan name stored is on.
+func (c *Catalog) Plan(name string) *Plan {
+	p, ok := c.plans[name]
+	if !ok {
+		p = c.plans[c.defaultPlan]
+	}
+
+	return &p
+}
+
+// Counters are what a workspace uses of its plan, kept up to date as links
+// are created and clicked rather than counted on every check.
+type Counters struct {
+	WorkspaceID   int32
+	Plan          string
+	ActiveLinks   int64
+	MonthlyClicks int64
+}
+
+// MonthlyClicks are the clicks counted towards a workspace's plan in the
+// month starting at Month.
+type MonthlyClicks struct {
+	WorkspaceID int32
+	Month       time.Time
+	Clicks      int64
+}
+
+// Usage is what a workspace uses of its plan in the month starting at
+// PeriodStart.
+type Usage struct {
+	Plan          Plan
+	WorkspaceID   int32
+	PeriodStart   time.Time
+	PeriodEnd     time.Time
+	ActiveLinks   int64
+	MonthlyClicks int64
+}
+
+func NewUsage(p *Plan, counters *Counters, month time.Time) *Usage {
+	return &Usage{
+		Plan:          *p,
+		WorkspaceID:   counters.WorkspaceID,
+		PeriodStart:   month,
+		PeriodEnd:     month.AddDate(0, 1, 0),
+		ActiveLinks:   counters.ActiveLinks,
+		MonthlyClicks: counters.MonthlyClicks,
+	}
+}
+
+// TrackedClicks is how many of the month's clicks count towards the plan,
+// clicks over its limit are not tracked.
+func (u *Usage) TrackedClicks() int64 {
+	if u.Plan.Limits.MaxMonthlyClicks > 0 && u.MonthlyClicks > u.Plan.Limits.MaxMonthlyClicks {
+		return u.Plan.Limits.MaxMonthlyClicks
+	}
+
+	return u.MonthlyClicks
+}
+
+// MonthOf returns the first day of the UTC calendar month of t, quotas are
+// counted per month.
+func MonthOf(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrRateLimited = apperror.New(http.StatusTooManyRequests, "rate_limited", "too many requests, slow down")
+)
+
+// Group is a set of routes sharing a limit, each client has its own allowance
+// in every group.
+type Group string
+
+const (
+	// GroupDefault limits every request to the API per client address.
+	GroupDefault Group = "default"
+	// GroupAuth limits logins, token refreshes and other endpoints that
+	// take credentials per client address.
+	GroupAuth Group = "auth"
+	// GroupURLs limits creating, changing and deleting links per user.
+	GroupURLs Group = "urls"
+	// GroupRedirect limits redirects through short URLs per client address.
+	GroupRedirect Group = "redirect"
+)
+
+var Groups = []Group{GroupDefault, GroupAuth, GroupURLs, GroupRedirect}
+
+// Limit allows Requests per Period, spread out or all at once. A limit
+// without requests does not limit anything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// Interval is how often one more request is allowed.
+func (l Limit) Interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Decision is whether a request is allowed and what is left of the limit,
+// Reset is how long until the full limit is available again and RetryAfter
+// how long a refused client has to wait.
+type Decision struct {
+	Allowed    bool
+	Limit      Limit
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Apply decides on a request at now with the generic cell rate algorithm.
+// tat is the theoretical arrival time stored for the client, the time at
+// which its limit would be fully available again, and the new one is
+// returned to be stored in its place.
+func Apply(l Limit, tat, now time.Time) (Decision, time.Time) {
+	if tat.Before(now) {
+		tat = now
+	}
+
+	interval := l.Interval()
+	next := tat.Add(interval)
+	allowAt := next.Add(-l.Period)
+
+	if now.Before(allowAt) {
+		return Decision{
+			Limit:      l,
+			Reset:      tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}, tat
+	}
+
+	return Decision{
+		Allowed:   true,
+		Limit:     l,
+		Remaining: int((l.Period - next.Sub(now)) / interval),
+		Reset:     next.Sub(now),
+	}, next
+}
+
+// LimitedError is returned for a request over its limit.
+type LimitedError struct {
+	Decision Decision
+}
+
+func (e *LimitedError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+func (e *LimitedError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// Allowlist holds the networks of trusted callers that are never limited.
+type Allowlist []*net.IPNet
+
+func NewAllowlist(cidrs []string) (Allowlist, error) {
+	allowlist := Allowlist{}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist network %q", cidr)
+		}
+
+		allowlist = append(allowlist, network)
+	}
+
+	return allowlist, nil
+}
+
+func (a Allowlist) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range a {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IPKey and UserKey name the client a limit is counted against.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func UserKey(userID int32) string {
+	return fmt.Sprintf("user:%d", userID)
+}
@@ -0,0 +1,444 @@
+package scim
+
+import (
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-short/internal/apperror"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+)
+
+var (
+	ErrInvalidToken    = apperror.New(http.StatusUnauthorized, "invalid_scim_token", "scim token is invalid or has been revoked")
+	ErrTokenNotFound   = apperror.New(http.StatusNotFound, "scim_token_not_found", "scim token could not be found")
+	ErrUserNotFound    = apperror.New(http.StatusNotFound, "scim_user_not_found", "user is not managed by the workspace's directory")
+	ErrGroupNotFound   = apperror.New(http.StatusNotFound, "scim_group_not_found", "group could not be found")
+	ErrInvalidFilter   = apperror.New(http.StatusBadRequest, "invalid_scim_filter", `filter must have the form attribute eq "value"`)
+	ErrInvalidPage     = apperror.New(http.StatusBadRequest, "invalid_scim_page", "startIndex and count must be integers")
+	ErrInvalidUserName = apperror.New(http.StatusBadRequest, "invalid_scim_user_name", "userName must be an email address")
+	ErrInvalidExternal = apperror.New(http.StatusBadRequest, "invalid_scim_external_id", "externalId must be at most 250 characters")
+	ErrInvalidPatch    = apperror.New(http.StatusBadRequest, "invalid_scim_patch", "patch operation or path is not supported")
+	ErrInvalidMember   = apperror.New(http.StatusBadRequest, "invalid_scim_member", "group members must be users managed by the workspace's directory")
+	ErrUniqueness      = apperror.New(http.StatusConflict, "scim_user_already_exists", "a user with this userName already exists")
+	ErrMutability      = apperror.New(http.StatusBadRequest, "scim_group_immutable", "groups are the workspace roles and can not be renamed")
+	ErrUnsupported     = apperror.New(http.StatusNotImplemented, "scim_groups_unsupported", "groups are the workspace roles and can not be created or deleted")
+	ErrUnexpectedError = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+)
+
+const (
+	defaultPageSize       = 100
+	maxPageSize           = 200
+	maxExternalIDLength   = 250
+	filterOperatorPattern = `^\s*([A-Za-z][A-Za-z0-9.]*)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`
+)
+
+var filterPattern = regexp.MustCompile(filterOperatorPattern)
+
+// Token authenticates a directory against one workspace. Token is only set
+// when the token was just created, only its hash is stored.
+type Token struct {
+	ID          int32
+	WorkspaceID int32
+	Token       string
+	TokenHash   string
+	CreatedBy   int32
+	CreatedAt   time.Time
+}
+
+// User is an account provisioned by a workspace's directory, UserName is the
+// account's email. Role is empty when the user was removed from the
+// workspace outside of SCIM.
+type User struct {
+	ID         int32
+	UserName   string
+	ExternalID string
+	Active     bool
+	Role       workspace.Role
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Group is one of the workspace roles, its members are the managed users
+// holding that role. Groups are identified by the role's name.
+type Group struct {
+	ID      workspace.Role
+	Members []User
+}
+
+// Groups lists every role, highest first.
+var Groups = []workspace.Role{
+	workspace.RoleOwner,
+	workspace.RoleAdmin,
+	workspace.RoleEditor,
+	workspace.RoleViewer,
+}
+
+func NewGroupID(groupID string) (workspace.Role, error) {
+	role, err := workspace.NewRole(groupID)
+	if err != nil {
+		return "", ErrGroupNotFound
+	}
+
+	return role, nil
+}
+
+// Filter is a single attribute eq "value" comparison, the only filter
+// directories need to find existing resources.
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+// NewFilter parses filter and checks its attribute is one of attributes, an
+// empty filter matches everything and returns nil. Attribute names are
+// compared case insensitively as required by RFC 7644.
+func NewFilter(filter string, attributes ...string) (*Filter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return nil, ErrInvalidFilter
+	}
+
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	for _, attribute := range attributes {
+		if strings.EqualFold(match[1], attribute) {
+			return &Filter{
+				Attribute: attribute,
+				Value:     value,
+			}, nil
+		}
+	}
+
+	return nil, ErrInvalidFilter
+}
+
+// MatchesUser compares userName and emails case insensitively and
+// externalId exactly.
+func (f *Filter) MatchesUser(u User) bool {
+	if f == nil {
+		return true
+	}
+
+	switch f.Attribute {
+	case "userName", "emails.value":
+		return strings.EqualFold(u.UserName, f.Value)
+	case "externalId":
+		return u.ExternalID == f.Value
+	default:
+		return false
+	}
+}
+
+func (f *Filter) MatchesGroup(g Group) bool {
+	if f == nil {
+		return true
+	}
+
+	switch f.Attribute {
+	case "displayName", "id":
+		return strings.EqualFold(string(g.ID), f.Value)
+	default:
+		return false
+	}
+}
+
+// Page is a 1-based window over a list of resources.
+type Page struct {
+	StartIndex int
+	Count      int
+}
+
+// NewPage takes startIndex and count as given in a query string. As RFC 7644
+// asks, a startIndex below 1 is read as 1 and a negative count as 0, counts
+// above 200 are capped.
+func NewPage(startIndex, count string) (*Page, error) {
+	page := &Page{
+		StartIndex: 1,
+		Count:      defaultPageSize,
+	}
+
+	if startIndex != "" {
+		parsed, err := strconv.Atoi(startIndex)
+		if err != nil {
+			return nil, ErrInvalidPage
+		}
+
+		page.StartIndex = max(parsed, 1)
+	}
+
+	if count != "" {
+		parsed, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, ErrInvalidPage
+		}
+
+		page.Count = min(max(parsed, 0), maxPageSize)
+	}
+
+	return page, nil
+}
+
+// Bounds returns the slice bounds of the page in a list of total resources.
+func (p Page) Bounds(total int) (int, int) {
+	from := min(p.StartIndex-1, total)
+	to := min(from+p.Count, total)
+
+	return from, to
+}
+
+type ListUsersRequest struct {
+	WorkspaceID int32
+	Filter      *Filter
+	Page        Page
+}
+
+func NewListUsersRequest(workspaceID int32, filter, startIndex, count string) (*ListUsersRequest, error) {
+	parsedFilter, err := NewFilter(filter, "userName", "emails.value", "externalId")
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := NewPage(startIndex, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListUsersRequest{
+		WorkspaceID: workspaceID,
+		Filter:      parsedFilter,
+		Page:        *page,
+	}, nil
+}
+
+type ListGroupsRequest struct {
+	WorkspaceID int32
+	Filter      *Filter
+	Page        Page
+}
+
+func NewListGroupsRequest(workspaceID int32, filter, startIndex, count string) (*ListGroupsRequest, error) {
+	parsedFilter, err := NewFilter(filter, "displayName", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := NewPage(startIndex, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListGroupsRequest{
+		WorkspaceID: workspaceID,
+		Filter:      parsedFilter,
+		Page:        *page,
+	}, nil
+}
+
+// List is one page of resources, TotalResults counts every resource that
+// matched the filter.
+type List[T any] struct {
+	Resources    []T
+	TotalResults int
+	StartIndex   int
+}
+
+func NewList[T any](resources []T, page Page) *List[T] {
+	from, to := page.Bounds(len(resources))
+
+	return &List[T]{
+		Resources:    resources[from:to],
+		TotalResults: len(resources),
+		StartIndex:   page.StartIndex,
+	}
+}
+
+func newUserName(userName string) (string, error) {
+	userName = strings.ToLower(strings.TrimSpace(userName))
+
+	if _, err := mail.ParseAddress(userName); err != nil {
+		return "", ErrInvalidUserName
+	}
+
+	return userName, nil
+}
+
+func newExternalID(externalID string) (string, error) {
+	if len(externalID) > maxExternalIDLength {
+		return "", ErrInvalidExternal
+	}
+
+	return externalID, nil
+}
+
+type CreateUserRequest struct {
+	WorkspaceID int32
+	UserName    string
+	ExternalID  string
+	Active      bool
+}
+
+func NewCreateUserRequest(workspaceID int32, userName, externalID string, active bool) (*CreateUserRequest, error) {
+	userName, err := newUserName(userName)
+	if err != nil {
+		return nil, err
+	}
+
+	externalID, err = newExternalID(externalID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateUserRequest{
+		WorkspaceID: workspaceID,
+		UserName:    userName,
+		ExternalID:  externalID,
+		Active:      active,
+	}, nil
+}
+
+// PatchUserRequest changes the attributes that are set and leaves the rest,
+// an empty ExternalID clears it.
+type PatchUserRequest struct {
+	WorkspaceID int32
+	UserID      int32
+	UserName    *string
+	ExternalID  *string
+	Active      *bool
+}
+
+func NewPatchUserRequest(
+	workspaceID int32,
+	userID string,
+	userName *string,
+	externalID *string,
+	active *bool,
+) (*PatchUserRequest, error) {
+	parsedUserID, err := user.NewUserID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	request := &PatchUserRequest{
+		WorkspaceID: workspaceID,
+		UserID:      parsedUserID,
+		Active:      active,
+	}
+
+	if userName != nil {
+		parsed, err := newUserName(*userName)
+		if err != nil {
+			return nil, err
+		}
+
+		request.UserName = &parsed
+	}
+
+	if externalID != nil {
+		parsed, err := newExternalID(*externalID)
+		if err != nil {
+			return nil, err
+		}
+
+		request.ExternalID = &parsed
+	}
+
+	return request, nil
+}
+
+type MemberOperation string
+
+const (
+	MemberOperationAdd     MemberOperation = "add"
+	MemberOperationRemove  MemberOperation = "remove"
+	MemberOperationReplace MemberOperation = "replace"
+)
+
+// MemberChange adds users to a group, removes them from it or replaces every
+// member of the group with them.
+type MemberChange struct {
+	Operation MemberOperation
+	UserIDs   []int32
+}
+
+func NewMemberChange(operation string, userIDs []string) (*MemberChange, error) {
+	parsedOperation := MemberOperation(strings.ToLower(operation))
+
+	switch parsedOperation {
+	case MemberOperationAdd, MemberOperationRemove, MemberOperationReplace:
+	default:
+		return nil, ErrInvalidPatch
+	}
+
+	change := &MemberChange{
+		Operation: parsedOperation,
+		UserIDs:   []int32{},
+	}
+
+	for _, userID := range userIDs {
+		parsed, err := user.NewUserID(userID)
+		if err != nil {
+			return nil, ErrInvalidMember
+		}
+
+		change.UserIDs = append(change.UserIDs, parsed)
+	}
+
+	return change, nil
+}
+
+// PatchGroupRequest applies Changes in order. Adding a user to a group gives
+// them its role and removing them drops them back to viewer, the role every
+// provisioned user starts with.
+type PatchGroupRequest struct {
+	WorkspaceID int32
+	Role        workspace.Role
+	Changes     []MemberChange
+}
+
+func NewPatchGroupRequest(workspaceID int32, groupID string, changes []MemberChange) (*PatchGroupRequest, error) {
+	role, err := NewGroupID(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PatchGroupRequest{
+		WorkspaceID: workspaceID,
+		Role:        role,
+		Changes:     changes,
+	}, nil
+}
+
+type CreateTokenRequest struct {
+	WorkspaceID int32
+	TokenHash   string
+	CreatedBy   int32
+}
+
+func NewCreateTokenRequest(workspaceID int32, token string, createdBy int32) *CreateTokenRequest {
+	return &CreateTokenRequest{
+		WorkspaceID: workspaceID,
+		TokenHash:   user.HashToken(token),
+		CreatedBy:   createdBy,
+	}
+}
+
+func NewTokenID(tokenID string) (int32, error) {
+	parsed, err := strconv.ParseInt(tokenID, 10, 32)
+	if err != nil || parsed < 1 {
+		return 0, ErrTokenNotFound
+	}
+
+	return int32(parsed), nil
+}
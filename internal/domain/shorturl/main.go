@@ -1,16 +1,22 @@
 package shorturl
 
 import (
-	"errors"
+	"net/http"
 	"net/url"
 	"time"
+
+	"url-short/internal/apperror"
 )
 
 var (
-	ErrURLNotFound     = errors.New("url could not be found")
-	ErrURLValidation   = errors.New("could not validate url")
-	ErrUnexpectedError = errors.New("unexpected server error")
-	ErrDuplicateURL    = errors.New("duplicate url")
+	ErrURLNotFound     = apperror.New(http.StatusNotFound, "url_not_found", "url could not be found")
+	ErrURLValidation   = apperror.New(http.StatusBadRequest, "invalid_url", "could not validate url")
+	ErrUnexpectedError = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+	ErrDuplicateURL    = apperror.New(http.StatusBadRequest, "duplicate_url", "duplicate url")
+
+	ErrURLUnavailableForLegalReasons = apperror.New(http.StatusUnavailableForLegalReasons, "url_unavailable_for_legal_reasons", "url is unavailable for legal reasons")
+	ErrURLGone                       = apperror.New(http.StatusGone, "url_gone", "url has been removed")
+	ErrInvalidDisableReason          = apperror.New(http.StatusBadRequest, "invalid_disable_reason", "reason must be one of legal or removed")
 )
 
 type URL struct {
@@ -19,7 +25,42 @@ type URL struct {
 	LongURL   string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	UserID    int32
+	// UserID is the member who created the URL, zero once they have been
+	// deleted. The URL belongs to the workspace.
+	UserID      int32
+	WorkspaceID int32
+	// DisabledAt is set when an administrator has taken the URL down,
+	// DisabledReason decides what visitors are told.
+	DisabledAt     time.Time
+	DisabledReason DisableReason
+}
+
+// DisableReason is why an administrator took a URL down.
+type DisableReason string
+
+const (
+	// DisableReasonLegal is served as 451 Unavailable For Legal Reasons.
+	DisableReasonLegal DisableReason = "legal"
+	// DisableReasonRemoved is served as 410 Gone.
+	DisableReasonRemoved DisableReason = "removed"
+)
+
+func (u *URL) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+// CheckAvailable returns the error a visitor gets for a URL that has been
+// taken down.
+func (u *URL) CheckAvailable() error {
+	if !u.IsDisabled() {
+		return nil
+	}
+
+	if u.DisabledReason == DisableReasonLegal {
+		return ErrURLUnavailableForLegalReasons
+	}
+
+	return ErrURLGone
 }
 
 func NewLongURL(URL string) (*string, error) {
@@ -50,10 +91,16 @@ func NewUrl(longURL string) (*URL, error) {
 	}, nil
 }
 
+// CreateURLRequest adds a URL to a workspace the user can edit, a zero
+// WorkspaceID means the user's personal workspace. The URL is only added
+// while the workspace has fewer than MaxActiveLinks active links, zero is
+// unlimited.
 type CreateURLRequest struct {
-	UserID   int32
-	LongURL  string
-	ShortURL string
+	UserID         int32
+	WorkspaceID    int32
+	LongURL        string
+	ShortURL       string
+	MaxActiveLinks int64
 }
 
 func NewCreateURLRequest(userID int32, URL string) (*CreateURLRequest, error) {
@@ -93,3 +140,51 @@ func NewUpdateURLRequest(userID int32, shortURL string, longURL string) *UpdateU
 		LongURL:  longURL,
 	}
 }
+
+// LinkCounts counts a user's links, Disabled counts the ones taken down by an
+// administrator.
+type LinkCounts struct {
+	Total    int64
+	Disabled int64
+}
+
+// ClickAggregate counts the redirects through a short URL on one day.
+type ClickAggregate struct {
+	ShortURL string
+	Day      time.Time
+	Clicks   int64
+}
+
+type DisableURLRequest struct {
+	ShortURL string
+	Reason   DisableReason
+}
+
+func NewDisableURLRequest(shortURL, reason string) (*DisableURLRequest, error) {
+	switch DisableReason(reason) {
+	case DisableReasonLegal, DisableReasonRemoved:
+	default:
+		return nil, ErrInvalidDisableReason
+	}
+
+	return &DisableURLRequest{
+		ShortURL: shortURL,
+		Reason:   DisableReason(reason),
+	}, nil
+}
+
+// ListURLsRequest searches every user's URLs by short or long URL, an empty
+// query lists them all.
+type ListURLsRequest struct {
+	Query  string
+	Limit  int32
+	Offset int32
+}
+
+func NewListURLsRequest(query string, limit, offset int32) *ListURLsRequest {
+	return &ListURLsRequest{
+		Query:  query,
+		Limit:  limit,
+		Offset: offset,
+	}
+}
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"net/http"
+	"net/mail"
+	"time"
+
+	"url-short/internal/apperror"
+	"url-short/internal/domain/shorturl"
+)
+
+var (
+	ErrEmptyProfileUpdate       = apperror.New(http.StatusBadRequest, "empty_profile_update", "set email or password to update your profile")
+	ErrCurrentPasswordRequired  = apperror.New(http.StatusBadRequest, "current_password_required", "current password is required to change your email or password")
+	ErrReauthenticationRequired = apperror.New(http.StatusUnauthorized, "reauthentication_required", "changing your email requires your current two factor code")
+)
+
+// Deletion is a user's request to have their account deleted, the account is
+// purged once PurgeAfter has passed unless the user logs in before then.
+type Deletion struct {
+	UserID      int32
+	RequestedAt time.Time
+	PurgeAfter  time.Time
+}
+
+type DeleteUserRequest struct {
+	UserID   int32
+	Password string
+	ClientIP string
+}
+
+// NewDeleteUserRequest requires the user's password so a stolen access token
+// is not enough to delete an account.
+func NewDeleteUserRequest(userID int32, password, clientIP string) (*DeleteUserRequest, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	return &DeleteUserRequest{
+		UserID:   userID,
+		Password: password,
+		ClientIP: clientIP,
+	}, nil
+}
+
+// DataExport is everything stored about a user that they can download.
+type DataExport struct {
+	User             *User
+	TwoFactorEnabled bool
+	Identities       []Identity
+	Links            []shorturl.URL
+	Sessions         []RefreshToken
+	Clicks           []shorturl.ClickAggregate
+}
+
+// Profile is the user together with what their account settings page shows.
+type Profile struct {
+	User             *User
+	TwoFactorEnabled bool
+	Links            shorturl.LinkCounts
+}
+
+// UpdateProfileRequest changes the fields that are set, an empty Email or
+// NewPassword leaves them as they are.
+type UpdateProfileRequest struct {
+	UserID          int32
+	Email           string
+	NewPassword     string
+	CurrentPassword string
+	TwoFactorCode   string
+	ClientIP        string
+}
+
+// NewUpdateProfileRequest takes the fields to change as nil when they are
+// left out. Any change needs the current password, so a stolen access token
+// is not enough to take over an account.
+func NewUpdateProfileRequest(
+	userID int32,
+	email *string,
+	newPassword *string,
+	currentPassword string,
+	twoFactorCode string,
+	clientIP string,
+) (*UpdateProfileRequest, error) {
+	if email == nil && newPassword == nil {
+		return nil, ErrEmptyProfileUpdate
+	}
+
+	if currentPassword == "" {
+		return nil, ErrCurrentPasswordRequired
+	}
+
+	request := &UpdateProfileRequest{
+		UserID:          userID,
+		CurrentPassword: currentPassword,
+		TwoFactorCode:   twoFactorCode,
+		ClientIP:        clientIP,
+	}
+
+	if email != nil {
+		if *email == "" {
+			return nil, ErrEmptyEmail
+		}
+
+		if _, err := mail.ParseAddress(*email); err != nil {
+			return nil, ErrInvalidEmail
+		}
+
+		request.Email = *email
+	}
+
+	if newPassword != nil {
+		// checked against the policy and hashed by the service once the
+		// current password has been confirmed
+		if *newPassword == "" {
+			return nil, ErrEmptyPassword
+		}
+
+		request.NewPassword = *newPassword
+	}
+
+	return request, nil
+}
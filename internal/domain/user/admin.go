@@ -0,0 +1,101 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrForbidden           = apperror.New(http.StatusForbidden, "forbidden", "forbidden")
+	ErrUserDisabled        = apperror.New(http.StatusForbidden, "user_disabled", "user has been disabled")
+	ErrUserDisabledByAdmin = apperror.New(http.StatusForbidden, "user_disabled_by_admin", "user was disabled by an administrator, only an administrator can enable them")
+	ErrInvalidRole         = apperror.New(http.StatusBadRequest, "invalid_role", "role must be one of user or admin")
+	ErrCannotModerateSelf  = apperror.New(http.StatusBadRequest, "cannot_moderate_self", "administrators can not change their own account through the admin api")
+	ErrInvalidListRequest  = apperror.New(http.StatusBadRequest, "invalid_list_request", "limit must be between 1 and 200 and offset must not be negative")
+	ErrInvalidUserID       = apperror.New(http.StatusBadRequest, "invalid_user_id", "invalid user id")
+)
+
+// Role decides what a user is authorized to do, it is carried in the role
+// claim of access tokens.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+func NewRole(role string) (Role, error) {
+	switch Role(role) {
+	case RoleUser, RoleAdmin:
+		return Role(role), nil
+	default:
+		return "", ErrInvalidRole
+	}
+}
+
+// HasRole reports whether the user may act as role, administrators may act
+// as any role.
+func (u *User) HasRole(role Role) bool {
+	return u.Role == role || u.Role == RoleAdmin
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// ListUsersRequest searches users by email, an empty query lists every user.
+type ListUsersRequest struct {
+	Query  string
+	Limit  int32
+	Offset int32
+}
+
+// NewListUsersRequest takes limit and offset as given in a query string,
+// an empty limit means 50 and an empty offset 0.
+func NewListUsersRequest(query, limit, offset string) (*ListUsersRequest, error) {
+	parsedLimit, parsedOffset, err := ParsePage(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListUsersRequest{
+		Query:  query,
+		Limit:  parsedLimit,
+		Offset: parsedOffset,
+	}, nil
+}
+
+// ParsePage parses the limit and offset of a page of results.
+func ParsePage(limit, offset string) (int32, int32, error) {
+	parsedLimit := defaultListLimit
+	parsedOffset := 0
+
+	var err error
+	if limit != "" {
+		parsedLimit, err = strconv.Atoi(limit)
+		if err != nil || parsedLimit < 1 || parsedLimit > maxListLimit {
+			return 0, 0, ErrInvalidListRequest
+		}
+	}
+
+	if offset != "" {
+		parsedOffset, err = strconv.Atoi(offset)
+		if err != nil || parsedOffset < 0 {
+			return 0, 0, ErrInvalidListRequest
+		}
+	}
+
+	return int32(parsedLimit), int32(parsedOffset), nil
+}
+
+func NewUserID(userID string) (int32, error) {
+	parsed, err := strconv.ParseInt(userID, 10, 32)
+	if err != nil || parsed < 1 {
+		return 0, ErrInvalidUserID
+	}
+
+	return int32(parsed), nil
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrInvalidVerificationToken    = apperror.New(http.StatusBadRequest, "invalid_verification_token", "verification token is invalid or has expired")
+	ErrEmailNotVerified            = apperror.New(http.StatusForbidden, "email_not_verified", "email address has not been verified")
+	ErrTooManyVerificationRequests = apperror.New(http.StatusTooManyRequests, "too_many_verification_requests", "too many verification requests, please try again later")
+)
+
+// UnverifiedUserPolicy decides what users can do before verifying their email.
+type UnverifiedUserPolicy string
+
+const (
+	UnverifiedUsersBlocked       UnverifiedUserPolicy = "none"
+	UnverifiedUsersCanLogin      UnverifiedUserPolicy = "login"
+	UnverifiedUsersCanCreateURLs UnverifiedUserPolicy = "login_and_links"
+)
+
+func NewUnverifiedUserPolicy(policy string) (UnverifiedUserPolicy, error) {
+	switch UnverifiedUserPolicy(policy) {
+	case UnverifiedUsersBlocked, UnverifiedUsersCanLogin, UnverifiedUsersCanCreateURLs:
+		return UnverifiedUserPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("unknown unverified user policy %q", policy)
+}
+
+func (p UnverifiedUserPolicy) AllowsLogin(u *User) bool {
+	return u.IsEmailVerified() || p != UnverifiedUsersBlocked
+}
+
+func (p UnverifiedUserPolicy) AllowsURLCreation(u *User) bool {
+	return u.IsEmailVerified() || p == UnverifiedUsersCanCreateURLs
+}
+
+type EmailVerificationToken struct {
+	ID        int32
+	UserID    int32
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+// CreateEmailVerificationTokenRequest ties the token to the address it was
+// sent to, so it can not verify an address the user changed to afterwards.
+type CreateEmailVerificationTokenRequest struct {
+	UserID    int32
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func NewCreateEmailVerificationTokenRequest(
+	userID int32,
+	email string,
+	token string,
+	expiresAt time.Time,
+) *CreateEmailVerificationTokenRequest {
+	return &CreateEmailVerificationTokenRequest{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: HashToken(token),
+		ExpiresAt: expiresAt,
+	}
+}
+
+type VerifyEmailRequest struct {
+	TokenHash string
+}
+
+func NewVerifyEmailRequest(token string) (*VerifyEmailRequest, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	return &VerifyEmailRequest{
+		TokenHash: HashToken(token),
+	}, nil
+}
+
+type ResendVerificationRequest struct {
+	Email    string
+	ClientIP string
+}
+
+func NewResendVerificationRequest(email, clientIP string) (*ResendVerificationRequest, error) {
+	if email == "" {
+		return nil, ErrEmptyEmail
+	}
+
+	_, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, ErrInvalidEmail
+	}
+
+	return &ResendVerificationRequest{
+		Email:    email,
+		ClientIP: clientIP,
+	}, nil
+}
+
+func (r *ResendVerificationRequest) NormalizedEmail() string {
+	return strings.ToLower(strings.TrimSpace(r.Email))
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrUnknownOIDCProvider       = apperror.New(http.StatusNotFound, "unknown_identity_provider", "unknown identity provider")
+	ErrInvalidOIDCState          = apperror.New(http.StatusBadRequest, "invalid_oidc_state", "sign in request is invalid or has expired, please try again")
+	ErrOIDCLoginFailed           = apperror.New(http.StatusUnauthorized, "oidc_login_failed", "identity provider did not authenticate the user")
+	ErrOIDCEmailNotVerified      = apperror.New(http.StatusForbidden, "oidc_email_not_verified", "identity provider has not verified the email address")
+	ErrOIDCEmailDomainNotAllowed = apperror.New(http.StatusForbidden, "oidc_email_domain_not_allowed", "email domain is not allowed to sign in with this identity provider")
+	ErrOIDCUserManaged           = apperror.New(http.StatusConflict, "oidc_user_managed", "a workspace directory manages the user with this email, sign in with their password instead")
+	ErrIdentityNotFound          = apperror.New(http.StatusNotFound, "identity_not_found", "identity could not be found")
+	ErrIdentityAlreadyLinked     = apperror.New(http.StatusConflict, "identity_already_linked", "identity is already linked to a user")
+)
+
+// Identity links a user to the subject an external identity provider knows
+// them by, so they keep signing in to the same user if their email changes.
+type Identity struct {
+	ID        int32
+	UserID    int32
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type CreateIdentityRequest struct {
+	UserID   int32
+	Provider string
+	Subject  string
+	Email    string
+}
+
+func NewCreateIdentityRequest(userID int32, provider, subject, email string) *CreateIdentityRequest {
+	return &CreateIdentityRequest{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}
+}
+
+// OIDCLoginState is kept between sending the user to the identity provider
+// and the provider sending them back.
+type OIDCLoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type OIDCCallbackRequest struct {
+	Provider string
+	State    string
+	Code     string
+}
+
+// NewOIDCCallbackRequest builds a request from the callback query, providerError
+// is the error parameter the provider sets when it did not authenticate the
+// user.
+func NewOIDCCallbackRequest(provider, state, code, providerError string) (*OIDCCallbackRequest, error) {
+	if providerError != "" {
+		return nil, ErrOIDCLoginFailed
+	}
+
+	if state == "" || code == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	return &OIDCCallbackRequest{
+		Provider: provider,
+		State:    state,
+		Code:     code,
+	}, nil
+}
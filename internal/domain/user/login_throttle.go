@@ -0,0 +1,24 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var ErrTooManyLoginAttempts = apperror.New(http.StatusTooManyRequests, "too_many_login_attempts", "too many failed login attempts, please try again later")
+
+// LoginLockedError is returned while logins are refused after too many
+// failures, RetryAfter is how long until the next attempt is accepted.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
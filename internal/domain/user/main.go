@@ -1,36 +1,62 @@
 package user
 
 import (
-	"errors"
+	"net/http"
 	"net/mail"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"url-short/internal/apperror"
 )
 
 type User struct {
-	Id                     int32
-	Email                  string
-	PasswordHash           []byte
-	CreatedAt              time.Time
-	UpdatedAt              time.Time
-	Token                  string
-	RefreshToken           string
-	RefreshTokenRevokeDate time.Time
+	Id              int32
+	Email           string
+	PasswordHash    []byte
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt time.Time
+	Role            Role
+	DisabledAt      time.Time
+	Token           string
+	RefreshToken    string
+	// MFAChallengeToken is set instead of Token and RefreshToken when the
+	// login still needs a second factor
+	MFAChallengeToken string
 }
 
 var (
-	ErrEmptyEmail          = errors.New("empty email")
-	ErrInvalidEmail        = errors.New("invalid email")
-	ErrEmptyPassword       = errors.New("empty password")
-	ErrInvalidPassword     = errors.New("invalid password")
-	ErrInvalidLoginRequest = errors.New("email and password must not be empty")
-	ErrUserNotFound        = errors.New("user could not be found")
-	ErrUnexpectedError     = errors.New("unexpected server error")
-	ErrDuplicateUSer       = errors.New("user already exists")
+	ErrEmptyEmail          = apperror.New(http.StatusBadRequest, "empty_email", "empty email")
+	ErrInvalidEmail        = apperror.New(http.StatusBadRequest, "invalid_email", "invalid email")
+	ErrEmptyPassword       = apperror.New(http.StatusBadRequest, "empty_password", "empty password")
+	ErrInvalidPassword     = apperror.New(http.StatusBadRequest, "invalid_password", "invalid password")
+	ErrInvalidLoginRequest = apperror.New(http.StatusBadRequest, "invalid_login_request", "email and password must not be empty")
+	ErrUserNotFound        = apperror.New(http.StatusNotFound, "user_not_found", "user could not be found")
+	ErrUnexpectedError     = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+	ErrDuplicateUSer       = apperror.New(http.StatusBadRequest, "user_already_exists", "user already exists")
+	ErrTokenRevoked        = apperror.New(http.StatusUnauthorized, "token_revoked", "token has been revoked")
 )
 
-func NewUser(email, password string) (*User, error) {
+func (u *User) GetPasswordHash() string {
+	return string(u.PasswordHash)
+}
+
+func (u *User) IsEmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
+}
+
+func (u *User) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+// CreateUserRequest holds the password in clear, the service checks it
+// against the policy and hashes it.
+type CreateUserRequest struct {
+	Email    string
+	Password string
+}
+
+func NewCreateUserRequest(email, password string) (*CreateUserRequest, error) {
 	if email == "" {
 		return nil, ErrEmptyEmail
 	}
@@ -44,48 +70,19 @@ func NewUser(email, password string) (*User, error) {
 		return nil, ErrEmptyPassword
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword(
-		[]byte(password),
-		bcrypt.DefaultCost,
-	)
-
-	if err != nil {
-		return nil, ErrInvalidPassword
-	}
-
-	return &User{
-		Email:        email,
-		PasswordHash: passwordHash,
-	}, nil
-}
-
-func (u *User) GetPasswordHash() string {
-	return string(u.PasswordHash)
-}
-
-type CreateUserRequest struct {
-	Email        string
-	PasswordHash string
-}
-
-func NewCreateUserRequest(email, password string) (*CreateUserRequest, error) {
-	user, err := NewUser(email, password)
-	if err != nil {
-		return nil, err
-	}
-
 	return &CreateUserRequest{
-		Email:        user.Email,
-		PasswordHash: user.GetPasswordHash(),
+		Email:    email,
+		Password: password,
 	}, nil
 }
 
 type LoginUserRequest struct {
 	Email    string
 	Password string
+	ClientIP string
 }
 
-func NewLoginUserRequest(email, password string) (*LoginUserRequest, error) {
+func NewLoginUserRequest(email, password, clientIP string) (*LoginUserRequest, error) {
 	if email == "" || password == "" {
 		return nil, ErrInvalidLoginRequest
 	}
@@ -93,24 +90,24 @@ func NewLoginUserRequest(email, password string) (*LoginUserRequest, error) {
 	return &LoginUserRequest{
 		Email:    email,
 		Password: password,
+		ClientIP: clientIP,
 	}, nil
 }
 
-type UpdateUserRequest struct {
-	Id              int32
-	Email           string
-	NewPasswordHash string
+func (r *LoginUserRequest) NormalizedEmail() string {
+	return strings.ToLower(strings.TrimSpace(r.Email))
 }
 
-func NewUpdateUserRequest(email, password string, userId int32) (*UpdateUserRequest, error) {
-	user, err := NewUser(email, password)
-	if err != nil {
-		return nil, err
-	}
+type LogoutUserRequest struct {
+	UserID       int32
+	AccessToken  string
+	RefreshToken string
+}
 
-	return &UpdateUserRequest{
-		Id:              userId,
-		Email:           user.Email,
-		NewPasswordHash: user.GetPasswordHash(),
-	}, nil
+func NewLogoutUserRequest(userID int32, accessToken, refreshToken string) *LogoutUserRequest {
+	return &LogoutUserRequest{
+		UserID:       userID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
 }
@@ -0,0 +1,147 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"unicode/utf8"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrPasswordTooShort = apperror.New(http.StatusBadRequest, "password_too_short", "password is too short")
+	ErrPasswordBreached = apperror.New(http.StatusBadRequest, "password_breached", "password has appeared in a data breach, please choose another")
+)
+
+// BreachedPasswordChecker reports whether a password is known to have
+// leaked.
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// PasswordPolicy decides which new passwords are accepted, passwords that
+// are already set are never checked against it.
+type PasswordPolicy struct {
+	MinLength int
+	Breached  BreachedPasswordChecker
+}
+
+func NewPasswordPolicy(minLength int, breached BreachedPasswordChecker) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		Breached:  breached,
+	}
+}
+
+func (p *PasswordPolicy) Validate(password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+
+	if p.Breached == nil {
+		return nil
+	}
+
+	breached, err := p.Breached.IsBreached(password)
+	if err != nil {
+		// an unreadable corpus should not stop users from setting passwords
+		slog.Warn("could not check password against breached passwords", "error", err)
+		return nil
+	}
+
+	if breached {
+		return ErrPasswordBreached
+	}
+
+	return nil
+}
+
+// PasswordHasher hashes passwords and checks them against stored hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encodedHash string) (bool, error)
+	NeedsRehash(encodedHash string) bool
+}
+
+// Passwords hashes and checks user passwords with hasher and decides which
+// new passwords are accepted with policy.
+type Passwords struct {
+	hasher    PasswordHasher
+	policy    *PasswordPolicy
+	dummyHash string
+}
+
+// NewPasswords hashes the dummy password VerifyDummy checks against up
+// front, so it costs as much as the hashes the hasher makes.
+func NewPasswords(hasher PasswordHasher, policy *PasswordPolicy) (*Passwords, error) {
+	dummyHash, err := hasher.Hash("not a real password")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Passwords{
+		hasher:    hasher,
+		policy:    policy,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// Validate checks a new password against the policy.
+func (p *Passwords) Validate(password string) error {
+	return p.policy.Validate(password)
+}
+
+// Hash hashes a password with the current algorithm and cost without
+// applying the policy to it. It is slow on purpose, so new passwords are only
+// hashed once the request setting them has been authorized.
+func (p *Passwords) Hash(password string) (string, error) {
+	passwordHash, err := p.hasher.Hash(password)
+	if err != nil {
+		return "", ErrUnexpectedError
+	}
+
+	return passwordHash, nil
+}
+
+// Verify checks password against the user's hash and reports whether the
+// hash should be replaced because it was made with an outdated algorithm or
+// cost.
+func (p *Passwords) Verify(u *User, password string) (bool, error) {
+	matches, err := p.hasher.Verify(password, string(u.PasswordHash))
+	if err != nil {
+		slog.Warn("could not verify password hash", "user_id", u.Id, "error", err)
+		return false, ErrInvalidPassword
+	}
+
+	if !matches {
+		return false, ErrInvalidPassword
+	}
+
+	return p.hasher.NeedsRehash(string(u.PasswordHash)), nil
+}
+
+// VerifyDummy takes as long as checking a real password, it is used when
+// there is no user to check against so the response time does not give that
+// away.
+func (p *Passwords) VerifyDummy(password string) {
+	_, _ = p.hasher.Verify(password, p.dummyHash)
+}
+
+// RandomHash hashes a random password nobody knows, it is set on users who
+// must sign in through an identity provider.
+func (p *Passwords) RandomHash() (string, error) {
+	password := make([]byte, 32)
+
+	_, err := rand.Read(password)
+	if err != nil {
+		return "", ErrUnexpectedError
+	}
+
+	return p.Hash(hex.EncodeToString(password))
+}
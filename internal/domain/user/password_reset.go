@@ -0,0 +1,87 @@
+package user
+
+import (
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrInvalidPasswordResetToken    = apperror.New(http.StatusBadRequest, "invalid_password_reset_token", "password reset token is invalid or has expired")
+	ErrTooManyPasswordResetRequests = apperror.New(http.StatusTooManyRequests, "too_many_password_reset_requests", "too many password reset requests, please try again later")
+)
+
+type PasswordResetToken struct {
+	ID        int32
+	UserID    int32
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+type CreatePasswordResetTokenRequest struct {
+	UserID    int32
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func NewCreatePasswordResetTokenRequest(userID int32, token string, expiresAt time.Time) *CreatePasswordResetTokenRequest {
+	return &CreatePasswordResetTokenRequest{
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: expiresAt,
+	}
+}
+
+type PasswordResetRequest struct {
+	Email    string
+	ClientIP string
+}
+
+func NewPasswordResetRequest(email, clientIP string) (*PasswordResetRequest, error) {
+	if email == "" {
+		return nil, ErrEmptyEmail
+	}
+
+	_, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, ErrInvalidEmail
+	}
+
+	return &PasswordResetRequest{
+		Email:    email,
+		ClientIP: clientIP,
+	}, nil
+}
+
+// NormalizedEmail is used to key rate limits so that changing the case of an
+// address does not reset them.
+func (r *PasswordResetRequest) NormalizedEmail() string {
+	return strings.ToLower(strings.TrimSpace(r.Email))
+}
+
+type ConfirmPasswordResetRequest struct {
+	TokenHash   string
+	NewPassword string
+}
+
+// NewConfirmPasswordResetRequest keeps the new password in clear, it is
+// checked against the policy before the token is spent and hashed after.
+func NewConfirmPasswordResetRequest(token, password string) (*ConfirmPasswordResetRequest, error) {
+	if token == "" {
+		return nil, ErrInvalidPasswordResetToken
+	}
+
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+
+	return &ConfirmPasswordResetRequest{
+		TokenHash:   HashToken(token),
+		NewPassword: password,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrInvalidRefreshToken = apperror.New(http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token")
+	ErrRefreshTokenExpired = apperror.New(http.StatusUnauthorized, "refresh_token_expired", "refresh token expired, please login again")
+	ErrRefreshTokenReused  = apperror.New(http.StatusUnauthorized, "refresh_token_reused", "refresh token has already been used, please login again")
+)
+
+// RefreshToken is a single link in a refresh token family. Every login starts
+// a new family and every refresh rotates the presented token for a new one in
+// the same family, so a token that is presented twice has leaked.
+type RefreshToken struct {
+	ID        int32
+	UserID    int32
+	FamilyID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	RevokedAt time.Time
+}
+
+func (t *RefreshToken) IsUsed() bool {
+	return !t.UsedAt.IsZero()
+}
+
+func (t *RefreshToken) IsRevoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return now.After(t.ExpiresAt)
+}
+
+// HashToken returns the value stored in place of a raw refresh or reset
+// token so a database leak does not hand out usable tokens.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type CreateRefreshTokenRequest struct {
+	UserID    int32
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+func NewCreateRefreshTokenRequest(userID int32, familyID, token string, expiresAt time.Time) *CreateRefreshTokenRequest {
+	return &CreateRefreshTokenRequest{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(token),
+		ExpiresAt: expiresAt,
+	}
+}
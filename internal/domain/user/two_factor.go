@@ -0,0 +1,87 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"url-short/internal/apperror"
+)
+
+var (
+	ErrInvalidTwoFactorCode     = apperror.New(http.StatusUnauthorized, "invalid_two_factor_code", "two factor code is invalid")
+	ErrTwoFactorAlreadyEnabled  = apperror.New(http.StatusConflict, "two_factor_already_enabled", "two factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled     = apperror.New(http.StatusBadRequest, "two_factor_not_enrolled", "two factor authentication has not been enrolled")
+	ErrTwoFactorNotConfigured   = apperror.New(http.StatusNotImplemented, "two_factor_not_configured", "two factor authentication is not configured on this server")
+	ErrInvalidMFAChallenge      = apperror.New(http.StatusUnauthorized, "invalid_mfa_challenge", "two factor challenge is invalid or has expired")
+	ErrTooManyTwoFactorAttempts = apperror.New(http.StatusTooManyRequests, "too_many_two_factor_attempts", "too many two factor attempts, please log in again")
+)
+
+// TwoFactor is a user's TOTP enrollment, it only protects logins once it has
+// been confirmed with a first code.
+type TwoFactor struct {
+	UserID          int32
+	EncryptedSecret string
+	LastUsedStep    int64
+	CreatedAt       time.Time
+	ConfirmedAt     time.Time
+}
+
+func (t *TwoFactor) IsEnabled() bool {
+	return !t.ConfirmedAt.IsZero()
+}
+
+// TwoFactorEnrollment is returned once when enrolling, the secret can not be
+// read back afterwards.
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type ConfirmTwoFactorRequest struct {
+	UserID int32
+	Code   string
+}
+
+func NewConfirmTwoFactorRequest(userID int32, code string) (*ConfirmTwoFactorRequest, error) {
+	code = normalizeTwoFactorCode(code)
+	if code == "" {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	return &ConfirmTwoFactorRequest{
+		UserID: userID,
+		Code:   code,
+	}, nil
+}
+
+// LoginWithTwoFactorRequest completes a login that was answered with a
+// challenge token, Code is either a TOTP code or an unused recovery code.
+type LoginWithTwoFactorRequest struct {
+	ChallengeToken string
+	Code           string
+}
+
+func NewLoginWithTwoFactorRequest(challengeToken, code string) (*LoginWithTwoFactorRequest, error) {
+	if challengeToken == "" {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if code == "" {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	return &LoginWithTwoFactorRequest{
+		ChallengeToken: challengeToken,
+		Code:           code,
+	}, nil
+}
+
+// normalizeTwoFactorCode drops the spaces and dashes people copy along with
+// codes, recovery codes are shown in upper case but accepted in any case.
+func normalizeTwoFactorCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+
+	return strings.ToLower(code)
+}
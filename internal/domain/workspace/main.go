@@ -0,0 +1,229 @@
+package workspace
+
+import (
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-short/internal/apperror"
+	"url-short/internal/domain/user"
+)
+
+var (
+	ErrWorkspaceNotFound     = apperror.New(http.StatusNotFound, "workspace_not_found", "workspace could not be found")
+	ErrMemberNotFound        = apperror.New(http.StatusNotFound, "member_not_found", "workspace member could not be found")
+	ErrInvalidWorkspaceID    = apperror.New(http.StatusBadRequest, "invalid_workspace_id", "invalid workspace id")
+	ErrInvalidWorkspaceName  = apperror.New(http.StatusBadRequest, "invalid_workspace_name", "workspace name must be between 1 and 100 characters")
+	ErrInvalidRole           = apperror.New(http.StatusBadRequest, "invalid_workspace_role", "role must be one of owner, admin, editor or viewer")
+	ErrInvalidInviteEmail    = apperror.New(http.StatusBadRequest, "invalid_invite_email", "invite email is invalid")
+	ErrInsufficientRole      = apperror.New(http.StatusForbidden, "insufficient_role", "your role in the workspace does not allow this")
+	ErrLastOwner             = apperror.New(http.StatusConflict, "last_owner", "workspace must keep at least one owner, make another member an owner first")
+	ErrPersonalWorkspace     = apperror.New(http.StatusBadRequest, "personal_workspace", "personal workspaces can not be shared")
+	ErrAlreadyMember         = apperror.New(http.StatusConflict, "already_member", "user is already a member of the workspace")
+	ErrInvalidInvite         = apperror.New(http.StatusBadRequest, "invalid_invite", "invite is invalid, has expired or was sent to another email address")
+	ErrSoleOwnerOfWorkspaces = apperror.New(http.StatusConflict, "sole_owner_of_workspaces", "you are the only owner of a shared workspace, make another member an owner first")
+	ErrUnexpectedError       = apperror.New(http.StatusInternalServerError, "internal_error", "unexpected server error")
+)
+
+const maxWorkspaceNameLength = 100
+
+// Role decides what a member can do in a workspace, every role can do what
+// the roles below it can.
+type Role string
+
+const (
+	// RoleOwner can manage every member, including other owners.
+	RoleOwner Role = "owner"
+	// RoleAdmin can invite and manage editors and viewers.
+	RoleAdmin Role = "admin"
+	// RoleEditor can create, change and delete the workspace's links.
+	RoleEditor Role = "editor"
+	// RoleViewer can list the workspace's links and members.
+	RoleViewer Role = "viewer"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func NewRole(role string) (Role, error) {
+	if _, ok := roleRanks[Role(role)]; !ok {
+		return "", ErrInvalidRole
+	}
+
+	return Role(role), nil
+}
+
+// Allows reports whether the role can do what required can.
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// CanManage reports whether a member with this role may invite, change or
+// remove members with the other role. Owners manage everyone, admins manage
+// editors and viewers.
+func (r Role) CanManage(other Role) bool {
+	if r == RoleOwner {
+		return true
+	}
+
+	return r == RoleAdmin && roleRanks[other] < roleRanks[RoleAdmin]
+}
+
+// Workspace owns links on behalf of its members. Every user has a personal
+// workspace that can not be shared, PersonalUserID is zero for shared
+// workspaces.
+type Workspace struct {
+	ID             int32
+	Name           string
+	PersonalUserID int32
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (w *Workspace) IsPersonal() bool {
+	return w.PersonalUserID != 0
+}
+
+// Membership is a workspace together with the user's role in it.
+type Membership struct {
+	Workspace Workspace
+	Role      Role
+}
+
+type Member struct {
+	WorkspaceID int32
+	UserID      int32
+	Email       string
+	Role        Role
+	CreatedAt   time.Time
+}
+
+type Invite struct {
+	ID          int32
+	WorkspaceID int32
+	Email       string
+	Role        Role
+	TokenHash   string
+	InvitedBy   int32
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	AcceptedAt  time.Time
+}
+
+func NewWorkspaceID(workspaceID string) (int32, error) {
+	parsed, err := strconv.ParseInt(workspaceID, 10, 32)
+	if err != nil || parsed < 1 {
+		return 0, ErrInvalidWorkspaceID
+	}
+
+	return int32(parsed), nil
+}
+
+type CreateWorkspaceRequest struct {
+	Name    string
+	OwnerID int32
+}
+
+func NewCreateWorkspaceRequest(name string, ownerID int32) (*CreateWorkspaceRequest, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWorkspaceNameLength {
+		return nil, ErrInvalidWorkspaceName
+	}
+
+	return &CreateWorkspaceRequest{
+		Name:    name,
+		OwnerID: ownerID,
+	}, nil
+}
+
+type InviteMemberRequest struct {
+	WorkspaceID int32
+	Email       string
+	Role        Role
+	InvitedBy   int32
+}
+
+func NewInviteMemberRequest(workspaceID int32, email, role string, invitedBy int32) (*InviteMemberRequest, error) {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, ErrInvalidInviteEmail
+	}
+
+	parsedRole, err := NewRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InviteMemberRequest{
+		WorkspaceID: workspaceID,
+		Email:       strings.TrimSpace(email),
+		Role:        parsedRole,
+		InvitedBy:   invitedBy,
+	}, nil
+}
+
+// CreateInviteRequest stores the hash of the token that is emailed to the
+// invited address.
+type CreateInviteRequest struct {
+	WorkspaceID int32
+	Email       string
+	Role        Role
+	TokenHash   string
+	InvitedBy   int32
+	ExpiresAt   time.Time
+}
+
+func NewCreateInviteRequest(request InviteMemberRequest, token string, expiresAt time.Time) *CreateInviteRequest {
+	return &CreateInviteRequest{
+		WorkspaceID: request.WorkspaceID,
+		Email:       request.Email,
+		Role:        request.Role,
+		TokenHash:   user.HashToken(token),
+		InvitedBy:   request.InvitedBy,
+		ExpiresAt:   expiresAt,
+	}
+}
+
+// AcceptInviteRequest joins the user to the workspace the token invites to,
+// the invite must have been sent to the user's email.
+type AcceptInviteRequest struct {
+	TokenHash string
+	UserID    int32
+	Email     string
+}
+
+func NewAcceptInviteRequest(token string, userID int32, email string) (*AcceptInviteRequest, error) {
+	if token == "" {
+		return nil, ErrInvalidInvite
+	}
+
+	return &AcceptInviteRequest{
+		TokenHash: user.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+	}, nil
+}
+
+type SetMemberRoleRequest struct {
+	WorkspaceID int32
+	UserID      int32
+	Role        Role
+}
+
+func NewSetMemberRoleRequest(workspaceID, userID int32, role string) (*SetMemberRoleRequest, error) {
+	parsedRole, err := NewRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SetMemberRoleRequest{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        parsedRole,
+	}, nil
+}
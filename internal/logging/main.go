@@ -0,0 +1,44 @@
+// Package logging carries a request scoped structured logger through the
+// context, so every line logged while serving a request can be traced back
+// to it by its request id.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+type loggerContextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger when
+// ctx does not carry one.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+
+	return logger
+}
+
+// With returns a copy of ctx whose logger adds args to every line.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// NewRequestID returns a random id for a request that did not come with one.
+func NewRequestID() string {
+	id := make([]byte, 16)
+
+	// crypto/rand never returns an error
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrSendFailed = errors.New("could not send email")
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text emails to users.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"url-short/internal/logging"
+)
+
+// smtpTimeout bounds sending an email when the context has no deadline of
+// its own, so a server that stops answering does not hold up the request or
+// the shutdown waiting for it.
+const smtpTimeout = 30 * time.Second
+
+type SMTPMailer struct {
+	host    string
+	address string
+	from    string
+	auth    smtp.Auth
+}
+
+// NewSMTPMailer sends mail through the SMTP server at host:port, upgrading to
+// TLS when the server supports STARTTLS. Authentication is skipped when no
+// username is given.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		host:    host,
+		address: net.JoinHostPort(host, port),
+		from:    from,
+		auth:    auth,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	err := m.send(ctx, message)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not send email", "error", err)
+		return ErrSendFailed
+	}
+
+	return nil
+}
+
+// send does what smtp.SendMail does over a connection that is dialled with
+// ctx and gives up at ctx's deadline, or after smtpTimeout when it has none.
+func (m *SMTPMailer) send(ctx context.Context, message Message) error {
+	if _, found := ctx.Deadline(); !found {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, smtpTimeout)
+		defer cancel()
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", m.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	// the deadline does not stop a read or write when ctx is cancelled
+	// before it, closing the connection does
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(message.To); err != nil {
+		return err
+	}
+
+	body, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := body.Write(m.format(message)); err != nil {
+		return err
+	}
+
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (m *SMTPMailer) format(message Message) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", m.from),
+		fmt.Sprintf("To: %s", message.To),
+		fmt.Sprintf("Subject: %s", message.Subject),
+		fmt.Sprintf("Date: %s", time.Now().UTC().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	body := strings.ReplaceAll(message.Body, "\n", "\r\n")
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
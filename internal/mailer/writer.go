@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterMailer writes emails to a writer instead of delivering them, it is
+// meant for local development and tests.
+type WriterMailer struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func NewWriterMailer(w io.Writer) *WriterMailer {
+	return &WriterMailer{
+		writer: w,
+	}
+}
+
+// NewLogMailer writes emails to the standard logger output.
+func NewLogMailer() *WriterMailer {
+	return NewWriterMailer(log.Writer())
+}
+
+// NewFileMailer appends emails to the file at path, creating it if needed.
+func NewFileMailer(path string) (*WriterMailer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterMailer(file), nil
+}
+
+func (m *WriterMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(
+		m.writer,
+		"Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC1123Z),
+		message.To,
+		message.Subject,
+		message.Body,
+	)
+	if err != nil {
+		return ErrSendFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedPasswordDirectory checks passwords against a local copy of a
+// breached password corpus split by k-anonymity range, as downloaded from
+// the Pwned Passwords range API. The directory holds one file per five
+// character SHA-1 prefix, named <PREFIX>.txt, with one SUFFIX:COUNT line per
+// breached password hash.
+type BreachedPasswordDirectory struct {
+	path string
+}
+
+func NewBreachedPasswordDirectory(path string) (*BreachedPasswordDirectory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, errors.New("breached password path is not a directory")
+	}
+
+	return &BreachedPasswordDirectory{
+		path: path,
+	}, nil
+}
+
+func (d *BreachedPasswordDirectory) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(d.path, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AttemptCounterRepository counts attempts against a key in fixed windows,
+// the first attempt in a window starts it.
+type AttemptCounterRepository interface {
+	IncrementAttempts(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+
+type RedisAttemptCounter struct {
+	cache *redis.Client
+}
+
+func NewRedisAttemptCounter(c *redis.Client) *RedisAttemptCounter {
+	return &RedisAttemptCounter{
+		cache: c,
+	}
+}
+
+func (c *RedisAttemptCounter) IncrementAttempts(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := c.cache.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/audit"
+	"url-short/internal/logging"
+)
+
+type AuditRepository interface {
+	CreateAuditEvent(ctx context.Context, request audit.CreateEventRequest) (*audit.Event, error)
+	ListUserAuditEvents(ctx context.Context, userID, limit, offset int32) ([]audit.Event, error)
+	SearchAuditEvents(ctx context.Context, request audit.ListEventsRequest) ([]audit.Event, error)
+	VerifyAuditChain(ctx context.Context) (*audit.ChainVerification, error)
+}
+
+type PostgresAuditRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresAuditRepository(db *database.Queries) *PostgresAuditRepository {
+	return &PostgresAuditRepository{
+		db: db,
+	}
+}
+
+// CreateAuditEvent appends an event, the database links it to the event
+// before it and fills in its hashes.
+func (r *PostgresAuditRepository) CreateAuditEvent(
+	ctx context.Context,
+	request audit.CreateEventRequest,
+) (*audit.Event, error) {
+	details, err := json.Marshal(request.Details)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := json.Marshal(request.Diff)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		EventType:  string(request.Type),
+		UserID:     sql.NullInt32{Int32: request.UserID, Valid: request.UserID != 0},
+		ActorID:    sql.NullInt32{Int32: request.ActorID, Valid: request.ActorID != 0},
+		IpAddress:  request.IPAddress,
+		UserAgent:  request.UserAgent,
+		TargetType: string(request.Target.Type),
+		TargetID:   request.Target.ID,
+		Details:    details,
+		Diff:       diff,
+		CreatedAt:  time.Now().UTC(),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("unexpected database error", "error", err)
+		return nil, audit.ErrUnexpectedError
+	}
+
+	return auditEventFromRow(res), nil
+}
+
+func (r *PostgresAuditRepository) ListUserAuditEvents(
+	ctx context.Context,
+	userID, limit, offset int32,
+) ([]audit.Event, error) {
+	res, err := r.db.SelectUserAuditEvents(ctx, database.SelectUserAuditEventsParams{
+		UserID: sql.NullInt32{Int32: userID, Valid: true},
+		Limit:  limit,
+		Offset: offset,
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("unexpected database error", "error", err)
+		return nil, audit.ErrUnexpectedError
+	}
+
+	return auditEventsFromRows(res), nil
+}
+
+func (r *PostgresAuditRepository) SearchAuditEvents(
+	ctx context.Context,
+	request audit.ListEventsRequest,
+) ([]audit.Event, error) {
+	res, err := r.db.SearchAuditEvents(ctx, database.SearchAuditEventsParams{
+		UserID:    sql.NullInt32{Int32: request.UserID, Valid: request.UserID != 0},
+		ActorID:   sql.NullInt32{Int32: request.ActorID, Valid: request.ActorID != 0},
+		EventType: string(request.Type),
+		Since:     sql.NullTime{Time: request.Since.UTC(), Valid: !request.Since.IsZero()},
+		Until:     sql.NullTime{Time: request.Until.UTC(), Valid: !request.Until.IsZero()},
+		RowLimit:  request.Limit,
+		RowOffset: request.Offset,
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("unexpected database error", "error", err)
+		return nil, audit.ErrUnexpectedError
+	}
+
+	return auditEventsFromRows(res), nil
+}
+
+func (r *PostgresAuditRepository) VerifyAuditChain(ctx context.Context) (*audit.ChainVerification, error) {
+	res, err := r.db.VerifyAuditChain(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("unexpected database error", "error", err)
+		return nil, audit.ErrUnexpectedError
+	}
+
+	return &audit.ChainVerification{
+		Events:        res.Events,
+		HeadHash:      res.HeadHash,
+		FirstBrokenID: res.FirstBrokenID,
+	}, nil
+}
+
+func auditEventsFromRows(res []database.AuditEvent) []audit.Event {
+	events := []audit.Event{}
+	for _, row := range res {
+		events = append(events, *auditEventFromRow(row))
+	}
+
+	return events
+}
+
+func auditEventFromRow(res database.AuditEvent) *audit.Event {
+	details := map[string]any{}
+	_ = json.Unmarshal(res.Details, &details)
+
+	diff := audit.Diff{}
+	_ = json.Unmarshal(res.Diff, &diff)
+
+	return &audit.Event{
+		ID:        res.ID,
+		Type:      audit.EventType(res.EventType),
+		UserID:    res.UserID.Int32,
+		ActorID:   res.ActorID.Int32,
+		IPAddress: res.IpAddress,
+		UserAgent: res.UserAgent,
+		Target:    audit.NewTarget(audit.TargetType(res.TargetType), res.TargetID),
+		Details:   details,
+		Diff:      diff,
+		CreatedAt: res.CreatedAt,
+		PrevHash:  res.PrevHash,
+		Hash:      res.Hash,
+	}
+}
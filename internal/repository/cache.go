@@ -7,12 +7,33 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// CacheRepository caches the long URL of each short URL. Evicting a URL keeps
+// it out of the cache for a while, so a redirect that read the URL from the
+// database before it was disabled or deleted can not put it back afterwards.
 type CacheRepository interface {
 	GetURL(ctx context.Context, key string) (string, error)
 	InsertURL(ctx context.Context, key string, value string, cacheTime time.Duration) error
 	DeleteURL(ctx context.Context, key string) error
 }
 
+const (
+	// evictedURL marks a URL that was evicted, it is never a valid long URL
+	evictedURL = "evicted"
+	// evictionTime outlasts any request that read a URL before its eviction
+	evictionTime = 1 * time.Minute
+)
+
+// insertURLScript caches a URL unless it was evicted since, the insert is
+// dropped rather than undoing the eviction.
+var insertURLScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[2] then
+	return 0
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
 type CacheRedis struct {
 	cache *redis.Client
 }
@@ -34,11 +55,15 @@ func (c CacheRedis) GetURL(ctx context.Context, key string) (string, error) {
 		return "", err
 	}
 
+	if result == evictedURL {
+		return "", redis.Nil
+	}
+
 	return result, nil
 }
 
 func (c CacheRedis) InsertURL(ctx context.Context, key string, value string, cacheTime time.Duration) error {
-	err := c.cache.Set(ctx, key, value, cacheTime).Err()
+	err := insertURLScript.Run(ctx, c.cache, []string{key}, value, evictedURL, cacheTime.Milliseconds()).Err()
 	if err != nil {
 		return err
 	}
@@ -46,7 +71,7 @@ func (c CacheRedis) InsertURL(ctx context.Context, key string, value string, cac
 }
 
 func (c CacheRedis) DeleteURL(ctx context.Context, key string) error {
-	err := c.cache.Del(ctx, key).Err()
+	err := c.cache.Set(ctx, key, evictedURL, evictionTime).Err()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+)
+
+type EmailVerificationRepository interface {
+	CreateEmailVerificationToken(
+		ctx context.Context,
+		request user.CreateEmailVerificationTokenRequest,
+	) (*user.EmailVerificationToken, error)
+	ConsumeEmailVerificationToken(ctx context.Context, tokenHash string) (*user.EmailVerificationToken, error)
+}
+
+type PostgresEmailVerificationRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresEmailVerificationRepository(db *database.Queries) *PostgresEmailVerificationRepository {
+	return &PostgresEmailVerificationRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresEmailVerificationRepository) CreateEmailVerificationToken(
+	ctx context.Context,
+	request user.CreateEmailVerificationTokenRequest,
+) (*user.EmailVerificationToken, error) {
+	res, err := r.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		UserID:    request.UserID,
+		Email:     request.Email,
+		TokenHash: request.TokenHash,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: request.ExpiresAt.UTC(),
+	})
+
+	if err != nil {
+		return nil, getEmailVerificationDomainErrorFromSQLError(ctx, err)
+	}
+
+	return emailVerificationTokenFromRow(res), nil
+}
+
+func (r *PostgresEmailVerificationRepository) ConsumeEmailVerificationToken(
+	ctx context.Context,
+	tokenHash string,
+) (*user.EmailVerificationToken, error) {
+	res, err := r.db.ConsumeEmailVerificationToken(ctx, database.ConsumeEmailVerificationTokenParams{
+		UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		TokenHash: tokenHash,
+	})
+
+	if err != nil {
+		return nil, getEmailVerificationDomainErrorFromSQLError(ctx, err)
+	}
+
+	return emailVerificationTokenFromRow(res), nil
+}
+
+func emailVerificationTokenFromRow(res database.EmailVerificationToken) *user.EmailVerificationToken {
+	return &user.EmailVerificationToken{
+		ID:        res.ID,
+		UserID:    res.UserID,
+		Email:     res.Email,
+		TokenHash: res.TokenHash,
+		CreatedAt: res.CreatedAt,
+		ExpiresAt: res.ExpiresAt,
+		UsedAt:    res.UsedAt.Time,
+	}
+}
+
+func getEmailVerificationDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return user.ErrInvalidVerificationToken
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return getUserDomainErrorFromSQLError(ctx, sqlError)
+}
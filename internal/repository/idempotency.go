@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"url-short/internal/domain/idempotency"
+)
+
+// IdempotencyRepository keeps a record per user and idempotency key, only
+// the first request made with a key can reserve it.
+type IdempotencyRepository interface {
+	ReserveIdempotencyKey(
+		ctx context.Context,
+		userID int32,
+		key string,
+		record idempotency.Record,
+		ttl time.Duration,
+	) (*idempotency.Record, error)
+	SaveIdempotencyRecord(
+		ctx context.Context,
+		userID int32,
+		key string,
+		record idempotency.Record,
+		ttl time.Duration,
+	) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int32, key string) error
+}
+
+type RedisIdempotencyRepository struct {
+	cache *redis.Client
+}
+
+func NewRedisIdempotencyRepository(c *redis.Client) *RedisIdempotencyRepository {
+	return &RedisIdempotencyRepository{
+		cache: c,
+	}
+}
+
+func idempotencyKey(userID int32, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", userID, idempotency.HashKey(key))
+}
+
+// ReserveIdempotencyKey stores record unless the key is already taken, in
+// which case the record stored under it is returned instead.
+func (r *RedisIdempotencyRepository) ReserveIdempotencyKey(
+	ctx context.Context,
+	userID int32,
+	key string,
+	record idempotency.Record,
+	ttl time.Duration,
+) (*idempotency.Record, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// SET NX GET reserves the key and reads what it already holds in one
+	// step, so two requests with the same key can not both reserve it
+	existing, err := r.cache.SetArgs(ctx, idempotencyKey(userID, key), data, redis.SetArgs{
+		Mode: "NX",
+		TTL:  ttl,
+		Get:  true,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	stored := idempotency.Record{}
+	if err := json.Unmarshal([]byte(existing), &stored); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+func (r *RedisIdempotencyRepository) SaveIdempotencyRecord(
+	ctx context.Context,
+	userID int32,
+	key string,
+	record idempotency.Record,
+	ttl time.Duration,
+) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return r.cache.Set(ctx, idempotencyKey(userID, key), data, ttl).Err()
+}
+
+func (r *RedisIdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, userID int32, key string) error {
+	return r.cache.Del(ctx, idempotencyKey(userID, key)).Err()
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+)
+
+type IdentityRepository interface {
+	CreateIdentity(ctx context.Context, request user.CreateIdentityRequest) (*user.Identity, error)
+	SelectIdentity(ctx context.Context, provider, subject string) (*user.Identity, error)
+	ListUserIdentities(ctx context.Context, userID int32) ([]user.Identity, error)
+}
+
+type PostgresIdentityRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresIdentityRepository(db *database.Queries) *PostgresIdentityRepository {
+	return &PostgresIdentityRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresIdentityRepository) CreateIdentity(
+	ctx context.Context,
+	request user.CreateIdentityRequest,
+) (*user.Identity, error) {
+	res, err := r.db.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:    request.UserID,
+		Provider:  request.Provider,
+		Subject:   request.Subject,
+		Email:     request.Email,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if err != nil {
+		return nil, getIdentityDomainErrorFromSQLError(ctx, err)
+	}
+
+	return identityFromRow(res), nil
+}
+
+func (r *PostgresIdentityRepository) SelectIdentity(
+	ctx context.Context,
+	provider string,
+	subject string,
+) (*user.Identity, error) {
+	res, err := r.db.SelectUserIdentity(ctx, database.SelectUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+
+	if err != nil {
+		return nil, getIdentityDomainErrorFromSQLError(ctx, err)
+	}
+
+	return identityFromRow(res), nil
+}
+
+func (r *PostgresIdentityRepository) ListUserIdentities(ctx context.Context, userID int32) ([]user.Identity, error) {
+	rows, err := r.db.SelectUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, getIdentityDomainErrorFromSQLError(ctx, err)
+	}
+
+	identities := []user.Identity{}
+	for _, res := range rows {
+		identities = append(identities, *identityFromRow(res))
+	}
+
+	return identities, nil
+}
+
+func identityFromRow(res database.UserIdentity) *user.Identity {
+	return &user.Identity{
+		ID:        res.ID,
+		UserID:    res.UserID,
+		Provider:  res.Provider,
+		Subject:   res.Subject,
+		Email:     res.Email,
+		CreatedAt: res.CreatedAt,
+	}
+}
+
+func getIdentityDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return user.ErrIdentityNotFound
+	}
+
+	pgErr, ok := sqlError.(*pq.Error)
+	if ok && pgErr.Code == "23505" {
+		return user.ErrIdentityAlreadyLinked
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return getUserDomainErrorFromSQLError(ctx, sqlError)
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttemptRepository counts failed logins against a key in a sliding
+// window and keeps track of keys that are locked out.
+type LoginAttemptRepository interface {
+	RecordFailedLogin(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error)
+	ClearFailedLogins(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error)
+	LockLogins(ctx context.Context, key string, until time.Time) error
+	GetLoginsLockedUntil(ctx context.Context, key string) (time.Time, error)
+}
+
+type RedisLoginAttemptRepository struct {
+	cache *redis.Client
+}
+
+func NewRedisLoginAttemptRepository(c *redis.Client) *RedisLoginAttemptRepository {
+	return &RedisLoginAttemptRepository{
+		cache: c,
+	}
+}
+
+func failedLoginsKey(key string) string {
+	return fmt.Sprintf("auth:login:failures:%s", key)
+}
+
+func loginLockKey(key string) string {
+	return fmt.Sprintf("auth:login:lock:%s", key)
+}
+
+// RecordFailedLogin stores each failure as a member of a sorted set scored by
+// its time, so failures older than the window can be dropped exactly.
+func (r *RedisLoginAttemptRepository) RecordFailedLogin(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (int64, error) {
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return 0, err
+	}
+
+	pipe := r.cache.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, failedLoginsKey(key), "-inf", windowStart(at, window))
+	pipe.ZAdd(ctx, failedLoginsKey(key), redis.Z{Score: float64(at.UnixMilli()), Member: hex.EncodeToString(member)})
+	count := pipe.ZCard(ctx, failedLoginsKey(key))
+	pipe.Expire(ctx, failedLoginsKey(key), window)
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
+
+// ClearFailedLogins returns how many failures were in the window before they
+// were cleared.
+func (r *RedisLoginAttemptRepository) ClearFailedLogins(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (int64, error) {
+	pipe := r.cache.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, failedLoginsKey(key), "-inf", windowStart(at, window))
+	count := pipe.ZCard(ctx, failedLoginsKey(key))
+	pipe.Del(ctx, failedLoginsKey(key), loginLockKey(key))
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
+
+func (r *RedisLoginAttemptRepository) LockLogins(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return r.cache.Set(ctx, loginLockKey(key), until.UnixMilli(), ttl).Err()
+}
+
+func (r *RedisLoginAttemptRepository) GetLoginsLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	result, err := r.cache.Get(ctx, loginLockKey(key)).Result()
+
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unixMilli, err := strconv.ParseInt(result, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(unixMilli), nil
+}
+
+func windowStart(at time.Time, window time.Duration) string {
+	return fmt.Sprintf("(%d", at.Add(-window).UnixMilli())
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"url-short/internal/domain/user"
+)
+
+// OIDCStateRepository keeps the state of sign ins that are in progress at an
+// identity provider, each state can only be consumed once.
+type OIDCStateRepository interface {
+	SaveOIDCState(ctx context.Context, state string, loginState user.OIDCLoginState, ttl time.Duration) error
+	ConsumeOIDCState(ctx context.Context, state string) (*user.OIDCLoginState, error)
+}
+
+type RedisOIDCStateRepository struct {
+	cache *redis.Client
+}
+
+func NewRedisOIDCStateRepository(c *redis.Client) *RedisOIDCStateRepository {
+	return &RedisOIDCStateRepository{
+		cache: c,
+	}
+}
+
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("auth:oidc:state:%s", state)
+}
+
+func (r *RedisOIDCStateRepository) SaveOIDCState(
+	ctx context.Context,
+	state string,
+	loginState user.OIDCLoginState,
+	ttl time.Duration,
+) error {
+	data, err := json.Marshal(loginState)
+	if err != nil {
+		return err
+	}
+
+	return r.cache.Set(ctx, oidcStateKey(state), data, ttl).Err()
+}
+
+func (r *RedisOIDCStateRepository) ConsumeOIDCState(ctx context.Context, state string) (*user.OIDCLoginState, error) {
+	data, err := r.cache.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, user.ErrInvalidOIDCState
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	loginState := user.OIDCLoginState{}
+	if err := json.Unmarshal(data, &loginState); err != nil {
+		return nil, err
+	}
+
+	return &loginState, nil
+}
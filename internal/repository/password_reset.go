@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+)
+
+type PasswordResetRepository interface {
+	CreatePasswordResetToken(ctx context.Context, request user.CreatePasswordResetTokenRequest) (*user.PasswordResetToken, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (*user.PasswordResetToken, error)
+	InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error
+}
+
+type PostgresPasswordResetRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresPasswordResetRepository(db *database.Queries) *PostgresPasswordResetRepository {
+	return &PostgresPasswordResetRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresPasswordResetRepository) CreatePasswordResetToken(
+	ctx context.Context,
+	request user.CreatePasswordResetTokenRequest,
+) (*user.PasswordResetToken, error) {
+	res, err := r.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		UserID:    request.UserID,
+		TokenHash: request.TokenHash,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: request.ExpiresAt.UTC(),
+	})
+
+	if err != nil {
+		return nil, getPasswordResetDomainErrorFromSQLError(ctx, err)
+	}
+
+	return passwordResetTokenFromRow(res), nil
+}
+
+// ConsumePasswordResetToken marks an unused and unexpired token as used in a
+// single statement, so a token can only ever be consumed once.
+func (r *PostgresPasswordResetRepository) ConsumePasswordResetToken(
+	ctx context.Context,
+	tokenHash string,
+) (*user.PasswordResetToken, error) {
+	res, err := r.db.ConsumePasswordResetToken(ctx, database.ConsumePasswordResetTokenParams{
+		UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		TokenHash: tokenHash,
+	})
+
+	if err != nil {
+		return nil, getPasswordResetDomainErrorFromSQLError(ctx, err)
+	}
+
+	return passwordResetTokenFromRow(res), nil
+}
+
+func (r *PostgresPasswordResetRepository) InvalidateUserPasswordResetTokens(ctx context.Context, userID int32) error {
+	err := r.db.InvalidateUserPasswordResetTokens(ctx, database.InvalidateUserPasswordResetTokensParams{
+		UsedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		UserID: userID,
+	})
+
+	if err != nil {
+		return getPasswordResetDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func passwordResetTokenFromRow(res database.PasswordResetToken) *user.PasswordResetToken {
+	return &user.PasswordResetToken{
+		ID:        res.ID,
+		UserID:    res.UserID,
+		TokenHash: res.TokenHash,
+		CreatedAt: res.CreatedAt,
+		ExpiresAt: res.ExpiresAt,
+		UsedAt:    res.UsedAt.Time,
+	}
+}
+
+func getPasswordResetDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return user.ErrInvalidPasswordResetToken
+	}
+
+	return getUserDomainErrorFromSQLError(ctx, sqlError)
+}
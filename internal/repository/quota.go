@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+
+	"github.com/lib/pq"
+)
+
+type QuotaRepository interface {
+	SelectWorkspaceCounters(ctx context.Context, workspaceID int32, month time.Time) (*plan.Counters, error)
+	SetWorkspacePlan(ctx context.Context, workspaceID int32, planName string) error
+	SelectURLWorkspace(ctx context.Context, shortURL string) (int32, error)
+	StoreMonthlyClicks(ctx context.Context, clicks plan.MonthlyClicks) error
+}
+
+type PostgresQuotaRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresQuotaRepository(db *database.Queries) *PostgresQuotaRepository {
+	return &PostgresQuotaRepository{
+		db: db,
+	}
+}
+
+// SelectWorkspaceCounters reads the workspace's plan, its active links and
+// its clicks in the month.
+func (r *PostgresQuotaRepository) SelectWorkspaceCounters(
+	ctx context.Context,
+	workspaceID int32,
+	month time.Time,
+) (*plan.Counters, error) {
+	res, err := r.db.SelectWorkspaceQuota(ctx, database.SelectWorkspaceQuotaParams{
+		Month:       month,
+		WorkspaceID: workspaceID,
+	})
+
+	if err != nil {
+		return nil, getQuotaDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &plan.Counters{
+		WorkspaceID:   res.WorkspaceID,
+		Plan:          res.Plan,
+		ActiveLinks:   res.ActiveLinks,
+		MonthlyClicks: res.MonthlyClicks,
+	}, nil
+}
+
+func (r *PostgresQuotaRepository) SetWorkspacePlan(ctx context.Context, workspaceID int32, planName string) error {
+	err := r.db.SetWorkspacePlan(ctx, database.SetWorkspacePlanParams{
+		WorkspaceID: workspaceID,
+		Plan:        planName,
+	})
+
+	if err != nil {
+		return getQuotaDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+// SelectURLWorkspace returns the workspace the short URL belongs to.
+func (r *PostgresQuotaRepository) SelectURLWorkspace(ctx context.Context, shortURL string) (int32, error) {
+	workspaceID, err := r.db.SelectURLWorkspace(ctx, shortURL)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, shorturl.ErrURLNotFound
+	}
+
+	if err != nil {
+		return 0, getQuotaDomainErrorFromSQLError(ctx, err)
+	}
+
+	return workspaceID, nil
+}
+
+// StoreMonthlyClicks sets the workspace's clicks in the month. Clicks only go
+// up, so a total lower than the one already stored is ignored.
+func (r *PostgresQuotaRepository) StoreMonthlyClicks(ctx context.Context, clicks plan.MonthlyClicks) error {
+	err := r.db.StoreWorkspaceMonthlyClicks(ctx, database.StoreWorkspaceMonthlyClicksParams{
+		WorkspaceID: clicks.WorkspaceID,
+		Month:       clicks.Month,
+		Clicks:      clicks.Clicks,
+	})
+
+	if err != nil {
+		return getQuotaDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func getQuotaDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return workspace.ErrWorkspaceNotFound
+	}
+
+	pgErr, ok := sqlError.(*pq.Error)
+	if ok {
+		// foreign_key_violation, the workspace does not exist
+		if pgErr.Code == "23503" {
+			return workspace.ErrWorkspaceNotFound
+		}
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return plan.ErrUnexpectedError
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"url-short/internal/domain/plan"
+)
+
+const (
+	// quotaLinkCacheTime matches how long redirects cache a link
+	quotaLinkCacheTime = 1 * time.Hour
+	// quotaPlanCacheTime bounds how long a plan change that could not be
+	// written to Redis goes unnoticed by click counting
+	quotaPlanCacheTime = 1 * time.Hour
+	// clickCounterGrace keeps a month's counter past the end of the month
+	// for the last flush to store it
+	clickCounterGrace = 24 * time.Hour
+	changedClicksKey  = "quota:clicks:changed"
+)
+
+// QuotaCounterRepository counts the clicks each workspace's plan tracks in
+// Redis, ahead of them being stored in Postgres, along with the workspace
+// each link belongs to and the plan each workspace is on. Lookups of a link
+// or plan that is not cached fail with redis.Nil.
+type QuotaCounterRepository interface {
+	GetURLWorkspace(ctx context.Context, shortURL string) (int32, error)
+	SetURLWorkspace(ctx context.Context, shortURL string, workspaceID int32) error
+	GetPlan(ctx context.Context, workspaceID int32) (string, error)
+	SetPlan(ctx context.Context, workspaceID int32, planName string) error
+	IncrementClicks(ctx context.Context, workspaceID int32, month time.Time, clicks int64) (int64, error)
+	GetClicks(ctx context.Context, workspaceID int32, month time.Time) (int64, error)
+	PopChangedClicks(ctx context.Context, count int) ([]plan.MonthlyClicks, error)
+	MarkClicksChanged(ctx context.Context, clicks []plan.MonthlyClicks) error
+}
+
+type RedisQuotaCounterRepository struct {
+	cache *redis.Client
+}
+
+func NewRedisQuotaCounterRepository(c *redis.Client) *RedisQuotaCounterRepository {
+	return &RedisQuotaCounterRepository{
+		cache: c,
+	}
+}
+
+func quotaLinkKey(shortURL string) string {
+	return "quota:link:" + shortURL
+}
+
+func quotaPlanKey(workspaceID int32) string {
+	return fmt.Sprintf("quota:plan:%d", workspaceID)
+}
+
+// clickCounterMember names a workspace's month in the set of changed
+// counters, the counter's key is derived from it.
+func clickCounterMember(workspaceID int32, month time.Time) string {
+	return fmt.Sprintf("%d:%s", workspaceID, month.Format(time.DateOnly))
+}
+
+func clickCounterKey(workspaceID int32, month time.Time) string {
+	return "quota:clicks:" + clickCounterMember(workspaceID, month)
+}
+
+func parseClickCounterMember(member string) (int32, time.Time, error) {
+	id, day, found := strings.Cut(member, ":")
+	if !found {
+		return 0, time.Time{}, fmt.Errorf("malformed click counter %q", member)
+	}
+
+	workspaceID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("malformed click counter %q: %w", member, err)
+	}
+
+	month, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("malformed click counter %q: %w", member, err)
+	}
+
+	return int32(workspaceID), month, nil
+}
+
+func (r *RedisQuotaCounterRepository) GetURLWorkspace(ctx context.Context, shortURL string) (int32, error) {
+	workspaceID, err := r.cache.Get(ctx, quotaLinkKey(shortURL)).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return int32(workspaceID), nil
+}
+
+func (r *RedisQuotaCounterRepository) SetURLWorkspace(ctx context.Context, shortURL string, workspaceID int32) error {
+	return r.cache.Set(ctx, quotaLinkKey(shortURL), workspaceID, quotaLinkCacheTime).Err()
+}
+
+func (r *RedisQuotaCounterRepository) GetPlan(ctx context.Context, workspaceID int32) (string, error) {
+	return r.cache.Get(ctx, quotaPlanKey(workspaceID)).Result()
+}
+
+func (r *RedisQuotaCounterRepository) SetPlan(ctx context.Context, workspaceID int32, planName string) error {
+	return r.cache.Set(ctx, quotaPlanKey(workspaceID), planName, quotaPlanCacheTime).Err()
+}
+
+// IncrementClicks adds clicks to the workspace's month and returns its
+// clicks including them. The counter expires once the month is over and is
+// marked as changed for the next flush to store.
+func (r *RedisQuotaCounterRepository) IncrementClicks(
+	ctx context.Context,
+	workspaceID int32,
+	month time.Time,
+	clicks int64,
+) (int64, error) {
+	key := clickCounterKey(workspaceID, month)
+
+	pipe := r.cache.TxPipeline()
+	total := pipe.IncrBy(ctx, key, clicks)
+	pipe.ExpireAt(ctx, key, month.AddDate(0, 1, 0).Add(clickCounterGrace))
+	pipe.SAdd(ctx, changedClicksKey, clickCounterMember(workspaceID, month))
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return total.Val(), nil
+}
+
+// GetClicks returns the workspace's clicks in the month, zero when Redis has
+// not counted any.
+func (r *RedisQuotaCounterRepository) GetClicks(ctx context.Context, workspaceID int32, month time.Time) (int64, error) {
+	clicks, err := r.cache.Get(ctx, clickCounterKey(workspaceID, month)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return clicks, err
+}
+
+// PopChangedClicks takes up to count counters that changed since they were
+// last taken and returns their clicks. Counters that expired in the meantime
+// are left out.
+func (r *RedisQuotaCounterRepository) PopChangedClicks(ctx context.Context, count int) ([]plan.MonthlyClicks, error) {
+	members, err := r.cache.SPopN(ctx, changedClicksKey, int64(count)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	changed := make([]plan.MonthlyClicks, 0, len(members))
+	keys := make([]string, 0, len(members))
+	for _, member := range members {
+		workspaceID, month, err := parseClickCounterMember(member)
+		if err != nil {
+			return nil, err
+		}
+
+		changed = append(changed, plan.MonthlyClicks{WorkspaceID: workspaceID, Month: month})
+		keys = append(keys, clickCounterKey(workspaceID, month))
+	}
+
+	values, err := r.cache.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	clicks := make([]plan.MonthlyClicks, 0, len(changed))
+	for i, value := range values {
+		total, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		changed[i].Clicks, err = strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		clicks = append(clicks, changed[i])
+	}
+
+	return clicks, nil
+}
+
+// MarkClicksChanged puts counters back for the next flush to store.
+func (r *RedisQuotaCounterRepository) MarkClicksChanged(ctx context.Context, clicks []plan.MonthlyClicks) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	members := make([]any, 0, len(clicks))
+	for _, c := range clicks {
+		members = append(members, clickCounterMember(c.WorkspaceID, c.Month))
+	}
+
+	return r.cache.SAdd(ctx, changedClicksKey, members...).Err()
+}
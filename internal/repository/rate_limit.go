@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"url-short/internal/domain/ratelimit"
+)
+
+// RateLimitRepository counts a request against the limit for the key and
+// decides whether it is allowed.
+type RateLimitRepository interface {
+	Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error)
+}
+
+type RedisRateLimiter struct {
+	cache *redis.Client
+}
+
+func NewRedisRateLimiter(c *redis.Client) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		cache: c,
+	}
+}
+
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s", key)
+}
+
+// takeScript runs ratelimit.Apply in Redis so that every instance shares the
+// key's theoretical arrival time and reads it with the same clock. Times are
+// in milliseconds.
+var takeScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if now < allow_at then
+	return {0, 0, tat - now, allow_at - now}
+end
+
+redis.call('SET', KEYS[1], new_tat, 'PX', new_tat - now)
+return {1, math.floor((period - (new_tat - now)) / interval), new_tat - now, 0}
+`)
+
+func (l *RedisRateLimiter) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	result, err := takeScript.Run(
+		ctx,
+		l.cache,
+		[]string{rateLimitKey(key)},
+		max(limit.Interval().Milliseconds(), 1),
+		limit.Period.Milliseconds(),
+	).Int64Slice()
+
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	return ratelimit.Decision{
+		Allowed:    result[0] == 1,
+		Limit:      limit,
+		Remaining:  int(result[1]),
+		Reset:      time.Duration(result[2]) * time.Millisecond,
+		RetryAfter: time.Duration(result[3]) * time.Millisecond,
+	}, nil
+}
+
+// LocalRateLimiter limits requests to this process in memory, it stands in
+// for Redis while Redis is unavailable.
+type LocalRateLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+// keys are swept at most this often, sweeping on every request would make a
+// flood of requests from many addresses slower still
+const localRateLimitSweepInterval = time.Minute
+
+func NewLocalRateLimiter() *LocalRateLimiter {
+	return &LocalRateLimiter{
+		tats: map[string]time.Time{},
+	}
+}
+
+func (l *LocalRateLimiter) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.removeExpired(now)
+
+	decision, tat := ratelimit.Apply(limit, l.tats[key], now)
+	l.tats[key] = tat
+
+	return decision, nil
+}
+
+// removeExpired forgets keys whose limit is fully available again, they
+// behave the same as keys that were never seen.
+func (l *LocalRateLimiter) removeExpired(now time.Time) {
+	if now.Sub(l.lastSweep) < localRateLimitSweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+
+	for key, tat := range l.tats {
+		if !tat.After(now) {
+			delete(l.tats, key)
+		}
+	}
+}
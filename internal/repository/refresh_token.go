@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, request user.CreateRefreshTokenRequest) (*user.RefreshToken, error)
+	SelectRefreshToken(ctx context.Context, tokenHash string) (*user.RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, tokenID int32) (*user.RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int32) error
+	ListUserRefreshTokens(ctx context.Context, userID int32) ([]user.RefreshToken, error)
+}
+
+type PostgresRefreshTokenRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresRefreshTokenRepository(db *database.Queries) *PostgresRefreshTokenRepository {
+	return &PostgresRefreshTokenRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresRefreshTokenRepository) CreateRefreshToken(
+	ctx context.Context,
+	request user.CreateRefreshTokenRequest,
+) (*user.RefreshToken, error) {
+	res, err := r.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		UserID:    request.UserID,
+		FamilyID:  request.FamilyID,
+		TokenHash: request.TokenHash,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: request.ExpiresAt.UTC(),
+	})
+
+	if err != nil {
+		return nil, getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	return refreshTokenFromRow(res), nil
+}
+
+func (r *PostgresRefreshTokenRepository) SelectRefreshToken(
+	ctx context.Context,
+	tokenHash string,
+) (*user.RefreshToken, error) {
+	res, err := r.db.SelectRefreshTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return nil, getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	return refreshTokenFromRow(res), nil
+}
+
+// MarkRefreshTokenUsed only succeeds for a token that is neither used nor
+// revoked, two concurrent refreshes with the same token can not both win.
+func (r *PostgresRefreshTokenRepository) MarkRefreshTokenUsed(
+	ctx context.Context,
+	tokenID int32,
+) (*user.RefreshToken, error) {
+	res, err := r.db.MarkRefreshTokenUsed(ctx, database.MarkRefreshTokenUsedParams{
+		UsedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:     tokenID,
+	})
+
+	if err != nil {
+		return nil, getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	return refreshTokenFromRow(res), nil
+}
+
+func (r *PostgresRefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	err := r.db.RevokeRefreshTokenFamily(ctx, database.RevokeRefreshTokenFamilyParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		FamilyID:  familyID,
+	})
+
+	if err != nil {
+		return getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int32) error {
+	err := r.db.RevokeUserRefreshTokens(ctx, database.RevokeUserRefreshTokensParams{
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		UserID:    userID,
+	})
+
+	if err != nil {
+		return getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func (r *PostgresRefreshTokenRepository) ListUserRefreshTokens(
+	ctx context.Context,
+	userID int32,
+) ([]user.RefreshToken, error) {
+	rows, err := r.db.SelectUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return nil, getRefreshTokenDomainErrorFromSQLError(ctx, err)
+	}
+
+	tokens := []user.RefreshToken{}
+	for _, res := range rows {
+		tokens = append(tokens, *refreshTokenFromRow(res))
+	}
+
+	return tokens, nil
+}
+
+func refreshTokenFromRow(res database.RefreshToken) *user.RefreshToken {
+	return &user.RefreshToken{
+		ID:        res.ID,
+		UserID:    res.UserID,
+		FamilyID:  res.FamilyID,
+		TokenHash: res.TokenHash,
+		CreatedAt: res.CreatedAt,
+		ExpiresAt: res.ExpiresAt,
+		UsedAt:    res.UsedAt.Time,
+		RevokedAt: res.RevokedAt.Time,
+	}
+}
+
+func getRefreshTokenDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return user.ErrInvalidRefreshToken
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return getUserDomainErrorFromSQLError(ctx, sqlError)
+}
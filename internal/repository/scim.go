@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/scim"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+
+	"github.com/lib/pq"
+)
+
+type SCIMRepository interface {
+	CreateToken(ctx context.Context, request scim.CreateTokenRequest) (*scim.Token, error)
+	SelectActiveToken(ctx context.Context, tokenHash string) (*scim.Token, error)
+	RevokeToken(ctx context.Context, workspaceID int32, tokenID int32) error
+	ProvisionUser(ctx context.Context, request scim.CreateUserRequest, passwordHash string) (int32, error)
+	SelectUser(ctx context.Context, workspaceID int32, userID int32) (*scim.User, error)
+	ListUsers(ctx context.Context, workspaceID int32) ([]scim.User, error)
+	SetUserName(ctx context.Context, workspaceID int32, userID int32, userName string) error
+	SetExternalID(ctx context.Context, workspaceID int32, userID int32, externalID string) error
+	DeleteUser(ctx context.Context, workspaceID int32, userID int32) error
+	IsManagedUser(ctx context.Context, userID int32) (bool, error)
+}
+
+type PostgresSCIMRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresSCIMRepository(db *database.Queries) *PostgresSCIMRepository {
+	return &PostgresSCIMRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresSCIMRepository) CreateToken(
+	ctx context.Context,
+	request scim.CreateTokenRequest,
+) (*scim.Token, error) {
+	res, err := r.db.CreateSCIMToken(ctx, database.CreateSCIMTokenParams{
+		WorkspaceID: request.WorkspaceID,
+		TokenHash:   request.TokenHash,
+		CreatedBy:   sql.NullInt32{Int32: request.CreatedBy, Valid: true},
+		CreatedAt:   time.Now().UTC(),
+	})
+
+	if err != nil {
+		return nil, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return tokenFromRow(res), nil
+}
+
+func (r *PostgresSCIMRepository) SelectActiveToken(ctx context.Context, tokenHash string) (*scim.Token, error) {
+	res, err := r.db.SelectActiveSCIMToken(ctx, tokenHash)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, scim.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return tokenFromRow(res), nil
+}
+
+func (r *PostgresSCIMRepository) RevokeToken(ctx context.Context, workspaceID int32, tokenID int32) error {
+	revoked, err := r.db.RevokeSCIMToken(ctx, database.RevokeSCIMTokenParams{
+		RevokedAt:   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:          tokenID,
+		WorkspaceID: workspaceID,
+	})
+
+	if err != nil {
+		return getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	if revoked == 0 {
+		return scim.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// ProvisionUser creates the user, their personal workspace, a viewer
+// membership in the directory's workspace and marks the user as managed by
+// the directory, all in one statement.
+func (r *PostgresSCIMRepository) ProvisionUser(
+	ctx context.Context,
+	request scim.CreateUserRequest,
+	passwordHash string,
+) (int32, error) {
+	now := time.Now().UTC()
+
+	id, err := r.db.ProvisionSCIMUser(ctx, database.ProvisionSCIMUserParams{
+		Email:       request.UserName,
+		Password:    passwordHash,
+		CreatedAt:   now,
+		DisabledAt:  sql.NullTime{Time: now, Valid: !request.Active},
+		DisabledBy:  sql.NullString{String: disabledByDirectory, Valid: !request.Active},
+		WorkspaceID: request.WorkspaceID,
+		ExternalID:  sql.NullString{String: request.ExternalID, Valid: request.ExternalID != ""},
+	})
+
+	if err != nil {
+		return 0, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return id, nil
+}
+
+func (r *PostgresSCIMRepository) SelectUser(ctx context.Context, workspaceID int32, userID int32) (*scim.User, error) {
+	res, err := r.db.SelectSCIMUser(ctx, database.SelectSCIMUserParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+
+	if err != nil {
+		return nil, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &scim.User{
+		ID:         res.ID,
+		UserName:   res.Email,
+		ExternalID: res.ExternalID.String,
+		Active:     !res.DisabledAt.Valid,
+		Role:       workspace.Role(res.Role.String),
+		CreatedAt:  res.CreatedAt,
+		UpdatedAt:  res.UpdatedAt,
+	}, nil
+}
+
+func (r *PostgresSCIMRepository) ListUsers(ctx context.Context, workspaceID int32) ([]scim.User, error) {
+	rows, err := r.db.SelectSCIMUsers(ctx, workspaceID)
+	if err != nil {
+		return nil, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	users := []scim.User{}
+	for _, res := range rows {
+		users = append(users, scim.User{
+			ID:         res.ID,
+			UserName:   res.Email,
+			ExternalID: res.ExternalID.String,
+			Active:     !res.DisabledAt.Valid,
+			Role:       workspace.Role(res.Role.String),
+			CreatedAt:  res.CreatedAt,
+			UpdatedAt:  res.UpdatedAt,
+		})
+	}
+
+	return users, nil
+}
+
+// SetUserName changes the email of a managed user. The directory is not
+// trusted to vouch for the new address, it is unverified until its owner
+// verifies it.
+func (r *PostgresSCIMRepository) SetUserName(
+	ctx context.Context,
+	workspaceID int32,
+	userID int32,
+	userName string,
+) error {
+	updated, err := r.db.UpdateSCIMUserEmail(ctx, database.UpdateSCIMUserEmailParams{
+		Email:       userName,
+		UpdatedAt:   time.Now().UTC(),
+		ID:          userID,
+		WorkspaceID: workspaceID,
+	})
+
+	if err != nil {
+		return getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	if updated == 0 {
+		return scim.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *PostgresSCIMRepository) SetExternalID(
+	ctx context.Context,
+	workspaceID int32,
+	userID int32,
+	externalID string,
+) error {
+	_, err := r.db.UpdateSCIMUser(ctx, database.UpdateSCIMUserParams{
+		ExternalID:  sql.NullString{String: externalID, Valid: externalID != ""},
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+	})
+
+	if err != nil {
+		return getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+// DeleteUser stops the directory from managing the user, the account itself
+// is kept.
+func (r *PostgresSCIMRepository) DeleteUser(ctx context.Context, workspaceID int32, userID int32) error {
+	deleted, err := r.db.DeleteSCIMUser(ctx, database.DeleteSCIMUserParams{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+	})
+
+	if err != nil {
+		return getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	if deleted == 0 {
+		return scim.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// IsManagedUser tells whether any workspace's directory manages the user.
+func (r *PostgresSCIMRepository) IsManagedUser(ctx context.Context, userID int32) (bool, error) {
+	managed, err := r.db.IsSCIMUser(ctx, userID)
+	if err != nil {
+		return false, getSCIMDomainErrorFromSQLError(ctx, err)
+	}
+
+	return managed, nil
+}
+
+func tokenFromRow(res database.ScimToken) *scim.Token {
+	return &scim.Token{
+		ID:          res.ID,
+		WorkspaceID: res.WorkspaceID,
+		TokenHash:   res.TokenHash,
+		CreatedBy:   res.CreatedBy.Int32,
+		CreatedAt:   res.CreatedAt,
+	}
+}
+
+func getSCIMDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return scim.ErrUserNotFound
+	}
+
+	pgErr, ok := sqlError.(*pq.Error)
+	if ok {
+		// unique_violation
+		if pgErr.Code == "23505" {
+			return scim.ErrUniqueness
+		}
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return scim.ErrUnexpectedError
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenDenylistRepository records access tokens that must be refused before
+// they expire, either one token by its jti or every token a user was issued
+// before a point in time.
+type TokenDenylistRepository interface {
+	DenyToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenDenied(ctx context.Context, jti string) (bool, error)
+	SetTokensInvalidBefore(ctx context.Context, userID int32, before time.Time, ttl time.Duration) error
+	GetTokensInvalidBefore(ctx context.Context, userID int32) (time.Time, error)
+}
+
+type RedisTokenDenylist struct {
+	cache *redis.Client
+}
+
+func NewRedisTokenDenylist(c *redis.Client) *RedisTokenDenylist {
+	return &RedisTokenDenylist{
+		cache: c,
+	}
+}
+
+func deniedTokenKey(jti string) string {
+	return fmt.Sprintf("auth:denylist:jti:%s", jti)
+}
+
+func tokensInvalidBeforeKey(userID int32) string {
+	return fmt.Sprintf("auth:denylist:user:%d", userID)
+}
+
+func (d *RedisTokenDenylist) DenyToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return d.cache.Set(ctx, deniedTokenKey(jti), 1, ttl).Err()
+}
+
+func (d *RedisTokenDenylist) IsTokenDenied(ctx context.Context, jti string) (bool, error) {
+	count, err := d.cache.Exists(ctx, deniedTokenKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (d *RedisTokenDenylist) SetTokensInvalidBefore(
+	ctx context.Context,
+	userID int32,
+	before time.Time,
+	ttl time.Duration,
+) error {
+	return d.cache.Set(ctx, tokensInvalidBeforeKey(userID), before.Unix(), ttl).Err()
+}
+
+func (d *RedisTokenDenylist) GetTokensInvalidBefore(ctx context.Context, userID int32) (time.Time, error) {
+	result, err := d.cache.Get(ctx, tokensInvalidBeforeKey(userID)).Result()
+
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unix, err := strconv.ParseInt(result, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0), nil
+}
+
+type localExpiringTime struct {
+	value     time.Time
+	expiresAt time.Time
+}
+
+// LocalTokenDenylist keeps revocations made by this process in memory so they
+// are still enforced while Redis is unavailable.
+type LocalTokenDenylist struct {
+	mu            sync.Mutex
+	deniedTokens  map[string]time.Time
+	invalidBefore map[int32]localExpiringTime
+}
+
+func NewLocalTokenDenylist() *LocalTokenDenylist {
+	return &LocalTokenDenylist{
+		deniedTokens:  map[string]time.Time{},
+		invalidBefore: map[int32]localExpiringTime{},
+	}
+}
+
+func (d *LocalTokenDenylist) DenyToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.removeExpired(time.Now())
+	d.deniedTokens[jti] = expiresAt
+
+	return nil
+}
+
+func (d *LocalTokenDenylist) IsTokenDenied(ctx context.Context, jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expiresAt, found := d.deniedTokens[jti]
+
+	return found && time.Now().Before(expiresAt), nil
+}
+
+func (d *LocalTokenDenylist) SetTokensInvalidBefore(
+	ctx context.Context,
+	userID int32,
+	before time.Time,
+	ttl time.Duration,
+) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.removeExpired(now)
+	d.invalidBefore[userID] = localExpiringTime{value: before, expiresAt: now.Add(ttl)}
+
+	return nil
+}
+
+func (d *LocalTokenDenylist) GetTokensInvalidBefore(ctx context.Context, userID int32) (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, found := d.invalidBefore[userID]
+	if !found || time.Now().After(entry.expiresAt) {
+		return time.Time{}, nil
+	}
+
+	return entry.value, nil
+}
+
+func (d *LocalTokenDenylist) removeExpired(now time.Time) {
+	for jti, expiresAt := range d.deniedTokens {
+		if now.After(expiresAt) {
+			delete(d.deniedTokens, jti)
+		}
+	}
+
+	for userID, entry := range d.invalidBefore {
+		if now.After(entry.expiresAt) {
+			delete(d.invalidBefore, userID)
+		}
+	}
+}
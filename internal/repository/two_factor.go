@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+)
+
+type TwoFactorRepository interface {
+	UpsertPendingTwoFactor(ctx context.Context, userID int32, encryptedSecret string) (*user.TwoFactor, error)
+	SelectTwoFactor(ctx context.Context, userID int32) (*user.TwoFactor, error)
+	ConfirmTwoFactor(ctx context.Context, userID int32, step int64) (*user.TwoFactor, error)
+	UseTwoFactorStep(ctx context.Context, userID int32, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int32, codeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID int32, codeHash string) error
+}
+
+type PostgresTwoFactorRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresTwoFactorRepository(db *database.Queries) *PostgresTwoFactorRepository {
+	return &PostgresTwoFactorRepository{
+		db: db,
+	}
+}
+
+// UpsertPendingTwoFactor replaces an unconfirmed enrollment, a confirmed one
+// is left untouched and ErrTwoFactorAlreadyEnabled is returned.
+func (r *PostgresTwoFactorRepository) UpsertPendingTwoFactor(
+	ctx context.Context,
+	userID int32,
+	encryptedSecret string,
+) (*user.TwoFactor, error) {
+	res, err := r.db.UpsertPendingTOTP(ctx, database.UpsertPendingTOTPParams{
+		UserID:          userID,
+		EncryptedSecret: encryptedSecret,
+		CreatedAt:       time.Now().UTC(),
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.ErrTwoFactorAlreadyEnabled
+	}
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return twoFactorFromRow(res), nil
+}
+
+func (r *PostgresTwoFactorRepository) SelectTwoFactor(ctx context.Context, userID int32) (*user.TwoFactor, error) {
+	res, err := r.db.SelectTOTP(ctx, userID)
+	if err != nil {
+		return nil, getTwoFactorDomainErrorFromSQLError(ctx, err)
+	}
+
+	return twoFactorFromRow(res), nil
+}
+
+func (r *PostgresTwoFactorRepository) ConfirmTwoFactor(
+	ctx context.Context,
+	userID int32,
+	step int64,
+) (*user.TwoFactor, error) {
+	res, err := r.db.ConfirmTOTP(ctx, database.ConfirmTOTPParams{
+		ConfirmedAt:  sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		LastUsedStep: step,
+		UserID:       userID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.ErrTwoFactorAlreadyEnabled
+	}
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return twoFactorFromRow(res), nil
+}
+
+// UseTwoFactorStep records step as used, a step at or before the last used
+// one is refused so a code can only be used once.
+func (r *PostgresTwoFactorRepository) UseTwoFactorStep(ctx context.Context, userID int32, step int64) error {
+	_, err := r.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		LastUsedStep: step,
+		UserID:       userID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return user.ErrInvalidTwoFactorCode
+	}
+
+	if err != nil {
+		return getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) ReplaceRecoveryCodes(
+	ctx context.Context,
+	userID int32,
+	codeHashes []string,
+) error {
+	if err := r.db.DeleteUserRecoveryCodes(ctx, userID); err != nil {
+		return getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	now := time.Now().UTC()
+
+	for _, codeHash := range codeHashes {
+		err := r.db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:    userID,
+			CodeHash:  codeHash,
+			CreatedAt: now,
+		})
+
+		if err != nil {
+			return getUserDomainErrorFromSQLError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) ConsumeRecoveryCode(ctx context.Context, userID int32, codeHash string) error {
+	_, err := r.db.ConsumeRecoveryCode(ctx, database.ConsumeRecoveryCodeParams{
+		UsedAt:   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		UserID:   userID,
+		CodeHash: codeHash,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return user.ErrInvalidTwoFactorCode
+	}
+
+	if err != nil {
+		return getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+func twoFactorFromRow(res database.UserTotp) *user.TwoFactor {
+	return &user.TwoFactor{
+		UserID:          res.UserID,
+		EncryptedSecret: res.EncryptedSecret,
+		LastUsedStep:    res.LastUsedStep,
+		CreatedAt:       res.CreatedAt,
+		ConfirmedAt:     res.ConfirmedAt.Time,
+	}
+}
+
+func getTwoFactorDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return user.ErrTwoFactorNotEnrolled
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return getUserDomainErrorFromSQLError(ctx, sqlError)
+}
@@ -8,6 +8,8 @@ import (
 
 	"url-short/internal/database"
 	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
 
 	"github.com/lib/pq"
 )
@@ -16,7 +18,14 @@ type URLRepository interface {
 	CreateShortURL(ctx context.Context, request shorturl.CreateURLRequest) (*shorturl.URL, error)
 	GetURLByHash(ctx context.Context, hash string) (*shorturl.URL, error)
 	UpdateShortURL(ctx context.Context, url shorturl.UpdateURLRequest) (*shorturl.URL, error)
-	DeleteShortURL(ctx context.Context, url shorturl.DeleteURLRequest) error
+	DeleteShortURL(ctx context.Context, url shorturl.DeleteURLRequest) (*shorturl.URL, error)
+	ListUserURLs(ctx context.Context, userID int32) ([]shorturl.URL, error)
+	ListWorkspaceURLs(ctx context.Context, workspaceID int32, userID int32) ([]shorturl.URL, error)
+	RecordClicks(ctx context.Context, shortURL string, day time.Time, clicks int64) error
+	ListUserURLClicks(ctx context.Context, userID int32) ([]shorturl.ClickAggregate, error)
+	CountUserURLs(ctx context.Context, userID int32) (*shorturl.LinkCounts, error)
+	SearchURLs(ctx context.Context, request shorturl.ListURLsRequest) ([]shorturl.URL, error)
+	SetURLDisabled(ctx context.Context, shortURL string, reason shorturl.DisableReason) (*shorturl.URL, error)
 }
 
 type PostgresURLRepository struct {
@@ -33,24 +42,34 @@ func (r *PostgresURLRepository) CreateShortURL(
 ) (*shorturl.URL, error) {
 	now := time.Now().UTC()
 	res, err := r.db.CreateURL(ctx, database.CreateURLParams{
-		LongUrl:   url.LongURL,
-		ShortUrl:  url.ShortURL,
-		CreatedAt: now,
-		UpdatedAt: now,
-		UserID:    url.UserID,
+		WorkspaceID:    url.WorkspaceID,
+		MaxActiveLinks: url.MaxActiveLinks,
+		LongUrl:        url.LongURL,
+		ShortUrl:       url.ShortURL,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		UserID:         url.UserID,
 	})
 
+	// nothing is inserted unless the user can edit the workspace and it has
+	// fewer than MaxActiveLinks active links
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, workspace.ErrWorkspaceNotFound
+	}
 	if err != nil {
-		return nil, getURLDomainErrorFromSQLError(err)
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &shorturl.URL{
-		ID:        res.ID,
-		ShortURL:  res.ShortUrl,
-		LongURL:   res.LongUrl,
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		UserID:    res.UserID,
+		ID:             res.ID,
+		ShortURL:       res.ShortUrl,
+		LongURL:        res.LongUrl,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+		UserID:         res.UserID.Int32,
+		WorkspaceID:    res.WorkspaceID,
+		DisabledAt:     res.DisabledAt.Time,
+		DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
 	}, nil
 }
 
@@ -61,30 +80,46 @@ func (r *PostgresURLRepository) GetURLByHash(
 	res, err := r.db.SelectURL(ctx, hash)
 
 	if err != nil {
-		return nil, getURLDomainErrorFromSQLError(err)
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &shorturl.URL{
-		ID:        res.ID,
-		ShortURL:  res.ShortUrl,
-		LongURL:   res.LongUrl,
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		UserID:    res.UserID,
+		ID:             res.ID,
+		ShortURL:       res.ShortUrl,
+		LongURL:        res.LongUrl,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+		UserID:         res.UserID.Int32,
+		WorkspaceID:    res.WorkspaceID,
+		DisabledAt:     res.DisabledAt.Time,
+		DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
 	}, nil
 }
 
 func (r *PostgresURLRepository) DeleteShortURL(
 	ctx context.Context,
 	url shorturl.DeleteURLRequest,
-) error {
-	if err := r.db.DeleteURL(ctx, database.DeleteURLParams{
+) (*shorturl.URL, error) {
+	res, err := r.db.DeleteURL(ctx, database.DeleteURLParams{
 		UserID:   url.UserID,
 		ShortUrl: url.ShortURL,
-	}); err != nil {
-		return getURLDomainErrorFromSQLError(err)
+	})
+
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
 	}
-	return nil
+
+	return &shorturl.URL{
+		ID:             res.ID,
+		ShortURL:       res.ShortUrl,
+		LongURL:        res.LongUrl,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+		UserID:         res.UserID.Int32,
+		WorkspaceID:    res.WorkspaceID,
+		DisabledAt:     res.DisabledAt.Time,
+		DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
+	}, nil
 }
 
 func (r *PostgresURLRepository) UpdateShortURL(
@@ -99,20 +134,195 @@ func (r *PostgresURLRepository) UpdateShortURL(
 	})
 
 	if err != nil {
-		return nil, getURLDomainErrorFromSQLError(err)
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &shorturl.URL{
+		ID:             res.ID,
+		ShortURL:       res.ShortUrl,
+		LongURL:        res.LongUrl,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+		UserID:         res.UserID.Int32,
+		WorkspaceID:    res.WorkspaceID,
+		DisabledAt:     res.DisabledAt.Time,
+		DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
+	}, nil
+}
+
+func (r *PostgresURLRepository) ListUserURLs(ctx context.Context, userID int32) ([]shorturl.URL, error) {
+	rows, err := r.db.SelectUserURLs(ctx, sql.NullInt32{Int32: userID, Valid: true})
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	urls := []shorturl.URL{}
+	for _, res := range rows {
+		urls = append(urls, shorturl.URL{
+			ID:             res.ID,
+			ShortURL:       res.ShortUrl,
+			LongURL:        res.LongUrl,
+			CreatedAt:      res.CreatedAt,
+			UpdatedAt:      res.UpdatedAt,
+			UserID:         res.UserID.Int32,
+			WorkspaceID:    res.WorkspaceID,
+			DisabledAt:     res.DisabledAt.Time,
+			DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
+		})
+	}
+
+	return urls, nil
+}
+
+// ListWorkspaceURLs lists the URLs of a workspace the user is a member of.
+func (r *PostgresURLRepository) ListWorkspaceURLs(
+	ctx context.Context,
+	workspaceID int32,
+	userID int32,
+) ([]shorturl.URL, error) {
+	rows, err := r.db.SelectWorkspaceURLs(ctx, database.SelectWorkspaceURLsParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	urls := []shorturl.URL{}
+	for _, res := range rows {
+		urls = append(urls, shorturl.URL{
+			ID:             res.ID,
+			ShortURL:       res.ShortUrl,
+			LongURL:        res.LongUrl,
+			CreatedAt:      res.CreatedAt,
+			UpdatedAt:      res.UpdatedAt,
+			UserID:         res.UserID.Int32,
+			WorkspaceID:    res.WorkspaceID,
+			DisabledAt:     res.DisabledAt.Time,
+			DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
+		})
+	}
+
+	return urls, nil
+}
+
+// RecordClicks adds redirects through the short URL to its total for the UTC
+// day, clicks are only kept as daily totals. Clicks on a URL that no longer
+// exists are dropped.
+func (r *PostgresURLRepository) RecordClicks(ctx context.Context, shortURL string, day time.Time, clicks int64) error {
+	err := r.db.RecordURLClicks(ctx, database.RecordURLClicksParams{
+		Day:      day,
+		Clicks:   clicks,
+		ShortUrl: shortURL,
+	})
+
+	if err != nil {
+		return getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+// CountUserURLs counts the links the user created in any workspace.
+func (r *PostgresURLRepository) CountUserURLs(ctx context.Context, userID int32) (*shorturl.LinkCounts, error) {
+	res, err := r.db.CountUserURLs(ctx, sql.NullInt32{Int32: userID, Valid: true})
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &shorturl.LinkCounts{
+		Total:    res.Links,
+		Disabled: res.DisabledLinks,
+	}, nil
+}
+
+func (r *PostgresURLRepository) ListUserURLClicks(
+	ctx context.Context,
+	userID int32,
+) ([]shorturl.ClickAggregate, error) {
+	rows, err := r.db.SelectUserURLClicks(ctx, sql.NullInt32{Int32: userID, Valid: true})
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	clicks := []shorturl.ClickAggregate{}
+	for _, res := range rows {
+		clicks = append(clicks, shorturl.ClickAggregate{
+			ShortURL: res.ShortUrl,
+			Day:      res.Day,
+			Clicks:   res.Clicks,
+		})
+	}
+
+	return clicks, nil
+}
+
+func (r *PostgresURLRepository) SearchURLs(
+	ctx context.Context,
+	request shorturl.ListURLsRequest,
+) ([]shorturl.URL, error) {
+	rows, err := r.db.SearchURLs(ctx, database.SearchURLsParams{
+		Query:     escapeLikePattern(request.Query),
+		RowLimit:  request.Limit,
+		RowOffset: request.Offset,
+	})
+
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
+	}
+
+	urls := []shorturl.URL{}
+	for _, res := range rows {
+		urls = append(urls, shorturl.URL{
+			ID:             res.ID,
+			ShortURL:       res.ShortUrl,
+			LongURL:        res.LongUrl,
+			CreatedAt:      res.CreatedAt,
+			UpdatedAt:      res.UpdatedAt,
+			UserID:         res.UserID.Int32,
+			WorkspaceID:    res.WorkspaceID,
+			DisabledAt:     res.DisabledAt.Time,
+			DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
+		})
+	}
+
+	return urls, nil
+}
+
+// SetURLDisabled takes the URL down for reason, an empty reason puts it back
+// up.
+func (r *PostgresURLRepository) SetURLDisabled(
+	ctx context.Context,
+	shortURL string,
+	reason shorturl.DisableReason,
+) (*shorturl.URL, error) {
+	disabled := reason != ""
+
+	res, err := r.db.SetURLDisabled(ctx, database.SetURLDisabledParams{
+		DisabledAt:     sql.NullTime{Time: time.Now().UTC(), Valid: disabled},
+		DisabledReason: sql.NullString{String: string(reason), Valid: disabled},
+		ShortUrl:       shortURL,
+	})
+
+	if err != nil {
+		return nil, getURLDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &shorturl.URL{
-		ID:        res.ID,
-		ShortURL:  res.ShortUrl,
-		LongURL:   res.LongUrl,
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		UserID:    res.UserID,
+		ID:             res.ID,
+		ShortURL:       res.ShortUrl,
+		LongURL:        res.LongUrl,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+		UserID:         res.UserID.Int32,
+		WorkspaceID:    res.WorkspaceID,
+		DisabledAt:     res.DisabledAt.Time,
+		DisabledReason: shorturl.DisableReason(res.DisabledReason.String),
 	}, nil
 }
 
-func getURLDomainErrorFromSQLError(sqlError error) error {
+func getURLDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
 	if errors.Is(sqlError, sql.ErrNoRows) {
 		return shorturl.ErrURLNotFound
 	}
@@ -125,5 +335,7 @@ func getURLDomainErrorFromSQLError(sqlError error) error {
 		}
 	}
 
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
 	return shorturl.ErrUnexpectedError
 }
@@ -4,24 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"strings"
 	"time"
 
 	"url-short/internal/database"
 	"url-short/internal/domain/user"
+	"url-short/internal/logging"
 
 	"github.com/lib/pq"
 )
 
 type UserRepository interface {
-	CreateUser(ctx context.Context, request user.CreateUserRequest) (*user.User, error)
+	CreateUser(ctx context.Context, email, passwordHash string) (*user.User, error)
 	SelectUser(ctx context.Context, email string) (*user.User, error)
-	SelectUserByRefreshToken(ctx context.Context, email string) (*user.User, error)
 	SelectUserByID(ctx context.Context, userID int32) (*user.User, error)
-	UpdateRefreshToken(ctx context.Context, refreshToken string, userID int32) error
-	UpdateUser(ctx context.Context, request user.UpdateUserRequest) (*user.User, error)
+	UpdateUserEmail(ctx context.Context, userID int32, email string) (*user.User, error)
+	UpdateUserPassword(ctx context.Context, userID int32, passwordHash string) (*user.User, error)
+	MarkUserEmailVerified(ctx context.Context, userID int32, email string) (*user.User, error)
+	SearchUsers(ctx context.Context, request user.ListUsersRequest) ([]user.User, error)
+	SetUserDisabled(ctx context.Context, userID int32, disabled bool) (*user.User, error)
+	DisableDirectoryUser(ctx context.Context, userID int32) (*user.User, error)
+	EnableDirectoryUser(ctx context.Context, userID int32) (*user.User, error)
+	SetUserRole(ctx context.Context, userID int32, role user.Role) (*user.User, error)
 }
 
+// who disabled a user, a workspace's directory can only enable the users it
+// disabled itself
+const (
+	disabledByAdmin     = "admin"
+	disabledByDirectory = "directory"
+)
+
 type PostgresUserRepository struct {
 	db *database.Queries
 }
@@ -32,26 +45,29 @@ func NewPostgresUserRepository(db *database.Queries) *PostgresUserRepository {
 	}
 }
 
-func (r *PostgresUserRepository) CreateUser(ctx context.Context, request user.CreateUserRequest) (*user.User, error) {
+func (r *PostgresUserRepository) CreateUser(ctx context.Context, email, passwordHash string) (*user.User, error) {
 	now := time.Now().UTC()
 
 	res, err := r.db.CreateUser(ctx, database.CreateUserParams{
-		Email:     request.Email,
-		Password:  request.PasswordHash,
+		Email:     email,
+		Password:  passwordHash,
 		CreatedAt: now,
 		UpdatedAt: now,
 	})
 
 	if err != nil {
-		return nil, getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &user.User{
-		Id:           res.ID,
-		Email:        res.Email,
-		PasswordHash: []byte(res.Password),
-		CreatedAt:    res.CreatedAt,
-		UpdatedAt:    res.UpdatedAt,
+		Id:              res.ID,
+		Email:           res.Email,
+		PasswordHash:    []byte(res.Password),
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
 	}, nil
 }
 
@@ -59,86 +75,265 @@ func (r *PostgresUserRepository) SelectUser(ctx context.Context, email string) (
 	res, err := r.db.SelectUser(ctx, email)
 
 	if err != nil {
-		return nil, getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &user.User{
-		Id:           res.ID,
-		Email:        res.Email,
-		PasswordHash: []byte(res.Password),
-		CreatedAt:    res.CreatedAt,
-		UpdatedAt:    res.UpdatedAt,
+		Id:              res.ID,
+		Email:           res.Email,
+		PasswordHash:    []byte(res.Password),
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
 	}, nil
 }
 
 func (r *PostgresUserRepository) SelectUserByID(ctx context.Context, id int32) (*user.User, error) {
 	res, err := r.db.SelectUserByID(ctx, id)
 	if err != nil {
-		return nil, getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &user.User{
-		Id:           res.ID,
-		Email:        res.Email,
-		PasswordHash: []byte(res.Password),
-		CreatedAt:    res.CreatedAt,
-		UpdatedAt:    res.UpdatedAt,
+		Id:              res.ID,
+		Email:           res.Email,
+		PasswordHash:    []byte(res.Password),
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
 	}, nil
 }
 
-func (r *PostgresUserRepository) UpdateRefreshToken(ctx context.Context, refreshToken string, userID int32) error {
-	err := r.db.UserTokenRefresh(ctx, database.UserTokenRefreshParams{
-		RefreshToken:           sql.NullString{String: refreshToken, Valid: true},
-		RefreshTokenRevokeDate: sql.NullTime{Time: time.Now().Add(60 * (24 * time.Hour)), Valid: true},
-		ID:                     userID,
+// UpdateUserEmail changes the user's email, a changed email is unverified.
+func (r *PostgresUserRepository) UpdateUserEmail(
+	ctx context.Context,
+	userID int32,
+	email string,
+) (*user.User, error) {
+	res, err := r.db.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+		Email:     email,
+		UpdatedAt: time.Now().UTC(),
+		ID:        userID,
 	})
 
 	if err != nil {
-		return getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
-	return nil
+	return &user.User{
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
+	}, nil
 }
 
-func (r *PostgresUserRepository) SelectUserByRefreshToken(ctx context.Context, refreshToken string) (*user.User, error) {
-	res, err := r.db.SelectUserByRefreshToken(ctx, sql.NullString{String: refreshToken, Valid: true})
+func (r *PostgresUserRepository) UpdateUserPassword(
+	ctx context.Context,
+	userID int32,
+	passwordHash string,
+) (*user.User, error) {
+	res, err := r.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		Password:  passwordHash,
+		UpdatedAt: time.Now().UTC(),
+		ID:        userID,
+	})
+
 	if err != nil {
-		return nil, getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &user.User{
-		Id:                     res.ID,
-		Email:                  res.Email,
-		PasswordHash:           []byte(res.Password),
-		CreatedAt:              res.CreatedAt,
-		UpdatedAt:              res.UpdatedAt,
-		RefreshTokenRevokeDate: res.RefreshTokenRevokeDate.Time,
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
 	}, nil
 }
 
-func (r *PostgresUserRepository) UpdateUser(ctx context.Context, request user.UpdateUserRequest) (*user.User, error) {
-	res, err := r.db.UpdateUser(ctx, database.UpdateUserParams{
-		Email:     request.Email,
-		Password:  request.NewPasswordHash,
-		ID:        request.Id,
-		UpdatedAt: time.Now().UTC(),
+// MarkUserEmailVerified only verifies the user when their email is still the
+// one that was verified.
+func (r *PostgresUserRepository) MarkUserEmailVerified(
+	ctx context.Context,
+	userID int32,
+	email string,
+) (*user.User, error) {
+	res, err := r.db.MarkUserEmailVerified(ctx, database.MarkUserEmailVerifiedParams{
+		EmailVerifiedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:              userID,
+		Email:           email,
 	})
 
 	if err != nil {
-		return nil, getUserDomainErrorFromSQLError(err)
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
 	}
 
 	return &user.User{
-		Id:        res.ID,
-		Email:     res.Email,
-		UpdatedAt: res.UpdatedAt,
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
 	}, nil
+}
+
+func (r *PostgresUserRepository) SearchUsers(
+	ctx context.Context,
+	request user.ListUsersRequest,
+) ([]user.User, error) {
+	rows, err := r.db.SearchUsers(ctx, database.SearchUsersParams{
+		Query:     escapeLikePattern(request.Query),
+		RowLimit:  request.Limit,
+		RowOffset: request.Offset,
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
 
+	users := []user.User{}
+	for _, res := range rows {
+		users = append(users, user.User{
+			Id:              res.ID,
+			Email:           res.Email,
+			CreatedAt:       res.CreatedAt,
+			UpdatedAt:       res.UpdatedAt,
+			EmailVerifiedAt: res.EmailVerifiedAt.Time,
+			Role:            user.Role(res.Role),
+			DisabledAt:      res.DisabledAt.Time,
+		})
+	}
+
+	return users, nil
 }
 
-func getUserDomainErrorFromSQLError(sqlError error) error {
-	log.Println(sqlError)
+// SetUserDisabled disables or enables the user as an administrator, whoever
+// disabled them before.
+func (r *PostgresUserRepository) SetUserDisabled(
+	ctx context.Context,
+	userID int32,
+	disabled bool,
+) (*user.User, error) {
+	now := time.Now().UTC()
+
+	res, err := r.db.SetUserDisabledAt(ctx, database.SetUserDisabledAtParams{
+		DisabledAt: sql.NullTime{Time: now, Valid: disabled},
+		DisabledBy: sql.NullString{String: disabledByAdmin, Valid: disabled},
+		UpdatedAt:  now,
+		ID:         userID,
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
 
+	return &user.User{
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
+	}, nil
+}
+
+// DisableDirectoryUser disables the user for a workspace's directory, a user
+// an administrator disabled stays disabled by the administrator.
+func (r *PostgresUserRepository) DisableDirectoryUser(ctx context.Context, userID int32) (*user.User, error) {
+	res, err := r.db.DisableUserBy(ctx, database.DisableUserByParams{
+		DisabledAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		DisabledBy: sql.NullString{String: disabledByDirectory, Valid: true},
+		ID:         userID,
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &user.User{
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
+	}, nil
+}
+
+// EnableDirectoryUser enables the user for a workspace's directory, it fails
+// with ErrUserDisabledByAdmin when an administrator disabled the user.
+func (r *PostgresUserRepository) EnableDirectoryUser(ctx context.Context, userID int32) (*user.User, error) {
+	res, err := r.db.EnableUserDisabledBy(ctx, database.EnableUserDisabledByParams{
+		UpdatedAt:  time.Now().UTC(),
+		ID:         userID,
+		DisabledBy: sql.NullString{String: disabledByDirectory, Valid: true},
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.ErrUserDisabledByAdmin
+	}
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &user.User{
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
+	}, nil
+}
+
+func (r *PostgresUserRepository) SetUserRole(
+	ctx context.Context,
+	userID int32,
+	role user.Role,
+) (*user.User, error) {
+	res, err := r.db.SetUserRole(ctx, database.SetUserRoleParams{
+		Role:      string(role),
+		UpdatedAt: time.Now().UTC(),
+		ID:        userID,
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &user.User{
+		Id:              res.ID,
+		Email:           res.Email,
+		CreatedAt:       res.CreatedAt,
+		UpdatedAt:       res.UpdatedAt,
+		EmailVerifiedAt: res.EmailVerifiedAt.Time,
+		Role:            user.Role(res.Role),
+		DisabledAt:      res.DisabledAt.Time,
+	}, nil
+}
+
+// escapeLikePattern escapes the wildcards of a LIKE pattern so a search
+// matches them literally.
+func escapeLikePattern(query string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)
+}
+
+func getUserDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
 	if errors.Is(sqlError, sql.ErrNoRows) {
 		return user.ErrUserNotFound
 	}
@@ -151,5 +346,7 @@ func getUserDomainErrorFromSQLError(sqlError error) error {
 		}
 	}
 
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
 	return user.ErrUnexpectedError
 }
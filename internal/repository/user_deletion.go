@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/user"
+)
+
+type UserDeletionRepository interface {
+	ScheduleUserDeletion(ctx context.Context, userID int32, purgeAfter time.Time) (*user.Deletion, error)
+	CancelUserDeletion(ctx context.Context, userID int32) (bool, error)
+	SelectDueUserDeletions(ctx context.Context, now time.Time, limit int32) ([]user.Deletion, error)
+	PurgeUser(ctx context.Context, userID int32, now time.Time) (bool, error)
+}
+
+type PostgresUserDeletionRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresUserDeletionRepository(db *database.Queries) *PostgresUserDeletionRepository {
+	return &PostgresUserDeletionRepository{
+		db: db,
+	}
+}
+
+// ScheduleUserDeletion replaces any deletion already scheduled for the user.
+func (r *PostgresUserDeletionRepository) ScheduleUserDeletion(
+	ctx context.Context,
+	userID int32,
+	purgeAfter time.Time,
+) (*user.Deletion, error) {
+	res, err := r.db.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{
+		UserID:      userID,
+		RequestedAt: time.Now().UTC(),
+		PurgeAfter:  purgeAfter.UTC(),
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return userDeletionFromRow(res), nil
+}
+
+// CancelUserDeletion reports whether a deletion was scheduled for the user.
+func (r *PostgresUserDeletionRepository) CancelUserDeletion(ctx context.Context, userID int32) (bool, error) {
+	cancelled, err := r.db.DeleteUserDeletion(ctx, userID)
+	if err != nil {
+		return false, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return cancelled > 0, nil
+}
+
+func (r *PostgresUserDeletionRepository) SelectDueUserDeletions(
+	ctx context.Context,
+	now time.Time,
+	limit int32,
+) ([]user.Deletion, error) {
+	rows, err := r.db.SelectDueUserDeletions(ctx, database.SelectDueUserDeletionsParams{
+		PurgeAfter: now.UTC(),
+		Limit:      limit,
+	})
+
+	if err != nil {
+		return nil, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	deletions := []user.Deletion{}
+	for _, res := range rows {
+		deletions = append(deletions, *userDeletionFromRow(res))
+	}
+
+	return deletions, nil
+}
+
+// PurgeUser deletes the user only while their deletion is still scheduled and
+// due, a login that cancelled it in the meantime keeps the user. Links,
+// tokens and everything else that references the user go with them through
+// ON DELETE CASCADE.
+func (r *PostgresUserDeletionRepository) PurgeUser(ctx context.Context, userID int32, now time.Time) (bool, error) {
+	purged, err := r.db.PurgeUser(ctx, database.PurgeUserParams{
+		ID:         userID,
+		PurgeAfter: now.UTC(),
+	})
+
+	if err != nil {
+		return false, getUserDomainErrorFromSQLError(ctx, err)
+	}
+
+	return purged > 0, nil
+}
+
+func userDeletionFromRow(res database.UserDeletion) *user.Deletion {
+	return &user.Deletion{
+		UserID:      res.UserID,
+		RequestedAt: res.RequestedAt,
+		PurgeAfter:  res.PurgeAfter,
+	}
+}
@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"url-short/internal/database"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+
+	"github.com/lib/pq"
+)
+
+type WorkspaceRepository interface {
+	CreateWorkspace(ctx context.Context, request workspace.CreateWorkspaceRequest) (*workspace.Workspace, error)
+	SelectWorkspace(ctx context.Context, workspaceID int32) (*workspace.Workspace, error)
+	SelectPersonalWorkspace(ctx context.Context, userID int32) (*workspace.Workspace, error)
+	ListUserWorkspaces(ctx context.Context, userID int32) ([]workspace.Membership, error)
+	SelectMember(ctx context.Context, workspaceID int32, userID int32) (*workspace.Member, error)
+	ListMembers(ctx context.Context, workspaceID int32) ([]workspace.Member, error)
+	CreateMember(ctx context.Context, workspaceID int32, userID int32, role workspace.Role) error
+	SetMemberRole(ctx context.Context, request workspace.SetMemberRoleRequest) error
+	DeleteMember(ctx context.Context, workspaceID int32, userID int32) error
+	CountSoleOwnedWorkspaces(ctx context.Context, userID int32) (int64, error)
+	CreateInvite(ctx context.Context, request workspace.CreateInviteRequest) (*workspace.Invite, error)
+	ConsumeInvite(ctx context.Context, request workspace.AcceptInviteRequest) (*workspace.Invite, error)
+}
+
+type PostgresWorkspaceRepository struct {
+	db *database.Queries
+}
+
+func NewPostgresWorkspaceRepository(db *database.Queries) *PostgresWorkspaceRepository {
+	return &PostgresWorkspaceRepository{
+		db: db,
+	}
+}
+
+// CreateWorkspace creates a shared workspace owned by the requesting user.
+func (r *PostgresWorkspaceRepository) CreateWorkspace(
+	ctx context.Context,
+	request workspace.CreateWorkspaceRequest,
+) (*workspace.Workspace, error) {
+	res, err := r.db.CreateWorkspace(ctx, database.CreateWorkspaceParams{
+		Name:      request.Name,
+		CreatedAt: time.Now().UTC(),
+		OwnerID:   request.OwnerID,
+	})
+
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &workspace.Workspace{
+		ID:             res.ID,
+		Name:           res.Name,
+		PersonalUserID: res.PersonalUserID.Int32,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+	}, nil
+}
+
+func (r *PostgresWorkspaceRepository) SelectWorkspace(
+	ctx context.Context,
+	workspaceID int32,
+) (*workspace.Workspace, error) {
+	res, err := r.db.SelectWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return workspaceFromRow(res), nil
+}
+
+func (r *PostgresWorkspaceRepository) SelectPersonalWorkspace(
+	ctx context.Context,
+	userID int32,
+) (*workspace.Workspace, error) {
+	res, err := r.db.SelectPersonalWorkspace(ctx, sql.NullInt32{Int32: userID, Valid: true})
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return workspaceFromRow(res), nil
+}
+
+func (r *PostgresWorkspaceRepository) ListUserWorkspaces(
+	ctx context.Context,
+	userID int32,
+) ([]workspace.Membership, error) {
+	rows, err := r.db.SelectUserWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	memberships := []workspace.Membership{}
+	for _, res := range rows {
+		memberships = append(memberships, workspace.Membership{
+			Workspace: workspace.Workspace{
+				ID:             res.ID,
+				Name:           res.Name,
+				PersonalUserID: res.PersonalUserID.Int32,
+				CreatedAt:      res.CreatedAt,
+				UpdatedAt:      res.UpdatedAt,
+			},
+			Role: workspace.Role(res.Role),
+		})
+	}
+
+	return memberships, nil
+}
+
+func (r *PostgresWorkspaceRepository) SelectMember(
+	ctx context.Context,
+	workspaceID int32,
+	userID int32,
+) (*workspace.Member, error) {
+	res, err := r.db.SelectWorkspaceMember(ctx, database.SelectWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, workspace.ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return &workspace.Member{
+		WorkspaceID: res.WorkspaceID,
+		UserID:      res.UserID,
+		Email:       res.Email,
+		Role:        workspace.Role(res.Role),
+		CreatedAt:   res.CreatedAt,
+	}, nil
+}
+
+func (r *PostgresWorkspaceRepository) ListMembers(ctx context.Context, workspaceID int32) ([]workspace.Member, error) {
+	rows, err := r.db.SelectWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	members := []workspace.Member{}
+	for _, res := range rows {
+		members = append(members, workspace.Member{
+			WorkspaceID: res.WorkspaceID,
+			UserID:      res.UserID,
+			Email:       res.Email,
+			Role:        workspace.Role(res.Role),
+			CreatedAt:   res.CreatedAt,
+		})
+	}
+
+	return members, nil
+}
+
+func (r *PostgresWorkspaceRepository) CreateMember(
+	ctx context.Context,
+	workspaceID int32,
+	userID int32,
+	role workspace.Role,
+) error {
+	_, err := r.db.CreateWorkspaceMember(ctx, database.CreateWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        string(role),
+		CreatedAt:   time.Now().UTC(),
+	})
+
+	if err != nil {
+		return getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+// SetMemberRole changes the member's role, unless they are the workspace's
+// last owner and the new role is not owner.
+func (r *PostgresWorkspaceRepository) SetMemberRole(
+	ctx context.Context,
+	request workspace.SetMemberRoleRequest,
+) error {
+	_, err := r.db.UpdateWorkspaceMemberRole(ctx, database.UpdateWorkspaceMemberRoleParams{
+		Role:        string(request.Role),
+		WorkspaceID: request.WorkspaceID,
+		UserID:      request.UserID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.memberNotChanged(ctx, request.WorkspaceID, request.UserID)
+	}
+	if err != nil {
+		return getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return nil
+}
+
+// DeleteMember takes the member out of the workspace, unless they are its
+// last owner.
+func (r *PostgresWorkspaceRepository) DeleteMember(ctx context.Context, workspaceID int32, userID int32) error {
+	deleted, err := r.db.DeleteWorkspaceMember(ctx, database.DeleteWorkspaceMemberParams{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+	})
+
+	if err != nil {
+		return getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	if deleted == 0 {
+		return r.memberNotChanged(ctx, workspaceID, userID)
+	}
+
+	return nil
+}
+
+// memberNotChanged tells why a member was not changed or deleted, either
+// they are not a member or they are the workspace's last owner.
+func (r *PostgresWorkspaceRepository) memberNotChanged(ctx context.Context, workspaceID int32, userID int32) error {
+	_, err := r.SelectMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	return workspace.ErrLastOwner
+}
+
+// CountSoleOwnedWorkspaces counts the workspaces that still have other
+// members but would be left without an owner if the user left.
+func (r *PostgresWorkspaceRepository) CountSoleOwnedWorkspaces(ctx context.Context, userID int32) (int64, error) {
+	count, err := r.db.CountSoleOwnedWorkspaces(ctx, userID)
+	if err != nil {
+		return 0, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return count, nil
+}
+
+func (r *PostgresWorkspaceRepository) CreateInvite(
+	ctx context.Context,
+	request workspace.CreateInviteRequest,
+) (*workspace.Invite, error) {
+	res, err := r.db.CreateWorkspaceInvite(ctx, database.CreateWorkspaceInviteParams{
+		WorkspaceID: request.WorkspaceID,
+		Email:       request.Email,
+		Role:        string(request.Role),
+		TokenHash:   request.TokenHash,
+		InvitedBy:   sql.NullInt32{Int32: request.InvitedBy, Valid: true},
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   request.ExpiresAt.UTC(),
+	})
+
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return inviteFromRow(res), nil
+}
+
+// ConsumeInvite spends an unexpired invite that was sent to the accepting
+// user's email.
+func (r *PostgresWorkspaceRepository) ConsumeInvite(
+	ctx context.Context,
+	request workspace.AcceptInviteRequest,
+) (*workspace.Invite, error) {
+	res, err := r.db.ConsumeWorkspaceInvite(ctx, database.ConsumeWorkspaceInviteParams{
+		AcceptedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		TokenHash:  request.TokenHash,
+		Email:      request.Email,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, workspace.ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, getWorkspaceDomainErrorFromSQLError(ctx, err)
+	}
+
+	return inviteFromRow(res), nil
+}
+
+func workspaceFromRow(res database.Workspace) *workspace.Workspace {
+	return &workspace.Workspace{
+		ID:             res.ID,
+		Name:           res.Name,
+		PersonalUserID: res.PersonalUserID.Int32,
+		CreatedAt:      res.CreatedAt,
+		UpdatedAt:      res.UpdatedAt,
+	}
+}
+
+func inviteFromRow(res database.WorkspaceInvite) *workspace.Invite {
+	return &workspace.Invite{
+		ID:          res.ID,
+		WorkspaceID: res.WorkspaceID,
+		Email:       res.Email,
+		Role:        workspace.Role(res.Role),
+		TokenHash:   res.TokenHash,
+		InvitedBy:   res.InvitedBy.Int32,
+		CreatedAt:   res.CreatedAt,
+		ExpiresAt:   res.ExpiresAt,
+		AcceptedAt:  res.AcceptedAt.Time,
+	}
+}
+
+func getWorkspaceDomainErrorFromSQLError(ctx context.Context, sqlError error) error {
+	if errors.Is(sqlError, sql.ErrNoRows) {
+		return workspace.ErrWorkspaceNotFound
+	}
+
+	pgErr, ok := sqlError.(*pq.Error)
+	if ok {
+		// unique_violation
+		if pgErr.Code == "23505" {
+			return workspace.ErrAlreadyMember
+		}
+	}
+
+	logging.FromContext(ctx).Error("unexpected database error", "error", sqlError)
+
+	return workspace.ErrUnexpectedError
+}
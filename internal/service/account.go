@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type AccountService interface {
+	GetProfile(ctx context.Context, userID int32) (*user.Profile, error)
+	UpdateProfile(ctx context.Context, request user.UpdateProfileRequest) (*user.Profile, error)
+	ExportUserData(ctx context.Context, userID int32) (*user.DataExport, error)
+	ScheduleUserDeletion(ctx context.Context, request user.DeleteUserRequest) (*user.Deletion, error)
+	CancelUserDeletion(ctx context.Context, userID int32) error
+	PurgeDeletedUsers(ctx context.Context) (int, error)
+}
+
+// purgeBatchSize bounds how many users one purge run deletes, the rest are
+// left for the next run.
+const purgeBatchSize = 100
+
+type AccountServiceImpl struct {
+	userRepo         repository.UserRepository
+	urlRepo          repository.URLRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	identityRepo     repository.IdentityRepository
+	deletionRepo     repository.UserDeletionRepository
+	cacheRepo        repository.CacheRepository
+	workspaceRepo    repository.WorkspaceRepository
+	twoFactor        TwoFactorService
+	verification     EmailVerificationService
+	denylist         *AccessTokenDenylist
+	loginThrottle    *LoginThrottle
+	passwords        *user.Passwords
+	audit            AuditService
+	gracePeriod      time.Duration
+}
+
+// NewAccountServiceImpl purges users gracePeriod after they ask for their
+// account to be deleted.
+func NewAccountServiceImpl(
+	u repository.UserRepository,
+	l repository.URLRepository,
+	t repository.RefreshTokenRepository,
+	i repository.IdentityRepository,
+	d repository.UserDeletionRepository,
+	c repository.CacheRepository,
+	w repository.WorkspaceRepository,
+	f TwoFactorService,
+	v EmailVerificationService,
+	n *AccessTokenDenylist,
+	lt *LoginThrottle,
+	pw *user.Passwords,
+	a AuditService,
+	gracePeriod time.Duration,
+) *AccountServiceImpl {
+	return &AccountServiceImpl{
+		userRepo:         u,
+		urlRepo:          l,
+		refreshTokenRepo: t,
+		identityRepo:     i,
+		deletionRepo:     d,
+		cacheRepo:        c,
+		workspaceRepo:    w,
+		twoFactor:        f,
+		verification:     v,
+		denylist:         n,
+		loginThrottle:    lt,
+		passwords:        pw,
+		audit:            a,
+		gracePeriod:      gracePeriod,
+	}
+}
+
+func (s *AccountServiceImpl) GetProfile(ctx context.Context, userID int32) (*user.Profile, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.GetProfile")
+	defer span.End()
+
+	res, err := s.userRepo.SelectUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorEnabled, err := s.twoFactor.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.urlRepo.CountUserURLs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.Profile{
+		User:             res,
+		TwoFactorEnabled: twoFactorEnabled,
+		Links:            *links,
+	}, nil
+}
+
+// UpdateProfile confirms the user's current password before changing their
+// email or password. Changing the email also needs a two factor code when
+// two factor authentication is enabled, and the new email is unverified
+// until the link sent to it is used. A new password revokes every token
+// issued to the user.
+func (s *AccountServiceImpl) UpdateProfile(
+	ctx context.Context,
+	request user.UpdateProfileRequest,
+) (*user.Profile, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.UpdateProfile")
+	defer span.End()
+
+	if request.NewPassword != "" {
+		if err := s.passwords.Validate(request.NewPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := s.userRepo.SelectUserByID(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPassword(ctx, current, request.CurrentPassword, request.ClientIP); err != nil {
+		return nil, err
+	}
+
+	newPasswordHash := ""
+	if request.NewPassword != "" {
+		newPasswordHash, err = s.passwords.Hash(request.NewPassword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Email != "" && request.Email != current.Email {
+		if err := s.reauthenticate(ctx, current.Id, request.TwoFactorCode); err != nil {
+			return nil, err
+		}
+
+		updated, err := s.userRepo.UpdateUserEmail(ctx, current.Id, request.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		emailChanged := audit.NewCreateEventRequest(audit.EventUserEmailChanged, current.Id, "", nil)
+		emailChanged.Diff.Add("email", current.Email, updated.Email)
+		s.audit.Record(ctx, *emailChanged)
+
+		if err := s.verification.SendVerificationEmail(ctx, updated); err != nil {
+			logging.FromContext(ctx).Error("could not send verification email", "user_id", updated.Id, "error", err)
+		}
+	}
+
+	if newPasswordHash != "" {
+		if _, err := s.userRepo.UpdateUserPassword(ctx, current.Id, newPasswordHash); err != nil {
+			return nil, err
+		}
+
+		if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, current.Id); err != nil {
+			return nil, err
+		}
+
+		s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventUserPasswordChanged, current.Id, "", nil))
+	}
+
+	return s.GetProfile(ctx, current.Id)
+}
+
+// confirmPassword checks the password of a user who is already logged in.
+// Attempts go through the login throttle, so an access token is no faster a
+// way to guess the password than logging in.
+func (s *AccountServiceImpl) confirmPassword(ctx context.Context, u *user.User, password, clientIP string) error {
+	attempt := user.LoginUserRequest{Email: u.Email, Password: password, ClientIP: clientIP}
+
+	if err := s.loginThrottle.Check(ctx, attempt); err != nil {
+		return err
+	}
+
+	if _, err := s.passwords.Verify(u, password); err != nil {
+		s.loginThrottle.RecordFailure(ctx, attempt, u.Id)
+		return err
+	}
+
+	s.loginThrottle.RecordSuccess(ctx, attempt, u.Id)
+
+	return nil
+}
+
+// reauthenticate asks users with two factor authentication enabled for a
+// code on top of their password.
+func (s *AccountServiceImpl) reauthenticate(ctx context.Context, userID int32, code string) error {
+	enabled, err := s.twoFactor.IsEnabled(ctx, userID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	if code == "" {
+		return user.ErrReauthenticationRequired
+	}
+
+	return s.twoFactor.VerifyCode(ctx, userID, code)
+}
+
+// ExportUserData collects the user's profile, links, sessions and daily click
+// totals. Secrets such as password and token hashes are left out.
+func (s *AccountServiceImpl) ExportUserData(ctx context.Context, userID int32) (*user.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.ExportUserData")
+	defer span.End()
+
+	res, err := s.userRepo.SelectUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorEnabled, err := s.twoFactor.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.identityRepo.ListUserIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.urlRepo.ListUserURLs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.refreshTokenRepo.ListUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	clicks, err := s.urlRepo.ListUserURLClicks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.DataExport{
+		User:             res,
+		TwoFactorEnabled: twoFactorEnabled,
+		Identities:       identities,
+		Links:            links,
+		Sessions:         sessions,
+		Clicks:           clicks,
+	}, nil
+}
+
+// ScheduleUserDeletion confirms the user's password and schedules their
+// account to be purged once the grace period is over. Every token issued to
+// the user is revoked, logging in again before the purge cancels it. Users
+// who are the only owner of a shared workspace must hand it over first.
+func (s *AccountServiceImpl) ScheduleUserDeletion(
+	ctx context.Context,
+	request user.DeleteUserRequest,
+) (*user.Deletion, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.ScheduleUserDeletion")
+	defer span.End()
+
+	res, err := s.userRepo.SelectUserByID(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPassword(ctx, res, request.Password, request.ClientIP); err != nil {
+		return nil, err
+	}
+
+	soleOwned, err := s.workspaceRepo.CountSoleOwnedWorkspaces(ctx, res.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if soleOwned > 0 {
+		return nil, workspace.ErrSoleOwnerOfWorkspaces
+	}
+
+	deletion, err := s.deletionRepo.ScheduleUserDeletion(ctx, res.Id, time.Now().Add(s.gracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, res.Id); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventUserDeletionScheduled,
+		res.Id,
+		"",
+		map[string]any{"purge_after": deletion.PurgeAfter},
+	))
+
+	return deletion, nil
+}
+
+// CancelUserDeletion drops the deletion scheduled for the user, if any.
+func (s *AccountServiceImpl) CancelUserDeletion(ctx context.Context, userID int32) error {
+	ctx, span := tracing.Start(ctx, "AccountService.CancelUserDeletion")
+	defer span.End()
+
+	cancelled, err := s.deletionRepo.CancelUserDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if cancelled {
+		s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventUserDeletionCancelled, userID, "", nil))
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers deletes users whose grace period is over and evicts
+// their links from the cache, returning how many users were purged. A user
+// that can not be purged does not stop the rest of the batch, the errors are
+// returned together once the batch is done and are logged by the caller.
+func (s *AccountServiceImpl) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AccountService.PurgeDeletedUsers")
+	defer span.End()
+
+	now := time.Now()
+
+	deletions, err := s.deletionRepo.SelectDueUserDeletions(ctx, now, purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for _, deletion := range deletions {
+		ok, err := s.purgeUser(ctx, deletion.UserID, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %w", deletion.UserID, err))
+			continue
+		}
+
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// purgeUser deletes the user together with their personal workspace and its
+// links, links they created in shared workspaces stay with the workspace.
+func (s *AccountServiceImpl) purgeUser(ctx context.Context, userID int32, now time.Time) (bool, error) {
+	personal, err := s.workspaceRepo.SelectPersonalWorkspace(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	links, err := s.urlRepo.ListWorkspaceURLs(ctx, personal.ID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	purged, err := s.deletionRepo.PurgeUser(ctx, userID, now)
+	if err != nil || !purged {
+		return false, err
+	}
+
+	// links are evicted once the database no longer has them to put back
+	// into the cache on a miss
+	for _, link := range links {
+		if err := s.cacheRepo.DeleteURL(ctx, link.ShortURL); err != nil {
+			logging.FromContext(ctx).Warn("could not evict url of purged user from the cache", "short_url", link.ShortURL, "user_id", userID, "error", err)
+		}
+	}
+
+	purgedEvent := audit.NewCreateEventRequest(audit.EventUserPurged, userID, "", map[string]any{"links": len(links)})
+	purgedEvent.ActorID = 0
+	s.audit.Record(ctx, *purgedEvent)
+
+	return true, nil
+}
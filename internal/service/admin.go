@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+// AdminService moderates users and links and moves them between plans. Every
+// method records what the acting administrator did in the audit trail.
+type AdminService interface {
+	ListUsers(ctx context.Context, actor audit.Actor, request user.ListUsersRequest) ([]user.User, error)
+	DisableUser(ctx context.Context, actor audit.Actor, userID int32) (*user.User, error)
+	EnableUser(ctx context.Context, actor audit.Actor, userID int32) (*user.User, error)
+	LogoutUser(ctx context.Context, actor audit.Actor, userID int32) error
+	SetUserRole(ctx context.Context, actor audit.Actor, userID int32, role user.Role) (*user.User, error)
+	SetUserPlan(ctx context.Context, actor audit.Actor, userID int32, planName string) (*plan.Usage, error)
+	SetWorkspacePlan(ctx context.Context, actor audit.Actor, workspaceID int32, planName string) (*plan.Usage, error)
+	ListURLs(ctx context.Context, actor audit.Actor, request shorturl.ListURLsRequest) ([]shorturl.URL, error)
+	DisableURL(ctx context.Context, actor audit.Actor, request shorturl.DisableURLRequest) (*shorturl.URL, error)
+	EnableURL(ctx context.Context, actor audit.Actor, shortURL string) (*shorturl.URL, error)
+	ListAuditEvents(ctx context.Context, actor audit.Actor, request audit.ListEventsRequest) ([]audit.Event, error)
+	VerifyAuditChain(ctx context.Context, actor audit.Actor) (*audit.ChainVerification, error)
+}
+
+type AdminServiceImpl struct {
+	userRepo         repository.UserRepository
+	urlRepo          repository.URLRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	cacheRepo        repository.CacheRepository
+	denylist         *AccessTokenDenylist
+	audit            AuditService
+	quotas           QuotaService
+}
+
+func NewAdminServiceImpl(
+	u repository.UserRepository,
+	l repository.URLRepository,
+	t repository.RefreshTokenRepository,
+	c repository.CacheRepository,
+	d *AccessTokenDenylist,
+	a AuditService,
+	q QuotaService,
+) *AdminServiceImpl {
+	return &AdminServiceImpl{
+		userRepo:         u,
+		urlRepo:          l,
+		refreshTokenRepo: t,
+		cacheRepo:        c,
+		denylist:         d,
+		audit:            a,
+		quotas:           q,
+	}
+}
+
+func (s *AdminServiceImpl) ListUsers(
+	ctx context.Context,
+	actor audit.Actor,
+	request user.ListUsersRequest,
+) ([]user.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListUsers")
+	defer span.End()
+
+	users, err := s.userRepo.SearchUsers(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, actor, audit.NewCreateEventRequest(audit.EventAdminUsersListed, actor.UserID, "", map[string]any{
+		"query":   request.Query,
+		"limit":   request.Limit,
+		"offset":  request.Offset,
+		"results": len(users),
+	}))
+
+	return users, nil
+}
+
+// DisableUser stops the user from logging in and revokes every token issued
+// to them.
+func (s *AdminServiceImpl) DisableUser(ctx context.Context, actor audit.Actor, userID int32) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.DisableUser")
+	defer span.End()
+
+	if actor.UserID == userID {
+		return nil, user.ErrCannotModerateSelf
+	}
+
+	res, err := s.userRepo.SetUserDisabled(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID); err != nil {
+		return nil, err
+	}
+
+	disabled := newUserModerationEvent(audit.EventAdminUserDisabled, userID)
+	disabled.Diff.Add("disabled", false, true)
+	s.record(ctx, actor, disabled)
+
+	return res, nil
+}
+
+func (s *AdminServiceImpl) EnableUser(ctx context.Context, actor audit.Actor, userID int32) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.EnableUser")
+	defer span.End()
+
+	res, err := s.userRepo.SetUserDisabled(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := newUserModerationEvent(audit.EventAdminUserEnabled, userID)
+	enabled.Diff.Add("disabled", true, false)
+	s.record(ctx, actor, enabled)
+
+	return res, nil
+}
+
+// LogoutUser revokes every token issued to the user, they can log in again
+// straight away.
+func (s *AdminServiceImpl) LogoutUser(ctx context.Context, actor audit.Actor, userID int32) error {
+	ctx, span := tracing.Start(ctx, "AdminService.LogoutUser")
+	defer span.End()
+
+	if _, err := s.userRepo.SelectUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, actor, newUserModerationEvent(audit.EventAdminUserLoggedOut, userID))
+
+	return nil
+}
+
+// SetUserRole changes what the user is authorized to do. Access tokens carry
+// the role they were issued with, so the user's tokens are revoked.
+func (s *AdminServiceImpl) SetUserRole(
+	ctx context.Context,
+	actor audit.Actor,
+	userID int32,
+	role user.Role,
+) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SetUserRole")
+	defer span.End()
+
+	// an administrator demoting themselves could leave nobody to undo it
+	if actor.UserID == userID {
+		return nil, user.ErrCannotModerateSelf
+	}
+
+	current, err := s.userRepo.SelectUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.userRepo.SetUserRole(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID); err != nil {
+		return nil, err
+	}
+
+	roleSet := newUserModerationEvent(audit.EventAdminUserRoleSet, userID)
+	roleSet.Diff.Add("role", string(current.Role), string(res.Role))
+	s.record(ctx, actor, roleSet)
+
+	return res, nil
+}
+
+// SetUserPlan moves the user's personal workspace to the plan.
+func (s *AdminServiceImpl) SetUserPlan(
+	ctx context.Context,
+	actor audit.Actor,
+	userID int32,
+	planName string,
+) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SetUserPlan")
+	defer span.End()
+
+	current, err := s.quotas.GetUserUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.quotas.SetUserPlan(ctx, userID, planName)
+	if err != nil {
+		return nil, err
+	}
+
+	planSet := newUserModerationEvent(audit.EventAdminUserPlanSet, userID)
+	planSet.Diff.Add("plan", current.Plan.Name, res.Plan.Name)
+	s.record(ctx, actor, planSet)
+
+	return res, nil
+}
+
+// SetWorkspacePlan moves the workspace to the plan, every member shares it.
+func (s *AdminServiceImpl) SetWorkspacePlan(
+	ctx context.Context,
+	actor audit.Actor,
+	workspaceID int32,
+	planName string,
+) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SetWorkspacePlan")
+	defer span.End()
+
+	current, err := s.quotas.GetWorkspaceUsage(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.quotas.SetWorkspacePlan(ctx, workspaceID, planName)
+	if err != nil {
+		return nil, err
+	}
+
+	planSet := audit.NewCreateEventRequest(audit.EventAdminWorkspacePlanSet, 0, "", nil)
+	planSet.Target = audit.NewTarget(audit.TargetWorkspace, strconv.Itoa(int(workspaceID)))
+	planSet.Diff.Add("plan", current.Plan.Name, res.Plan.Name)
+	s.record(ctx, actor, planSet)
+
+	return res, nil
+}
+
+func (s *AdminServiceImpl) ListURLs(
+	ctx context.Context,
+	actor audit.Actor,
+	request shorturl.ListURLsRequest,
+) ([]shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListURLs")
+	defer span.End()
+
+	urls, err := s.urlRepo.SearchURLs(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, actor, audit.NewCreateEventRequest(audit.EventAdminURLsListed, actor.UserID, "", map[string]any{
+		"query":   request.Query,
+		"limit":   request.Limit,
+		"offset":  request.Offset,
+		"results": len(urls),
+	}))
+
+	return urls, nil
+}
+
+// DisableURL takes a URL down without deleting it and evicts it from the
+// cache, visitors get 451 or 410 depending on the reason.
+func (s *AdminServiceImpl) DisableURL(
+	ctx context.Context,
+	actor audit.Actor,
+	request shorturl.DisableURLRequest,
+) (*shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.DisableURL")
+	defer span.End()
+
+	res, err := s.urlRepo.SetURLDisabled(ctx, request.ShortURL, request.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cacheRepo.DeleteURL(ctx, res.ShortURL); err != nil {
+		// the cached entry keeps redirecting until it expires
+		logging.FromContext(ctx).Warn("could not evict disabled url from the cache", "short_url", res.ShortURL, "error", err)
+	}
+
+	disabled := newURLModerationEvent(audit.EventAdminURLDisabled, res)
+	disabled.Details["reason"] = request.Reason
+	disabled.Diff.Add("disabled", false, true)
+	s.record(ctx, actor, disabled)
+
+	return res, nil
+}
+
+func (s *AdminServiceImpl) EnableURL(ctx context.Context, actor audit.Actor, shortURL string) (*shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.EnableURL")
+	defer span.End()
+
+	res, err := s.urlRepo.SetURLDisabled(ctx, shortURL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := newURLModerationEvent(audit.EventAdminURLEnabled, res)
+	enabled.Diff.Add("disabled", true, false)
+	s.record(ctx, actor, enabled)
+
+	return res, nil
+}
+
+// ListAuditEvents searches the audit log, reading it is audited as well.
+func (s *AdminServiceImpl) ListAuditEvents(
+	ctx context.Context,
+	actor audit.Actor,
+	request audit.ListEventsRequest,
+) ([]audit.Event, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListAuditEvents")
+	defer span.End()
+
+	events, err := s.audit.ListEvents(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, actor, audit.NewCreateEventRequest(audit.EventAdminAuditListed, actor.UserID, "", map[string]any{
+		"user_id":  request.UserID,
+		"actor_id": request.ActorID,
+		"type":     request.Type,
+		"limit":    request.Limit,
+		"offset":   request.Offset,
+		"results":  len(events),
+	}))
+
+	return events, nil
+}
+
+// VerifyAuditChain checks that no event in the audit log was changed or
+// removed, tampering is logged as a security event.
+func (s *AdminServiceImpl) VerifyAuditChain(ctx context.Context, actor audit.Actor) (*audit.ChainVerification, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.VerifyAuditChain")
+	defer span.End()
+
+	verification, err := s.audit.VerifyChain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !verification.Intact() {
+		logging.FromContext(ctx).Warn("security event: audit log chain is broken", "event_id", verification.FirstBrokenID)
+	}
+
+	s.record(ctx, actor, audit.NewCreateEventRequest(audit.EventAdminAuditVerified, actor.UserID, "", map[string]any{
+		"events":          verification.Events,
+		"first_broken_id": verification.FirstBrokenID,
+	}))
+
+	return verification, nil
+}
+
+// record stores an event caused by actor, moderation events are about the
+// user who was moderated or who owns the moderated URL.
+func (s *AdminServiceImpl) record(ctx context.Context, actor audit.Actor, request *audit.CreateEventRequest) {
+	request.ActorID = actor.UserID
+	request.IPAddress = actor.IPAddress
+
+	s.audit.Record(ctx, *request)
+}
+
+func newUserModerationEvent(eventType audit.EventType, userID int32) *audit.CreateEventRequest {
+	request := audit.NewCreateEventRequest(eventType, userID, "", nil)
+	request.Target = audit.NewUserTarget(userID)
+
+	return request
+}
+
+func newURLModerationEvent(eventType audit.EventType, url *shorturl.URL) *audit.CreateEventRequest {
+	request := audit.NewCreateEventRequest(eventType, url.UserID, "", nil)
+	request.Target = audit.NewTarget(audit.TargetURL, url.ShortURL)
+
+	return request
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type AuditService interface {
+	Record(ctx context.Context, request audit.CreateEventRequest)
+	ListUserEvents(ctx context.Context, userID, limit, offset int32) ([]audit.Event, error)
+	ListEvents(ctx context.Context, request audit.ListEventsRequest) ([]audit.Event, error)
+	VerifyChain(ctx context.Context) (*audit.ChainVerification, error)
+}
+
+type AuditServiceImpl struct {
+	auditRepo repository.AuditRepository
+}
+
+func NewAuditServiceImpl(a repository.AuditRepository) *AuditServiceImpl {
+	return &AuditServiceImpl{
+		auditRepo: a,
+	}
+}
+
+// user agents longer than this are cut short, the column holds no more
+const maxUserAgentLength = 512
+
+// Record stores an audit event. A failure to store it is logged along with
+// the event rather than failing the action it describes. The event is stored
+// even when the client has gone away, the action it describes already
+// happened.
+func (s *AuditServiceImpl) Record(ctx context.Context, request audit.CreateEventRequest) {
+	ctx, span := tracing.Start(context.WithoutCancel(ctx), "AuditService.Record")
+	defer span.End()
+
+	client := audit.ClientFromContext(ctx)
+
+	if request.IPAddress == "" {
+		request.IPAddress = client.IPAddress
+	}
+
+	if request.UserAgent == "" {
+		request.UserAgent = client.UserAgent
+	}
+
+	if len(request.UserAgent) > maxUserAgentLength {
+		request.UserAgent = request.UserAgent[:maxUserAgentLength]
+	}
+
+	_, err := s.auditRepo.CreateAuditEvent(ctx, request)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not record audit event", "event_type", request.Type, "error", err)
+	}
+}
+
+// ListUserEvents lists the events about a user, newest first.
+func (s *AuditServiceImpl) ListUserEvents(ctx context.Context, userID, limit, offset int32) ([]audit.Event, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListUserEvents")
+	defer span.End()
+
+	return s.auditRepo.ListUserAuditEvents(ctx, userID, limit, offset)
+}
+
+// ListEvents searches every event, newest first.
+func (s *AuditServiceImpl) ListEvents(ctx context.Context, request audit.ListEventsRequest) ([]audit.Event, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListEvents")
+	defer span.End()
+
+	return s.auditRepo.SearchAuditEvents(ctx, request)
+}
+
+func (s *AuditServiceImpl) VerifyChain(ctx context.Context) (*audit.ChainVerification, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyChain")
+	defer span.End()
+
+	return s.auditRepo.VerifyAuditChain(ctx)
+}
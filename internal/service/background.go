@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"url-short/internal/logging"
+)
+
+// Background runs work a request starts but should not wait for, such as
+// sending email. Tasks outlive the request that started them, Wait lets the
+// application drain them while it shuts down.
+type Background struct {
+	tasks sync.WaitGroup
+}
+
+func NewBackground() *Background {
+	return &Background{}
+}
+
+// Go runs task with a context that keeps ctx's values but is not cancelled
+// along with it, errors are logged as the request has been answered already.
+func (b *Background) Go(ctx context.Context, name string, task func(ctx context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+
+	b.tasks.Add(1)
+	go func() {
+		defer b.tasks.Done()
+
+		if err := task(ctx); err != nil {
+			logging.FromContext(ctx).Error("background task failed", "task", name, "error", err)
+		}
+	}()
+}
+
+// Wait blocks until every task has finished or ctx is done.
+func (b *Background) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		b.tasks.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return errors.New("background tasks did not finish in time")
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type bufferedClick struct {
+	shortURL string
+	day      time.Time
+}
+
+// ClickBuffer adds up redirects in memory so following a link does not write
+// to Postgres, Flush stores the totals per link and UTC day. Clicks that have
+// not been flushed are lost if the process dies, the application flushes the
+// buffer once more while it shuts down.
+type ClickBuffer struct {
+	urlRepo repository.URLRepository
+
+	mu     sync.Mutex
+	clicks map[bufferedClick]int64
+}
+
+func NewClickBuffer(r repository.URLRepository) *ClickBuffer {
+	return &ClickBuffer{
+		urlRepo: r,
+		clicks:  map[bufferedClick]int64{},
+	}
+}
+
+// Add counts a redirect through the short URL at towards its UTC day.
+func (b *ClickBuffer) Add(shortURL string, at time.Time) {
+	click := bufferedClick{shortURL: shortURL, day: at.UTC().Truncate(24 * time.Hour)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clicks[click]++
+}
+
+// Flush stores the clicks added since the last flush and returns how many
+// were stored. Totals that could not be stored are put back for the next
+// flush, their errors are returned together.
+func (b *ClickBuffer) Flush(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ClickBuffer.Flush")
+	defer span.End()
+
+	b.mu.Lock()
+	clicks := b.clicks
+	b.clicks = map[bufferedClick]int64{}
+	b.mu.Unlock()
+
+	stored := int64(0)
+	var errs []error
+	for click, count := range clicks {
+		if err := b.urlRepo.RecordClicks(ctx, click.shortURL, click.day, count); err != nil {
+			errs = append(errs, fmt.Errorf("short url %s: %w", click.shortURL, err))
+			b.putBack(click, count)
+			continue
+		}
+
+		stored += count
+	}
+
+	return stored, errors.Join(errs...)
+}
+
+func (b *ClickBuffer) putBack(click bufferedClick, count int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clicks[click] += count
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/mailer"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type EmailVerificationService interface {
+	SendVerificationEmail(ctx context.Context, u *user.User) error
+	VerifyEmail(ctx context.Context, request user.VerifyEmailRequest) (*user.User, error)
+	ResendVerificationEmail(ctx context.Context, request user.ResendVerificationRequest) error
+}
+
+const (
+	emailVerificationTokenLifetime = 24 * time.Hour
+	emailVerificationWindow        = 1 * time.Hour
+	emailVerificationLimitPerEmail = 3
+	emailVerificationLimitPerIP    = 10
+)
+
+type EmailVerificationServiceImpl struct {
+	userRepo         repository.UserRepository
+	verificationRepo repository.EmailVerificationRepository
+	attemptCounter   repository.AttemptCounterRepository
+	mailer           mailer.Mailer
+	background       *Background
+	verifyURL        string
+}
+
+// NewEmailVerificationServiceImpl sends verification tokens as a token query
+// parameter on verifyURL, the page at that URL is expected to post the token
+// back to the verify endpoint.
+func NewEmailVerificationServiceImpl(
+	u repository.UserRepository,
+	v repository.EmailVerificationRepository,
+	a repository.AttemptCounterRepository,
+	m mailer.Mailer,
+	b *Background,
+	verifyURL string,
+) *EmailVerificationServiceImpl {
+	return &EmailVerificationServiceImpl{
+		userRepo:         u,
+		verificationRepo: v,
+		attemptCounter:   a,
+		mailer:           m,
+		background:       b,
+		verifyURL:        verifyURL,
+	}
+}
+
+func (s *EmailVerificationServiceImpl) SendVerificationEmail(ctx context.Context, u *user.User) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.SendVerificationEmail")
+	defer span.End()
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	createRequest := user.NewCreateEmailVerificationTokenRequest(
+		u.Id,
+		u.Email,
+		token,
+		time.Now().Add(emailVerificationTokenLifetime),
+	)
+
+	_, err = s.verificationRepo.CreateEmailVerificationToken(ctx, *createRequest)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("token", token)
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      u.Email,
+		Subject: "Verify your url-short email address",
+		Body: fmt.Sprintf(
+			"Use the link below within %d hours to verify this email address for your url-short account:\n\n%s\n\n"+
+				"If you did not sign up or change your email you can ignore this email.",
+			int(emailVerificationTokenLifetime.Hours()),
+			s.verifyURL+"?"+query.Encode(),
+		),
+	})
+}
+
+// VerifyEmail spends the token and verifies the address it was sent to, a
+// token for an address the user has since changed away from is invalid.
+func (s *EmailVerificationServiceImpl) VerifyEmail(
+	ctx context.Context,
+	request user.VerifyEmailRequest,
+) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.VerifyEmail")
+	defer span.End()
+
+	token, err := s.verificationRepo.ConsumeEmailVerificationToken(ctx, request.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedUser, err := s.userRepo.MarkUserEmailVerified(ctx, token.UserID, token.Email)
+	if err == user.ErrUserNotFound {
+		return nil, user.ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return verifiedUser, nil
+}
+
+// ResendVerificationEmail sends a new verification link when the address
+// belongs to an unverified user. Other addresses and addresses over their
+// limit are silently ignored so the caller can not tell which addresses have
+// an account. Looking up the address and sending the email happen in the
+// background for every address, so the response time does not tell either.
+func (s *EmailVerificationServiceImpl) ResendVerificationEmail(
+	ctx context.Context,
+	request user.ResendVerificationRequest,
+) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.ResendVerificationEmail")
+	defer span.End()
+
+	if s.isOverLimit(ctx, "email-verification:ip:"+request.ClientIP, emailVerificationLimitPerIP) {
+		return user.ErrTooManyVerificationRequests
+	}
+
+	if s.isOverLimit(ctx, "email-verification:email:"+user.HashToken(request.NormalizedEmail()), emailVerificationLimitPerEmail) {
+		return nil
+	}
+
+	s.background.Go(ctx, "resend email verification", func(ctx context.Context) error {
+		return s.resendVerificationEmail(ctx, request)
+	})
+
+	return nil
+}
+
+func (s *EmailVerificationServiceImpl) resendVerificationEmail(
+	ctx context.Context,
+	request user.ResendVerificationRequest,
+) error {
+	unverifiedUser, err := s.userRepo.SelectUser(ctx, request.Email)
+	if err == user.ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if unverifiedUser.IsEmailVerified() {
+		return nil
+	}
+
+	return s.SendVerificationEmail(ctx, unverifiedUser)
+}
+
+func (s *EmailVerificationServiceImpl) isOverLimit(ctx context.Context, key string, limit int64) bool {
+	attempts, err := s.attemptCounter.IncrementAttempts(ctx, key, emailVerificationWindow)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not count email verification attempts", "error", err)
+		return false
+	}
+
+	return attempts > limit
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/idempotency"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+)
+
+// idempotencyReservation is how long a key stays reserved for a request that
+// has not been answered, so a key is not held for the whole retention when
+// the process dies while answering.
+const idempotencyReservation = time.Minute
+
+// IdempotencyKeys lets clients retry requests safely. The first request made
+// with a key is processed and its response is replayed to later requests
+// with the same key. When Redis can not be reached requests are processed as
+// if they carried no key.
+type IdempotencyKeys struct {
+	repo repository.IdempotencyRepository
+}
+
+func NewIdempotencyKeys(r repository.IdempotencyRepository) *IdempotencyKeys {
+	return &IdempotencyKeys{
+		repo: r,
+	}
+}
+
+// Begin reserves the key for the request. It returns the stored record when
+// a request with the same key was already answered, and nil when the request
+// should be processed.
+func (k *IdempotencyKeys) Begin(
+	ctx context.Context,
+	userID int32,
+	key string,
+	fingerprint string,
+) (*idempotency.Record, error) {
+	if err := idempotency.ValidateKey(key); err != nil {
+		return nil, err
+	}
+
+	stored, err := k.repo.ReserveIdempotencyKey(
+		ctx,
+		userID,
+		key,
+		idempotency.Record{Fingerprint: fingerprint},
+		idempotencyReservation,
+	)
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not reserve idempotency key, processing the request without it", "error", err)
+		return nil, nil
+	}
+
+	if stored == nil {
+		return nil, nil
+	}
+
+	if stored.Fingerprint != fingerprint {
+		return nil, idempotency.ErrKeyReused
+	}
+
+	if !stored.Completed {
+		return nil, idempotency.ErrRequestInProgress
+	}
+
+	return stored, nil
+}
+
+// Complete stores the response to the request that reserved the key when it
+// is final, a success or a conflict with the state the request ran against.
+// Any other response may be different on a retry, for example after the user
+// verifies their email or after a server error, so instead of being stored it
+// releases the key for the request to be retried.
+func (k *IdempotencyKeys) Complete(
+	ctx context.Context,
+	userID int32,
+	key string,
+	fingerprint string,
+	status int,
+	contentType string,
+	body []byte,
+) {
+	var err error
+
+	if !isFinalStatus(status) {
+		err = k.repo.ReleaseIdempotencyKey(ctx, userID, key)
+	} else {
+		err = k.repo.SaveIdempotencyRecord(ctx, userID, key, idempotency.Record{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      status,
+			ContentType: contentType,
+			Body:        body,
+		}, idempotency.Retention)
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not store idempotent response", "error", err)
+	}
+}
+
+func isFinalStatus(status int) bool {
+	if status >= 200 && status < 300 {
+		return true
+	}
+
+	return status == http.StatusConflict || status == http.StatusUnprocessableEntity
+}
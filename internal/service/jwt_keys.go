@@ -0,0 +1,333 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidPEMKey            = errors.New("could not parse pem encoded key")
+	ErrUnsupportedSigningKey    = errors.New("unsupported jwt signing key, use an RSA (2048 bit or larger) or Ed25519 key")
+	ErrUnknownVerificationKey   = errors.New("token was not signed by a known key")
+	ErrUnexpectedSigningMethod  = errors.New("token signing method does not match its key")
+	ErrNoJWTSigningKeyAvailable = errors.New("no jwt signing key or secret configured")
+)
+
+const minimumRSAKeyBits = 2048
+
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// JWTKeys holds the key used to sign new tokens and every key that tokens are
+// still accepted from. Asymmetric keys are identified by the RFC 7638
+// thumbprint of their public key, sent as the kid header, so a key can be
+// rotated by adding the new signing key while keeping the old public key as a
+// verification key until the tokens it signed have expired.
+type JWTKeys struct {
+	signing      *jwtKey
+	verification map[string]*jwtKey
+	hmacSecret   []byte
+}
+
+// NewHMACJWTKeys signs and verifies tokens with a shared HS256 secret.
+func NewHMACJWTKeys(secret string) *JWTKeys {
+	return &JWTKeys{
+		signing: &jwtKey{
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(secret),
+			verifyKey: []byte(secret),
+		},
+		verification: map[string]*jwtKey{},
+		hmacSecret:   []byte(secret),
+	}
+}
+
+// NewJWTKeys signs tokens with the PEM encoded RSA or Ed25519 private key and
+// verifies tokens signed by it or by any of the PEM encoded verification keys.
+// When hmacSecret is not empty HS256 tokens without a kid are still accepted,
+// which allows moving off a shared secret without logging everyone out.
+func NewJWTKeys(signingKeyPEM []byte, verificationKeyPEMs [][]byte, hmacSecret string) (*JWTKeys, error) {
+	signing, err := parsePrivateJWTKey(signingKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &JWTKeys{
+		signing: signing,
+		verification: map[string]*jwtKey{
+			signing.id: signing,
+		},
+	}
+
+	for _, verificationKeyPEM := range verificationKeyPEMs {
+		key, err := parsePublicJWTKey(verificationKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+
+		keys.verification[key.id] = key
+	}
+
+	if hmacSecret != "" {
+		keys.hmacSecret = []byte(hmacSecret)
+	}
+
+	return keys, nil
+}
+
+func (k *JWTKeys) Sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return "", ErrNoJWTSigningKeyAvailable
+	}
+
+	token := jwt.NewWithClaims(k.signing.method, claims)
+
+	if k.signing.id != "" {
+		token.Header["kid"] = k.signing.id
+	}
+
+	return token.SignedString(k.signing.signKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token, refusing any
+// token whose alg header does not match the algorithm of the selected key.
+func (k *JWTKeys) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if kid == "" {
+		if k.hmacSecret != nil && token.Method == jwt.SigningMethodHS256 {
+			return k.hmacSecret, nil
+		}
+
+		return nil, ErrUnknownVerificationKey
+	}
+
+	key, found := k.verification[kid]
+	if !found {
+		return nil, ErrUnknownVerificationKey
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrUnexpectedSigningMethod
+	}
+
+	return key.verifyKey, nil
+}
+
+func (k *JWTKeys) ValidMethods() []string {
+	methods := []string{}
+	seen := map[string]bool{}
+
+	for _, key := range k.verification {
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			methods = append(methods, key.method.Alg())
+		}
+	}
+
+	if k.hmacSecret != nil && !seen[jwt.SigningMethodHS256.Alg()] {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	return methods
+}
+
+// JSONWebKey is the public half of a verification key as described by RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// PublicKeys returns every asymmetric verification key, the shared HS256
+// secret is never published.
+func (k *JWTKeys) PublicKeys() []JSONWebKey {
+	publicKeys := []JSONWebKey{}
+
+	for _, key := range k.verification {
+		jwk := newJSONWebKey(key.verifyKey)
+		jwk.KeyID = key.id
+		jwk.Use = "sig"
+		jwk.Algorithm = key.method.Alg()
+
+		publicKeys = append(publicKeys, jwk)
+	}
+
+	sort.Slice(publicKeys, func(i, j int) bool {
+		return publicKeys[i].KeyID < publicKeys[j].KeyID
+	})
+
+	return publicKeys
+}
+
+func newJSONWebKey(publicKey any) JSONWebKey {
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(publicKey),
+		}
+	}
+
+	return JSONWebKey{}
+}
+
+// jwkThumbprint implements RFC 7638, the members are marshalled in
+// lexicographic order as the RFC requires.
+func jwkThumbprint(publicKey any) (string, error) {
+	jwk := newJSONWebKey(publicKey)
+
+	var members any
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	default:
+		return "", ErrUnsupportedSigningKey
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+func parsePrivateJWTKey(data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	var privateKey any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrInvalidPEMKey
+	}
+
+	if err != nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedSigningKey
+	}
+
+	key, err := newAsymmetricJWTKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	key.signKey = signer
+
+	return key, nil
+}
+
+// parsePublicJWTKey accepts public keys as well as private keys, so a retired
+// signing key file can be moved straight into the verification key list.
+func parsePublicJWTKey(data []byte) (*jwtKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	var publicKey any
+	var err error
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY", "PRIVATE KEY":
+		key, err := parsePrivateJWTKey(data)
+		if err != nil {
+			return nil, err
+		}
+
+		key.signKey = nil
+
+		return key, nil
+	default:
+		return nil, ErrInvalidPEMKey
+	}
+
+	if err != nil {
+		return nil, ErrInvalidPEMKey
+	}
+
+	return newAsymmetricJWTKey(publicKey)
+}
+
+func newAsymmetricJWTKey(publicKey any) (*jwtKey, error) {
+	var method jwt.SigningMethod
+
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		if publicKey.N.BitLen() < minimumRSAKeyBits {
+			return nil, ErrUnsupportedSigningKey
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedSigningKey
+	}
+
+	kid, err := jwkThumbprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwtKey{
+		id:        kid,
+		method:    method,
+		verifyKey: publicKey,
+	}, nil
+}
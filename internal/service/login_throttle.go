@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+)
+
+const (
+	loginFailureWindow = 1 * time.Hour
+	maxLoginDelay      = 30 * time.Second
+)
+
+// loginLimit slows down logins for a key once delayAfter failures are in the
+// window, doubling the wait with every further failure, and locks the key
+// out once lockAfter failures are in the window.
+type loginLimit struct {
+	delayAfter int64
+	lockAfter  int64
+	lockout    time.Duration
+}
+
+var (
+	accountLoginLimit = loginLimit{delayAfter: 5, lockAfter: 10, lockout: 15 * time.Minute}
+	ipLoginLimit      = loginLimit{delayAfter: 20, lockAfter: 50, lockout: 15 * time.Minute}
+)
+
+func (l loginLimit) wait(failures int64) time.Duration {
+	if failures >= l.lockAfter {
+		return l.lockout
+	}
+
+	if failures < l.delayAfter {
+		return 0
+	}
+
+	delay := time.Second << (failures - l.delayAfter)
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+
+	return delay
+}
+
+// LoginThrottle tracks failed logins per account and per client IP. When
+// Redis can not be reached logins are not throttled.
+type LoginThrottle struct {
+	attemptRepo repository.LoginAttemptRepository
+	audit       AuditService
+}
+
+func NewLoginThrottle(a repository.LoginAttemptRepository, s AuditService) *LoginThrottle {
+	return &LoginThrottle{
+		attemptRepo: a,
+		audit:       s,
+	}
+}
+
+func accountLoginKey(request user.LoginUserRequest) string {
+	return "account:" + user.HashToken(request.NormalizedEmail())
+}
+
+func ipLoginKey(request user.LoginUserRequest) string {
+	return "ip:" + request.ClientIP
+}
+
+// Check refuses the login while the account or the client IP is locked.
+func (t *LoginThrottle) Check(ctx context.Context, request user.LoginUserRequest) error {
+	now := time.Now()
+	retryAfter := time.Duration(0)
+
+	for _, key := range []string{accountLoginKey(request), ipLoginKey(request)} {
+		lockedUntil, err := t.attemptRepo.GetLoginsLockedUntil(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).Warn("could not read login lockout, allowing login", "error", err)
+			return nil
+		}
+
+		if lockedUntil.Sub(now) > retryAfter {
+			retryAfter = lockedUntil.Sub(now)
+		}
+	}
+
+	if retryAfter > 0 {
+		return &user.LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login, userID is zero when the email does not
+// belong to a user.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, request user.LoginUserRequest, userID int32) {
+	t.recordFailure(ctx, request, accountLoginKey(request), accountLoginLimit, userID, audit.EventLoginLocked)
+	t.recordFailure(ctx, request, ipLoginKey(request), ipLoginLimit, 0, audit.EventLoginIPLocked)
+}
+
+func (t *LoginThrottle) recordFailure(
+	ctx context.Context,
+	request user.LoginUserRequest,
+	key string,
+	limit loginLimit,
+	userID int32,
+	lockEvent audit.EventType,
+) {
+	now := time.Now()
+
+	failures, err := t.attemptRepo.RecordFailedLogin(ctx, key, now, loginFailureWindow)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not record failed login", "error", err)
+		return
+	}
+
+	wait := limit.wait(failures)
+	if wait == 0 {
+		return
+	}
+
+	if err := t.attemptRepo.LockLogins(ctx, key, now.Add(wait)); err != nil {
+		logging.FromContext(ctx).Error("could not lock logins", "error", err)
+		return
+	}
+
+	if failures == limit.lockAfter {
+		t.audit.Record(ctx, *audit.NewCreateEventRequest(lockEvent, userID, request.ClientIP, map[string]any{
+			"failed_attempts": failures,
+			"locked_until":    now.Add(wait).UTC(),
+		}))
+	}
+}
+
+// RecordSuccess resets the account's failures, the client IP keeps its
+// failures as it may be guessing many accounts.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, request user.LoginUserRequest, userID int32) {
+	failures, err := t.attemptRepo.ClearFailedLogins(ctx, accountLoginKey(request), time.Now(), loginFailureWindow)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not clear failed logins", "error", err)
+		return
+	}
+
+	if failures >= accountLoginLimit.lockAfter {
+		t.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventLoginUnlocked, userID, request.ClientIP, map[string]any{
+			"failed_attempts": failures,
+		}))
+	}
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/metrics"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type OIDCService interface {
+	StartLogin(ctx context.Context, provider string) (string, error)
+	CompleteLogin(ctx context.Context, request user.OIDCCallbackRequest) (*user.User, error)
+}
+
+const oidcLoginStateLifetime = 10 * time.Minute
+
+type OIDCProviderConfig struct {
+	Name                string
+	Issuer              string
+	ClientID            string
+	ClientSecret        string
+	RedirectURL         string
+	Scopes              []string
+	AllowedEmailDomains []string
+}
+
+// OIDCProvider is an OpenID Connect identity provider users can sign in
+// with. The provider's discovery document is fetched on first use, so the
+// service still starts while a provider is unreachable.
+type OIDCProvider struct {
+	config OIDCProviderConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(c OIDCProviderConfig) *OIDCProvider {
+	return &OIDCProvider{
+		config: c,
+	}
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.verifier != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	// the provider keeps using this context to refresh its signing keys so it
+	// must outlive the request that triggered discovery
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), p.config.Issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+
+	return p.oauth, p.verifier, nil
+}
+
+func (p *OIDCProvider) allowsEmail(email string) bool {
+	if len(p.config.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := email[at+1:]
+	for _, allowed := range p.config.AllowedEmailDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type oidcIDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+type OIDCServiceImpl struct {
+	providers        map[string]*OIDCProvider
+	userService      UserService
+	userRepo         repository.UserRepository
+	identityRepo     repository.IdentityRepository
+	scimRepo         repository.SCIMRepository
+	stateRepo        repository.OIDCStateRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	denylist         *AccessTokenDenylist
+	passwords        *user.Passwords
+}
+
+func NewOIDCServiceImpl(
+	p []*OIDCProvider,
+	s UserService,
+	u repository.UserRepository,
+	i repository.IdentityRepository,
+	sc repository.SCIMRepository,
+	st repository.OIDCStateRepository,
+	t repository.RefreshTokenRepository,
+	d *AccessTokenDenylist,
+	pw *user.Passwords,
+) *OIDCServiceImpl {
+	providers := map[string]*OIDCProvider{}
+	for _, provider := range p {
+		providers[provider.config.Name] = provider
+	}
+
+	return &OIDCServiceImpl{
+		providers:        providers,
+		userService:      s,
+		userRepo:         u,
+		identityRepo:     i,
+		scimRepo:         sc,
+		stateRepo:        st,
+		refreshTokenRepo: t,
+		denylist:         d,
+		passwords:        pw,
+	}
+}
+
+// StartLogin returns the URL to send the user to at the identity provider.
+// The request is bound to this sign in by its state, nonce and PKCE verifier.
+func (s *OIDCServiceImpl) StartLogin(ctx context.Context, providerName string) (string, error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.StartLogin")
+	defer span.End()
+
+	provider, found := s.providers[providerName]
+	if !found {
+		return "", user.ErrUnknownOIDCProvider
+	}
+
+	oauthConfig, _, err := provider.discover(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not discover identity provider", "provider", providerName, "error", err)
+		return "", user.ErrUnexpectedError
+	}
+
+	state, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.stateRepo.SaveOIDCState(ctx, state, user.OIDCLoginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}, oidcLoginStateLifetime)
+	if err != nil {
+		return "", err
+	}
+
+	return oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// CompleteLogin exchanges the code the identity provider sent the user back
+// with for their identity and logs in the user it belongs to, creating or
+// linking a user by email the first time the identity is seen.
+func (s *OIDCServiceImpl) CompleteLogin(ctx context.Context, request user.OIDCCallbackRequest) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.CompleteLogin")
+	defer span.End()
+
+	provider, found := s.providers[request.Provider]
+	if !found {
+		return nil, user.ErrUnknownOIDCProvider
+	}
+
+	loginState, err := s.stateRepo.ConsumeOIDCState(ctx, request.State)
+	if err != nil {
+		return nil, err
+	}
+
+	if loginState.Provider != request.Provider {
+		return nil, user.ErrInvalidOIDCState
+	}
+
+	oauthConfig, verifier, err := provider.discover(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not discover identity provider", "provider", request.Provider, "error", err)
+		return nil, user.ErrUnexpectedError
+	}
+
+	token, err := oauthConfig.Exchange(ctx, request.Code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not exchange code with identity provider", "provider", request.Provider, "error", err)
+		return nil, user.ErrOIDCLoginFailed
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, user.ErrOIDCLoginFailed
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not verify id token from identity provider", "provider", request.Provider, "error", err)
+		return nil, user.ErrOIDCLoginFailed
+	}
+
+	if idToken.Nonce != loginState.Nonce {
+		return nil, user.ErrOIDCLoginFailed
+	}
+
+	claims := oidcIDTokenClaims{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, user.ErrOIDCLoginFailed
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, user.ErrOIDCEmailNotVerified
+	}
+
+	if !provider.allowsEmail(claims.Email) {
+		return nil, user.ErrOIDCEmailDomainNotAllowed
+	}
+
+	userID, err := s.resolveIdentity(ctx, request.Provider, idToken.Subject, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userService.LoginExternalUser(ctx, userID)
+}
+
+func (s *OIDCServiceImpl) resolveIdentity(ctx context.Context, provider, subject, email string) (int32, error) {
+	identity, err := s.identityRepo.SelectIdentity(ctx, provider, subject)
+	if err == nil {
+		return identity.UserID, nil
+	}
+
+	if err != user.ErrIdentityNotFound {
+		return 0, err
+	}
+
+	linkedUser, err := s.provisionUser(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+
+	identityRequest := user.NewCreateIdentityRequest(linkedUser.Id, provider, subject, email)
+
+	identity, err = s.identityRepo.CreateIdentity(ctx, *identityRequest)
+	if err == user.ErrIdentityAlreadyLinked {
+		// a concurrent sign in with the same identity linked it first
+		identity, err = s.identityRepo.SelectIdentity(ctx, provider, subject)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return identity.UserID, nil
+}
+
+// provisionUser returns the user with the email the identity provider
+// verified, creating one when there is none. A user who never verified the
+// email may have been created by someone else, so their password and tokens
+// are discarded before the identity is linked to them. Users managed by a
+// workspace's directory are never linked, the directory can change their
+// email to any address and back again.
+func (s *OIDCServiceImpl) provisionUser(ctx context.Context, email string) (*user.User, error) {
+	existing, err := s.userRepo.SelectUser(ctx, email)
+	if err == user.ErrUserNotFound {
+		return s.createExternalUser(ctx, email)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	managed, err := s.scimRepo.IsManagedUser(ctx, existing.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if managed {
+		return nil, user.ErrOIDCUserManaged
+	}
+
+	if existing.IsEmailVerified() {
+		return existing, nil
+	}
+
+	randomPasswordHash, err := s.passwords.RandomHash()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.userRepo.UpdateUserPassword(ctx, existing.Id, randomPasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, existing.Id); err != nil {
+		return nil, err
+	}
+
+	return s.userRepo.MarkUserEmailVerified(ctx, existing.Id, existing.Email)
+}
+
+// createExternalUser creates a user that can only sign in through identity
+// providers until they reset their password.
+func (s *OIDCServiceImpl) createExternalUser(ctx context.Context, email string) (*user.User, error) {
+	randomPasswordHash, err := s.passwords.RandomHash()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.userRepo.CreateUser(ctx, email, randomPasswordHash)
+	if err == user.ErrDuplicateUSer {
+		// a concurrent sign in created the user first
+		return s.userRepo.SelectUser(ctx, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.UsersRegistered.WithLabelValues(metrics.RegistrationOIDC).Inc()
+
+	return s.userRepo.MarkUserEmailVerified(ctx, created.Id, created.Email)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/mailer"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type PasswordResetService interface {
+	RequestPasswordReset(ctx context.Context, request user.PasswordResetRequest) error
+	ConfirmPasswordReset(ctx context.Context, request user.ConfirmPasswordResetRequest) error
+}
+
+const (
+	passwordResetTokenLifetime = 30 * time.Minute
+	passwordResetWindow        = 1 * time.Hour
+	passwordResetLimitPerEmail = 3
+	passwordResetLimitPerIP    = 10
+)
+
+type PasswordResetServiceImpl struct {
+	userRepo          repository.UserRepository
+	passwordResetRepo repository.PasswordResetRepository
+	refreshTokenRepo  repository.RefreshTokenRepository
+	attemptCounter    repository.AttemptCounterRepository
+	denylist          *AccessTokenDenylist
+	mailer            mailer.Mailer
+	audit             AuditService
+	background        *Background
+	passwords         *user.Passwords
+	resetURL          string
+}
+
+// NewPasswordResetServiceImpl sends reset tokens as a token query parameter
+// on resetURL, the page at that URL is expected to post the token back to the
+// confirm endpoint along with the new password.
+func NewPasswordResetServiceImpl(
+	u repository.UserRepository,
+	p repository.PasswordResetRepository,
+	t repository.RefreshTokenRepository,
+	a repository.AttemptCounterRepository,
+	d *AccessTokenDenylist,
+	m mailer.Mailer,
+	e AuditService,
+	b *Background,
+	pw *user.Passwords,
+	resetURL string,
+) *PasswordResetServiceImpl {
+	return &PasswordResetServiceImpl{
+		userRepo:          u,
+		passwordResetRepo: p,
+		refreshTokenRepo:  t,
+		attemptCounter:    a,
+		denylist:          d,
+		mailer:            m,
+		audit:             e,
+		background:        b,
+		passwords:         pw,
+		resetURL:          resetURL,
+	}
+}
+
+// RequestPasswordReset emails a reset link to the address when it belongs to
+// a user. Unknown addresses and addresses over their limit are silently
+// ignored so the caller can not tell which addresses have an account. Looking
+// up the address, storing the token and sending the email happen in the
+// background for every address, so the response time does not tell either.
+func (s *PasswordResetServiceImpl) RequestPasswordReset(ctx context.Context, request user.PasswordResetRequest) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.RequestPasswordReset")
+	defer span.End()
+
+	if s.isOverLimit(ctx, "password-reset:ip:"+request.ClientIP, passwordResetLimitPerIP) {
+		return user.ErrTooManyPasswordResetRequests
+	}
+
+	if s.isOverLimit(ctx, "password-reset:email:"+user.HashToken(request.NormalizedEmail()), passwordResetLimitPerEmail) {
+		return nil
+	}
+
+	s.background.Go(ctx, "send password reset", func(ctx context.Context) error {
+		return s.sendPasswordReset(ctx, request)
+	})
+
+	return nil
+}
+
+func (s *PasswordResetServiceImpl) sendPasswordReset(ctx context.Context, request user.PasswordResetRequest) error {
+	requester, err := s.userRepo.SelectUser(ctx, request.Email)
+	if err == user.ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	createRequest := user.NewCreatePasswordResetTokenRequest(
+		requester.Id,
+		token,
+		time.Now().Add(passwordResetTokenLifetime),
+	)
+
+	_, err = s.passwordResetRepo.CreatePasswordResetToken(ctx, *createRequest)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      requester.Email,
+		Subject: "Reset your url-short password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your url-short account.\n\n"+
+				"Use the link below within %d minutes to choose a new password:\n\n%s\n\n"+
+				"If you did not ask for this you can ignore this email, your password has not been changed.",
+			int(passwordResetTokenLifetime.Minutes()),
+			s.buildResetLink(token),
+		),
+	})
+}
+
+// ConfirmPasswordReset spends the token, sets the new password and revokes
+// every token issued to the user as well as any other outstanding reset
+// tokens. The new password is checked against the policy first, so a
+// rejected password does not spend the token.
+func (s *PasswordResetServiceImpl) ConfirmPasswordReset(ctx context.Context, request user.ConfirmPasswordResetRequest) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ConfirmPasswordReset")
+	defer span.End()
+
+	if err := s.passwords.Validate(request.NewPassword); err != nil {
+		return err
+	}
+
+	resetToken, err := s.passwordResetRepo.ConsumePasswordResetToken(ctx, request.TokenHash)
+	if err != nil {
+		return err
+	}
+
+	newPasswordHash, err := s.passwords.Hash(request.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.userRepo.UpdateUserPassword(ctx, resetToken.UserID, newPasswordHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.passwordResetRepo.InvalidateUserPasswordResetTokens(ctx, resetToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, resetToken.UserID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventUserPasswordChanged,
+		resetToken.UserID,
+		"",
+		map[string]any{"method": "reset"},
+	))
+
+	return nil
+}
+
+func (s *PasswordResetServiceImpl) isOverLimit(ctx context.Context, key string, limit int64) bool {
+	attempts, err := s.attemptCounter.IncrementAttempts(ctx, key, passwordResetWindow)
+	if err != nil {
+		// resets are still possible while the counter is unavailable
+		logging.FromContext(ctx).Error("could not count password reset attempts", "error", err)
+		return false
+	}
+
+	return attempts > limit
+}
+
+func (s *PasswordResetServiceImpl) buildResetLink(token string) string {
+	query := url.Values{}
+	query.Set("token", token)
+
+	return s.resetURL + "?" + query.Encode()
+}
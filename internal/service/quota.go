@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+// QuotaService enforces the plan each workspace is on. A user's plan is the
+// plan of their personal workspace.
+type QuotaService interface {
+	CheckLinkCreation(ctx context.Context, workspaceID int32) (int64, error)
+	TracksClick(ctx context.Context, shortURL string, at time.Time) bool
+	FlushClicks(ctx context.Context) (int, error)
+	GetUserUsage(ctx context.Context, userID int32) (*plan.Usage, error)
+	GetWorkspaceUsage(ctx context.Context, workspaceID int32) (*plan.Usage, error)
+	GetMemberWorkspaceUsage(ctx context.Context, userID, workspaceID int32) (*plan.Usage, error)
+	SetUserPlan(ctx context.Context, userID int32, planName string) (*plan.Usage, error)
+	SetWorkspacePlan(ctx context.Context, workspaceID int32, planName string) (*plan.Usage, error)
+}
+
+// clickFlushBatchSize bounds how many workspaces' clicks are taken from
+// Redis at once while flushing.
+const clickFlushBatchSize = 100
+
+type QuotaServiceImpl struct {
+	quotaRepo     repository.QuotaRepository
+	counters      repository.QuotaCounterRepository
+	workspaceRepo repository.WorkspaceRepository
+	plans         *plan.Catalog
+}
+
+func NewQuotaServiceImpl(
+	q repository.QuotaRepository,
+	c repository.QuotaCounterRepository,
+	w repository.WorkspaceRepository,
+	plans *plan.Catalog,
+) *QuotaServiceImpl {
+	return &QuotaServiceImpl{
+		quotaRepo:     q,
+		counters:      c,
+		workspaceRepo: w,
+		plans:         plans,
+	}
+}
+
+// CheckLinkCreation fails with a QuotaExceededError when the workspace
+// already has as many active links as its plan allows, otherwise it returns
+// the plan's limit for the insert to enforce, zero is unlimited. The check
+// lets most refusals skip generating a short URL, links created at the same
+// moment are kept within the limit by the insert.
+func (s *QuotaServiceImpl) CheckLinkCreation(ctx context.Context, workspaceID int32) (int64, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.CheckLinkCreation")
+	defer span.End()
+
+	usage, err := s.GetWorkspaceUsage(ctx, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := usage.Plan.Check(plan.QuotaActiveLinks, usage.ActiveLinks, 1); err != nil {
+		return 0, err
+	}
+
+	return usage.Plan.Limits.Limit(plan.QuotaActiveLinks), nil
+}
+
+// TracksClick counts a click through the short URL towards its workspace's
+// month and reports whether the plan allows tracking it. Clicks are counted
+// in Redis and stored in Postgres by FlushClicks, Postgres is only read the
+// first time a workspace's clicks are counted in a month or when its plan is
+// not cached. A click that could not be counted is tracked.
+func (s *QuotaServiceImpl) TracksClick(ctx context.Context, shortURL string, at time.Time) bool {
+	ctx, span := tracing.Start(ctx, "QuotaService.TracksClick")
+	defer span.End()
+
+	month := plan.MonthOf(at)
+
+	workspaceID, err := s.urlWorkspace(ctx, shortURL)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not count click towards its plan", "short_url", shortURL, "error", err)
+		return true
+	}
+
+	clicks, err := s.counters.IncrementClicks(ctx, workspaceID, month, 1)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not count click towards its plan", "short_url", shortURL, "error", err)
+		return true
+	}
+
+	planName, err := s.counters.GetPlan(ctx, workspaceID)
+	if err != nil && err != redis.Nil {
+		logging.FromContext(ctx).Error("could not read cached plan", "workspace_id", workspaceID, "error", err)
+		return true
+	}
+
+	if err == redis.Nil || clicks == 1 {
+		counters, err := s.quotaRepo.SelectWorkspaceCounters(ctx, workspaceID, month)
+		if err != nil {
+			logging.FromContext(ctx).Error("could not count click towards its plan", "short_url", shortURL, "error", err)
+			return true
+		}
+
+		// the counter was just started, clicks already stored for the month,
+		// for example before Redis lost the counter, carry over into it
+		if clicks == 1 && counters.MonthlyClicks > 0 {
+			clicks, err = s.counters.IncrementClicks(ctx, workspaceID, month, counters.MonthlyClicks)
+			if err != nil {
+				logging.FromContext(ctx).Error("could not count click towards its plan", "short_url", shortURL, "error", err)
+				return true
+			}
+		}
+
+		planName = counters.Plan
+		if err := s.counters.SetPlan(ctx, workspaceID, planName); err != nil {
+			logging.FromContext(ctx).Warn("could not cache plan", "workspace_id", workspaceID, "error", err)
+		}
+	}
+
+	return s.plans.Plan(planName).TracksClick(clicks)
+}
+
+func (s *QuotaServiceImpl) urlWorkspace(ctx context.Context, shortURL string) (int32, error) {
+	workspaceID, err := s.counters.GetURLWorkspace(ctx, shortURL)
+	if err == nil {
+		return workspaceID, nil
+	}
+
+	if err != redis.Nil {
+		return 0, err
+	}
+
+	workspaceID, err = s.quotaRepo.SelectURLWorkspace(ctx, shortURL)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.counters.SetURLWorkspace(ctx, shortURL, workspaceID); err != nil {
+		logging.FromContext(ctx).Warn("could not cache the workspace of a url", "short_url", shortURL, "error", err)
+	}
+
+	return workspaceID, nil
+}
+
+// FlushClicks stores the clicks counted in Redis since the last flush in
+// Postgres and returns for how many workspaces. Counters that could not be
+// stored are kept for the next flush, their errors are returned together.
+func (s *QuotaServiceImpl) FlushClicks(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.FlushClicks")
+	defer span.End()
+
+	stored := 0
+	var errs []error
+	for {
+		changed, err := s.counters.PopChangedClicks(ctx, clickFlushBatchSize)
+		if err != nil {
+			return stored, errors.Join(append(errs, err)...)
+		}
+
+		failed := []plan.MonthlyClicks{}
+		for _, clicks := range changed {
+			err := s.quotaRepo.StoreMonthlyClicks(ctx, clicks)
+			// the workspace was deleted along with its clicks
+			if err == workspace.ErrWorkspaceNotFound {
+				continue
+			}
+
+			if err != nil {
+				errs = append(errs, err)
+				failed = append(failed, clicks)
+				continue
+			}
+
+			stored++
+		}
+
+		if err := s.counters.MarkClicksChanged(ctx, failed); err != nil {
+			errs = append(errs, err)
+		}
+
+		// a short batch means every counter has been taken, counters put
+		// back or changed since are left for the next flush
+		if len(changed) < clickFlushBatchSize || len(failed) > 0 {
+			return stored, errors.Join(errs...)
+		}
+	}
+}
+
+func (s *QuotaServiceImpl) GetUserUsage(ctx context.Context, userID int32) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.GetUserUsage")
+	defer span.End()
+
+	personalID, err := s.personalWorkspaceID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetWorkspaceUsage(ctx, personalID)
+}
+
+func (s *QuotaServiceImpl) GetWorkspaceUsage(ctx context.Context, workspaceID int32) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.GetWorkspaceUsage")
+	defer span.End()
+
+	month := plan.MonthOf(time.Now())
+
+	counters, err := s.quotaRepo.SelectWorkspaceCounters(ctx, workspaceID, month)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redis is ahead of Postgres by the clicks that have not been flushed
+	clicks, err := s.counters.GetClicks(ctx, workspaceID, month)
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not read counted clicks", "workspace_id", workspaceID, "error", err)
+	}
+
+	if clicks > counters.MonthlyClicks {
+		counters.MonthlyClicks = clicks
+	}
+
+	return plan.NewUsage(s.plans.Plan(counters.Plan), counters, month), nil
+}
+
+// GetMemberWorkspaceUsage shows any member of the workspace what it uses of
+// its plan.
+func (s *QuotaServiceImpl) GetMemberWorkspaceUsage(ctx context.Context, userID, workspaceID int32) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.GetMemberWorkspaceUsage")
+	defer span.End()
+
+	if _, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, userID, workspace.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	return s.GetWorkspaceUsage(ctx, workspaceID)
+}
+
+// SetUserPlan moves the user's personal workspace to the plan.
+func (s *QuotaServiceImpl) SetUserPlan(ctx context.Context, userID int32, planName string) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.SetUserPlan")
+	defer span.End()
+
+	personalID, err := s.personalWorkspaceID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.SetWorkspacePlan(ctx, personalID, planName)
+}
+
+// SetWorkspacePlan moves the workspace to the plan. Links it already has over
+// the new plan's limits are kept, only new links are refused.
+func (s *QuotaServiceImpl) SetWorkspacePlan(ctx context.Context, workspaceID int32, planName string) (*plan.Usage, error) {
+	ctx, span := tracing.Start(ctx, "QuotaService.SetWorkspacePlan")
+	defer span.End()
+
+	if _, err := s.plans.Lookup(planName); err != nil {
+		return nil, err
+	}
+
+	if err := s.quotaRepo.SetWorkspacePlan(ctx, workspaceID, planName); err != nil {
+		return nil, err
+	}
+
+	if err := s.counters.SetPlan(ctx, workspaceID, planName); err != nil {
+		logging.FromContext(ctx).Warn("could not cache plan", "workspace_id", workspaceID, "error", err)
+	}
+
+	return s.GetWorkspaceUsage(ctx, workspaceID)
+}
+
+func (s *QuotaServiceImpl) personalWorkspaceID(ctx context.Context, userID int32) (int32, error) {
+	personal, err := s.workspaceRepo.SelectPersonalWorkspace(ctx, userID)
+	if err == workspace.ErrWorkspaceNotFound {
+		return 0, user.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return personal.ID, nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+
+	"url-short/internal/domain/ratelimit"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+)
+
+// RateLimiter limits how many requests each client makes to a group of
+// routes. Requests are counted in the shared limiter so every instance
+// enforces the same limit, when it can not be reached they are counted in
+// the local one and each instance enforces the limit on its own.
+type RateLimiter struct {
+	shared    repository.RateLimitRepository
+	local     repository.RateLimitRepository
+	limits    map[ratelimit.Group]ratelimit.Limit
+	allowlist ratelimit.Allowlist
+}
+
+func NewRateLimiter(
+	shared repository.RateLimitRepository,
+	local repository.RateLimitRepository,
+	limits map[ratelimit.Group]ratelimit.Limit,
+	allowlist ratelimit.Allowlist,
+) *RateLimiter {
+	return &RateLimiter{
+		shared:    shared,
+		local:     local,
+		limits:    limits,
+		allowlist: allowlist,
+	}
+}
+
+// Take counts a request by the client with the key against the group's
+// limit, ip is the address it came from. Groups without a limit and clients
+// on the allowlist are never limited.
+func (l *RateLimiter) Take(ctx context.Context, group ratelimit.Group, key, ip string) ratelimit.Decision {
+	limit := l.limits[group]
+	if !limit.Enabled() || l.allowlist.Contains(ip) {
+		return ratelimit.Decision{Allowed: true}
+	}
+
+	key = string(group) + ":" + key
+
+	decision, err := l.shared.Take(ctx, key, limit)
+	if err == nil {
+		return decision
+	}
+
+	logging.FromContext(ctx).Warn("could not reach shared rate limiter, using local rate limiter", "error", err)
+
+	decision, _ = l.local.Take(ctx, key, limit)
+
+	return decision
+}
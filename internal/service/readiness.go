@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"url-short/internal/logging"
+)
+
+const (
+	ReadinessReady    = "ready"
+	ReadinessDegraded = "degraded"
+	ReadinessNotReady = "not_ready"
+
+	ComponentUp   = "up"
+	ComponentDown = "down"
+)
+
+// ReadinessCheck checks one dependency. The application is not ready while a
+// required dependency is down, it is only degraded while an optional one is.
+type ReadinessCheck struct {
+	Name     string
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+type ComponentStatus struct {
+	Status  string
+	Latency time.Duration
+}
+
+type ReadinessReport struct {
+	Status     string
+	Components map[string]ComponentStatus
+	CheckedAt  time.Time
+}
+
+func (r *ReadinessReport) Ready() bool {
+	return r.Status != ReadinessNotReady
+}
+
+// Readiness runs the checks at most once per cacheTTL, so frequent probes do
+// not put load on the dependencies, and gives each check up to timeout.
+type Readiness struct {
+	checks   []ReadinessCheck
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	report *ReadinessReport
+}
+
+func NewReadiness(checks []ReadinessCheck, timeout, cacheTTL time.Duration) *Readiness {
+	return &Readiness{
+		checks:   checks,
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Check returns the latest report, running the checks again when it is
+// older than the cache TTL. Concurrent probes wait for the same run.
+func (r *Readiness) Check(ctx context.Context) ReadinessReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.report != nil && time.Since(r.report.CheckedAt) < r.cacheTTL {
+		return *r.report
+	}
+
+	report := r.run(ctx)
+	r.report = &report
+
+	return report
+}
+
+func (r *Readiness) run(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{
+		Status:     ReadinessReady,
+		Components: make(map[string]ComponentStatus, len(r.checks)),
+	}
+
+	results := make([]error, len(r.checks))
+	latencies := make([]time.Duration, len(r.checks))
+
+	wg := sync.WaitGroup{}
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// the result is cached for other probes, so it must not fail
+			// because this probe went away
+			checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+			defer cancel()
+
+			start := time.Now()
+			results[i] = check.Check(checkCtx)
+			latencies[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range r.checks {
+		status := ComponentStatus{Status: ComponentUp, Latency: latencies[i]}
+
+		if err := results[i]; err != nil {
+			logging.FromContext(ctx).Warn("readiness check failed", "component", check.Name, "error", err)
+			status.Status = ComponentDown
+
+			switch {
+			case check.Required:
+				report.Status = ReadinessNotReady
+			case report.Status == ReadinessReady:
+				report.Status = ReadinessDegraded
+			}
+		}
+
+		report.Components[check.Name] = status
+	}
+
+	report.CheckedAt = time.Now()
+
+	return report
+}
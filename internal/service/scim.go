@@ -0,0 +1,459 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/scim"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/metrics"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+// SCIMService provisions workspace members from an identity provider's
+// directory. Directories only see and change the users they provisioned,
+// groups are the workspace roles.
+type SCIMService interface {
+	CreateToken(ctx context.Context, actorID int32, workspaceID int32) (*scim.Token, error)
+	RevokeToken(ctx context.Context, actorID int32, workspaceID int32, tokenID int32) error
+	Authenticate(ctx context.Context, token string) (*scim.Token, error)
+	ListUsers(ctx context.Context, request scim.ListUsersRequest) (*scim.List[scim.User], error)
+	GetUser(ctx context.Context, workspaceID int32, userID int32) (*scim.User, error)
+	CreateUser(ctx context.Context, request scim.CreateUserRequest) (*scim.User, error)
+	PatchUser(ctx context.Context, request scim.PatchUserRequest) (*scim.User, error)
+	DeleteUser(ctx context.Context, workspaceID int32, userID int32) error
+	ListGroups(ctx context.Context, request scim.ListGroupsRequest) (*scim.List[scim.Group], error)
+	GetGroup(ctx context.Context, workspaceID int32, role workspace.Role) (*scim.Group, error)
+	PatchGroup(ctx context.Context, request scim.PatchGroupRequest) (*scim.Group, error)
+}
+
+type SCIMServiceImpl struct {
+	scimRepo         repository.SCIMRepository
+	userRepo         repository.UserRepository
+	workspaceRepo    repository.WorkspaceRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	denylist         *AccessTokenDenylist
+	audit            AuditService
+	passwords        *user.Passwords
+}
+
+func NewSCIMServiceImpl(
+	s repository.SCIMRepository,
+	u repository.UserRepository,
+	w repository.WorkspaceRepository,
+	t repository.RefreshTokenRepository,
+	d *AccessTokenDenylist,
+	a AuditService,
+	pw *user.Passwords,
+) *SCIMServiceImpl {
+	return &SCIMServiceImpl{
+		scimRepo:         s,
+		userRepo:         u,
+		workspaceRepo:    w,
+		refreshTokenRepo: t,
+		denylist:         d,
+		audit:            a,
+		passwords:        pw,
+	}
+}
+
+// CreateToken issues a token a directory can provision the workspace's
+// members with. Only owners can create tokens and personal workspaces can
+// not have any.
+func (s *SCIMServiceImpl) CreateToken(ctx context.Context, actorID int32, workspaceID int32) (*scim.Token, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateToken")
+	defer span.End()
+
+	if _, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, actorID, workspace.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	provisioned, err := s.workspaceRepo.SelectWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if provisioned.IsPersonal() {
+		return nil, workspace.ErrPersonalWorkspace
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.scimRepo.CreateToken(ctx, *scim.NewCreateTokenRequest(workspaceID, token, actorID))
+	if err != nil {
+		return nil, err
+	}
+	res.Token = token
+
+	created := audit.NewCreateEventRequest(audit.EventSCIMTokenCreated, actorID, "", map[string]any{
+		"workspace_id": workspaceID,
+	})
+	created.Target = audit.NewTarget(audit.TargetSCIMToken, strconv.Itoa(int(res.ID)))
+	s.audit.Record(ctx, *created)
+
+	return res, nil
+}
+
+func (s *SCIMServiceImpl) RevokeToken(ctx context.Context, actorID int32, workspaceID int32, tokenID int32) error {
+	ctx, span := tracing.Start(ctx, "SCIMService.RevokeToken")
+	defer span.End()
+
+	if _, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, actorID, workspace.RoleOwner); err != nil {
+		return err
+	}
+
+	if err := s.scimRepo.RevokeToken(ctx, workspaceID, tokenID); err != nil {
+		return err
+	}
+
+	revoked := audit.NewCreateEventRequest(audit.EventSCIMTokenRevoked, actorID, "", map[string]any{
+		"workspace_id": workspaceID,
+	})
+	revoked.Target = audit.NewTarget(audit.TargetSCIMToken, strconv.Itoa(int(tokenID)))
+	s.audit.Record(ctx, *revoked)
+
+	return nil
+}
+
+func (s *SCIMServiceImpl) Authenticate(ctx context.Context, token string) (*scim.Token, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.Authenticate")
+	defer span.End()
+
+	if token == "" {
+		return nil, scim.ErrInvalidToken
+	}
+
+	return s.scimRepo.SelectActiveToken(ctx, user.HashToken(token))
+}
+
+func (s *SCIMServiceImpl) ListUsers(
+	ctx context.Context,
+	request scim.ListUsersRequest,
+) (*scim.List[scim.User], error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListUsers")
+	defer span.End()
+
+	users, err := s.scimRepo.ListUsers(ctx, request.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []scim.User{}
+	for _, u := range users {
+		if request.Filter.MatchesUser(u) {
+			matched = append(matched, u)
+		}
+	}
+
+	return scim.NewList(matched, request.Page), nil
+}
+
+func (s *SCIMServiceImpl) GetUser(ctx context.Context, workspaceID int32, userID int32) (*scim.User, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.GetUser")
+	defer span.End()
+
+	return s.scimRepo.SelectUser(ctx, workspaceID, userID)
+}
+
+// CreateUser provisions a new account as a viewer of the workspace. The
+// account gets a random password and a verified email, provisioned users
+// set a password through a password reset or sign in with an identity
+// provider. Existing accounts can not be taken over and join through
+// invites instead.
+func (s *SCIMServiceImpl) CreateUser(ctx context.Context, request scim.CreateUserRequest) (*scim.User, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.CreateUser")
+	defer span.End()
+
+	randomPasswordHash, err := s.passwords.RandomHash()
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.scimRepo.ProvisionUser(ctx, request, randomPasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.UsersRegistered.WithLabelValues(metrics.RegistrationSCIM).Inc()
+	s.record(ctx, audit.EventSCIMUserProvisioned, userID, request.WorkspaceID, map[string]any{
+		"active": request.Active,
+	})
+
+	return s.scimRepo.SelectUser(ctx, request.WorkspaceID, userID)
+}
+
+// PatchUser changes the attributes set in the request. Deactivating a user
+// disables their account and revokes every token issued to them, their
+// links are kept.
+func (s *SCIMServiceImpl) PatchUser(ctx context.Context, request scim.PatchUserRequest) (*scim.User, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchUser")
+	defer span.End()
+
+	current, err := s.scimRepo.SelectUser(ctx, request.WorkspaceID, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.UserName != nil && *request.UserName != current.UserName {
+		if err := s.scimRepo.SetUserName(ctx, request.WorkspaceID, request.UserID, *request.UserName); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.ExternalID != nil && *request.ExternalID != current.ExternalID {
+		if err := s.scimRepo.SetExternalID(ctx, request.WorkspaceID, request.UserID, *request.ExternalID); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Active != nil && *request.Active != current.Active {
+		if *request.Active {
+			err = s.reactivateUser(ctx, request.WorkspaceID, request.UserID)
+		} else {
+			err = s.deprovisionUser(ctx, request.WorkspaceID, request.UserID)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.scimRepo.SelectUser(ctx, request.WorkspaceID, request.UserID)
+}
+
+// DeleteUser disables the account, revokes its tokens and takes it out of
+// the workspace. The account and its links are kept, the directory no longer
+// manages it.
+func (s *SCIMServiceImpl) DeleteUser(ctx context.Context, workspaceID int32, userID int32) error {
+	ctx, span := tracing.Start(ctx, "SCIMService.DeleteUser")
+	defer span.End()
+
+	current, err := s.scimRepo.SelectUser(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+
+	// the membership goes first, the last owner is refused before the
+	// account is disabled
+	if current.Role != "" {
+		err := s.workspaceRepo.DeleteMember(ctx, workspaceID, userID)
+		if err != nil && err != workspace.ErrMemberNotFound {
+			return err
+		}
+	}
+
+	if _, err := s.userRepo.DisableDirectoryUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID); err != nil {
+		return err
+	}
+
+	if err := s.scimRepo.DeleteUser(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.EventSCIMUserDeleted, userID, workspaceID, nil)
+
+	return nil
+}
+
+func (s *SCIMServiceImpl) ListGroups(
+	ctx context.Context,
+	request scim.ListGroupsRequest,
+) (*scim.List[scim.Group], error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.ListGroups")
+	defer span.End()
+
+	users, err := s.scimRepo.ListUsers(ctx, request.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []scim.Group{}
+	for _, role := range scim.Groups {
+		group := groupOfRole(users, role)
+		if request.Filter.MatchesGroup(*group) {
+			matched = append(matched, *group)
+		}
+	}
+
+	return scim.NewList(matched, request.Page), nil
+}
+
+func (s *SCIMServiceImpl) GetGroup(ctx context.Context, workspaceID int32, role workspace.Role) (*scim.Group, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.GetGroup")
+	defer span.End()
+
+	users, err := s.scimRepo.ListUsers(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupOfRole(users, role), nil
+}
+
+// PatchGroup applies the member changes in order. Removing a user from a
+// group drops them back to viewer, removing them from viewers changes
+// nothing as deprovisioning is how a directory takes access away.
+func (s *SCIMServiceImpl) PatchGroup(ctx context.Context, request scim.PatchGroupRequest) (*scim.Group, error) {
+	ctx, span := tracing.Start(ctx, "SCIMService.PatchGroup")
+	defer span.End()
+
+	for _, change := range request.Changes {
+		changed := []scim.User{}
+		for _, userID := range change.UserIDs {
+			member, err := s.scimRepo.SelectUser(ctx, request.WorkspaceID, userID)
+			if err == scim.ErrUserNotFound {
+				return nil, scim.ErrInvalidMember
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			changed = append(changed, *member)
+		}
+
+		switch change.Operation {
+		case scim.MemberOperationAdd:
+			for _, member := range changed {
+				if err := s.setRole(ctx, request.WorkspaceID, member, request.Role); err != nil {
+					return nil, err
+				}
+			}
+		case scim.MemberOperationRemove:
+			for _, member := range changed {
+				if member.Role != request.Role {
+					continue
+				}
+
+				if err := s.setRole(ctx, request.WorkspaceID, member, workspace.RoleViewer); err != nil {
+					return nil, err
+				}
+			}
+		case scim.MemberOperationReplace:
+			// members are added before the others are removed so a group of
+			// owners is never left empty along the way
+			kept := map[int32]bool{}
+			for _, member := range changed {
+				if err := s.setRole(ctx, request.WorkspaceID, member, request.Role); err != nil {
+					return nil, err
+				}
+
+				kept[member.ID] = true
+			}
+
+			users, err := s.scimRepo.ListUsers(ctx, request.WorkspaceID)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, member := range users {
+				if member.Role != request.Role || kept[member.ID] {
+					continue
+				}
+
+				if err := s.setRole(ctx, request.WorkspaceID, member, workspace.RoleViewer); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return s.GetGroup(ctx, request.WorkspaceID, request.Role)
+}
+
+// setRole gives a managed user the role, users who were taken out of the
+// workspace outside of SCIM are added back.
+func (s *SCIMServiceImpl) setRole(ctx context.Context, workspaceID int32, member scim.User, role workspace.Role) error {
+	if member.Role == role {
+		return nil
+	}
+
+	var err error
+	switch member.Role {
+	case "":
+		err = s.workspaceRepo.CreateMember(ctx, workspaceID, member.ID, role)
+	default:
+		// the repository refuses to demote the last owner
+		err = s.workspaceRepo.SetMemberRole(ctx, workspace.SetMemberRoleRequest{
+			WorkspaceID: workspaceID,
+			UserID:      member.ID,
+			Role:        role,
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.EventSCIMUserRoleSet, member.ID, workspaceID, map[string]any{"role": role})
+
+	return nil
+}
+
+func (s *SCIMServiceImpl) deprovisionUser(ctx context.Context, workspaceID int32, userID int32) error {
+	if _, err := s.userRepo.DisableDirectoryUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.EventSCIMUserDeprovisioned, userID, workspaceID, nil)
+
+	return nil
+}
+
+func (s *SCIMServiceImpl) reactivateUser(ctx context.Context, workspaceID int32, userID int32) error {
+	if _, err := s.userRepo.EnableDirectoryUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.EventSCIMUserReactivated, userID, workspaceID, nil)
+
+	return nil
+}
+
+func (s *SCIMServiceImpl) record(
+	ctx context.Context,
+	eventType audit.EventType,
+	userID int32,
+	workspaceID int32,
+	details map[string]any,
+) {
+	if details == nil {
+		details = map[string]any{}
+	}
+	details["workspace_id"] = workspaceID
+
+	// the directory acted, not a user
+	request := audit.NewCreateEventRequest(eventType, userID, "", details)
+	request.ActorID = 0
+	request.Target = audit.NewUserTarget(userID)
+
+	s.audit.Record(ctx, *request)
+}
+
+func groupOfRole(users []scim.User, role workspace.Role) *scim.Group {
+	group := &scim.Group{
+		ID:      role,
+		Members: []scim.User{},
+	}
+
+	for _, u := range users {
+		if u.Role == role {
+			group.Members = append(group.Members, u)
+		}
+	}
+
+	return group
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+)
+
+// AccessTokenDenylist enforces access token revocation. Revocations are
+// written to the shared denylist and to a local one, when the shared denylist
+// can not be read the local one is consulted and, if it does not know the
+// token, the token is accepted or refused depending on failClosed.
+type AccessTokenDenylist struct {
+	shared     repository.TokenDenylistRepository
+	local      repository.TokenDenylistRepository
+	failClosed bool
+}
+
+func NewAccessTokenDenylist(
+	shared repository.TokenDenylistRepository,
+	local repository.TokenDenylistRepository,
+	failClosed bool,
+) *AccessTokenDenylist {
+	return &AccessTokenDenylist{
+		shared:     shared,
+		local:      local,
+		failClosed: failClosed,
+	}
+}
+
+func (d *AccessTokenDenylist) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	// the local write can not fail, it is done first so the revocation is
+	// enforced by this process even when the shared write fails
+	_ = d.local.DenyToken(ctx, jti, expiresAt)
+
+	return d.shared.DenyToken(ctx, jti, expiresAt)
+}
+
+// RevokeUserTokens refuses every access token issued to the user up to now.
+func (d *AccessTokenDenylist) RevokeUserTokens(ctx context.Context, userID int32) error {
+	// token issue times only have second precision
+	now := time.Now().Truncate(time.Second)
+
+	_ = d.local.SetTokensInvalidBefore(ctx, userID, now, accessTokenLifetime)
+
+	return d.shared.SetTokensInvalidBefore(ctx, userID, now, accessTokenLifetime)
+}
+
+func (d *AccessTokenDenylist) IsRevoked(ctx context.Context, userID int32, jti string, issuedAt time.Time) bool {
+	revoked, err := d.isRevoked(ctx, d.shared, userID, jti, issuedAt)
+	if err == nil {
+		return revoked
+	}
+
+	logging.FromContext(ctx).Warn("could not read access token denylist, using local denylist", "error", err)
+
+	revoked, _ = d.isRevoked(ctx, d.local, userID, jti, issuedAt)
+	if revoked {
+		return true
+	}
+
+	return d.failClosed
+}
+
+func (d *AccessTokenDenylist) isRevoked(
+	ctx context.Context,
+	denylist repository.TokenDenylistRepository,
+	userID int32,
+	jti string,
+	issuedAt time.Time,
+) (bool, error) {
+	if jti != "" {
+		denied, err := denylist.IsTokenDenied(ctx, jti)
+		if err != nil {
+			return false, err
+		}
+
+		if denied {
+			return true, nil
+		}
+	}
+
+	invalidBefore, err := denylist.GetTokensInvalidBefore(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	// a token issued in the same second as the revocation may predate it, so
+	// it is refused too
+	return !invalidBefore.IsZero() && !issuedAt.After(invalidBefore), nil
+}
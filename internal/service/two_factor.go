@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/repository"
+	"url-short/internal/totp"
+	"url-short/internal/tracing"
+)
+
+type TwoFactorService interface {
+	EnrollTOTP(ctx context.Context, u *user.User) (*user.TwoFactorEnrollment, error)
+	ConfirmTOTP(ctx context.Context, request user.ConfirmTwoFactorRequest) ([]string, error)
+	IsEnabled(ctx context.Context, userID int32) (bool, error)
+	VerifyCode(ctx context.Context, userID int32, code string) error
+}
+
+const (
+	totpIssuer             = "url-short"
+	totpSkew               = 1
+	recoveryCodeCount      = 10
+	twoFactorAttemptWindow = 15 * time.Minute
+	twoFactorAttemptLimit  = 5
+)
+
+type TwoFactorServiceImpl struct {
+	twoFactorRepo  repository.TwoFactorRepository
+	attemptCounter repository.AttemptCounterRepository
+	cipher         *SecretCipher
+}
+
+// NewTwoFactorServiceImpl encrypts TOTP secrets with c, when c is nil two
+// factor authentication can not be enrolled or used.
+func NewTwoFactorServiceImpl(
+	f repository.TwoFactorRepository,
+	a repository.AttemptCounterRepository,
+	c *SecretCipher,
+) *TwoFactorServiceImpl {
+	return &TwoFactorServiceImpl{
+		twoFactorRepo:  f,
+		attemptCounter: a,
+		cipher:         c,
+	}
+}
+
+// EnrollTOTP starts an enrollment, replacing any unconfirmed one. The secret
+// is only returned here.
+func (s *TwoFactorServiceImpl) EnrollTOTP(ctx context.Context, u *user.User) (*user.TwoFactorEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.EnrollTOTP")
+	defer span.End()
+
+	if s.cipher == nil {
+		return nil, user.ErrTwoFactorNotConfigured
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, user.ErrUnexpectedError
+	}
+
+	encryptedSecret, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not encrypt totp secret", "user_id", u.Id, "error", err)
+		return nil, user.ErrUnexpectedError
+	}
+
+	_, err = s.twoFactorRepo.UpsertPendingTwoFactor(ctx, u.Id, encryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, u.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two factor authentication once the user proves their
+// authenticator works and returns recovery codes, which are only stored
+// hashed and so can not be shown again.
+func (s *TwoFactorServiceImpl) ConfirmTOTP(ctx context.Context, request user.ConfirmTwoFactorRequest) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.ConfirmTOTP")
+	defer span.End()
+
+	twoFactor, err := s.twoFactorRepo.SelectTwoFactor(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if twoFactor.IsEnabled() {
+		return nil, user.ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.limitAttempts(ctx, request.UserID); err != nil {
+		return nil, err
+	}
+
+	step, err := s.validateTOTP(ctx, twoFactor, request.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+
+	for i := range recoveryCodes {
+		code, err := generateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCodes[i] = strings.ToUpper(code[:5] + "-" + code[5:])
+		codeHashes[i] = user.HashToken(code)
+	}
+
+	// codes are stored before enabling so a failure can not leave an account
+	// with two factor enabled and no way to recover it
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, request.UserID, codeHashes); err != nil {
+		return nil, err
+	}
+
+	_, err = s.twoFactorRepo.ConfirmTwoFactor(ctx, request.UserID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (s *TwoFactorServiceImpl) IsEnabled(ctx context.Context, userID int32) (bool, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.IsEnabled")
+	defer span.End()
+
+	twoFactor, err := s.twoFactorRepo.SelectTwoFactor(ctx, userID)
+	if err == user.ErrTwoFactorNotEnrolled {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return twoFactor.IsEnabled(), nil
+}
+
+// VerifyCode accepts a TOTP code, which can only be used once, or an unused
+// recovery code.
+func (s *TwoFactorServiceImpl) VerifyCode(ctx context.Context, userID int32, code string) error {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.VerifyCode")
+	defer span.End()
+
+	twoFactor, err := s.twoFactorRepo.SelectTwoFactor(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !twoFactor.IsEnabled() {
+		return user.ErrTwoFactorNotEnrolled
+	}
+
+	if err := s.limitAttempts(ctx, userID); err != nil {
+		return err
+	}
+
+	if len(code) != totp.Digits {
+		return s.twoFactorRepo.ConsumeRecoveryCode(ctx, userID, user.HashToken(code))
+	}
+
+	step, err := s.validateTOTP(ctx, twoFactor, code)
+	if err != nil {
+		return err
+	}
+
+	return s.twoFactorRepo.UseTwoFactorStep(ctx, userID, step)
+}
+
+func (s *TwoFactorServiceImpl) validateTOTP(ctx context.Context, twoFactor *user.TwoFactor, code string) (int64, error) {
+	if s.cipher == nil {
+		return 0, user.ErrTwoFactorNotConfigured
+	}
+
+	secret, err := s.cipher.Decrypt(twoFactor.EncryptedSecret)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not decrypt totp secret", "user_id", twoFactor.UserID, "error", err)
+		return 0, user.ErrUnexpectedError
+	}
+
+	step, valid := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !valid || step <= twoFactor.LastUsedStep {
+		return 0, user.ErrInvalidTwoFactorCode
+	}
+
+	return step, nil
+}
+
+// limitAttempts counts every code checked for a user, a new login does not
+// reset the count so the password alone is not enough to keep guessing.
+func (s *TwoFactorServiceImpl) limitAttempts(ctx context.Context, userID int32) error {
+	attempts, err := s.attemptCounter.IncrementAttempts(
+		ctx,
+		fmt.Sprintf("2fa:attempts:user:%d", userID),
+		twoFactorAttemptWindow,
+	)
+	if err != nil {
+		return err
+	}
+
+	if attempts > twoFactorAttemptLimit {
+		return user.ErrTooManyTwoFactorAttempts
+	}
+
+	return nil
+}
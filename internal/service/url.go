@@ -4,14 +4,20 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"log"
 	"strings"
 	"time"
 
+	"url-short/internal/domain/audit"
 	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/logging"
+	"url-short/internal/metrics"
 	"url-short/internal/repository"
+	"url-short/internal/tracing"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type URLService interface {
@@ -23,35 +29,84 @@ type URLService interface {
 }
 
 type URLServiceImpl struct {
-	urlRepo   repository.URLRepository
-	cacheRepo repository.CacheRepository
+	urlRepo       repository.URLRepository
+	cacheRepo     repository.CacheRepository
+	workspaceRepo repository.WorkspaceRepository
+	audit         AuditService
+	quotas        QuotaService
+	clicks        *ClickBuffer
 }
 
-func NewURLServiceImpl(r repository.URLRepository, c repository.CacheRepository) *URLServiceImpl {
+func NewURLServiceImpl(
+	r repository.URLRepository,
+	c repository.CacheRepository,
+	w repository.WorkspaceRepository,
+	a AuditService,
+	q QuotaService,
+	b *ClickBuffer,
+) *URLServiceImpl {
 	return &URLServiceImpl{
-		urlRepo:   r,
-		cacheRepo: c,
+		urlRepo:       r,
+		cacheRepo:     c,
+		workspaceRepo: w,
+		audit:         a,
+		quotas:        q,
+		clicks:        b,
 	}
 }
 
+// CreateShortURL adds the URL to the requested workspace, or to the user's
+// personal workspace when none is given. Viewers can not add URLs, and the
+// workspace's plan may not allow more.
 func (s *URLServiceImpl) CreateShortURL(
 	ctx context.Context,
 	request shorturl.CreateURLRequest,
 ) (*shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "URLService.CreateShortURL")
+	defer span.End()
+
+	if request.WorkspaceID == 0 {
+		personal, err := s.workspaceRepo.SelectPersonalWorkspace(ctx, request.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		request.WorkspaceID = personal.ID
+	}
+
+	_, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, request.WorkspaceID, request.UserID, workspace.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	maxActiveLinks, err := s.quotas.CheckLinkCreation(ctx, request.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
 	shortURLHash, err := s.GenerateUniqueShortURL(ctx, request.LongURL)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
 	request.ShortURL = shortURLHash
+	request.MaxActiveLinks = maxActiveLinks
 
 	createdShortURL, err := s.urlRepo.CreateShortURL(ctx, request)
+	// nothing is inserted when links created since the check took the
+	// workspace to its limit
+	if err == workspace.ErrWorkspaceNotFound {
+		if _, quotaErr := s.quotas.CheckLinkCreation(ctx, request.WorkspaceID); quotaErr != nil {
+			return nil, quotaErr
+		}
+	}
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
 
+	metrics.LinksCreated.Inc()
+	s.recordURLEvent(ctx, audit.EventURLCreated, request.UserID, createdShortURL, nil, createdShortURL.LongURL)
+
 	return createdShortURL, nil
 }
 
@@ -59,6 +114,9 @@ func (s *URLServiceImpl) GenerateUniqueShortURL(
 	ctx context.Context,
 	longURL string,
 ) (string, error) {
+	ctx, span := tracing.Start(ctx, "URLService.GenerateUniqueShortURL")
+	defer span.End()
+
 	count := 0
 	hash := ""
 	urlHashPostfix := "Xa1"
@@ -79,39 +137,72 @@ func (s *URLServiceImpl) GenerateUniqueShortURL(
 			return "", err
 		}
 
+		metrics.ShortCodeCollisions.Inc()
 		count++
 	}
 }
 
+// GetLongURL resolves a short URL for a redirect and counts the click,
+// unless the workspace's plan has tracked all the clicks it allows this month.
+// Clicks are buffered and stored in the background.
 func (s *URLServiceImpl) GetLongURL(ctx context.Context, shortURL string) (*shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "URLService.GetLongURL")
+	defer span.End()
+
+	url, err := s.lookupLongURL(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !s.quotas.TracksClick(ctx, shortURL, now) {
+		return url, nil
+	}
+
+	s.clicks.Add(shortURL, now)
+
+	return url, nil
+}
+
+func (s *URLServiceImpl) lookupLongURL(ctx context.Context, shortURL string) (*shorturl.URL, error) {
 	url, err := s.cacheRepo.GetURL(ctx, shortURL)
 
 	switch {
 	// cache miss
 	case err == redis.Nil:
+		countCacheLookup(ctx, metrics.CacheMiss)
+
 		row, err := s.urlRepo.GetURLByHash(ctx, shortURL)
 
 		if err != nil {
-			log.Println(err)
+			return nil, err
+		}
+
+		// URLs that were taken down are never cached
+		if err := row.CheckAvailable(); err != nil {
 			return nil, err
 		}
 
 		err = s.cacheRepo.InsertURL(ctx, shortURL, row.LongURL, (time.Hour * 1))
 
 		if err != nil {
-			log.Printf("could not write to redis cache %s", err)
+			logging.FromContext(ctx).Warn("could not write url to the cache", "short_url", shortURL, "error", err)
 		}
 
 		return row, nil
 
 	// cache Error
 	case err != nil:
-		log.Println(err)
+		countCacheLookup(ctx, metrics.CacheError)
+		logging.FromContext(ctx).Warn("could not read url from the cache", "short_url", shortURL, "error", err)
 
 		row, err := s.urlRepo.GetURLByHash(ctx, shortURL)
 
 		if err != nil {
-			log.Println(err)
+			return nil, err
+		}
+
+		if err := row.CheckAvailable(); err != nil {
 			return nil, err
 		}
 
@@ -119,39 +210,92 @@ func (s *URLServiceImpl) GetLongURL(ctx context.Context, shortURL string) (*shor
 
 	// malformed cache Entry
 	case url == "":
+		countCacheLookup(ctx, metrics.CacheMiss)
+
 		row, err := s.urlRepo.GetURLByHash(ctx, shortURL)
 
 		if err != nil {
-			log.Println(err)
+			return nil, err
+		}
+
+		if err := row.CheckAvailable(); err != nil {
 			return nil, err
 		}
 
 		return row, nil
 	}
 
+	countCacheLookup(ctx, metrics.CacheHit)
+
 	return &shorturl.URL{LongURL: url}, nil
 }
 
+// countCacheLookup counts the result of a redirect cache lookup and adds it
+// to the redirect's span.
+func countCacheLookup(ctx context.Context, result string) {
+	metrics.RedirectCacheLookups.WithLabelValues(result).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("cache.result", result))
+}
+
 func (s *URLServiceImpl) DeleteShortURL(ctx context.Context, url shorturl.DeleteURLRequest) error {
-	if err := s.urlRepo.DeleteShortURL(ctx, url); err != nil {
+	ctx, span := tracing.Start(ctx, "URLService.DeleteShortURL")
+	defer span.End()
+
+	deleted, err := s.urlRepo.DeleteShortURL(ctx, url)
+	if err != nil {
 		return err
 	}
+
+	s.recordURLEvent(ctx, audit.EventURLDeleted, url.UserID, deleted, deleted.LongURL, nil)
+
 	return nil
 }
 
 func (s *URLServiceImpl) UpdateShortURL(ctx context.Context, request shorturl.UpdateURLRequest) (*shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "URLService.UpdateShortURL")
+	defer span.End()
+
+	previous, err := s.urlRepo.GetURLByHash(ctx, request.ShortURL)
+	if err != nil {
+		return nil, err
+	}
+
 	url, err := s.urlRepo.UpdateShortURL(ctx, request)
 
 	if err != nil {
 		return nil, err
 	}
 
+	s.recordURLEvent(ctx, audit.EventURLUpdated, request.UserID, url, previous.LongURL, url.LongURL)
+
+	// a URL that was taken down stays down when its owner changes it
+	if url.IsDisabled() {
+		return url, nil
+	}
+
 	err = s.cacheRepo.InsertURL(ctx, url.ShortURL, url.LongURL, (time.Hour * 1))
 
 	if err != nil {
 		// We can use a cache write failure metric here to avoid not returning the updated url to the user
-		log.Println(err)
+		logging.FromContext(ctx).Warn("could not write url to the cache", "short_url", url.ShortURL, "error", err)
 	}
 
 	return url, nil
 }
+
+// recordURLEvent records actorID changing the long URL of url from one value
+// to another, the event is about the user who created the URL.
+func (s *URLServiceImpl) recordURLEvent(
+	ctx context.Context,
+	eventType audit.EventType,
+	actorID int32,
+	url *shorturl.URL,
+	from, to any,
+) {
+	request := audit.NewCreateEventRequest(eventType, url.UserID, "", map[string]any{"workspace_id": url.WorkspaceID})
+	request.ActorID = actorID
+	request.Target = audit.NewTarget(audit.TargetURL, url.ShortURL)
+	request.Diff.Add("long_url", from, to)
+
+	s.audit.Record(ctx, *request)
+}
@@ -4,79 +4,287 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"errors"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 
+	"url-short/internal/domain/audit"
 	"url-short/internal/domain/user"
+	"url-short/internal/logging"
+	"url-short/internal/metrics"
 	"url-short/internal/repository"
+	"url-short/internal/tracing"
 )
 
 type UserService interface {
 	CreateUser(ctx context.Context, request user.CreateUserRequest) (*user.User, error)
 	LoginUser(ctx context.Context, request user.LoginUserRequest) (*user.User, error)
+	LoginUserWithTwoFactor(ctx context.Context, request user.LoginWithTwoFactorRequest) (*user.User, error)
+	LoginExternalUser(ctx context.Context, userID int32) (*user.User, error)
 	RefreshAccessToken(ctx context.Context, token string) (*user.User, error)
-	UpdateUser(ctx context.Context, request user.UpdateUserRequest) (*user.User, error)
+	UpdateUser(ctx context.Context, request user.UpdateProfileRequest) (*user.User, error)
 	ValidateUserJWT(ctx context.Context, requestToken string) (*user.User, error)
+	LogoutUser(ctx context.Context, request user.LogoutUserRequest) error
+	AuthorizeURLCreation(u *user.User) error
 }
 
 type UserServiceImpl struct {
-	userRepo  repository.UserRepository
-	JWTSecret string
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	jwtKeys          *JWTKeys
+	denylist         *AccessTokenDenylist
+	verification     EmailVerificationService
+	twoFactor        TwoFactorService
+	loginThrottle    *LoginThrottle
+	passwords        *user.Passwords
+	accounts         AccountService
+	unverifiedPolicy user.UnverifiedUserPolicy
+	audit            AuditService
 }
 
-func NewUserServiceImpl(r repository.UserRepository, jwtSecret string) *UserServiceImpl {
+func NewUserServiceImpl(
+	r repository.UserRepository,
+	t repository.RefreshTokenRepository,
+	k *JWTKeys,
+	d *AccessTokenDenylist,
+	v EmailVerificationService,
+	f TwoFactorService,
+	l *LoginThrottle,
+	pw *user.Passwords,
+	a AccountService,
+	p user.UnverifiedUserPolicy,
+	e AuditService,
+) *UserServiceImpl {
 	return &UserServiceImpl{
-		userRepo:  r,
-		JWTSecret: jwtSecret,
+		userRepo:         r,
+		refreshTokenRepo: t,
+		jwtKeys:          k,
+		denylist:         d,
+		verification:     v,
+		twoFactor:        f,
+		loginThrottle:    l,
+		passwords:        pw,
+		accounts:         a,
+		unverifiedPolicy: p,
+		audit:            e,
 	}
 }
 
+const (
+	accessTokenLifetime  = 1 * time.Hour
+	refreshTokenLifetime = 60 * (24 * time.Hour)
+	mfaChallengeLifetime = 5 * time.Minute
+	accessTokenIssuer    = "url-short-auth"
+	mfaChallengeIssuer   = "url-short-mfa"
+)
+
+// tokenClaims are the claims of access and challenge tokens, Role is only set
+// on access tokens.
+type tokenClaims struct {
+	Role user.Role `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
 func (s *UserServiceImpl) CreateUser(ctx context.Context, request user.CreateUserRequest) (*user.User, error) {
-	res, err := s.userRepo.CreateUser(ctx, request)
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer span.End()
+
+	if err := s.passwords.Validate(request.Password); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := s.passwords.Hash(request.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.userRepo.CreateUser(ctx, request.Email, passwordHash)
 	if err != nil {
 		return nil, err
 	}
 
+	metrics.UsersRegistered.WithLabelValues(metrics.RegistrationPassword).Inc()
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventUserCreated, res.Id, "", nil))
+
+	// the user can ask for the verification email again if this one never arrives
+	if err := s.verification.SendVerificationEmail(ctx, res); err != nil {
+		logging.FromContext(ctx).Error("could not send verification email", "user_id", res.Id, "error", err)
+	}
+
 	return res, nil
 }
 
 func (s *UserServiceImpl) LoginUser(ctx context.Context, request user.LoginUserRequest) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.LoginUser")
+	defer span.End()
+
+	if err := s.loginThrottle.Check(ctx, request); err != nil {
+		return nil, err
+	}
+
 	res, err := s.userRepo.SelectUser(ctx, request.Email)
+	if err == user.ErrUserNotFound {
+		s.passwords.VerifyDummy(request.Password)
+		s.loginThrottle.RecordFailure(ctx, request, 0)
+		s.recordLoginFailure(ctx, request, 0, "unknown_email")
+		return nil, user.ErrInvalidPassword
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword(res.PasswordHash, []byte(request.Password))
+	needsRehash, err := s.passwords.Verify(res, request.Password)
 	if err != nil {
-		return nil, user.ErrInvalidPassword
+		s.loginThrottle.RecordFailure(ctx, request, res.Id)
+		s.recordLoginFailure(ctx, request, res.Id, "wrong_password")
+		return nil, err
+	}
+
+	s.loginThrottle.RecordSuccess(ctx, request, res.Id)
+
+	if needsRehash {
+		s.rehashPassword(ctx, res, request.Password)
+	}
+
+	// only told once the password is known to be right
+	if res.IsDisabled() {
+		s.recordLoginFailure(ctx, request, res.Id, "disabled")
+		return nil, user.ErrUserDisabled
+	}
+
+	if !s.unverifiedPolicy.AllowsLogin(res) {
+		return nil, user.ErrEmailNotVerified
+	}
+
+	twoFactorEnabled, err := s.twoFactor.IsEnabled(ctx, res.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if twoFactorEnabled {
+		challengeToken, err := s.signToken(ctx, res.Id, "", mfaChallengeIssuer, mfaChallengeLifetime)
+		if err != nil {
+			return nil, err
+		}
+
+		res.MFAChallengeToken = challengeToken
+
+		return res, nil
+	}
+
+	return s.issueLoginTokens(ctx, res, "password")
+}
+
+func (s *UserServiceImpl) recordLoginFailure(
+	ctx context.Context,
+	request user.LoginUserRequest,
+	userID int32,
+	reason string,
+) {
+	metrics.LoginsFailed.Inc()
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventLoginFailed, userID, request.ClientIP, map[string]any{
+		"email":  request.Email,
+		"reason": reason,
+	}))
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or cost. The
+// login goes ahead with the old hash when this fails, it is retried on the
+// next login.
+func (s *UserServiceImpl) rehashPassword(ctx context.Context, u *user.User, password string) {
+	passwordHash, err := s.passwords.Hash(password)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not rehash password", "user_id", u.Id, "error", err)
+		return
 	}
 
-	registeredClaims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Issuer:    "url-short-auth",
-		Subject:   strconv.Itoa(int(res.Id)),
+	_, err = s.userRepo.UpdateUserPassword(ctx, u.Id, passwordHash)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not store rehashed password", "user_id", u.Id, "error", err)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, registeredClaims)
+	u.PasswordHash = []byte(passwordHash)
+}
+
+// LoginUserWithTwoFactor exchanges the challenge token LoginUser returned and
+// a second factor for access and refresh tokens. The challenge token is
+// revoked once used.
+func (s *UserServiceImpl) LoginUserWithTwoFactor(
+	ctx context.Context,
+	request user.LoginWithTwoFactorRequest,
+) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.LoginUserWithTwoFactor")
+	defer span.End()
+
+	claims, err := s.parseToken(request.ChallengeToken, mfaChallengeIssuer)
+	if err != nil || claims.IssuedAt == nil {
+		return nil, user.ErrInvalidMFAChallenge
+	}
 
-	signedToken, err := token.SignedString([]byte(s.JWTSecret))
+	userID, err := strconv.Atoi(claims.Subject)
 	if err != nil {
-		return nil, user.ErrUnexpectedError
+		return nil, user.ErrInvalidMFAChallenge
+	}
+
+	if s.denylist.IsRevoked(ctx, int32(userID), claims.ID, claims.IssuedAt.Time) {
+		return nil, user.ErrInvalidMFAChallenge
 	}
 
-	byteSlice := make([]byte, 32)
-	_, err = rand.Read(byteSlice)
-	refreshToken := hex.EncodeToString(byteSlice)
+	if err := s.twoFactor.VerifyCode(ctx, int32(userID), request.Code); err != nil {
+		s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventLoginTwoFactorFailed, int32(userID), "", nil))
+		return nil, err
+	}
+
+	if err := s.denylist.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		logging.FromContext(ctx).Error("could not write token to the access token denylist", "token_id", claims.ID, "error", err)
+	}
+
+	res, err := s.userRepo.SelectUserByID(ctx, int32(userID))
 	if err != nil {
-		return nil, user.ErrUnexpectedError
+		return nil, err
 	}
 
-	err = s.userRepo.UpdateRefreshToken(ctx, refreshToken, res.Id)
+	return s.issueLoginTokens(ctx, res, "two_factor")
+}
+
+// LoginExternalUser issues tokens to a user an identity provider has
+// authenticated, the provider is responsible for any second factor.
+func (s *UserServiceImpl) LoginExternalUser(ctx context.Context, userID int32) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.LoginExternalUser")
+	defer span.End()
+
+	res, err := s.userRepo.SelectUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueLoginTokens(ctx, res, "external")
+}
+
+// issueLoginTokens completes a login, which also cancels a deletion the user
+// scheduled for their account. method is how the user proved who they are.
+func (s *UserServiceImpl) issueLoginTokens(ctx context.Context, res *user.User, method string) (*user.User, error) {
+	if res.IsDisabled() {
+		return nil, user.ErrUserDisabled
+	}
+
+	if err := s.accounts.CancelUserDeletion(ctx, res.Id); err != nil {
+		return nil, err
+	}
+
+	signedToken, err := s.signAccessToken(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+
+	familyID, err := generateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, res.Id, familyID)
 	if err != nil {
 		return nil, err
 	}
@@ -84,83 +292,322 @@ func (s *UserServiceImpl) LoginUser(ctx context.Context, request user.LoginUserR
 	res.RefreshToken = refreshToken
 	res.Token = signedToken
 
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventLoginSucceeded,
+		res.Id,
+		"",
+		map[string]any{"method": method},
+	))
+
 	return res, nil
 }
 
+// RefreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token. The presented token is spent in the process, presenting
+// it again means it has leaked so its whole family is revoked.
 func (s *UserServiceImpl) RefreshAccessToken(ctx context.Context, refreshToken string) (*user.User, error) {
-	user, err := s.userRepo.SelectUserByRefreshToken(ctx, refreshToken)
+	ctx, span := tracing.Start(ctx, "UserService.RefreshAccessToken")
+	defer span.End()
+
+	presented, err := s.refreshTokenRepo.SelectRefreshToken(ctx, user.HashToken(refreshToken))
 	if err != nil {
 		return nil, err
 	}
 
-	if time.Now().After(user.RefreshTokenRevokeDate) {
-		return nil, errors.New("refresh token expired, please login again")
+	if presented.IsUsed() {
+		return nil, s.revokeReusedRefreshToken(ctx, presented)
 	}
 
-	registeredClaims := jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Issuer:    "url-short-auth",
-		Subject:   strconv.Itoa(int(user.Id)),
+	if presented.IsRevoked() {
+		return nil, user.ErrInvalidRefreshToken
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, registeredClaims)
+	if presented.IsExpired(time.Now()) {
+		return nil, user.ErrRefreshTokenExpired
+	}
 
-	signedToken, err := token.SignedString([]byte(s.JWTSecret))
+	_, err = s.refreshTokenRepo.MarkRefreshTokenUsed(ctx, presented.ID)
+	if err == user.ErrInvalidRefreshToken {
+		// another request spent this token between our read and our write
+		return nil, s.revokeReusedRefreshToken(ctx, presented)
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	refreshedUser, err := s.userRepo.SelectUserByID(ctx, presented.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	user.Token = signedToken
+	if refreshedUser.IsDisabled() {
+		return nil, user.ErrUserDisabled
+	}
 
-	return user, nil
-}
+	signedToken, err := s.signAccessToken(ctx, refreshedUser)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *UserServiceImpl) UpdateUser(ctx context.Context, request user.UpdateUserRequest) (*user.User, error) {
-	user, err := s.userRepo.UpdateUser(ctx, request)
+	rotatedToken, err := s.issueRefreshToken(ctx, refreshedUser.Id, presented.FamilyID)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	refreshedUser.Token = signedToken
+	refreshedUser.RefreshToken = rotatedToken
+
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventTokenRefreshed,
+		refreshedUser.Id,
+		"",
+		map[string]any{"family_id": presented.FamilyID},
+	))
+
+	return refreshedUser, nil
 }
 
-func (s *UserServiceImpl) ValidateUserJWT(ctx context.Context, requestToken string) (*user.User, error) {
-	claims := jwt.RegisteredClaims{}
+func (s *UserServiceImpl) revokeReusedRefreshToken(ctx context.Context, token *user.RefreshToken) error {
+	logging.FromContext(ctx).Warn(
+		"security event: refresh token reuse detected, revoking token family",
+		"user_id", token.UserID,
+		"family_id", token.FamilyID,
+	)
 
-	token, err := jwt.ParseWithClaims(
-		requestToken,
-		&claims,
-		func(token *jwt.Token) (any, error) { return []byte(s.JWTSecret), nil },
+	if err := s.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventTokenReuseDetected,
+		token.UserID,
+		"",
+		map[string]any{"family_id": token.FamilyID},
+	))
+
+	return user.ErrRefreshTokenReused
+}
+
+func (s *UserServiceImpl) signAccessToken(ctx context.Context, u *user.User) (string, error) {
+	return s.signToken(ctx, u.Id, u.Role, accessTokenIssuer, accessTokenLifetime)
+}
+
+// signToken signs a token for userID. Challenge tokens use their own issuer
+// so they are never accepted as access tokens.
+func (s *UserServiceImpl) signToken(
+	ctx context.Context,
+	userID int32,
+	role user.Role,
+	issuer string,
+	lifetime time.Duration,
+) (string, error) {
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := tokenClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Subject:   strconv.Itoa(int(userID)),
+		},
+	}
+
+	signedToken, err := s.jwtKeys.Sign(claims)
+	if err != nil {
+		logging.FromContext(ctx).Error("could not sign token", "user_id", userID, "error", err)
+		return "", user.ErrUnexpectedError
+	}
+
+	return signedToken, nil
+}
+
+func (s *UserServiceImpl) issueRefreshToken(ctx context.Context, userID int32, familyID string) (string, error) {
+	refreshToken, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	request := user.NewCreateRefreshTokenRequest(
+		userID,
+		familyID,
+		refreshToken,
+		time.Now().Add(refreshTokenLifetime),
 	)
+
+	_, err = s.refreshTokenRepo.CreateRefreshToken(ctx, *request)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+func generateRandomToken(length int) (string, error) {
+	byteSlice := make([]byte, length)
+
+	_, err := rand.Read(byteSlice)
+	if err != nil {
+		return "", user.ErrUnexpectedError
 	}
 
-	issuer, err := token.Claims.GetIssuer()
+	return hex.EncodeToString(byteSlice), nil
+}
+
+// UpdateUser backs the deprecated PUT /api/v1/users. It makes its changes
+// through AccountService.UpdateProfile, so they need the same current
+// password and two factor code.
+func (s *UserServiceImpl) UpdateUser(ctx context.Context, request user.UpdateProfileRequest) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	profile, err := s.accounts.UpdateProfile(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
-	if issuer != "url-short-auth" {
-		return nil, jwt.ErrTokenInvalidIssuer
+	return profile.User, nil
+}
+
+func (s *UserServiceImpl) AuthorizeURLCreation(u *user.User) error {
+	if !s.unverifiedPolicy.AllowsURLCreation(u) {
+		return user.ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+func (s *UserServiceImpl) revokeUserTokens(ctx context.Context, userID int32) error {
+	return revokeUserTokens(ctx, s.denylist, s.refreshTokenRepo, userID)
+}
+
+// revokeUserTokens revokes every access and refresh token issued to a user.
+func revokeUserTokens(
+	ctx context.Context,
+	denylist *AccessTokenDenylist,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	userID int32,
+) error {
+	if err := denylist.RevokeUserTokens(ctx, userID); err != nil {
+		// the revocation is still enforced by this instance through the local denylist
+		logging.FromContext(ctx).Error("could not write user to the access token denylist", "user_id", userID, "error", err)
+	}
+
+	return refreshTokenRepo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// LogoutUser revokes the presented access token and, when given, the family
+// of the presented refresh token.
+func (s *UserServiceImpl) LogoutUser(ctx context.Context, request user.LogoutUserRequest) error {
+	ctx, span := tracing.Start(ctx, "UserService.LogoutUser")
+	defer span.End()
+
+	claims, err := s.parseAccessToken(request.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.denylist.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		logging.FromContext(ctx).Error("could not write token to the access token denylist", "token_id", claims.ID, "error", err)
 	}
 
-	userID, err := token.Claims.GetSubject()
+	if request.RefreshToken == "" {
+		s.audit.Record(ctx, *audit.NewCreateEventRequest(audit.EventUserLoggedOut, request.UserID, "", nil))
+		return nil
+	}
+
+	refreshToken, err := s.refreshTokenRepo.SelectRefreshToken(ctx, user.HashToken(request.RefreshToken))
+	if err != nil {
+		return err
+	}
+
+	if refreshToken.UserID != request.UserID {
+		return user.ErrInvalidRefreshToken
+	}
+
+	if err := s.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, *audit.NewCreateEventRequest(
+		audit.EventUserLoggedOut,
+		request.UserID,
+		"",
+		map[string]any{"family_id": refreshToken.FamilyID},
+	))
+
+	return nil
+}
+
+func (s *UserServiceImpl) parseAccessToken(requestToken string) (*tokenClaims, error) {
+	return s.parseToken(requestToken, accessTokenIssuer)
+}
+
+func (s *UserServiceImpl) parseToken(requestToken, issuer string) (*tokenClaims, error) {
+	claims := tokenClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		requestToken,
+		&claims,
+		s.jwtKeys.Keyfunc,
+		jwt.WithValidMethods(s.jwtKeys.ValidMethods()),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (s *UserServiceImpl) ValidateUserJWT(ctx context.Context, requestToken string) (*user.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ValidateUserJWT")
+	defer span.End()
+
+	claims, err := s.parseAccessToken(requestToken)
 	if err != nil {
 		return nil, err
 	}
 
-	userIDInt, err := strconv.Atoi(userID)
+	userIDInt, err := strconv.Atoi(claims.Subject)
 	if err != nil {
 		return nil, err
 	}
 
+	issuedAt := time.Time{}
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	if s.denylist.IsRevoked(ctx, int32(userIDInt), claims.ID, issuedAt) {
+		return nil, user.ErrTokenRevoked
+	}
+
 	validatedUser, err := s.userRepo.SelectUserByID(ctx, int32(userIDInt))
 	if err != nil {
 		return nil, err
 	}
 
+	if validatedUser.IsDisabled() {
+		return nil, user.ErrUserDisabled
+	}
+
+	// tokens issued before roles existed carry no role claim
+	tokenRole := claims.Role
+	if tokenRole == "" {
+		tokenRole = user.RoleUser
+	}
+
+	// a token issued before the user's role changed must be refreshed to
+	// pick up the new role
+	if tokenRole != validatedUser.Role {
+		return nil, user.ErrTokenRevoked
+	}
+
 	return validatedUser, nil
 }
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/mailer"
+	"url-short/internal/repository"
+	"url-short/internal/tracing"
+)
+
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, request workspace.CreateWorkspaceRequest) (*workspace.Workspace, error)
+	ListWorkspaces(ctx context.Context, userID int32) ([]workspace.Membership, error)
+	ListMembers(ctx context.Context, userID int32, workspaceID int32) ([]workspace.Member, error)
+	InviteMember(ctx context.Context, request workspace.InviteMemberRequest) (*workspace.Invite, error)
+	AcceptInvite(ctx context.Context, request workspace.AcceptInviteRequest) (*workspace.Member, error)
+	SetMemberRole(ctx context.Context, actorID int32, request workspace.SetMemberRoleRequest) (*workspace.Member, error)
+	RemoveMember(ctx context.Context, actorID int32, workspaceID int32, userID int32) error
+	ListURLs(ctx context.Context, userID int32, workspaceID int32) ([]shorturl.URL, error)
+}
+
+const workspaceInviteLifetime = 7 * 24 * time.Hour
+
+type WorkspaceServiceImpl struct {
+	workspaceRepo repository.WorkspaceRepository
+	urlRepo       repository.URLRepository
+	mailer        mailer.Mailer
+	inviteURL     string
+}
+
+// NewWorkspaceServiceImpl sends invite tokens as a token query parameter on
+// inviteURL, the page at that URL is expected to post the token back to the
+// accept endpoint for the logged in user.
+func NewWorkspaceServiceImpl(
+	w repository.WorkspaceRepository,
+	l repository.URLRepository,
+	m mailer.Mailer,
+	inviteURL string,
+) *WorkspaceServiceImpl {
+	return &WorkspaceServiceImpl{
+		workspaceRepo: w,
+		urlRepo:       l,
+		mailer:        m,
+		inviteURL:     inviteURL,
+	}
+}
+
+func (s *WorkspaceServiceImpl) CreateWorkspace(
+	ctx context.Context,
+	request workspace.CreateWorkspaceRequest,
+) (*workspace.Workspace, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.CreateWorkspace")
+	defer span.End()
+
+	return s.workspaceRepo.CreateWorkspace(ctx, request)
+}
+
+func (s *WorkspaceServiceImpl) ListWorkspaces(ctx context.Context, userID int32) ([]workspace.Membership, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.ListWorkspaces")
+	defer span.End()
+
+	return s.workspaceRepo.ListUserWorkspaces(ctx, userID)
+}
+
+func (s *WorkspaceServiceImpl) ListMembers(
+	ctx context.Context,
+	userID int32,
+	workspaceID int32,
+) ([]workspace.Member, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.ListMembers")
+	defer span.End()
+
+	if _, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, userID, workspace.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	return s.workspaceRepo.ListMembers(ctx, workspaceID)
+}
+
+// InviteMember emails an invite to join the workspace with the requested
+// role, members can only invite others to roles they can manage.
+func (s *WorkspaceServiceImpl) InviteMember(
+	ctx context.Context,
+	request workspace.InviteMemberRequest,
+) (*workspace.Invite, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.InviteMember")
+	defer span.End()
+
+	inviter, err := authorizeWorkspaceMember(
+		ctx,
+		s.workspaceRepo,
+		request.WorkspaceID,
+		request.InvitedBy,
+		workspace.RoleAdmin,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inviter.Role.CanManage(request.Role) {
+		return nil, workspace.ErrInsufficientRole
+	}
+
+	invitedTo, err := s.workspaceRepo.SelectWorkspace(ctx, request.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitedTo.IsPersonal() {
+		return nil, workspace.ErrPersonalWorkspace
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	invite, err := s.workspaceRepo.CreateInvite(
+		ctx,
+		*workspace.NewCreateInviteRequest(request, token, time.Now().Add(workspaceInviteLifetime)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("token", token)
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      request.Email,
+		Subject: fmt.Sprintf("You have been invited to %s on url-short", invitedTo.Name),
+		Body: fmt.Sprintf(
+			"%s invited you to join the %s workspace on url-short as %s.\n\n"+
+				"Log in or sign up with this email address and use the link below within %d days to accept:\n\n%s",
+			inviter.Email,
+			invitedTo.Name,
+			request.Role,
+			int(workspaceInviteLifetime.Hours()/24),
+			s.inviteURL+"?"+query.Encode(),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// AcceptInvite spends the invite and adds the user to its workspace with the
+// role they were invited to.
+func (s *WorkspaceServiceImpl) AcceptInvite(
+	ctx context.Context,
+	request workspace.AcceptInviteRequest,
+) (*workspace.Member, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.AcceptInvite")
+	defer span.End()
+
+	invite, err := s.workspaceRepo.ConsumeInvite(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.workspaceRepo.CreateMember(ctx, invite.WorkspaceID, request.UserID, invite.Role); err != nil {
+		return nil, err
+	}
+
+	return s.workspaceRepo.SelectMember(ctx, invite.WorkspaceID, request.UserID)
+}
+
+// SetMemberRole changes a member's role. The actor must be able to manage
+// both the member's current role and the new one, and the last owner can not
+// be demoted.
+func (s *WorkspaceServiceImpl) SetMemberRole(
+	ctx context.Context,
+	actorID int32,
+	request workspace.SetMemberRoleRequest,
+) (*workspace.Member, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.SetMemberRole")
+	defer span.End()
+
+	actor, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, request.WorkspaceID, actorID, workspace.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.workspaceRepo.SelectMember(ctx, request.WorkspaceID, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actor.Role.CanManage(member.Role) || !actor.Role.CanManage(request.Role) {
+		return nil, workspace.ErrInsufficientRole
+	}
+
+	// the repository refuses to demote the last owner
+	if err := s.workspaceRepo.SetMemberRole(ctx, request); err != nil {
+		return nil, err
+	}
+
+	return s.workspaceRepo.SelectMember(ctx, request.WorkspaceID, request.UserID)
+}
+
+// RemoveMember takes a member out of the workspace, the links they created
+// stay in it. Members can always leave, except the last owner and the owner
+// of a personal workspace.
+func (s *WorkspaceServiceImpl) RemoveMember(
+	ctx context.Context,
+	actorID int32,
+	workspaceID int32,
+	userID int32,
+) error {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.RemoveMember")
+	defer span.End()
+
+	var member *workspace.Member
+
+	if actorID == userID {
+		leaving, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, actorID, workspace.RoleViewer)
+		if err != nil {
+			return err
+		}
+
+		left, err := s.workspaceRepo.SelectWorkspace(ctx, workspaceID)
+		if err != nil {
+			return err
+		}
+
+		if left.IsPersonal() {
+			return workspace.ErrPersonalWorkspace
+		}
+
+		member = leaving
+	} else {
+		actor, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, actorID, workspace.RoleAdmin)
+		if err != nil {
+			return err
+		}
+
+		member, err = s.workspaceRepo.SelectMember(ctx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+
+		if !actor.Role.CanManage(member.Role) {
+			return workspace.ErrInsufficientRole
+		}
+	}
+
+	// the repository refuses to remove the last owner
+	return s.workspaceRepo.DeleteMember(ctx, workspaceID, userID)
+}
+
+func (s *WorkspaceServiceImpl) ListURLs(
+	ctx context.Context,
+	userID int32,
+	workspaceID int32,
+) ([]shorturl.URL, error) {
+	ctx, span := tracing.Start(ctx, "WorkspaceService.ListURLs")
+	defer span.End()
+
+	if _, err := authorizeWorkspaceMember(ctx, s.workspaceRepo, workspaceID, userID, workspace.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	return s.urlRepo.ListWorkspaceURLs(ctx, workspaceID, userID)
+}
+
+// authorizeWorkspaceMember returns the user's membership when their role
+// allows required. Users who are not members are told the workspace does not
+// exist.
+func authorizeWorkspaceMember(
+	ctx context.Context,
+	workspaceRepo repository.WorkspaceRepository,
+	workspaceID int32,
+	userID int32,
+	required workspace.Role,
+) (*workspace.Member, error) {
+	member, err := workspaceRepo.SelectMember(ctx, workspaceID, userID)
+	if err == workspace.ErrMemberNotFound {
+		return nil, workspace.ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !member.Role.Allows(required) {
+		return nil, workspace.ErrInsufficientRole
+	}
+
+	return member, nil
+}
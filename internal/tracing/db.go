@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"url-short/internal/database"
+)
+
+// DB traces the queries run through a database.DBTX, each span is named
+// after the sqlc query that ran.
+type DB struct {
+	db database.DBTX
+}
+
+func NewDB(db database.DBTX) *DB {
+	return &DB{
+		db: db,
+	}
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	res, err := d.db.ExecContext(ctx, query, args...)
+	RecordError(span, err)
+
+	return res, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	stmt, err := d.db.PrepareContext(ctx, query)
+	RecordError(span, err)
+
+	return stmt, err
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	RecordError(span, err)
+
+	return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := d.start(ctx, query)
+	defer span.End()
+
+	row := d.db.QueryRowContext(ctx, query, args...)
+
+	// a missing row is an answer, not a failure
+	if err := row.Err(); !errors.Is(err, sql.ErrNoRows) {
+		RecordError(span, err)
+	}
+
+	return row
+}
+
+func (d *DB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := QueryName(query)
+
+	return Start(
+		ctx,
+		"db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// QueryName reads the name sqlc gives a query from the comment it starts
+// with, queries without one are named query.
+func QueryName(query string) string {
+	rest, found := strings.CutPrefix(query, "-- name: ")
+	if !found {
+		return "query"
+	}
+
+	name, _, _ := strings.Cut(rest, " ")
+
+	return name
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type accountHandler struct {
+	accountService service.AccountService
+}
+
+func NewAccountHandler(accountService service.AccountService) *accountHandler {
+	return &accountHandler{
+		accountService: accountService,
+	}
+}
+
+type profileHTTPResponseBody struct {
+	ID                int32      `json:"id"`
+	Email             string     `json:"email"`
+	Role              user.Role  `json:"role"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	EmailVerified     bool       `json:"email_verified"`
+	EmailVerifiedAt   *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled  bool       `json:"two_factor_enabled"`
+	LinkCount         int64      `json:"link_count"`
+	DisabledLinkCount int64      `json:"disabled_link_count"`
+}
+
+func newProfileHTTPResponseBody(profile *user.Profile) profileHTTPResponseBody {
+	return profileHTTPResponseBody{
+		ID:                profile.User.Id,
+		Email:             profile.User.Email,
+		Role:              profile.User.Role,
+		CreatedAt:         profile.User.CreatedAt,
+		UpdatedAt:         profile.User.UpdatedAt,
+		EmailVerified:     profile.User.IsEmailVerified(),
+		EmailVerifiedAt:   optionalTime(profile.User.EmailVerifiedAt),
+		TwoFactorEnabled:  profile.TwoFactorEnabled,
+		LinkCount:         profile.Links.Total,
+		DisabledLinkCount: profile.Links.Disabled,
+	}
+}
+
+func (handler *accountHandler) GetProfile(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	profile, err := handler.accountService.GetProfile(r.Context(), authUser.Id)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newProfileHTTPResponseBody(profile))
+}
+
+type updateProfileHTTPRequestBody struct {
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"current_password"`
+	TwoFactorCode   string  `json:"two_factor_code"`
+}
+
+// UpdateProfile changes only the fields present in the body, every change
+// needs the current password.
+func (handler *accountHandler) UpdateProfile(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := updateProfileHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	updateRequest, err := user.NewUpdateProfileRequest(
+		authUser.Id,
+		payload.Email,
+		payload.Password,
+		payload.CurrentPassword,
+		payload.TwoFactorCode,
+		clientIP(r),
+	)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	profile, err := handler.accountService.UpdateProfile(r.Context(), *updateRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newProfileHTTPResponseBody(profile))
+}
+
+type exportProfile struct {
+	ID               int32            `json:"id"`
+	Email            string           `json:"email"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	EmailVerifiedAt  *time.Time       `json:"email_verified_at"`
+	TwoFactorEnabled bool             `json:"two_factor_enabled"`
+	Identities       []exportIdentity `json:"identities"`
+}
+
+type exportIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportLink struct {
+	ShortURL  string    `json:"short_url"`
+	LongURL   string    `json:"long_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type exportClicks struct {
+	ShortURL string `json:"short_url"`
+	Day      string `json:"day"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// ExportUserData responds with a zip of JSON files holding everything stored
+// about the user.
+func (handler *accountHandler) ExportUserData(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	export, err := handler.accountService.ExportUserData(r.Context(), authUser.Id)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	// the archive is built in memory first so a failure can still be reported
+	// as a JSON error
+	archive, err := newExportArchive(export)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, user.ErrUnexpectedError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/zip")
+	w.Header().Set(
+		"content-disposition",
+		fmt.Sprintf(`attachment; filename="url-short-export-%d.zip"`, export.User.Id),
+	)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(archive); err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
+
+func newExportArchive(export *user.DataExport) ([]byte, error) {
+	profile := exportProfile{
+		ID:               export.User.Id,
+		Email:            export.User.Email,
+		CreatedAt:        export.User.CreatedAt,
+		UpdatedAt:        export.User.UpdatedAt,
+		EmailVerifiedAt:  optionalTime(export.User.EmailVerifiedAt),
+		TwoFactorEnabled: export.TwoFactorEnabled,
+		Identities:       []exportIdentity{},
+	}
+	for _, identity := range export.Identities {
+		profile.Identities = append(profile.Identities, exportIdentity{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	links := []exportLink{}
+	for _, link := range export.Links {
+		links = append(links, exportLink{
+			ShortURL:  link.ShortURL,
+			LongURL:   link.LongURL,
+			CreatedAt: link.CreatedAt,
+			UpdatedAt: link.UpdatedAt,
+		})
+	}
+
+	sessions := []exportSession{}
+	for _, session := range export.Sessions {
+		sessions = append(sessions, exportSession{
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+			UsedAt:    optionalTime(session.UsedAt),
+			RevokedAt: optionalTime(session.RevokedAt),
+		})
+	}
+
+	clicks := []exportClicks{}
+	for _, click := range export.Clicks {
+		clicks = append(clicks, exportClicks{
+			ShortURL: click.ShortURL,
+			Day:      click.Day.Format(time.DateOnly),
+			Clicks:   click.Clicks,
+		})
+	}
+
+	files := []struct {
+		name    string
+		payload any
+	}{
+		{"profile.json", profile},
+		{"links.json", links},
+		{"sessions.json", sessions},
+		{"clicks.json", clicks},
+	}
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// optionalTime exports an unset time as null rather than the zero time.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+type deleteUserHTTPRequestBody struct {
+	Password string `json:"password"`
+}
+
+type deleteUserHTTPResponseBody struct {
+	ID          int32     `json:"id"`
+	RequestedAt time.Time `json:"requested_at"`
+	PurgeAfter  time.Time `json:"purge_after"`
+}
+
+// DeleteUser schedules the user's account to be purged once the grace period
+// is over, logging in before then cancels it.
+func (handler *accountHandler) DeleteUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := deleteUserHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	deleteUserRequest, err := user.NewDeleteUserRequest(authUser.Id, payload.Password, clientIP(r))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	deletion, err := handler.accountService.ScheduleUserDeletion(r.Context(), *deleteUserRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, deleteUserHTTPResponseBody{
+		ID:          deletion.UserID,
+		RequestedAt: deletion.RequestedAt,
+		PurgeAfter:  deletion.PurgeAfter,
+	})
+}
@@ -0,0 +1,362 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/shorturl"
+	userDomain "url-short/internal/domain/user"
+)
+
+func TestExportUserData(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	_, err = loginUserOne(app)
+	if err != nil {
+		t.Errorf("can not login user one for test case with err %q", err)
+	}
+
+	user, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.google.com")
+	link, err := app.URLService.CreateShortURL(context.Background(), *createRequest)
+	if err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	_, err = app.URLService.GetLongURL(context.Background(), link.ShortURL)
+	if err != nil {
+		t.Fatalf("could not follow short url %q", err)
+	}
+
+	if _, err := app.Clicks.Flush(context.Background()); err != nil {
+		t.Fatalf("could not store clicks %q", err)
+	}
+
+	accounts := NewAccountHandler(app.AccountService)
+
+	t.Run("test export is a zip of the user's data", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me/export", http.NoBody)
+		response := httptest.NewRecorder()
+		accounts.ExportUserData(response, request, user)
+
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		if got := response.Header().Get("content-type"); got != "application/zip" {
+			t.Errorf("got content type %q want %q", got, "application/zip")
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+		if err != nil {
+			t.Fatalf("could not read export archive %q", err)
+		}
+
+		files := map[string]*zip.File{}
+		for _, file := range archive.File {
+			files[file.Name] = file
+		}
+
+		for _, name := range []string{"profile.json", "links.json", "sessions.json", "clicks.json"} {
+			if files[name] == nil {
+				t.Errorf("export is missing %q", name)
+			}
+		}
+
+		profile := exportProfile{}
+		readExportFile(t, files["profile.json"], &profile)
+		if profile.Email != user.Email {
+			t.Errorf("got profile email %q want %q", profile.Email, user.Email)
+		}
+
+		links := []exportLink{}
+		readExportFile(t, files["links.json"], &links)
+		if len(links) != 1 || links[0].ShortURL != link.ShortURL {
+			t.Errorf("got links %v want %q", links, link.ShortURL)
+		}
+
+		sessions := []exportSession{}
+		readExportFile(t, files["sessions.json"], &sessions)
+		if len(sessions) != 1 {
+			t.Errorf("got %d sessions want 1", len(sessions))
+		}
+
+		clicks := []exportClicks{}
+		readExportFile(t, files["clicks.json"], &clicks)
+		if len(clicks) != 1 || clicks[0].Clicks != 1 {
+			t.Errorf("got clicks %v want one click on %q", clicks, link.ShortURL)
+		}
+	})
+}
+
+func readExportFile(t *testing.T, file *zip.File, v any) {
+	t.Helper()
+
+	if file == nil {
+		return
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		t.Fatalf("could not open %q %q", file.Name, err)
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(v); err != nil {
+		t.Fatalf("could not parse %q %q", file.Name, err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	userOne, err := loginUserOne(app)
+	if err != nil {
+		t.Errorf("can not login user one for test case with err %q", err)
+	}
+
+	user, err := app.UserRepo.SelectUser(context.Background(), userOne.Email)
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.google.com")
+	link, err := app.URLService.CreateShortURL(context.Background(), *createRequest)
+	if err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	// following the link puts it in the cache
+	_, err = app.URLService.GetLongURL(context.Background(), link.ShortURL)
+	if err != nil {
+		t.Fatalf("could not follow short url %q", err)
+	}
+
+	// a zero grace period makes a deletion due straight away
+	accountService := newTestAccountService(app, 0)
+	accounts := NewAccountHandler(accountService)
+
+	deleteUser := func(body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodDelete, "/api/v1/users/me", bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		accounts.DeleteUser(response, request, user)
+
+		return response
+	}
+
+	t.Run("test deletion needs the user's password", func(t *testing.T) {
+		response := deleteUser(`{"password": "not-the-password"}`)
+
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test logging in cancels a scheduled deletion", func(t *testing.T) {
+		response := deleteUser(`{"password": "test-password"}`)
+		if response.Result().StatusCode != http.StatusAccepted {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusAccepted)
+		}
+
+		_, err := app.UserService.ValidateUserJWT(context.Background(), userOne.Token)
+		if err != userDomain.ErrTokenRevoked {
+			t.Errorf("got %v want %v", err, userDomain.ErrTokenRevoked)
+		}
+
+		_, err = loginUserOne(app)
+		if err != nil {
+			t.Fatalf("can not login user one for test case with err %q", err)
+		}
+
+		purged, err := accountService.PurgeDeletedUsers(context.Background())
+		if err != nil || purged != 0 {
+			t.Errorf("got %d purged users and %v want none", purged, err)
+		}
+	})
+
+	t.Run("test deleted users are purged with their links", func(t *testing.T) {
+		response := deleteUser(`{"password": "test-password"}`)
+		if response.Result().StatusCode != http.StatusAccepted {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusAccepted)
+		}
+
+		purged, err := accountService.PurgeDeletedUsers(context.Background())
+		if err != nil || purged != 1 {
+			t.Fatalf("got %d purged users and %v want 1", purged, err)
+		}
+
+		_, err = app.UserRepo.SelectUserByID(context.Background(), user.Id)
+		if err != userDomain.ErrUserNotFound {
+			t.Errorf("got %v want %v", err, userDomain.ErrUserNotFound)
+		}
+
+		_, err = app.URLRepo.GetURLByHash(context.Background(), link.ShortURL)
+		if err != shorturl.ErrURLNotFound {
+			t.Errorf("got %v want %v", err, shorturl.ErrURLNotFound)
+		}
+
+		_, err = app.CacheRepo.GetURL(context.Background(), link.ShortURL)
+		if err == nil {
+			t.Errorf("purged link %q is still cached", link.ShortURL)
+		}
+	})
+}
+
+func TestProfile(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	login, err := loginUserOne(app)
+	if err != nil {
+		t.Errorf("can not login user one for test case with err %q", err)
+	}
+
+	user, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.google.com")
+	if _, err := app.URLService.CreateShortURL(context.Background(), *createRequest); err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	accounts := NewAccountHandler(app.AccountService)
+
+	update := func(body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPatch, "/api/v1/users/me", bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		accounts.UpdateProfile(response, request, user)
+
+		return response
+	}
+
+	t.Run("test profile shows account status and link counts", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me", http.NoBody)
+		response := httptest.NewRecorder()
+		accounts.GetProfile(response, request, user)
+
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := profileHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if got.Email != "test@mail.com" || got.EmailVerified || got.TwoFactorEnabled || got.LinkCount != 1 {
+			t.Errorf("got profile %+v want an unverified user with 1 link", got)
+		}
+
+		if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+			t.Errorf("got profile %+v want timestamps", got)
+		}
+	})
+
+	t.Run("test changes need the current password", func(t *testing.T) {
+		response := update(`{"email": "new@mail.com"}`)
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+
+		response = update(`{"password": "another-password", "current_password": "wrong-password"}`)
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test changing only the email keeps the password", func(t *testing.T) {
+		app.Mailbox.Reset()
+
+		response := update(`{"email": "new@mail.com", "current_password": "test-password"}`)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := profileHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if got.Email != "new@mail.com" || got.EmailVerified {
+			t.Errorf("got profile %+v want the new unverified email", got)
+		}
+
+		if !bytes.Contains(app.Mailbox.Bytes(), []byte("new@mail.com")) {
+			t.Errorf("no verification email was sent to the new email")
+		}
+
+		loginRequest, _ := userDomain.NewLoginUserRequest("new@mail.com", "test-password", "")
+		if _, err := app.UserService.LoginUser(context.Background(), *loginRequest); err != nil {
+			t.Errorf("could not log in with the unchanged password %q", err)
+		}
+	})
+
+	t.Run("test changing the password revokes existing tokens", func(t *testing.T) {
+		response := update(`{"password": "another-password", "current_password": "test-password"}`)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		if _, err := app.UserService.ValidateUserJWT(context.Background(), login.Token); err == nil {
+			t.Errorf("access token issued before the password change is still valid")
+		}
+
+		loginRequest, _ := userDomain.NewLoginUserRequest("new@mail.com", "another-password", "")
+		if _, err := app.UserService.LoginUser(context.Background(), *loginRequest); err != nil {
+			t.Errorf("could not log in with the new password %q", err)
+		}
+	})
+
+	t.Run("test wrong current passwords count towards the login lockout", func(t *testing.T) {
+		for range 5 {
+			update(`{"password": "guessed-password", "current_password": "wrong-password"}`)
+		}
+
+		response := update(`{"password": "guessed-password", "current_password": "another-password"}`)
+		if response.Result().StatusCode != http.StatusTooManyRequests {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusTooManyRequests)
+		}
+
+		loginRequest, _ := userDomain.NewLoginUserRequest("new@mail.com", "another-password", "")
+		if _, err := app.UserService.LoginUser(context.Background(), *loginRequest); !errors.Is(err, userDomain.ErrTooManyLoginAttempts) {
+			t.Errorf("got %v want logins to be locked as well", err)
+		}
+	})
+}
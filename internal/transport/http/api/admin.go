@@ -0,0 +1,390 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/service"
+)
+
+type adminHandler struct {
+	adminService service.AdminService
+}
+
+func NewAdminHandler(adminService service.AdminService) *adminHandler {
+	return &adminHandler{
+		adminService: adminService,
+	}
+}
+
+type adminUserHTTPResponseBody struct {
+	ID              int32      `json:"id"`
+	Email           string     `json:"email"`
+	Role            user.Role  `json:"role"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+}
+
+func newAdminUserHTTPResponseBody(u *user.User) adminUserHTTPResponseBody {
+	return adminUserHTTPResponseBody{
+		ID:              u.Id,
+		Email:           u.Email,
+		Role:            u.Role,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		EmailVerifiedAt: optionalTime(u.EmailVerifiedAt),
+		DisabledAt:      optionalTime(u.DisabledAt),
+	}
+}
+
+type listUsersHTTPResponseBody struct {
+	Users  []adminUserHTTPResponseBody `json:"users"`
+	Limit  int32                       `json:"limit"`
+	Offset int32                       `json:"offset"`
+}
+
+type adminURLHTTPResponseBody struct {
+	ID             int32                  `json:"id"`
+	ShortURL       string                 `json:"short_url"`
+	LongURL        string                 `json:"long_url"`
+	UserID         int32                  `json:"user_id"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+	DisabledAt     *time.Time             `json:"disabled_at"`
+	DisabledReason shorturl.DisableReason `json:"disabled_reason,omitempty"`
+}
+
+func newAdminURLHTTPResponseBody(u *shorturl.URL) adminURLHTTPResponseBody {
+	return adminURLHTTPResponseBody{
+		ID:             u.ID,
+		ShortURL:       u.ShortURL,
+		LongURL:        u.LongURL,
+		UserID:         u.UserID,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+		DisabledAt:     optionalTime(u.DisabledAt),
+		DisabledReason: u.DisabledReason,
+	}
+}
+
+type listURLsHTTPResponseBody struct {
+	URLs   []adminURLHTTPResponseBody `json:"urls"`
+	Limit  int32                      `json:"limit"`
+	Offset int32                      `json:"offset"`
+}
+
+func newActor(r *http.Request, authUser *user.User) audit.Actor {
+	return *audit.NewActor(authUser.Id, clientIP(r))
+}
+
+// ListUsers searches users by the q query parameter, paged by limit and
+// offset.
+func (handler *adminHandler) ListUsers(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	query := r.URL.Query()
+
+	listUsersRequest, err := user.NewListUsersRequest(query.Get("q"), query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	users, err := handler.adminService.ListUsers(r.Context(), newActor(r, authUser), *listUsersRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	response := listUsersHTTPResponseBody{
+		Users:  []adminUserHTTPResponseBody{},
+		Limit:  listUsersRequest.Limit,
+		Offset: listUsersRequest.Offset,
+	}
+	for _, u := range users {
+		response.Users = append(response.Users, newAdminUserHTTPResponseBody(&u))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (handler *adminHandler) DisableUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.DisableUser(r.Context(), newActor(r, authUser), userID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAdminUserHTTPResponseBody(res))
+}
+
+func (handler *adminHandler) EnableUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.EnableUser(r.Context(), newActor(r, authUser), userID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAdminUserHTTPResponseBody(res))
+}
+
+func (handler *adminHandler) LogoutUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = handler.adminService.LogoutUser(r.Context(), newActor(r, authUser), userID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type setUserRoleHTTPRequestBody struct {
+	Role string `json:"role"`
+}
+
+func (handler *adminHandler) SetUserRole(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := setUserRoleHTTPRequestBody{}
+
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	role, err := user.NewRole(payload.Role)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.SetUserRole(r.Context(), newActor(r, authUser), userID, role)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAdminUserHTTPResponseBody(res))
+}
+
+type setPlanHTTPRequestBody struct {
+	Plan string `json:"plan"`
+}
+
+// SetUserPlan moves the user's personal workspace to another plan.
+func (handler *adminHandler) SetUserPlan(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := setPlanHTTPRequestBody{}
+
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.SetUserPlan(r.Context(), newActor(r, authUser), userID, payload.Plan)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUsageHTTPResponseBody(res))
+}
+
+func (handler *adminHandler) SetWorkspacePlan(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := setPlanHTTPRequestBody{}
+
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.SetWorkspacePlan(r.Context(), newActor(r, authUser), workspaceID, payload.Plan)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUsageHTTPResponseBody(res))
+}
+
+// ListURLs searches every user's links by the q query parameter, paged by
+// limit and offset.
+func (handler *adminHandler) ListURLs(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	query := r.URL.Query()
+
+	limit, offset, err := user.ParsePage(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	listURLsRequest := shorturl.NewListURLsRequest(query.Get("q"), limit, offset)
+
+	urls, err := handler.adminService.ListURLs(r.Context(), newActor(r, authUser), *listURLsRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	response := listURLsHTTPResponseBody{
+		URLs:   []adminURLHTTPResponseBody{},
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, u := range urls {
+		response.URLs = append(response.URLs, newAdminURLHTTPResponseBody(&u))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+type disableURLHTTPRequestBody struct {
+	Reason string `json:"reason"`
+}
+
+func (handler *adminHandler) DisableURL(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := disableURLHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	disableURLRequest, err := shorturl.NewDisableURLRequest(r.PathValue("shortUrl"), payload.Reason)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.DisableURL(r.Context(), newActor(r, authUser), *disableURLRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAdminURLHTTPResponseBody(res))
+}
+
+func (handler *adminHandler) EnableURL(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	shortURL, err := shorturl.NewShortURL(r.PathValue("shortUrl"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.adminService.EnableURL(r.Context(), newActor(r, authUser), shortURL)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newAdminURLHTTPResponseBody(res))
+}
+
+// ListAuditEvents searches the audit log by the user_id, actor_id, type,
+// since and until query parameters, paged by limit and offset.
+func (handler *adminHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	query := r.URL.Query()
+
+	listEventsRequest, err := audit.NewListEventsRequest(
+		query.Get("user_id"),
+		query.Get("actor_id"),
+		query.Get("type"),
+		query.Get("since"),
+		query.Get("until"),
+		query.Get("limit"),
+		query.Get("offset"),
+	)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	events, err := handler.adminService.ListAuditEvents(r.Context(), newActor(r, authUser), *listEventsRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(
+		w,
+		http.StatusOK,
+		newListAuditEventsHTTPResponseBody(events, listEventsRequest.Limit, listEventsRequest.Offset),
+	)
+}
+
+type verifyAuditChainHTTPResponseBody struct {
+	Intact        bool   `json:"intact"`
+	Events        int64  `json:"events"`
+	HeadHash      string `json:"head_hash"`
+	FirstBrokenID int64  `json:"first_broken_id,omitempty"`
+}
+
+func (handler *adminHandler) VerifyAuditChain(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	verification, err := handler.adminService.VerifyAuditChain(r.Context(), newActor(r, authUser))
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, verifyAuditChainHTTPResponseBody{
+		Intact:        verification.Intact(),
+		Events:        verification.Events,
+		HeadHash:      verification.HeadHash,
+		FirstBrokenID: verification.FirstBrokenID,
+	})
+}
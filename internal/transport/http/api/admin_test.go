@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/shorturl"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	// the role is checked on the already authenticated user
+	auth := NewAuthHandler(nil)
+
+	handler := auth.AuthorizationMiddleware(
+		userDomain.RoleAdmin,
+		func(w http.ResponseWriter, r *http.Request, u *userDomain.User) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+	)
+
+	cases := []struct {
+		name string
+		role userDomain.Role
+		want int
+	}{
+		{"test users can not use admin endpoints", userDomain.RoleUser, http.StatusForbidden},
+		{"test admins can use admin endpoints", userDomain.RoleAdmin, http.StatusNoContent},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/api/v1/admin/users", http.NoBody)
+			response := httptest.NewRecorder()
+			handler(response, request, &userDomain.User{Id: 1, Role: c.role})
+
+			if response.Result().StatusCode != c.want {
+				t.Errorf("got status %d want %d", response.Result().StatusCode, c.want)
+			}
+		})
+	}
+}
+
+func TestAdminModeration(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	auditEvents := &auditRecorder{}
+	admin := NewAdminHandler(service.NewAdminServiceImpl(
+		app.UserRepo,
+		app.URLRepo,
+		app.TokenRepo,
+		app.CacheRepo,
+		app.TokenDenylist,
+		auditEvents,
+		app.QuotaService,
+	))
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	userOne, err := loginUserOne(app)
+	if err != nil {
+		t.Errorf("can not login user one for test case with err %q", err)
+	}
+
+	createAdmin, _ := userDomain.NewCreateUserRequest("admin@mail.com", "admin-password")
+	adminUser, err := app.UserService.CreateUser(context.Background(), *createAdmin)
+	if err != nil {
+		t.Fatalf("could not create admin %q", err)
+	}
+
+	adminUser, err = app.UserRepo.SetUserRole(context.Background(), adminUser.Id, userDomain.RoleAdmin)
+	if err != nil {
+		t.Fatalf("could not promote admin %q", err)
+	}
+
+	createRequest, _ := shorturl.NewCreateURLRequest(userOne.ID, "https://www.google.com")
+	link, err := app.URLService.CreateShortURL(context.Background(), *createRequest)
+	if err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	call := func(handler authedHandeler, method, target, pathKey, pathValue, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		request.SetPathValue(pathKey, pathValue)
+		response := httptest.NewRecorder()
+		handler(response, request, adminUser)
+
+		return response
+	}
+
+	userID := strconv.Itoa(int(userOne.ID))
+
+	t.Run("test admins can search users", func(t *testing.T) {
+		response := call(admin.ListUsers, http.MethodGet, "/api/v1/admin/users?q=test%40", "", "", "")
+
+		got := listUsersHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if len(got.Users) != 1 || got.Users[0].Email != userOne.Email {
+			t.Errorf("got users %v want only %q", got.Users, userOne.Email)
+		}
+	})
+
+	t.Run("test disabled users can not log in or use their tokens", func(t *testing.T) {
+		response := call(admin.DisableUser, http.MethodPost, "/api/v1/admin/users/"+userID+"/disable", "id", userID, "")
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		_, err := app.UserService.ValidateUserJWT(context.Background(), userOne.Token)
+		if err == nil {
+			t.Errorf("token of disabled user was accepted")
+		}
+
+		loginRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(UserOne))
+		loginResponse := httptest.NewRecorder()
+		NewUserHandler(app.UserService).LoginUser(loginResponse, loginRequest)
+
+		if loginResponse.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("got status %d want %d", loginResponse.Result().StatusCode, http.StatusForbidden)
+		}
+
+		response = call(admin.EnableUser, http.MethodPost, "/api/v1/admin/users/"+userID+"/enable", "id", userID, "")
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		_, err = loginUserOne(app)
+		if err != nil {
+			t.Errorf("could not log in after being enabled %q", err)
+		}
+	})
+
+	t.Run("test admins can not disable themselves", func(t *testing.T) {
+		adminID := strconv.Itoa(int(adminUser.Id))
+		response := call(admin.DisableUser, http.MethodPost, "/api/v1/admin/users/"+adminID+"/disable", "id", adminID, "")
+
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test disabled links are not served", func(t *testing.T) {
+		urls := NewShortUrlHandler(app.URLService)
+
+		follow := func() int {
+			request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/urls/%s", link.ShortURL), http.NoBody)
+			request.SetPathValue("shortUrl", link.ShortURL)
+			response := httptest.NewRecorder()
+			urls.GetShortURL(response, request)
+
+			return response.Result().StatusCode
+		}
+
+		// caches the link before it is taken down
+		if got := follow(); got != http.StatusMovedPermanently {
+			t.Fatalf("got status %d want %d", got, http.StatusMovedPermanently)
+		}
+
+		cases := []struct {
+			reason string
+			want   int
+		}{
+			{"legal", http.StatusUnavailableForLegalReasons},
+			{"removed", http.StatusGone},
+		}
+
+		for _, c := range cases {
+			response := call(
+				admin.DisableURL,
+				http.MethodPost,
+				"/api/v1/admin/urls/"+link.ShortURL+"/disable",
+				"shortUrl",
+				link.ShortURL,
+				`{"reason": "`+c.reason+`"}`,
+			)
+			if response.Result().StatusCode != http.StatusOK {
+				t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+			}
+
+			if got := follow(); got != c.want {
+				t.Errorf("got status %d want %d for reason %q", got, c.want, c.reason)
+			}
+		}
+
+		response := call(admin.EnableURL, http.MethodPost, "/api/v1/admin/urls/"+link.ShortURL+"/enable", "shortUrl", link.ShortURL, "")
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		if got := follow(); got != http.StatusMovedPermanently {
+			t.Errorf("got status %d want %d", got, http.StatusMovedPermanently)
+		}
+	})
+
+	t.Run("test redirects that read a link before it was disabled do not cache it", func(t *testing.T) {
+		response := call(
+			admin.DisableURL,
+			http.MethodPost,
+			"/api/v1/admin/urls/"+link.ShortURL+"/disable",
+			"shortUrl",
+			link.ShortURL,
+			`{"reason": "legal"}`,
+		)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		// what a redirect that read the link before the disable committed
+		// writes once the admin has evicted it
+		if err := app.CacheRepo.InsertURL(context.Background(), link.ShortURL, link.LongURL, time.Hour); err != nil {
+			t.Fatalf("could not write to the cache %q", err)
+		}
+
+		if _, err := app.URLService.GetLongURL(context.Background(), link.ShortURL); err != shorturl.ErrURLUnavailableForLegalReasons {
+			t.Errorf("got %v want %v", err, shorturl.ErrURLUnavailableForLegalReasons)
+		}
+
+		response = call(admin.EnableURL, http.MethodPost, "/api/v1/admin/urls/"+link.ShortURL+"/enable", "shortUrl", link.ShortURL, "")
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("test admin actions are audited", func(t *testing.T) {
+		want := []audit.EventType{
+			audit.EventAdminUsersListed,
+			audit.EventAdminUserDisabled,
+			audit.EventAdminUserEnabled,
+			audit.EventAdminURLDisabled,
+			audit.EventAdminURLDisabled,
+			audit.EventAdminURLEnabled,
+		}
+
+		if len(auditEvents.events) != len(want) {
+			t.Fatalf("got %d audit events want %d", len(auditEvents.events), len(want))
+		}
+
+		for i, event := range auditEvents.events {
+			if event.Type != want[i] || event.ActorID != adminUser.Id {
+				t.Errorf("got event %q by %d want %q by %d", event.Type, event.ActorID, want[i], adminUser.Id)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+// ClientMiddleware puts the address and user agent of every request in its
+// context, for the audit events recorded while handling it.
+func ClientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.ContextWithClient(r.Context(), audit.Client{
+			IPAddress: clientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type auditHandler struct {
+	auditService service.AuditService
+}
+
+func NewAuditHandler(auditService service.AuditService) *auditHandler {
+	return &auditHandler{
+		auditService: auditService,
+	}
+}
+
+type auditEventHTTPResponseBody struct {
+	ID         int64                   `json:"id"`
+	Type       audit.EventType         `json:"type"`
+	UserID     int32                   `json:"user_id,omitempty"`
+	ActorID    int32                   `json:"actor_id,omitempty"`
+	IPAddress  string                  `json:"ip_address"`
+	UserAgent  string                  `json:"user_agent"`
+	TargetType audit.TargetType        `json:"target_type,omitempty"`
+	TargetID   string                  `json:"target_id,omitempty"`
+	Details    map[string]any          `json:"details"`
+	Diff       map[string]audit.Change `json:"diff"`
+	CreatedAt  time.Time               `json:"created_at"`
+	PrevHash   string                  `json:"prev_hash"`
+	Hash       string                  `json:"hash"`
+}
+
+func newAuditEventHTTPResponseBody(e *audit.Event) auditEventHTTPResponseBody {
+	return auditEventHTTPResponseBody{
+		ID:         e.ID,
+		Type:       e.Type,
+		UserID:     e.UserID,
+		ActorID:    e.ActorID,
+		IPAddress:  e.IPAddress,
+		UserAgent:  e.UserAgent,
+		TargetType: e.Target.Type,
+		TargetID:   e.Target.ID,
+		Details:    e.Details,
+		Diff:       e.Diff,
+		CreatedAt:  e.CreatedAt,
+		PrevHash:   e.PrevHash,
+		Hash:       e.Hash,
+	}
+}
+
+type listAuditEventsHTTPResponseBody struct {
+	Events []auditEventHTTPResponseBody `json:"events"`
+	Limit  int32                        `json:"limit"`
+	Offset int32                        `json:"offset"`
+}
+
+func newListAuditEventsHTTPResponseBody(events []audit.Event, limit, offset int32) listAuditEventsHTTPResponseBody {
+	response := listAuditEventsHTTPResponseBody{
+		Events: []auditEventHTTPResponseBody{},
+		Limit:  limit,
+		Offset: offset,
+	}
+	for _, e := range events {
+		response.Events = append(response.Events, newAuditEventHTTPResponseBody(&e))
+	}
+
+	return response
+}
+
+// ListUserEvents lists the events about the user, newest first, paged by
+// limit and offset.
+func (handler *auditHandler) ListUserEvents(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	query := r.URL.Query()
+
+	limit, offset, err := user.ParsePage(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	events, err := handler.auditService.ListUserEvents(r.Context(), authUser.Id, limit, offset)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newListAuditEventsHTTPResponseBody(events, limit, offset))
+}
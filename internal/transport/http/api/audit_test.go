@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/shorturl"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+func TestClientMiddleware(t *testing.T) {
+	var got audit.Client
+
+	handler := ClientMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = audit.ClientFromContext(r.Context())
+	}))
+
+	request, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me", http.NoBody)
+	request.RemoteAddr = "192.0.2.1:4242"
+	request.Header.Set("User-Agent", "audit-test/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	want := audit.Client{IPAddress: "192.0.2.1", UserAgent: "audit-test/1.0"}
+	if got != want {
+		t.Errorf("got client %+v want %+v", got, want)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	userHandler := ClientMiddleware(http.HandlerFunc(NewUserHandler(app.UserService).LoginUser))
+	login := func(body []byte) {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body))
+		request.Header.Set("User-Agent", "audit-test/1.0")
+		userHandler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	login(UserOneBadPassword)
+	login(UserOne)
+
+	user, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	ctx := audit.ContextWithClient(context.Background(), audit.Client{IPAddress: "192.0.2.1"})
+
+	createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.google.com")
+	link, err := app.URLService.CreateShortURL(ctx, *createRequest)
+	if err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	updateRequest := shorturl.NewUpdateURLRequest(user.Id, link.ShortURL, "https://www.example.com")
+	if _, err := app.URLService.UpdateShortURL(ctx, *updateRequest); err != nil {
+		t.Fatalf("could not update short url %q", err)
+	}
+
+	deleteRequest := shorturl.NewDeleteURLRequest(user.Id, link.ShortURL)
+	if err := app.URLService.DeleteShortURL(ctx, *deleteRequest); err != nil {
+		t.Fatalf("could not delete short url %q", err)
+	}
+
+	auditLog := NewAuditHandler(app.AuditService)
+
+	listUserEvents := func(u *userDomain.User) listAuditEventsHTTPResponseBody {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me/audit", http.NoBody)
+		response := httptest.NewRecorder()
+		auditLog.ListUserEvents(response, request, u)
+
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := listAuditEventsHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		return got
+	}
+
+	t.Run("test users see their events newest first", func(t *testing.T) {
+		got := listUserEvents(user)
+
+		want := []audit.EventType{
+			audit.EventURLDeleted,
+			audit.EventURLUpdated,
+			audit.EventURLCreated,
+			audit.EventLoginSucceeded,
+			audit.EventLoginFailed,
+			audit.EventUserCreated,
+		}
+
+		if len(got.Events) != len(want) {
+			t.Fatalf("got %d events want %d", len(got.Events), len(want))
+		}
+
+		for i, event := range got.Events {
+			if event.Type != want[i] || event.UserID != user.Id {
+				t.Errorf("got event %q about %d want %q about %d", event.Type, event.UserID, want[i], user.Id)
+			}
+		}
+
+		if got.Events[3].UserAgent != "audit-test/1.0" {
+			t.Errorf("got user agent %q want the login request's", got.Events[3].UserAgent)
+		}
+
+		updated := got.Events[1]
+		if updated.TargetType != audit.TargetURL || updated.TargetID != link.ShortURL {
+			t.Errorf("got target %s %s want url %s", updated.TargetType, updated.TargetID, link.ShortURL)
+		}
+
+		if updated.IPAddress != "192.0.2.1" || updated.ActorID != user.Id {
+			t.Errorf("got event by %d from %q want the user's request", updated.ActorID, updated.IPAddress)
+		}
+
+		change := updated.Diff["long_url"]
+		if change.From != "https://www.google.com" || change.To != "https://www.example.com" {
+			t.Errorf("got diff %+v want the old and new long url", updated.Diff)
+		}
+	})
+
+	t.Run("test users do not see other users' events", func(t *testing.T) {
+		createOther, _ := userDomain.NewCreateUserRequest("other@mail.com", "other-password")
+		other, err := app.UserService.CreateUser(context.Background(), *createOther)
+		if err != nil {
+			t.Fatalf("could not create user %q", err)
+		}
+
+		got := listUserEvents(other)
+		if len(got.Events) != 1 || got.Events[0].Type != audit.EventUserCreated {
+			t.Errorf("got events %+v want only the user being created", got.Events)
+		}
+	})
+
+	t.Run("test every event links to the one before it", func(t *testing.T) {
+		got := listUserEvents(user)
+
+		for i := 0; i < len(got.Events)-1; i++ {
+			if got.Events[i].PrevHash == "" || got.Events[i].Hash == got.Events[i].PrevHash {
+				t.Errorf("got event %d with hashes %q and %q", got.Events[i].ID, got.Events[i].Hash, got.Events[i].PrevHash)
+			}
+		}
+	})
+
+	t.Run("test admins can search and verify the audit log", func(t *testing.T) {
+		adminUser := &userDomain.User{Id: user.Id + 100, Role: userDomain.RoleAdmin}
+		admin := NewAdminHandler(service.NewAdminServiceImpl(
+			app.UserRepo,
+			app.URLRepo,
+			app.TokenRepo,
+			app.CacheRepo,
+			app.TokenDenylist,
+			app.AuditService,
+			app.QuotaService,
+		))
+
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/admin/audit?type=login.failed", http.NoBody)
+		response := httptest.NewRecorder()
+		admin.ListAuditEvents(response, request, adminUser)
+
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := listAuditEventsHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if len(got.Events) != 1 || got.Events[0].Details["reason"] != "wrong_password" {
+			t.Errorf("got events %+v want the failed login", got.Events)
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, "/api/v1/admin/audit?since=yesterday", http.NoBody)
+		response = httptest.NewRecorder()
+		admin.ListAuditEvents(response, request, adminUser)
+
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+
+		request, _ = http.NewRequest(http.MethodGet, "/api/v1/admin/audit/verify", http.NoBody)
+		response = httptest.NewRecorder()
+		admin.VerifyAuditChain(response, request, adminUser)
+
+		verification := verifyAuditChainHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&verification); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if !verification.Intact || verification.Events == 0 || verification.HeadHash == "" {
+			t.Errorf("got verification %+v want an intact chain", verification)
+		}
+	})
+}
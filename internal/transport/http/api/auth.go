@@ -1,11 +1,10 @@
 package api
 
 import (
-	"errors"
-	"log"
 	"net/http"
 	"strings"
 
+	"url-short/internal/apperror"
 	"url-short/internal/domain/user"
 	"url-short/internal/service"
 )
@@ -21,7 +20,7 @@ func NewAuthHandler(service service.UserService) *authHandler {
 }
 
 var (
-	ErrUnauthorized = errors.New("unauthorized")
+	ErrUnauthorized = apperror.New(http.StatusUnauthorized, "unauthorized", "unauthorized")
 )
 
 func ExtractAuthTokenFromRequest(r *http.Request) (string, error) {
@@ -57,11 +56,37 @@ func (handler *authHandler) AuthenticationMiddleware(nextHandler authedHandeler)
 
 		user, err := handler.service.ValidateUserJWT(r.Context(), requestToken)
 		if err != nil {
-			log.Println(err)
+			logError(r, err)
 			respondWithError(w, ErrUnauthorized)
 			return
 		}
 
-		nextHandler(w, r, user)
+		nextHandler(w, withLoggedUser(r, user.Id), user)
 	})
 }
+
+// VerifiedEmailMiddleware refuses users the configured unverified user policy
+// does not allow to create or change links.
+func (handler *authHandler) VerifiedEmailMiddleware(nextHandler authedHandeler) authedHandeler {
+	return func(w http.ResponseWriter, r *http.Request, user *user.User) {
+		if err := handler.service.AuthorizeURLCreation(user); err != nil {
+			respondWithError(w, err)
+			return
+		}
+
+		nextHandler(w, r, user)
+	}
+}
+
+// AuthorizationMiddleware refuses users whose role does not allow them to use
+// the endpoint, it runs after AuthenticationMiddleware.
+func (handler *authHandler) AuthorizationMiddleware(role user.Role, nextHandler authedHandeler) authedHandeler {
+	return func(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+		if !authUser.HasRole(role) {
+			respondWithError(w, user.ErrForbidden)
+			return
+		}
+
+		nextHandler(w, r, authUser)
+	}
+}
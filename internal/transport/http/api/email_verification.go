@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type emailVerificationHandler struct {
+	verificationService service.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(s service.EmailVerificationService) *emailVerificationHandler {
+	return &emailVerificationHandler{
+		verificationService: s,
+	}
+}
+
+type verifyEmailHTTPRequestBody struct {
+	Token string `json:"token"`
+}
+
+type verifyEmailHTTPResponseBody struct {
+	ID              int32     `json:"id"`
+	Email           string    `json:"email"`
+	EmailVerifiedAt time.Time `json:"email_verified_at"`
+}
+
+func (h *emailVerificationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	payload := verifyEmailHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	verifyRequest, err := user.NewVerifyEmailRequest(payload.Token)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	verifiedUser, err := h.verificationService.VerifyEmail(r.Context(), *verifyRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, verifyEmailHTTPResponseBody{
+		ID:              verifiedUser.Id,
+		Email:           verifiedUser.Email,
+		EmailVerifiedAt: verifiedUser.EmailVerifiedAt,
+	})
+}
+
+type resendVerificationEmailHTTPRequestBody struct {
+	Email string `json:"email"`
+}
+
+type resendVerificationEmailHTTPResponseBody struct {
+	Message string `json:"message"`
+}
+
+// ResendVerificationEmail responds the same way whether or not the email
+// belongs to an unverified user.
+func (h *emailVerificationHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	payload := resendVerificationEmailHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	resendRequest, err := user.NewResendVerificationRequest(payload.Email, clientIP(r))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = h.verificationService.ResendVerificationEmail(r.Context(), *resendRequest)
+	if err == user.ErrTooManyVerificationRequests {
+		respondWithError(w, err)
+		return
+	}
+	if err != nil {
+		logError(r, err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, resendVerificationEmailHTTPResponseBody{
+		Message: "if the email belongs to an unverified account a verification link has been sent to it",
+	})
+}
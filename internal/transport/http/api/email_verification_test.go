@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	userDomain "url-short/internal/domain/user"
+)
+
+var verificationTokenPattern = regexp.MustCompile(`verify-email\?token=([0-9a-f]+)`)
+
+func TestVerifyEmail(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	verifications := NewEmailVerificationHandler(app.EmailVerificationService)
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"token": %q}`, token)
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/users/verify", bytes.NewBufferString(body))
+
+		response := httptest.NewRecorder()
+		verifications.VerifyEmail(response, request)
+
+		return response
+	}
+
+	t.Run("test new users can not create links until verified", func(t *testing.T) {
+		unverifiedUser, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		if unverifiedUser.IsEmailVerified() {
+			t.Error("new user was verified without using the verification link")
+		}
+
+		err = app.UserService.AuthorizeURLCreation(unverifiedUser)
+		if err != userDomain.ErrEmailNotVerified {
+			t.Errorf("unverified user was allowed to create links got %v", err)
+		}
+	})
+
+	t.Run("test verification link from sign up verifies the user once", func(t *testing.T) {
+		match := verificationTokenPattern.FindStringSubmatch(app.Mailbox.String())
+		if match == nil {
+			t.Fatalf("no verification link was sent got %q", app.Mailbox.String())
+		}
+
+		response := verify(match[1])
+
+		got := verifyEmailHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusOK || got.EmailVerifiedAt.IsZero() {
+			t.Errorf("user was not verified got status %d and %+v", response.Result().StatusCode, got)
+		}
+
+		verifiedUser, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		err = app.UserService.AuthorizeURLCreation(verifiedUser)
+		if err != nil {
+			t.Errorf("verified user was not allowed to create links got %v", err)
+		}
+
+		reused := verify(match[1])
+		if reused.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("verification token could be used twice got status %d", reused.Result().StatusCode)
+		}
+	})
+
+	t.Run("test changing email requires verifying the new address", func(t *testing.T) {
+		verifiedUser, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		app.Mailbox.Reset()
+
+		body := []byte(`{"email": "changed@mail.com", "password": "test-password", "current_password": "test-password"}`)
+		putUserRequest, _ := http.NewRequest(http.MethodPut, "/api/v1/users", bytes.NewBuffer(body))
+		putUserResponse := httptest.NewRecorder()
+
+		NewUserHandler(app.UserService).UpdateUser(putUserResponse, putUserRequest, verifiedUser)
+
+		changedUser, err := app.UserRepo.SelectUser(t.Context(), "changed@mail.com")
+		if err != nil {
+			t.Fatal("could not find user after changing email")
+		}
+
+		if changedUser.IsEmailVerified() {
+			t.Error("changed email was verified without using the verification link")
+		}
+
+		match := verificationTokenPattern.FindStringSubmatch(app.Mailbox.String())
+		if match == nil {
+			t.Fatalf("no verification link was sent to the new email got %q", app.Mailbox.String())
+		}
+
+		response := verify(match[1])
+		if response.Result().StatusCode != http.StatusOK {
+			t.Errorf("new email could not be verified got status %d", response.Result().StatusCode)
+		}
+	})
+}
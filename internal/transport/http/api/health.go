@@ -2,14 +2,83 @@ package api
 
 import (
 	"net/http"
+
+	"url-short/internal/buildinfo"
+	"url-short/internal/service"
 )
 
+type healthHandler struct {
+	ready     func() bool
+	readiness *service.Readiness
+	build     buildinfo.Info
+}
+
+// NewHealthHandler serves the liveness and readiness probes. ready reports
+// false once the application starts shutting down, the application is not
+// ready from then on whatever its dependencies report.
+func NewHealthHandler(ready func() bool, readiness *service.Readiness) *healthHandler {
+	return &healthHandler{
+		ready:     ready,
+		readiness: readiness,
+		build:     buildinfo.Read(),
+	}
+}
+
 type getHealthHTTPResponseBody struct {
-	Status string `json:"status"`
+	Status string         `json:"status"`
+	Build  buildinfo.Info `json:"build"`
+}
+
+type componentHTTPResponseBody struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type getReadinessHTTPResponseBody struct {
+	Status     string                               `json:"status"`
+	Components map[string]componentHTTPResponseBody `json:"components,omitempty"`
+	Build      buildinfo.Info                       `json:"build"`
 }
 
-func GetHealth(w http.ResponseWriter, r *http.Request) {
+// GetLiveness reports that the process is up and serving, it does not check
+// any dependency so a dependency outage never gets the process restarted.
+func (handler *healthHandler) GetLiveness(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, getHealthHTTPResponseBody{
 		Status: "ok",
+		Build:  handler.build,
 	})
 }
+
+// GetReadiness reports whether the application should be sent traffic,
+// with the status of each dependency.
+func (handler *healthHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	if !handler.ready() {
+		respondWithJSON(w, http.StatusServiceUnavailable, getReadinessHTTPResponseBody{
+			Status: "shutting_down",
+			Build:  handler.build,
+		})
+		return
+	}
+
+	report := handler.readiness.Check(r.Context())
+
+	response := getReadinessHTTPResponseBody{
+		Status:     report.Status,
+		Components: make(map[string]componentHTTPResponseBody, len(report.Components)),
+		Build:      handler.build,
+	}
+
+	for name, component := range report.Components {
+		response.Components[name] = componentHTTPResponseBody{
+			Status:    component.Status,
+			LatencyMs: component.Latency.Milliseconds(),
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	respondWithJSON(w, status, response)
+}
@@ -1,32 +1,149 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"url-short/internal/service"
 )
 
 func TestHealthEndpoint(t *testing.T) {
-	t.Run("test healthz endpoint", func(t *testing.T) {
-		request, _ := http.NewRequest(http.MethodGet, "/api/v1/healthz", nil)
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	newHandler := func(ready bool, checks ...service.ReadinessCheck) *healthHandler {
+		return NewHealthHandler(func() bool { return ready }, service.NewReadiness(checks, time.Second, time.Minute))
+	}
+
+	getReadiness := func(t *testing.T, handler *healthHandler) (int, getReadinessHTTPResponseBody) {
+		request, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		response := httptest.NewRecorder()
+
+		handler.GetReadiness(response, request)
+
+		got := getReadinessHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse response %q", err)
+		}
+
+		return response.Result().StatusCode, got
+	}
+
+	t.Run("test livez endpoint", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/livez", nil)
 		response := httptest.NewRecorder()
 
-		GetHealth(response, request)
+		newHandler(true, service.ReadinessCheck{Name: "postgres", Required: true, Check: down}).GetLiveness(response, request)
 
 		got := getHealthHTTPResponseBody{}
 		err := json.NewDecoder(response.Body).Decode(&got)
 
 		if err != nil {
-			t.Errorf("unable to parse response %q into %q", response.Body, got)
+			t.Errorf("unable to parse response %q", err)
 		}
 
 		if got.Status != "ok" {
 			t.Errorf("status field must be okay on health response got %q wanted %q", got.Status, "ok")
 		}
 
+		if got.Build.Version == "" {
+			t.Errorf("got no build version")
+		}
+
 		if response.Result().StatusCode != http.StatusOK {
 			t.Error("endpoint must return 200")
 		}
 	})
+
+	t.Run("test readyz reports every component", func(t *testing.T) {
+		status, got := getReadiness(t, newHandler(
+			true,
+			service.ReadinessCheck{Name: "postgres", Required: true, Check: up},
+			service.ReadinessCheck{Name: "redis", Check: up},
+		))
+
+		if status != http.StatusOK || got.Status != service.ReadinessReady {
+			t.Errorf("got status %d %q want 200 ready", status, got.Status)
+		}
+
+		if got.Components["postgres"].Status != service.ComponentUp || got.Components["redis"].Status != service.ComponentUp {
+			t.Errorf("got components %v want both up", got.Components)
+		}
+	})
+
+	t.Run("test readyz is degraded but ready without redis", func(t *testing.T) {
+		status, got := getReadiness(t, newHandler(
+			true,
+			service.ReadinessCheck{Name: "postgres", Required: true, Check: up},
+			service.ReadinessCheck{Name: "redis", Check: down},
+		))
+
+		if status != http.StatusOK || got.Status != service.ReadinessDegraded {
+			t.Errorf("got status %d %q want 200 degraded", status, got.Status)
+		}
+
+		if got.Components["redis"].Status != service.ComponentDown {
+			t.Errorf("got redis %q want down", got.Components["redis"].Status)
+		}
+	})
+
+	t.Run("test readyz fails without a required component", func(t *testing.T) {
+		status, got := getReadiness(t, newHandler(
+			true,
+			service.ReadinessCheck{Name: "postgres", Required: true, Check: down},
+			service.ReadinessCheck{Name: "redis", Check: up},
+		))
+
+		if status != http.StatusServiceUnavailable || got.Status != service.ReadinessNotReady {
+			t.Errorf("got status %d %q want 503 not_ready", status, got.Status)
+		}
+	})
+
+	t.Run("test readyz fails while shutting down", func(t *testing.T) {
+		status, got := getReadiness(t, newHandler(false, service.ReadinessCheck{Name: "postgres", Check: up}))
+
+		if status != http.StatusServiceUnavailable || got.Status != "shutting_down" {
+			t.Errorf("got status %d %q want 503 shutting_down", status, got.Status)
+		}
+	})
+
+	t.Run("test readyz reuses recent results", func(t *testing.T) {
+		calls := 0
+		handler := newHandler(true, service.ReadinessCheck{
+			Name:     "postgres",
+			Required: true,
+			Check: func(ctx context.Context) error {
+				calls++
+				return nil
+			},
+		})
+
+		getReadiness(t, handler)
+		getReadiness(t, handler)
+
+		if calls != 1 {
+			t.Errorf("got %d checks want 1", calls)
+		}
+	})
+
+	t.Run("test readiness checks time out", func(t *testing.T) {
+		handler := NewHealthHandler(func() bool { return true }, service.NewReadiness([]service.ReadinessCheck{{
+			Name:     "postgres",
+			Required: true,
+			Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}}, 10*time.Millisecond, 0))
+
+		status, _ := getReadiness(t, handler)
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("got status %d want a hung check to fail", status)
+		}
+	})
 }
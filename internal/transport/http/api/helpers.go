@@ -4,21 +4,40 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
-	"url-short/internal/domain/shorturl"
+	"reflect"
+	"strconv"
+	"url-short/internal/apperror"
+	"url-short/internal/domain/ratelimit"
 	"url-short/internal/domain/user"
 )
 
-type errorHTTPResponseBody struct {
-	Error string `json:"error"`
+// problemHTTPResponseBody is an RFC 7807 problem. Code identifies the
+// problem for clients to branch on, Errors points at the request fields that
+// failed validation.
+type problemHTTPResponseBody struct {
+	Type   string                `json:"type"`
+	Title  string                `json:"title"`
+	Status int                   `json:"status"`
+	Detail string                `json:"detail"`
+	Code   string                `json:"code"`
+	Errors []apperror.FieldError `json:"errors,omitempty"`
 }
 
+const problemContentType = "application/problem+json"
+
+// ErrMalformedRequest is reported when the request body is not the JSON the
+// endpoint reads.
+var ErrMalformedRequest = apperror.New(http.StatusBadRequest, "malformed_request", "could not parse request")
+
 func respondWithJSON(w http.ResponseWriter, status int, payload any) {
 	data, err := json.Marshal(payload)
 
 	if err != nil {
-		log.Printf("can not marshal payload %v", payload)
+		slog.Error("could not marshal payload", "error", err)
 		return
 	}
 
@@ -27,15 +46,19 @@ func respondWithJSON(w http.ResponseWriter, status int, payload any) {
 	_, err = w.Write(data)
 
 	if err != nil {
-		log.Println("could not write data to response writer")
+		slog.Error("could not write data to response writer", "error", err)
 	}
 }
 
+// respondWithError answers with the problem err carries, errors that are
+// not application errors are reported as unexpected without their details.
 func respondWithError(w http.ResponseWriter, err error) {
-	var code int
+	appError := apperror.From(err)
 
-	errorResponse := errorHTTPResponseBody{
-		Error: err.Error(),
+	// an error wrapping an application error, such as a quota error naming
+	// the limit, explains it better
+	if appError != apperror.ErrInternal && err.Error() != appError.Message {
+		appError = appError.WithMessage(err.Error())
 	}
 
 	// json validation errros that I do not controll but must parse
@@ -43,47 +66,86 @@ func respondWithError(w http.ResponseWriter, err error) {
 	var unmarshalTypeError *json.UnmarshalTypeError
 	var invalidUnmarshalError *json.InvalidUnmarshalError
 	if errors.As(err, &syntaxError) ||
-		errors.As(err, &unmarshalTypeError) ||
 		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
 		errors.As(err, &invalidUnmarshalError) {
-		code = http.StatusBadRequest
-		errorResponse = errorHTTPResponseBody{
-			Error: "could not parse request",
+		appError = ErrMalformedRequest
+	}
+
+	if errors.As(err, &unmarshalTypeError) {
+		appError = ErrMalformedRequest
+		if unmarshalTypeError.Field != "" {
+			appError = ErrMalformedRequest.WithFields(apperror.FieldError{
+				Field:   unmarshalTypeError.Field,
+				Code:    "invalid_type",
+				Message: "must be " + jsonTypeName(unmarshalTypeError.Type),
+			})
 		}
-		respondWithJSON(w, code, errorResponse)
+	}
+
+	var loginLockedError *user.LoginLockedError
+	if errors.As(err, &loginLockedError) {
+		retryAfter := math.Ceil(loginLockedError.RetryAfter.Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+	}
+
+	var limitedError *ratelimit.LimitedError
+	if errors.As(err, &limitedError) {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(limitedError.Decision.RetryAfter)))
+	}
+
+	respondWithProblem(w, appError)
+}
+
+func respondWithProblem(w http.ResponseWriter, appError *apperror.Error) {
+	data, err := json.Marshal(problemHTTPResponseBody{
+		Type:   "about:blank",
+		Title:  http.StatusText(appError.Status),
+		Status: appError.Status,
+		Detail: appError.Message,
+		Code:   appError.Code,
+		Errors: appError.Fields,
+	})
+
+	if err != nil {
+		slog.Error("could not marshal payload", "error", err)
 		return
 	}
 
-	switch err {
-	// user domain errros -> HTTP errors
-	case user.ErrEmptyEmail,
-		user.ErrInvalidEmail,
-		user.ErrEmptyPassword,
-		user.ErrInvalidPassword,
-		user.ErrDuplicateUSer,
-		user.ErrInvalidLoginRequest:
-		code = http.StatusBadRequest
-	case user.ErrUserNotFound:
-		code = http.StatusNotFound
-	case user.ErrUnexpectedError:
-		code = http.StatusInternalServerError
-
-	// authorization errors -> HTTP errors
-	case ErrUnauthorized:
-		code = http.StatusUnauthorized
-
-	// shorturl domain errors -> HTTP errors
-	case shorturl.ErrURLValidation,
-		shorturl.ErrDuplicateURL:
-		code = http.StatusBadRequest
-	case shorturl.ErrURLNotFound:
-		code = http.StatusNotFound
-	case shorturl.ErrUnexpectedError:
-		code = http.StatusInternalServerError
+	w.Header().Set("content-type", problemContentType)
+	w.WriteHeader(appError.Status)
+	_, err = w.Write(data)
 
+	if err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
 	default:
-		code = http.StatusInternalServerError
+		return "an object"
+	}
+}
+
+// clientIP returns the address of the peer that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
 
-	respondWithJSON(w, code, errorResponse)
+	return host
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
@@ -17,17 +18,20 @@ import (
 
 	"url-short/internal/configuration"
 	"url-short/internal/database"
+	"url-short/internal/domain/plan"
 	"url-short/internal/domain/user"
+	"url-short/internal/mailer"
+	"url-short/internal/password"
 	"url-short/internal/repository"
 	"url-short/internal/service"
 )
 
 var (
-	UserOne                = []byte(`{"email": "test@mail.com", "password": "test"}`)
-	UserOneUpdatedPassword = []byte(`{"email": "test@mail.com", "password":"new-password"}`)
+	UserOne                = []byte(`{"email": "test@mail.com", "password": "test-password"}`)
+	UserOneUpdatedPassword = []byte(`{"email": "test@mail.com", "password":"new-password", "current_password": "test-password"}`)
 	UserOneBadPassword     = []byte(`{"email": "test@mail.com", "password": "testerrrrr"}`)
 	UserBadInput           = []byte(`{"gmail": "test@mail.com", "auth": "test", "extra_data": "data"}`)
-	UserBadEmail           = []byte(`{"email": "test1mail.com", "password": "test"}`)
+	UserBadEmail           = []byte(`{"email": "test1mail.com", "password": "test-password"}`)
 
 	LongUrl = []byte(`{"long_url":"https://www.google.com"}`)
 )
@@ -101,14 +105,31 @@ func withDB() (*database.Queries, error) {
 }
 
 type testApplication struct {
-	DB          *database.Queries
-	Cache       *redis.Client
-	JWTSecret   string
-	CacheRepo   repository.CacheRepository
-	URLRepo     repository.URLRepository
-	UserRepo    repository.UserRepository
-	URLService  service.URLService
-	UserService service.UserService
+	DB                       *database.Queries
+	Cache                    *redis.Client
+	JWTKeys                  *service.JWTKeys
+	CacheRepo                repository.CacheRepository
+	URLRepo                  repository.URLRepository
+	WorkspaceRepo            repository.WorkspaceRepository
+	UserRepo                 repository.UserRepository
+	TokenRepo                repository.RefreshTokenRepository
+	TokenDenylist            *service.AccessTokenDenylist
+	Passwords                *user.Passwords
+	URLService               service.URLService
+	Clicks                   *service.ClickBuffer
+	UserService              service.UserService
+	Mailbox                  *bytes.Buffer
+	Mailer                   mailer.Mailer
+	EmailVerificationService service.EmailVerificationService
+	PasswordResetService     service.PasswordResetService
+	Background               *service.Background
+	TwoFactorService         service.TwoFactorService
+	AuditService             service.AuditService
+	QuotaService             service.QuotaService
+	AccountService           service.AccountService
+	AdminService             service.AdminService
+	WorkspaceService         service.WorkspaceService
+	SCIMService              service.SCIMService
 }
 
 func newTestApplication(s *configuration.ApplicationSettings) (*testApplication, error) {
@@ -127,9 +148,9 @@ func newTestApplication(s *configuration.ApplicationSettings) (*testApplication,
 	redisClient := redis.NewClient(opt)
 
 	a := &testApplication{
-		DB:        dbQueries,
-		Cache:     redisClient,
-		JWTSecret: s.Server.JwtSecret,
+		DB:      dbQueries,
+		Cache:   redisClient,
+		JWTKeys: service.NewHMACJWTKeys(s.JWT.Secret),
 	}
 
 	return a, nil
@@ -155,15 +176,152 @@ func withTestApplication() (*testApplication, error) {
 	// name from WithDB
 	app.DB = db
 
+	// every test shares the cache, so counters such as failed logins
+	// must not carry over from the previous test
+	err = app.Cache.FlushDB(context.Background()).Err()
+	if err != nil {
+		return nil, err
+	}
+
 	app.UserRepo = repository.NewPostgresUserRepository(app.DB)
+	app.TokenRepo = repository.NewPostgresRefreshTokenRepository(app.DB)
 	app.URLRepo = repository.NewPostgresURLRepository(app.DB)
+	app.WorkspaceRepo = repository.NewPostgresWorkspaceRepository(app.DB)
 	app.CacheRepo = repository.NewCacheRedis(app.Cache)
-	app.URLService = service.NewURLServiceImpl(app.URLRepo, app.CacheRepo)
-	app.UserService = service.NewUserServiceImpl(app.UserRepo, app.JWTSecret)
+	app.AuditService = service.NewAuditServiceImpl(repository.NewPostgresAuditRepository(app.DB))
+	app.QuotaService = service.NewQuotaServiceImpl(
+		repository.NewPostgresQuotaRepository(app.DB),
+		repository.NewRedisQuotaCounterRepository(app.Cache),
+		app.WorkspaceRepo,
+		newTestPlanCatalog(),
+	)
+	app.Clicks = service.NewClickBuffer(app.URLRepo)
+	app.URLService = service.NewURLServiceImpl(
+		app.URLRepo,
+		app.CacheRepo,
+		app.WorkspaceRepo,
+		app.AuditService,
+		app.QuotaService,
+		app.Clicks,
+	)
+	app.TokenDenylist = service.NewAccessTokenDenylist(
+		repository.NewRedisTokenDenylist(app.Cache),
+		repository.NewLocalTokenDenylist(),
+		false,
+	)
+	app.Passwords, err = user.NewPasswords(
+		password.NewHasher(password.DefaultArgon2idParams),
+		user.NewPasswordPolicy(8, nil),
+	)
+	if err != nil {
+		return nil, err
+	}
+	app.Mailbox = &bytes.Buffer{}
+	app.Mailer = mailer.NewWriterMailer(app.Mailbox)
+	app.Background = service.NewBackground()
+	app.EmailVerificationService = service.NewEmailVerificationServiceImpl(
+		app.UserRepo,
+		repository.NewPostgresEmailVerificationRepository(app.DB),
+		repository.NewRedisAttemptCounter(app.Cache),
+		app.Mailer,
+		app.Background,
+		"http://localhost/verify-email",
+	)
+	totpCipher, err := service.NewSecretCipher(settings.Users.TOTPEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	app.TwoFactorService = service.NewTwoFactorServiceImpl(
+		repository.NewPostgresTwoFactorRepository(app.DB),
+		repository.NewRedisAttemptCounter(app.Cache),
+		totpCipher,
+	)
+	app.AccountService = newTestAccountService(app, time.Hour)
+	app.UserService = service.NewUserServiceImpl(
+		app.UserRepo,
+		app.TokenRepo,
+		app.JWTKeys,
+		app.TokenDenylist,
+		app.EmailVerificationService,
+		app.TwoFactorService,
+		service.NewLoginThrottle(repository.NewRedisLoginAttemptRepository(app.Cache), app.AuditService),
+		app.Passwords,
+		app.AccountService,
+		user.UnverifiedUsersCanLogin,
+		app.AuditService,
+	)
+	app.AdminService = service.NewAdminServiceImpl(
+		app.UserRepo,
+		app.URLRepo,
+		app.TokenRepo,
+		app.CacheRepo,
+		app.TokenDenylist,
+		app.AuditService,
+		app.QuotaService,
+	)
+	app.WorkspaceService = service.NewWorkspaceServiceImpl(
+		app.WorkspaceRepo,
+		app.URLRepo,
+		app.Mailer,
+		"http://localhost/workspace-invite",
+	)
+	app.SCIMService = service.NewSCIMServiceImpl(
+		repository.NewPostgresSCIMRepository(app.DB),
+		app.UserRepo,
+		app.WorkspaceRepo,
+		app.TokenRepo,
+		app.TokenDenylist,
+		app.AuditService,
+		app.Passwords,
+	)
+	app.PasswordResetService = service.NewPasswordResetServiceImpl(
+		app.UserRepo,
+		repository.NewPostgresPasswordResetRepository(app.DB),
+		app.TokenRepo,
+		repository.NewRedisAttemptCounter(app.Cache),
+		app.TokenDenylist,
+		app.Mailer,
+		app.AuditService,
+		app.Background,
+		app.Passwords,
+		"http://localhost/password-reset",
+	)
 
 	return app, nil
 }
 
+// newTestPlanCatalog puts workspaces on an unlimited free plan unless a test
+// moves them to the starter plan, which allows one link and one tracked
+// click a month.
+func newTestPlanCatalog() *plan.Catalog {
+	catalog, _ := plan.NewCatalog([]plan.Plan{
+		{Name: "free"},
+		{Name: "starter", Limits: plan.Limits{MaxActiveLinks: 1, MaxMonthlyClicks: 1}},
+	}, "free")
+
+	return catalog
+}
+
+func newTestAccountService(a *testApplication, gracePeriod time.Duration) *service.AccountServiceImpl {
+	return service.NewAccountServiceImpl(
+		a.UserRepo,
+		a.URLRepo,
+		a.TokenRepo,
+		repository.NewPostgresIdentityRepository(a.DB),
+		repository.NewPostgresUserDeletionRepository(a.DB),
+		a.CacheRepo,
+		a.WorkspaceRepo,
+		a.TwoFactorService,
+		a.EmailVerificationService,
+		a.TokenDenylist,
+		service.NewLoginThrottle(repository.NewRedisLoginAttemptRepository(a.Cache), a.AuditService),
+		a.Passwords,
+		a.AuditService,
+		gracePeriod,
+	)
+}
+
 func setupUserOne(a *testApplication) (*createUserHTTPResponseBody, error) {
 	request, err := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBuffer(UserOne))
 
@@ -243,7 +401,7 @@ func TestRespondWithError(t *testing.T) {
 
 		respondWithError(response, user.ErrEmptyEmail)
 
-		wantStruct := errorHTTPResponseBody{}
+		wantStruct := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&wantStruct)
 
@@ -254,5 +412,69 @@ func TestRespondWithError(t *testing.T) {
 		if response.Result().StatusCode != http.StatusBadRequest {
 			t.Errorf("failed to respond with a generic error")
 		}
+
+		if response.Header().Get("content-type") != problemContentType {
+			t.Errorf("got content type %q want %q", response.Header().Get("content-type"), problemContentType)
+		}
+
+		if wantStruct.Code != "empty_email" || wantStruct.Status != http.StatusBadRequest || wantStruct.Detail != "empty email" {
+			t.Errorf("problem does not describe the error got %+v", wantStruct)
+		}
+	})
+
+	t.Run("test respond with error hides unexpected errors", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		respondWithError(response, errors.New("pq: connection refused"))
+
+		got := problemHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusInternalServerError || got.Code != "internal_error" {
+			t.Errorf("expected an internal error got %d %q", response.Result().StatusCode, got.Code)
+		}
+
+		if got.Detail != "unexpected server error" {
+			t.Errorf("unexpected error details reached the client got %q", got.Detail)
+		}
+	})
+
+	t.Run("test respond with error maps errors the service returns", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		respondWithError(response, user.ErrRefreshTokenExpired)
+
+		got := problemHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusUnauthorized || got.Code != "refresh_token_expired" {
+			t.Errorf("expected an expired refresh token got %d %q", response.Result().StatusCode, got.Code)
+		}
+	})
+
+	t.Run("test respond with error points at the field of the wrong type", func(t *testing.T) {
+		response := httptest.NewRecorder()
+
+		payload := struct {
+			Email string `json:"email"`
+		}{}
+		respondWithError(response, json.Unmarshal([]byte(`{"email": 5}`), &payload))
+
+		got := problemHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusBadRequest || got.Code != "malformed_request" {
+			t.Errorf("expected a malformed request got %d %q", response.Result().StatusCode, got.Code)
+		}
+
+		if len(got.Errors) != 1 || got.Errors[0].Field != "email" || got.Errors[0].Code != "invalid_type" {
+			t.Errorf("expected the email field to be reported got %+v", got.Errors)
+		}
 	})
 }
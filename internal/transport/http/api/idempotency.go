@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"url-short/internal/domain/idempotency"
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type idempotencyHandler struct {
+	keys *service.IdempotencyKeys
+}
+
+func NewIdempotencyHandler(keys *service.IdempotencyKeys) *idempotencyHandler {
+	return &idempotencyHandler{
+		keys: keys,
+	}
+}
+
+// IdempotencyMiddleware lets clients retry a request carrying an
+// Idempotency-Key header without it being processed twice. Keys are scoped
+// to the user, a retry gets the first response replayed while a retry that
+// arrives before the first request is answered gets 409 Conflict, and reusing
+// a key for a different request gets 422 Unprocessable Entity.
+func (handler *idempotencyHandler) IdempotencyMiddleware(next authedHandeler) authedHandeler {
+	return func(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+		key := r.Header.Get(idempotency.Header)
+		if key == "" {
+			next(w, r, authUser)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logError(r, err)
+			respondWithError(w, err)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := idempotency.Fingerprint(r.Method, r.URL.Path, body)
+
+		stored, err := handler.keys.Begin(r.Context(), authUser.Id, key, fingerprint)
+		if err != nil {
+			logError(r, err)
+			respondWithError(w, err)
+			return
+		}
+
+		if stored != nil {
+			replayResponse(w, stored)
+			return
+		}
+
+		response := &recordedResponse{ResponseWriter: w}
+		next(response, r, authUser)
+
+		// the response is stored even when the client has gone away, its
+		// retry should find it
+		handler.keys.Complete(
+			context.WithoutCancel(r.Context()),
+			authUser.Id,
+			key,
+			fingerprint,
+			response.statusCode(),
+			w.Header().Get("content-type"),
+			response.body.Bytes(),
+		)
+	}
+}
+
+func replayResponse(w http.ResponseWriter, record *idempotency.Record) {
+	if record.ContentType != "" {
+		w.Header().Set("content-type", record.ContentType)
+	}
+
+	w.Header().Set(idempotency.ReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+
+	if _, err := w.Write(record.Body); err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
+
+// recordedResponse keeps a copy of the response it writes through.
+type recordedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recordedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recordedResponse) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	r.body.Write(data)
+
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *recordedResponse) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
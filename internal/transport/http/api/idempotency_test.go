@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"url-short/internal/domain/idempotency"
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+// memoryIdempotencyRepository keeps records like Redis does, without
+// expiring them.
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+	err     error
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]idempotency.Record{}}
+}
+
+func (m *memoryIdempotencyRepository) recordKey(userID int32, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func (m *memoryIdempotencyRepository) ReserveIdempotencyKey(
+	ctx context.Context,
+	userID int32,
+	key string,
+	record idempotency.Record,
+	ttl time.Duration,
+) (*idempotency.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if stored, ok := m.records[m.recordKey(userID, key)]; ok {
+		return &stored, nil
+	}
+
+	m.records[m.recordKey(userID, key)] = record
+
+	return nil, nil
+}
+
+func (m *memoryIdempotencyRepository) SaveIdempotencyRecord(
+	ctx context.Context,
+	userID int32,
+	key string,
+	record idempotency.Record,
+	ttl time.Duration,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	m.records[m.recordKey(userID, key)] = record
+
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, userID int32, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, m.recordKey(userID, key))
+
+	return m.err
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	alice := &user.User{Id: 1}
+	bob := &user.User{Id: 2}
+
+	// create answers with the number of requests it has processed, so
+	// replays are told apart from new responses
+	newCreate := func(status int) (authedHandeler, *int) {
+		calls := 0
+
+		return func(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+			if _, err := io.ReadAll(r.Body); err != nil {
+				t.Errorf("could not read request body %q", err)
+			}
+
+			calls++
+			respondWithJSON(w, status, map[string]int{"calls": calls})
+		}, &calls
+	}
+
+	send := func(handler authedHandeler, authUser *user.User, key, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/urls", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(idempotency.Header, key)
+		}
+
+		response := httptest.NewRecorder()
+		handler(response, request, authUser)
+
+		return response
+	}
+
+	newMiddleware := func(repo *memoryIdempotencyRepository) *idempotencyHandler {
+		return NewIdempotencyHandler(service.NewIdempotencyKeys(repo))
+	}
+
+	t.Run("test retries replay the first response", func(t *testing.T) {
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		first := send(handler, alice, "key-1", `{"long_url": "https://example.com"}`)
+		retry := send(handler, alice, "key-1", `{"long_url": "https://example.com"}`)
+
+		if *calls != 1 {
+			t.Errorf("expected the request to be processed once got %d", *calls)
+		}
+
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Errorf("got %d %s want the first response %s", retry.Code, retry.Body.String(), first.Body.String())
+		}
+
+		if retry.Header().Get("content-type") != "application/json" {
+			t.Errorf("got content type %q want application/json", retry.Header().Get("content-type"))
+		}
+
+		if first.Header().Get(idempotency.ReplayedHeader) != "" || retry.Header().Get(idempotency.ReplayedHeader) != "true" {
+			t.Errorf("expected only the retry to be marked as replayed")
+		}
+	})
+
+	t.Run("test keys are scoped to the user", func(t *testing.T) {
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "key-1", `{}`)
+		send(handler, bob, "key-1", `{}`)
+
+		if *calls != 2 {
+			t.Errorf("expected both users' requests to be processed got %d", *calls)
+		}
+	})
+
+	t.Run("test reusing a key for a different request is rejected", func(t *testing.T) {
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "key-1", `{"long_url": "https://example.com"}`)
+		response := send(handler, alice, "key-1", `{"long_url": "https://example.org"}`)
+
+		if response.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 got %d", response.Code)
+		}
+
+		got := problemHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse response %q", err)
+		}
+
+		if got.Code != idempotency.ErrKeyReused.Code {
+			t.Errorf("got code %q want %q", got.Code, idempotency.ErrKeyReused.Code)
+		}
+
+		if *calls != 1 {
+			t.Errorf("expected the request to be processed once got %d", *calls)
+		}
+	})
+
+	t.Run("test retries of a request in flight conflict", func(t *testing.T) {
+		repo := newMemoryIdempotencyRepository()
+		retried := false
+
+		var handler authedHandeler
+		handler = newMiddleware(repo).IdempotencyMiddleware(
+			func(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+				if !retried {
+					retried = true
+
+					response := send(handler, authUser, "key-1", `{}`)
+					if response.Code != http.StatusConflict {
+						t.Errorf("expected 409 got %d", response.Code)
+					}
+				}
+
+				respondWithJSON(w, http.StatusCreated, nil)
+			},
+		)
+
+		if response := send(handler, alice, "key-1", `{}`); response.Code != http.StatusCreated {
+			t.Errorf("expected the first request to succeed got %d", response.Code)
+		}
+	})
+
+	t.Run("test server errors release the key", func(t *testing.T) {
+		create, calls := newCreate(http.StatusInternalServerError)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "key-1", `{}`)
+		send(handler, alice, "key-1", `{}`)
+
+		if *calls != 2 {
+			t.Errorf("expected the retry to be processed got %d calls", *calls)
+		}
+	})
+
+	t.Run("test conflicts are replayed", func(t *testing.T) {
+		create, calls := newCreate(http.StatusConflict)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "key-1", `{}`)
+		response := send(handler, alice, "key-1", `{}`)
+
+		if *calls != 1 || response.Code != http.StatusConflict {
+			t.Errorf("expected the 409 to be replayed got %d after %d calls", response.Code, *calls)
+		}
+	})
+
+	t.Run("test refusals that may change release the key", func(t *testing.T) {
+		create, calls := newCreate(http.StatusForbidden)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "key-1", `{}`)
+		send(handler, alice, "key-1", `{}`)
+
+		if *calls != 2 {
+			t.Errorf("expected the retry to be processed got %d calls", *calls)
+		}
+	})
+
+	t.Run("test requests without a key are always processed", func(t *testing.T) {
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		send(handler, alice, "", `{}`)
+		send(handler, alice, "", `{}`)
+
+		if *calls != 2 {
+			t.Errorf("expected both requests to be processed got %d", *calls)
+		}
+	})
+
+	t.Run("test invalid keys are rejected", func(t *testing.T) {
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(newMemoryIdempotencyRepository()).IdempotencyMiddleware(create)
+
+		for _, key := range []string{strings.Repeat("k", idempotency.MaxKeyLength+1), "key\x7f"} {
+			if response := send(handler, alice, key, `{}`); response.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for %q got %d", key, response.Code)
+			}
+		}
+
+		if *calls != 0 {
+			t.Errorf("expected no request to be processed got %d", *calls)
+		}
+	})
+
+	t.Run("test requests are processed while redis is down", func(t *testing.T) {
+		repo := newMemoryIdempotencyRepository()
+		repo.err = errors.New("connection refused")
+
+		create, calls := newCreate(http.StatusCreated)
+		handler := newMiddleware(repo).IdempotencyMiddleware(create)
+
+		if response := send(handler, alice, "key-1", `{}`); response.Code != http.StatusCreated {
+			t.Errorf("expected 201 got %d", response.Code)
+		}
+
+		if *calls != 1 {
+			t.Errorf("expected the request to be processed got %d", *calls)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"url-short/internal/service"
+)
+
+type jwksHandler struct {
+	keys *service.JWTKeys
+}
+
+func NewJWKSHandler(keys *service.JWTKeys) *jwksHandler {
+	return &jwksHandler{
+		keys: keys,
+	}
+}
+
+type getJWKSHTTPResponseBody struct {
+	Keys []service.JSONWebKey `json:"keys"`
+}
+
+// GetJWKS publishes the public verification keys so other services can verify
+// our access tokens without sharing a secret.
+func (h *jwksHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("cache-control", "public, max-age=300")
+
+	respondWithJSON(w, http.StatusOK, getJWKSHTTPResponseBody{
+		Keys: h.keys.PublicKeys(),
+	})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"url-short/internal/service"
+)
+
+func generateEd25519PEM(t *testing.T) []byte {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key %q", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("could not marshal key %q", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	previousKey := generateEd25519PEM(t)
+	currentKey := generateEd25519PEM(t)
+
+	previousKeys, err := service.NewJWTKeys(previousKey, nil, "")
+	if err != nil {
+		t.Fatalf("could not load previous keys %q", err)
+	}
+
+	rotatedKeys, err := service.NewJWTKeys(currentKey, [][]byte{previousKey}, "")
+	if err != nil {
+		t.Fatalf("could not load rotated keys %q", err)
+	}
+
+	t.Run("test jwks endpoint publishes every verification key", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		response := httptest.NewRecorder()
+
+		NewJWKSHandler(rotatedKeys).GetJWKS(response, request)
+
+		got := getJWKSHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("unable to parse response %q", err)
+		}
+
+		if len(got.Keys) != 2 {
+			t.Fatalf("expected both keys to be published got %d", len(got.Keys))
+		}
+
+		for _, key := range got.Keys {
+			if key.KeyID == "" || key.KeyType != "OKP" || key.Algorithm != "EdDSA" || key.X == "" {
+				t.Errorf("published key is incomplete got %+v", key)
+			}
+		}
+	})
+
+	t.Run("test tokens signed with a rotated out key still verify", func(t *testing.T) {
+		claims := jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:   "1",
+		}
+
+		signedToken, err := previousKeys.Sign(claims)
+		if err != nil {
+			t.Fatalf("could not sign token %q", err)
+		}
+
+		_, err = jwt.Parse(signedToken, rotatedKeys.Keyfunc, jwt.WithValidMethods(rotatedKeys.ValidMethods()))
+		if err != nil {
+			t.Errorf("token signed with previous key was rejected %q", err)
+		}
+	})
+
+	t.Run("test hmac tokens are rejected without a configured secret", func(t *testing.T) {
+		signedToken, err := service.NewHMACJWTKeys("secret").Sign(jwt.RegisteredClaims{Subject: "1"})
+		if err != nil {
+			t.Fatalf("could not sign token %q", err)
+		}
+
+		_, err = jwt.Parse(signedToken, rotatedKeys.Keyfunc, jwt.WithValidMethods(rotatedKeys.ValidMethods()))
+		if err == nil {
+			t.Error("hmac token was accepted without a configured secret")
+		}
+	})
+}
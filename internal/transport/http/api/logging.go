@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"url-short/internal/logging"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request ids taken from callers, longer ones
+// are replaced with a generated id.
+const maxRequestIDLength = 128
+
+type accessLogContextKey struct{}
+
+// accessLog is filled in while a request is served and logged once it is
+// done, handlers deeper in the chain record who made the request in it.
+type accessLog struct {
+	userID int32
+}
+
+// LoggingMiddleware gives every request an id, taken from its X-Request-ID
+// header when the caller sent a usable one, echoes it back and carries a
+// logger with it in the request context. Once the request is served it
+// writes an access log line with the route pattern routes matched. Requests
+// that are traced also log their trace id.
+func LoggingMiddleware(logger *slog.Logger, routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+
+		requestLogger := logger.With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			requestLogger = requestLogger.With("trace_id", spanContext.TraceID().String())
+		}
+		entry := &accessLog{}
+
+		ctx := logging.WithLogger(r.Context(), requestLogger)
+		ctx = context.WithValue(ctx, accessLogContextKey{}, entry)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		_, route := routes.Handler(r)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.Int("status", recorder.status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int64("bytes", recorder.bytes),
+			slog.String("ip", clientIP(r)),
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.Int("user_id", int(entry.userID)))
+		}
+
+		requestLogger.LogAttrs(ctx, level, "request served", attrs...)
+	})
+}
+
+// withLoggedUser records the authenticated user in the access log and adds
+// them to the request's logger.
+func withLoggedUser(r *http.Request, userID int32) *http.Request {
+	if entry, ok := r.Context().Value(accessLogContextKey{}).(*accessLog); ok {
+		entry.userID = userID
+	}
+
+	return r.WithContext(logging.With(r.Context(), "user_id", userID))
+}
+
+// logError logs the error a handler is about to respond with, errors nobody
+// expected are also logged where they happen.
+func logError(r *http.Request, err error) {
+	logging.FromContext(r.Context()).Warn("request failed", "error", err)
+}
+
+// validRequestID accepts ids made only of characters that are safe to echo
+// back and to write to the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusRecorder remembers the status and the size of the response written
+// through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
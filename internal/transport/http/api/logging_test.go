@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-short/internal/logging"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	newHandler := func(logs *bytes.Buffer) http.Handler {
+		logger := slog.New(slog.NewJSONHandler(logs, nil))
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /api/v1/urls/{shortUrl}", func(w http.ResponseWriter, r *http.Request) {
+			r = withLoggedUser(r, 7)
+			logging.FromContext(r.Context()).Info("handling")
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+		})
+
+		return LoggingMiddleware(logger, mux, mux)
+	}
+
+	parseLines := func(t *testing.T, logs *bytes.Buffer) []map[string]any {
+		lines := []map[string]any{}
+		for line := range strings.Lines(logs.String()) {
+			entry := map[string]any{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("could not parse log line %q", err)
+			}
+
+			lines = append(lines, entry)
+		}
+
+		return lines
+	}
+
+	t.Run("test requests are logged with their route and user", func(t *testing.T) {
+		logs := &bytes.Buffer{}
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/urls/abc", http.NoBody)
+		request.Header.Set("X-Request-ID", "req-1234")
+		response := httptest.NewRecorder()
+
+		newHandler(logs).ServeHTTP(response, request)
+
+		if response.Header().Get("X-Request-ID") != "req-1234" {
+			t.Errorf("got request id %q want req-1234", response.Header().Get("X-Request-ID"))
+		}
+
+		lines := parseLines(t, logs)
+		if len(lines) != 2 {
+			t.Fatalf("got %d log lines want 2", len(lines))
+		}
+
+		if lines[0]["request_id"] != "req-1234" || lines[0]["user_id"] != float64(7) {
+			t.Errorf("got handler log line %v want the request id and user", lines[0])
+		}
+
+		access := lines[1]
+		want := map[string]any{
+			"msg":        "request served",
+			"request_id": "req-1234",
+			"method":     http.MethodGet,
+			"route":      "GET /api/v1/urls/{shortUrl}",
+			"status":     float64(http.StatusCreated),
+			"bytes":      float64(5),
+			"user_id":    float64(7),
+		}
+		for key, value := range want {
+			if access[key] != value {
+				t.Errorf("got %s %v want %v", key, access[key], value)
+			}
+		}
+	})
+
+	t.Run("test unusable request ids are replaced", func(t *testing.T) {
+		logs := &bytes.Buffer{}
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/urls/abc", http.NoBody)
+		request.Header.Set("X-Request-ID", "bad id\n")
+		response := httptest.NewRecorder()
+
+		newHandler(logs).ServeHTTP(response, request)
+
+		requestID := response.Header().Get("X-Request-ID")
+		if requestID == "" || requestID == "bad id\n" {
+			t.Errorf("got request id %q want a generated one", requestID)
+		}
+
+		if lines := parseLines(t, logs); lines[len(lines)-1]["request_id"] != requestID {
+			t.Errorf("got access log %v want request id %q", lines[len(lines)-1], requestID)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/audit"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/repository"
+	"url-short/internal/service"
+)
+
+type auditRecorder struct {
+	events []audit.CreateEventRequest
+}
+
+func (r *auditRecorder) Record(ctx context.Context, request audit.CreateEventRequest) {
+	r.events = append(r.events, request)
+}
+
+func (r *auditRecorder) ListUserEvents(ctx context.Context, userID, limit, offset int32) ([]audit.Event, error) {
+	return nil, nil
+}
+
+func (r *auditRecorder) ListEvents(ctx context.Context, request audit.ListEventsRequest) ([]audit.Event, error) {
+	return nil, nil
+}
+
+func (r *auditRecorder) VerifyChain(ctx context.Context) (*audit.ChainVerification, error) {
+	return &audit.ChainVerification{}, nil
+}
+
+func TestLoginThrottling(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	auditEvents := &auditRecorder{}
+	loginAttempts := repository.NewRedisLoginAttemptRepository(app.Cache)
+
+	userService := service.NewUserServiceImpl(
+		app.UserRepo,
+		app.TokenRepo,
+		app.JWTKeys,
+		app.TokenDenylist,
+		app.EmailVerificationService,
+		app.TwoFactorService,
+		service.NewLoginThrottle(loginAttempts, auditEvents),
+		app.Passwords,
+		app.AccountService,
+		userDomain.UnverifiedUsersCanLogin,
+		app.AuditService,
+	)
+	userHandler := NewUserHandler(userService)
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	login := func(body []byte) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body))
+		response := httptest.NewRecorder()
+		userHandler.LoginUser(response, request)
+
+		return response
+	}
+
+	t.Run("test unknown emails are answered like wrong passwords", func(t *testing.T) {
+		unknown := login([]byte(`{"email": "nobody@mail.com", "password": "test-password"}`))
+		wrong := login(UserOneBadPassword)
+
+		if unknown.Result().StatusCode != wrong.Result().StatusCode || unknown.Body.String() != wrong.Body.String() {
+			t.Errorf("unknown email was distinguishable got %q want %q", unknown.Body.String(), wrong.Body.String())
+		}
+	})
+
+	t.Run("test successful login resets the account counter", func(t *testing.T) {
+		for range 3 {
+			login(UserOneBadPassword)
+		}
+
+		if response := login(UserOne); response.Result().StatusCode != http.StatusFound {
+			t.Fatalf("login failed got status %d", response.Result().StatusCode)
+		}
+
+		// 4 failures would have reached the delay without the reset
+		for range 4 {
+			login(UserOneBadPassword)
+		}
+
+		if response := login(UserOne); response.Result().StatusCode != http.StatusFound {
+			t.Errorf("failures before a successful login were still counted got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test repeated failures delay the next login", func(t *testing.T) {
+		for range 5 {
+			login(UserOneBadPassword)
+		}
+
+		response := login(UserOne)
+		if response.Result().StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("login was not delayed got status %d", response.Result().StatusCode)
+		}
+
+		if response.Result().Header.Get("Retry-After") != "1" {
+			t.Errorf("unexpected retry after got %q want %q", response.Result().Header.Get("Retry-After"), "1")
+		}
+	})
+
+	t.Run("test account is locked out and the lockout is audited", func(t *testing.T) {
+		time.Sleep(1100 * time.Millisecond)
+
+		// with the 5 failures above the next one is the 10th
+		request, _ := userDomain.NewLoginUserRequest("test@mail.com", "testerrrrr", "192.0.2.1")
+		for range 4 {
+			_, err := loginAttempts.RecordFailedLogin(t.Context(), "account:"+userDomain.HashToken(request.NormalizedEmail()), time.Now(), time.Hour)
+			if err != nil {
+				t.Fatalf("could not record failed login %q", err)
+			}
+		}
+
+		response := login(UserOneBadPassword)
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Fatalf("wrong password was not refused got status %d", response.Result().StatusCode)
+		}
+
+		response = login(UserOne)
+		retryAfter, _ := strconv.Atoi(response.Result().Header.Get("Retry-After"))
+		if response.Result().StatusCode != http.StatusTooManyRequests || retryAfter < 60 {
+			t.Errorf("account was not locked out got status %d and retry after %d", response.Result().StatusCode, retryAfter)
+		}
+
+		if len(auditEvents.events) != 1 || auditEvents.events[0].Type != audit.EventLoginLocked {
+			t.Errorf("lockout was not audited got %+v", auditEvents.events)
+		}
+	})
+}
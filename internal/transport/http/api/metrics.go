@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"url-short/internal/metrics"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths do not
+// each get their own series.
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a method outside the standard ones, so
+// made up methods do not each get their own series.
+const otherMethod = "OTHER"
+
+var standardMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// MetricsMiddleware counts requests and how long they took by the route
+// pattern routes matched, the method and the status.
+func MetricsMiddleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		_, route := routes.Handler(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		method := r.Method
+		if !slices.Contains(standardMethods, method) {
+			method = otherMethod
+		}
+
+		status := strconv.Itoa(recorder.status)
+
+		metrics.HTTPRequests.WithLabelValues(route, method, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-short/internal/metrics"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/urls/{shortUrl}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMovedPermanently)
+	})
+
+	handler := MetricsMiddleware(mux, mux)
+
+	for _, path := range []string{"/api/v1/urls/abc", "/api/v1/urls/def", "/not/a/route"} {
+		request, _ := http.NewRequest(http.MethodGet, path, http.NoBody)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	for _, method := range []string{"FOO", "BAR"} {
+		request, _ := http.NewRequest(method, "/not/a/route", http.NoBody)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, request)
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("could not read metrics %q", err)
+	}
+
+	for _, want := range []string{
+		`urlshort_http_requests_total{method="GET",route="GET /api/v1/urls/{shortUrl}",status="301"} 2`,
+		`urlshort_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`urlshort_http_requests_total{method="OTHER",route="unmatched",status="404"} 2`,
+		`urlshort_http_request_duration_seconds_count{method="GET",route="GET /api/v1/urls/{shortUrl}",status="301"} 2`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("got metrics without %q", want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type oidcHandler struct {
+	oidcService service.OIDCService
+}
+
+func NewOIDCHandler(s service.OIDCService) *oidcHandler {
+	return &oidcHandler{
+		oidcService: s,
+	}
+}
+
+// StartLogin redirects the user to the identity provider named in the path.
+func (h *oidcHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.oidcService.StartLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// CompleteLogin is where the identity provider sends the user back to, it
+// responds with the same tokens as a password login.
+func (h *oidcHandler) CompleteLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	callbackRequest, err := user.NewOIDCCallbackRequest(
+		r.PathValue("provider"),
+		query.Get("state"),
+		query.Get("code"),
+		query.Get("error"),
+	)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := h.oidcService.CompleteLogin(r.Context(), *callbackRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, loginUserHTTPResponseBody{
+		ID:           res.Id,
+		Email:        res.Email,
+		Token:        res.Token,
+		RefreshToken: res.RefreshToken,
+	})
+}
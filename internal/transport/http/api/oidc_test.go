@@ -0,0 +1,337 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/scim"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/repository"
+	"url-short/internal/service"
+)
+
+// mockOIDCProvider is an in-process OpenID Connect provider that issues a
+// code for whatever claims a test authorizes.
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]mockOIDCAuthorization
+}
+
+type mockOIDCAuthorization struct {
+	codeChallenge string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate key %q", err)
+	}
+
+	p := &mockOIDCProvider{
+		key:            key,
+		authorizations: map[string]mockOIDCAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /keys", p.keys)
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *mockOIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	authorization, found := p.authorizations[r.FormValue("code")]
+	delete(p.authorizations, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != authorization.codeChallenge {
+		respondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   "url-short",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": authorization.nonce,
+	}
+	for claim, value := range authorization.claims {
+		claims[claim] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays the user signing in at the provider, it returns the query
+// the provider would send the user back to the callback with.
+func (p *mockOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) url.Values {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("could not parse authorization url %q", err)
+	}
+
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request did not use pkce got %q", authURL)
+	}
+
+	code := generateRandomAlphaString(16)
+
+	p.mu.Lock()
+	p.authorizations[code] = mockOIDCAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		claims:        claims,
+	}
+	p.mu.Unlock()
+
+	return url.Values{
+		"state": {query.Get("state")},
+		"code":  {code},
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	provider := newMockOIDCProvider(t)
+
+	oidcService := service.NewOIDCServiceImpl(
+		[]*service.OIDCProvider{
+			service.NewOIDCProvider(service.OIDCProviderConfig{
+				Name:                "corp",
+				Issuer:              provider.server.URL,
+				ClientID:            "url-short",
+				ClientSecret:        "secret",
+				RedirectURL:         "http://localhost/api/v1/auth/oidc/corp/callback",
+				AllowedEmailDomains: []string{"mail.com"},
+			}),
+		},
+		app.UserService,
+		app.UserRepo,
+		repository.NewPostgresIdentityRepository(app.DB),
+		repository.NewPostgresSCIMRepository(app.DB),
+		repository.NewRedisOIDCStateRepository(app.Cache),
+		app.TokenRepo,
+		app.TokenDenylist,
+		app.Passwords,
+	)
+	oidcHandler := NewOIDCHandler(oidcService)
+
+	start := func(t *testing.T) string {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/auth/oidc/corp/start", nil)
+		request.SetPathValue("provider", "corp")
+
+		response := httptest.NewRecorder()
+		oidcHandler.StartLogin(response, request)
+
+		if response.Result().StatusCode != http.StatusFound {
+			t.Fatalf("start did not redirect got status %d", response.Result().StatusCode)
+		}
+
+		return response.Result().Header.Get("Location")
+	}
+
+	callback := func(query url.Values) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/auth/oidc/corp/callback?"+query.Encode(), nil)
+		request.SetPathValue("provider", "corp")
+
+		response := httptest.NewRecorder()
+		oidcHandler.CompleteLogin(response, request)
+
+		return response
+	}
+
+	login := func(t *testing.T, claims jwt.MapClaims) (*httptest.ResponseRecorder, url.Values) {
+		query := provider.authorize(t, start(t), claims)
+
+		return callback(query), query
+	}
+
+	firstUserID := int32(0)
+
+	t.Run("test first sign in provisions a verified user", func(t *testing.T) {
+		response, _ := login(t, jwt.MapClaims{"sub": "staff-1", "email": "staff@mail.com", "email_verified": true})
+
+		got := loginUserHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusOK || got.Token == "" || got.RefreshToken == "" {
+			t.Fatalf("sign in did not issue tokens got status %d", response.Result().StatusCode)
+		}
+
+		validatedUser, err := app.UserService.ValidateUserJWT(t.Context(), got.Token)
+		if err != nil {
+			t.Fatalf("issued access token was not accepted %q", err)
+		}
+
+		if validatedUser.Email != "staff@mail.com" || !validatedUser.IsEmailVerified() {
+			t.Errorf("unexpected provisioned user got %+v", validatedUser)
+		}
+
+		firstUserID = validatedUser.Id
+	})
+
+	t.Run("test identity keeps its user when the email changes", func(t *testing.T) {
+		response, _ := login(t, jwt.MapClaims{"sub": "staff-1", "email": "renamed@mail.com", "email_verified": true})
+
+		got := loginUserHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if got.ID != firstUserID {
+			t.Errorf("identity signed in to a different user got %d want %d", got.ID, firstUserID)
+		}
+	})
+
+	t.Run("test sign in links an existing user by email", func(t *testing.T) {
+		_, err := setupUserOne(app)
+		if err != nil {
+			t.Fatalf("can not set up user for test case with err %q", err)
+		}
+
+		response, _ := login(t, jwt.MapClaims{"sub": "staff-2", "email": "test@mail.com", "email_verified": true})
+
+		got := loginUserHTTPResponseBody{}
+		err = json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		linkedUser, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		if got.ID != linkedUser.Id || !linkedUser.IsEmailVerified() {
+			t.Errorf("identity was not linked to the existing user got %d want %d", got.ID, linkedUser.Id)
+		}
+
+		// the password was set before anyone proved they own the email
+		loginRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(UserOne))
+		loginResponse := httptest.NewRecorder()
+		NewUserHandler(app.UserService).LoginUser(loginResponse, loginRequest)
+
+		if loginResponse.Result().StatusCode == http.StatusFound {
+			t.Error("password of an unverified user survived linking an identity")
+		}
+	})
+
+	t.Run("test sign in does not link users managed by a directory", func(t *testing.T) {
+		linkedUser, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		createWorkspace, _ := workspace.NewCreateWorkspaceRequest("Engineering", linkedUser.Id)
+		directory, err := app.WorkspaceService.CreateWorkspace(t.Context(), *createWorkspace)
+		if err != nil {
+			t.Fatalf("could not create workspace %q", err)
+		}
+
+		createUser, _ := scim.NewCreateUserRequest(directory.ID, "managed@mail.com", "", true)
+		if _, err := app.SCIMService.CreateUser(t.Context(), *createUser); err != nil {
+			t.Fatalf("could not provision user %q", err)
+		}
+
+		response, _ := login(t, jwt.MapClaims{"sub": "staff-5", "email": "managed@mail.com", "email_verified": true})
+		if response.Result().StatusCode != http.StatusConflict {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusConflict)
+		}
+	})
+
+	t.Run("test unverified and disallowed emails are refused", func(t *testing.T) {
+		response, _ := login(t, jwt.MapClaims{"sub": "staff-3", "email": "other@mail.com", "email_verified": false})
+		if response.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("unverified email was accepted got status %d", response.Result().StatusCode)
+		}
+
+		response, _ = login(t, jwt.MapClaims{"sub": "staff-4", "email": "staff@elsewhere.com", "email_verified": true})
+		if response.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("disallowed email domain was accepted got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test state can only be used once", func(t *testing.T) {
+		response, query := login(t, jwt.MapClaims{"sub": "staff-1", "email": "renamed@mail.com", "email_verified": true})
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("sign in failed got status %d", response.Result().StatusCode)
+		}
+
+		response = callback(query)
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("state was accepted twice got status %d", response.Result().StatusCode)
+		}
+	})
+}
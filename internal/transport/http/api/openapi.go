@@ -0,0 +1,45 @@
+package api
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+)
+
+// openAPIDocument describes every route the application serves, the
+// validation middleware checks requests and responses against it.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//go:embed openapi.html
+var openAPIDocsPage []byte
+
+type openAPIHandler struct{}
+
+func NewOpenAPIHandler() *openAPIHandler {
+	return &openAPIHandler{}
+}
+
+// GetSpec serves the OpenAPI document.
+func (handler *openAPIHandler) GetSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("cache-control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(openAPIDocument); err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
+
+// GetDocs serves a page that renders the OpenAPI document, it loads nothing
+// from other origins.
+func (handler *openAPIHandler) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Header().Set("content-security-policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(openAPIDocsPage); err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
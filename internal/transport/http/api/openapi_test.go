@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+func TestOpenAPIValidation(t *testing.T) {
+	validator, err := NewOpenAPIValidator()
+	if err != nil {
+		t.Fatalf("could not build validator from the OpenAPI document %q", err)
+	}
+
+	serve := func(handler http.HandlerFunc, request *http.Request) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", handler)
+
+		response := httptest.NewRecorder()
+		validator.ValidationMiddleware(mux).ServeHTTP(response, request)
+
+		return response
+	}
+
+	respondWith := func(status int, payload any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			respondWithJSON(w, status, payload)
+		}
+	}
+
+	t.Run("test every documented operation is unique", func(t *testing.T) {
+		patterns := validator.Patterns()
+		if len(patterns) == 0 {
+			t.Fatal("expected operations in the OpenAPI document")
+		}
+
+		for i, pattern := range patterns {
+			if slices.Contains(patterns[i+1:], pattern) {
+				t.Errorf("operation %q is documented twice", pattern)
+			}
+		}
+	})
+
+	t.Run("test documented responses pass through", func(t *testing.T) {
+		health := NewHealthHandler(func() bool { return true }, service.NewReadiness(nil, time.Second, time.Minute))
+
+		for _, path := range []string{"/livez", "/readyz", "/api/v1/healthz"} {
+			request := httptest.NewRequest(http.MethodGet, path, nil)
+
+			handler := health.GetLiveness
+			if path == "/readyz" {
+				handler = health.GetReadiness
+			}
+
+			response := serve(handler, request)
+			if response.Code != http.StatusOK {
+				t.Errorf("%s: expected 200 got %d %s", path, response.Code, response.Body.String())
+			}
+		}
+
+		keys, err := service.NewJWTKeys(generateEd25519PEM(t), nil, "")
+		if err != nil {
+			t.Fatalf("could not load keys %q", err)
+		}
+
+		response := serve(NewJWKSHandler(keys).GetJWKS, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		if response.Code != http.StatusOK {
+			t.Errorf("expected 200 got %d %s", response.Code, response.Body.String())
+		}
+
+		response = serve(NewOpenAPIHandler().GetSpec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+		if response.Code != http.StatusOK {
+			t.Errorf("expected 200 got %d %s", response.Code, response.Body.String())
+		}
+
+		response = serve(NewOpenAPIHandler().GetDocs, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+		if response.Code != http.StatusOK || !strings.HasPrefix(response.Header().Get("content-type"), "text/html") {
+			t.Errorf("expected a 200 html page got %d %s", response.Code, response.Header().Get("content-type"))
+		}
+	})
+
+	t.Run("test request body that violates the schema is rejected", func(t *testing.T) {
+		called := false
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"email": 5}`))
+		request.Header.Set("content-type", "application/json")
+
+		response := serve(handler, request)
+
+		if called {
+			t.Error("handler must not see requests that violate the OpenAPI document")
+		}
+
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 got %d", response.Code)
+		}
+
+		got := problemHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse response %q", err)
+		}
+
+		if got.Code != ErrInvalidRequest.Code {
+			t.Errorf("got code %q want %q", got.Code, ErrInvalidRequest.Code)
+		}
+
+		fields := []string{}
+		for _, field := range got.Errors {
+			fields = append(fields, field.Field)
+		}
+
+		if !slices.Equal(fields, []string{"email", "password"}) {
+			t.Errorf("expected the email and the missing password to be reported got %+v", got.Errors)
+		}
+	})
+
+	t.Run("test handler reads the validated request body", func(t *testing.T) {
+		got := ""
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			payload := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("could not read request body %q", err)
+			}
+			got = payload["email"]
+
+			respondWithError(w, user.ErrPasswordTooShort)
+		}
+
+		request := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/users",
+			strings.NewReader(`{"email": "user@example.com", "password": "password"}`),
+		)
+
+		response := serve(handler, request)
+
+		if got != "user@example.com" {
+			t.Errorf("expected handler to read the body got %q", got)
+		}
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("expected the handler's 400 got %d", response.Code)
+		}
+	})
+
+	t.Run("test query parameter that violates the schema is rejected", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users?limit=1000", nil)
+
+		response := serve(respondWith(http.StatusOK, nil), request)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 got %d", response.Code)
+		}
+	})
+
+	t.Run("test scim requests are rejected with scim errors", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/scim/v2/Users", strings.NewReader(`{"userName": 5}`))
+		request.Header.Set("content-type", scimContentType)
+
+		response := serve(respondWith(http.StatusOK, nil), request)
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 got %d", response.Code)
+		}
+
+		if response.Header().Get("content-type") != scimContentType {
+			t.Errorf("expected a scim error got %q", response.Header().Get("content-type"))
+		}
+	})
+
+	t.Run("test response that violates the schema is replaced", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/livez", nil)
+
+		response := serve(respondWith(http.StatusOK, map[string]int{"status": 1}), request)
+		if response.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500 got %d", response.Code)
+		}
+	})
+
+	t.Run("test undocumented status is replaced", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/livez", nil)
+
+		response := serve(respondWith(http.StatusTeapot, nil), request)
+		if response.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500 got %d", response.Code)
+		}
+	})
+
+	t.Run("test undocumented routes pass through", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/not/documented", nil)
+
+		response := serve(respondWith(http.StatusTeapot, nil), request)
+		if response.Code != http.StatusTeapot {
+			t.Errorf("expected 418 got %d", response.Code)
+		}
+	})
+}
+
+func TestHandlersMatchOpenAPIDocument(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	validator, err := NewOpenAPIValidator()
+	if err != nil {
+		t.Fatalf("could not build validator from the OpenAPI document %q", err)
+	}
+
+	users := NewUserHandler(app.UserService)
+	accounts := NewAccountHandler(app.AccountService)
+	auth := NewAuthHandler(app.UserService)
+	urls := NewShortUrlHandler(app.URLService)
+	workspaces := NewWorkspaceHandler(app.WorkspaceService)
+	auditLog := NewAuditHandler(app.AuditService)
+	usage := NewUsageHandler(app.QuotaService)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/users", users.CreateUser)
+	mux.HandleFunc("POST /api/v1/login", users.LoginUser)
+	mux.HandleFunc("POST /api/v1/refresh", users.RefreshAccessToken)
+	mux.HandleFunc("GET /api/v1/users/me", auth.AuthenticationMiddleware(accounts.GetProfile))
+	mux.HandleFunc("GET /api/v1/users/me/audit", auth.AuthenticationMiddleware(auditLog.ListUserEvents))
+	mux.HandleFunc("GET /api/v1/users/me/usage", auth.AuthenticationMiddleware(usage.GetUserUsage))
+	mux.HandleFunc("POST /api/v1/urls", auth.AuthenticationMiddleware(auth.VerifiedEmailMiddleware(urls.CreateShortURL)))
+	mux.HandleFunc("GET /api/v1/urls/{shortUrl}", urls.GetShortURL)
+	mux.HandleFunc("GET /api/v1/workspaces", auth.AuthenticationMiddleware(workspaces.ListWorkspaces))
+	mux.HandleFunc("POST /api/v1/workspaces", auth.AuthenticationMiddleware(workspaces.CreateWorkspace))
+
+	server := validator.ValidationMiddleware(mux)
+
+	send := func(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		// the validator answers 500 in place of responses that do not
+		// match the document
+		if response.Code == http.StatusInternalServerError {
+			t.Fatalf("%s %s: %s", method, path, response.Body.String())
+		}
+
+		return response
+	}
+
+	t.Run("test sign up and login responses match the document", func(t *testing.T) {
+		send(t, http.MethodPost, "/api/v1/users", "", string(UserOne))
+		send(t, http.MethodPost, "/api/v1/users", "", string(UserOne))
+		send(t, http.MethodPost, "/api/v1/login", "", `{"email": "test@mail.com", "password": "wrong-password"}`)
+	})
+
+	login := send(t, http.MethodPost, "/api/v1/login", "", string(UserOne))
+
+	tokens := loginUserHTTPResponseBody{}
+	if err := json.NewDecoder(login.Body).Decode(&tokens); err != nil {
+		t.Fatalf("unable to parse response %q", err)
+	}
+
+	t.Run("test account responses match the document", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/users/me", "/api/v1/users/me/audit", "/api/v1/users/me/usage"} {
+			if response := send(t, http.MethodGet, path, tokens.Token, ""); response.Code != http.StatusOK {
+				t.Errorf("%s: expected 200 got %d", path, response.Code)
+			}
+		}
+
+		if response := send(t, http.MethodGet, "/api/v1/users/me", "", ""); response.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 got %d", response.Code)
+		}
+
+		send(t, http.MethodPost, "/api/v1/refresh", tokens.RefreshToken, "")
+	})
+
+	t.Run("test url responses match the document", func(t *testing.T) {
+		created := send(t, http.MethodPost, "/api/v1/urls", tokens.Token, string(LongUrl))
+
+		if created.Code == http.StatusCreated {
+			got := createShortURLHTTPResponseBody{}
+			if err := json.NewDecoder(created.Body).Decode(&got); err != nil {
+				t.Fatalf("unable to parse response %q", err)
+			}
+
+			send(t, http.MethodGet, "/api/v1/urls/"+got.ShortURL, "", "")
+		}
+
+		if response := send(t, http.MethodGet, "/api/v1/urls/missing", "", ""); response.Code != http.StatusNotFound {
+			t.Errorf("expected 404 got %d", response.Code)
+		}
+	})
+
+	t.Run("test workspace responses match the document", func(t *testing.T) {
+		if response := send(t, http.MethodPost, "/api/v1/workspaces", tokens.Token, `{"name": "marketing"}`); response.Code != http.StatusCreated {
+			t.Errorf("expected 201 got %d", response.Code)
+		}
+
+		if response := send(t, http.MethodGet, "/api/v1/workspaces", tokens.Token, ""); response.Code != http.StatusOK {
+			t.Errorf("expected 200 got %d", response.Code)
+		}
+	})
+}
@@ -0,0 +1,732 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"url-short/internal/apperror"
+	"url-short/internal/logging"
+)
+
+// openAPIDocumentURL names the document for the schema compiler, schemas
+// are compiled from their JSON pointer in it so references between them
+// resolve.
+const openAPIDocumentURL = "urn:url-short:openapi.json"
+
+var openAPIMethods = []string{
+	http.MethodGet,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	http.MethodPatch,
+}
+
+var schemaErrorPrinter = message.NewPrinter(language.English)
+
+// ErrInvalidRequest is reported for requests the OpenAPI document does not
+// allow, its fields point at what was rejected.
+var ErrInvalidRequest = apperror.New(
+	http.StatusBadRequest,
+	"invalid_request",
+	"request does not match the API specification",
+)
+
+type openAPIParameter struct {
+	Ref      string `json:"$ref"`
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                       `json:"required"`
+	Content  map[string]json.RawMessage `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref     string                     `json:"$ref"`
+	Content map[string]json.RawMessage `json:"content"`
+}
+
+type openAPIOperation struct {
+	Parameters  []openAPIParameter         `json:"parameters"`
+	RequestBody *openAPIRequestBody        `json:"requestBody"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters"`
+		Responses  map[string]openAPIResponse  `json:"responses"`
+	} `json:"components"`
+}
+
+// openAPIContent maps each documented media type to its schema, the schema
+// is nil when the document does not describe the body.
+type openAPIContent map[string]*jsonschema.Schema
+
+type validatedParameter struct {
+	name     string
+	in       string
+	required bool
+	schema   *jsonschema.Schema
+}
+
+type validatedBody struct {
+	required bool
+	content  openAPIContent
+}
+
+type validatedOperation struct {
+	pattern    string
+	parameters []validatedParameter
+	body       *validatedBody
+	responses  map[string]openAPIContent
+}
+
+// OpenAPIValidator checks requests and responses against the OpenAPI
+// document served at /api/v1/openapi.json.
+type OpenAPIValidator struct {
+	operations []*validatedOperation
+}
+
+func NewOpenAPIValidator() (*OpenAPIValidator, error) {
+	spec := openAPISpec{}
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		return nil, fmt.Errorf("could not parse the OpenAPI document: %w", err)
+	}
+
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(openAPIDocument))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the OpenAPI document: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+
+	if err := compiler.AddResource(openAPIDocumentURL, document); err != nil {
+		return nil, err
+	}
+
+	builder := operationBuilder{spec: &spec, compiler: compiler}
+	validator := &OpenAPIValidator{}
+
+	for _, path := range slices.Sorted(maps.Keys(spec.Paths)) {
+		item := spec.Paths[path]
+
+		pathParameters := []openAPIParameter{}
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &pathParameters); err != nil {
+				return nil, fmt.Errorf("could not parse the parameters of %s: %w", path, err)
+			}
+		}
+
+		for _, method := range openAPIMethods {
+			raw, ok := item[strings.ToLower(method)]
+			if !ok {
+				continue
+			}
+
+			operation, err := builder.build(path, method, pathParameters, raw)
+			if err != nil {
+				return nil, fmt.Errorf("could not build %s %s: %w", method, path, err)
+			}
+
+			validator.operations = append(validator.operations, operation)
+		}
+	}
+
+	return validator, nil
+}
+
+// Patterns lists the documented operations as ServeMux patterns, such as
+// "GET /api/v1/urls/{shortUrl}".
+func (v *OpenAPIValidator) Patterns() []string {
+	patterns := []string{}
+	for _, operation := range v.operations {
+		patterns = append(patterns, operation.pattern)
+	}
+
+	return patterns
+}
+
+// ValidationMiddleware rejects requests that do not match the OpenAPI
+// document with 400 Bad Request, and answers 500 Internal Server Error in
+// place of responses that do not match it so tests fail when handlers and
+// documentation drift apart. Responses are held back until they are
+// checked, it is meant for tests rather than production. Routes the document
+// does not know are passed through.
+func (v *OpenAPIValidator) ValidationMiddleware(next http.Handler) http.Handler {
+	routes := http.NewServeMux()
+	for _, operation := range v.operations {
+		routes.Handle(operation.pattern, operation.validate(next))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := routes.Handler(r); pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		routes.ServeHTTP(w, r)
+	})
+}
+
+func (operation *validatedOperation) validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := operation.validateRequest(r); err != nil {
+			logError(r, err)
+			operation.rejectRequest(w, err)
+			return
+		}
+
+		response := &bufferedResponse{header: http.Header{}}
+		next.ServeHTTP(response, r)
+
+		if err := operation.validateResponse(r, response); err != nil {
+			logging.FromContext(r.Context()).Error(
+				"response does not match the OpenAPI document",
+				"route", operation.pattern,
+				"status", response.status,
+				"error", err,
+			)
+			respondWithProblem(w, apperror.New(
+				http.StatusInternalServerError,
+				"invalid_response",
+				"response does not match the API specification: "+err.Error(),
+			))
+			return
+		}
+
+		response.writeTo(w)
+	})
+}
+
+func (operation *validatedOperation) validateRequest(r *http.Request) error {
+	for _, parameter := range operation.parameters {
+		if err := parameter.validate(r); err != nil {
+			return err
+		}
+	}
+
+	if operation.body == nil {
+		return nil
+	}
+
+	return operation.body.validate(r)
+}
+
+// rejectRequest answers in the error format the operation documents for
+// 400 Bad Request, SCIM directories expect SCIM errors.
+func (operation *validatedOperation) rejectRequest(w http.ResponseWriter, err error) {
+	appError := apperror.From(err)
+
+	if _, ok := operation.responses["400"][scimContentType]; ok && appError.Status == http.StatusBadRequest {
+		detail := appError.Message
+		if len(appError.Fields) > 0 {
+			detail += ": " + describeFields(appError.Fields)
+		}
+
+		respondWithSCIM(w, http.StatusBadRequest, scimErrorHTTPResponseBody{
+			Schemas:  []string{scimErrorSchema},
+			Status:   strconv.Itoa(http.StatusBadRequest),
+			ScimType: "invalidValue",
+			Detail:   detail,
+		})
+		return
+	}
+
+	respondWithProblem(w, appError)
+}
+
+func (operation *validatedOperation) validateResponse(r *http.Request, response *bufferedResponse) error {
+	content, ok := operation.response(response.status)
+	if !ok {
+		return fmt.Errorf("status %d is not documented", response.status)
+	}
+
+	// a response documented without content may still carry one, such as
+	// the page http.Redirect writes
+	if len(content) == 0 || r.Method == http.MethodHead {
+		return nil
+	}
+
+	if response.body.Len() == 0 {
+		return fmt.Errorf("status %d has no body", response.status)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.header.Get("content-type"))
+	if err != nil {
+		return fmt.Errorf("status %d has no valid content type", response.status)
+	}
+
+	schema, ok := content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %s is not documented for status %d", mediaType, response.status)
+	}
+
+	if schema == nil || !isJSONMediaType(mediaType) {
+		return nil
+	}
+
+	body, err := jsonschema.UnmarshalJSON(bytes.NewReader(response.body.Bytes()))
+	if err != nil {
+		return fmt.Errorf("status %d body is not JSON: %w", response.status, err)
+	}
+
+	if err := schema.Validate(body); err != nil {
+		return fmt.Errorf("status %d body: %s", response.status, describeSchemaError(err))
+	}
+
+	return nil
+}
+
+// response finds the documented response for the status, falling back to
+// its range such as 4XX and then to the default response.
+func (operation *validatedOperation) response(status int) (openAPIContent, bool) {
+	for _, key := range []string{strconv.Itoa(status), strconv.Itoa(status/100) + "XX", "default"} {
+		if content, ok := operation.responses[key]; ok {
+			return content, true
+		}
+	}
+
+	return nil, false
+}
+
+func (parameter *validatedParameter) validate(r *http.Request) error {
+	var value string
+
+	switch parameter.in {
+	case "path":
+		value = r.PathValue(parameter.name)
+	case "query":
+		value = r.URL.Query().Get(parameter.name)
+	case "header":
+		value = r.Header.Get(parameter.name)
+	}
+
+	// handlers treat an empty parameter the same as a missing one
+	if value == "" {
+		if parameter.required {
+			return ErrInvalidRequest.WithFields(apperror.FieldError{
+				Field:   parameter.name,
+				Code:    "required",
+				Message: "is required",
+			})
+		}
+
+		return nil
+	}
+
+	if err := validateParameterValue(parameter.schema, value); err != nil {
+		return ErrInvalidRequest.WithFields(schemaViolations(err, parameter.name)...)
+	}
+
+	return nil
+}
+
+// validateParameterValue checks a parameter, which always arrives as a
+// string, as the number or boolean it reads as when the schema does not
+// accept it as a string.
+func validateParameterValue(schema *jsonschema.Schema, value string) error {
+	err := schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+
+	typed, parseErr := jsonschema.UnmarshalJSON(strings.NewReader(value))
+	if parseErr != nil {
+		return err
+	}
+
+	if _, isString := typed.(string); isString {
+		return err
+	}
+
+	return schema.Validate(typed)
+}
+
+// validate checks the request body and puts it back for the handler to
+// read. Bodies that are not valid JSON are left to the handler to reject.
+func (body *validatedBody) validate(r *http.Request) error {
+	data := []byte{}
+	if r.Body != nil {
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.required {
+			return apperror.New(http.StatusBadRequest, ErrInvalidRequest.Code, "request body is required")
+		}
+
+		return nil
+	}
+
+	schema, err := body.schema(r.Header.Get("content-type"))
+	if err != nil {
+		return err
+	}
+
+	if schema == nil {
+		return nil
+	}
+
+	payload, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	if err := schema.Validate(payload); err != nil {
+		return ErrInvalidRequest.WithFields(schemaViolations(err, "")...)
+	}
+
+	return nil
+}
+
+// schema returns the schema for the request's content type, handlers read
+// JSON whatever the content type so requests without one are checked as
+// JSON.
+func (body *validatedBody) schema(contentType string) (*jsonschema.Schema, error) {
+	if contentType == "" {
+		for _, mediaType := range slices.Sorted(maps.Keys(body.content)) {
+			if isJSONMediaType(mediaType) {
+				return body.content[mediaType], nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, apperror.New(http.StatusBadRequest, "unsupported_media_type", "content type is not valid")
+	}
+
+	schema, ok := body.content[mediaType]
+	if !ok {
+		return nil, apperror.New(http.StatusBadRequest, "unsupported_media_type", "content type "+mediaType+" is not accepted")
+	}
+
+	if !isJSONMediaType(mediaType) {
+		return nil, nil
+	}
+
+	return schema, nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// schemaViolations reports each violation in err as a field error, fields
+// are dotted paths below prefix such as "emails.0.value".
+func schemaViolations(err error, prefix string) []apperror.FieldError {
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return []apperror.FieldError{{Field: prefix, Code: "invalid", Message: err.Error()}}
+	}
+
+	violations := []apperror.FieldError{}
+
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+
+		if len(e.Causes) > 0 {
+			return
+		}
+
+		field := fieldPath(prefix, e.InstanceLocation...)
+
+		// a missing property is reported on the property rather than on
+		// the object that lacks it
+		if required, ok := e.ErrorKind.(*kind.Required); ok {
+			for _, missing := range required.Missing {
+				violations = append(violations, apperror.FieldError{
+					Field:   fieldPath(field, missing),
+					Code:    "required",
+					Message: "is required",
+				})
+			}
+			return
+		}
+
+		keywordPath := e.ErrorKind.KeywordPath()
+		code := "invalid"
+		if len(keywordPath) > 0 {
+			code = keywordPath[len(keywordPath)-1]
+		}
+
+		violations = append(violations, apperror.FieldError{
+			Field:   field,
+			Code:    code,
+			Message: e.ErrorKind.LocalizedString(schemaErrorPrinter),
+		})
+	}
+	collect(validationError)
+
+	slices.SortStableFunc(violations, func(a, b apperror.FieldError) int {
+		return strings.Compare(a.Field, b.Field)
+	})
+
+	return violations
+}
+
+func fieldPath(prefix string, tokens ...string) string {
+	path := []string{}
+	if prefix != "" {
+		path = append(path, prefix)
+	}
+
+	return strings.Join(append(path, tokens...), ".")
+}
+
+// describeSchemaError lists every violation on one line, such as
+// "status: got number, want string; build: is required".
+func describeSchemaError(err error) string {
+	return describeFields(schemaViolations(err, ""))
+}
+
+func describeFields(fields []apperror.FieldError) string {
+	descriptions := []string{}
+	for _, field := range fields {
+		if field.Field == "" {
+			descriptions = append(descriptions, field.Message)
+			continue
+		}
+
+		descriptions = append(descriptions, field.Field+": "+field.Message)
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// operationBuilder compiles the schemas of an operation, following
+// references to shared parameters and responses.
+type operationBuilder struct {
+	spec     *openAPISpec
+	compiler *jsonschema.Compiler
+}
+
+func (b *operationBuilder) build(
+	path, method string,
+	pathParameters []openAPIParameter,
+	raw json.RawMessage,
+) (*validatedOperation, error) {
+	spec := openAPIOperation{}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, err
+	}
+
+	pointer := jsonPointer("paths", path, strings.ToLower(method))
+
+	operation := &validatedOperation{
+		pattern:   method + " " + path,
+		responses: map[string]openAPIContent{},
+	}
+
+	// operation parameters override path parameters of the same name
+	parameters := map[string]validatedParameter{}
+	order := []string{}
+
+	addParameters := func(list []openAPIParameter, pointer string) error {
+		for i, parameter := range list {
+			parameterPointer := pointer + jsonPointer("parameters", strconv.Itoa(i))
+
+			if parameter.Ref != "" {
+				name, err := referenceName(parameter.Ref, "parameters")
+				if err != nil {
+					return err
+				}
+
+				parameter = b.spec.Components.Parameters[name]
+				parameterPointer = jsonPointer("components", "parameters", name)
+			}
+
+			schema, err := b.compile(parameterPointer + "/schema")
+			if err != nil {
+				return err
+			}
+
+			key := parameter.In + " " + parameter.Name
+			if _, ok := parameters[key]; !ok {
+				order = append(order, key)
+			}
+
+			parameters[key] = validatedParameter{
+				name:     parameter.Name,
+				in:       parameter.In,
+				required: parameter.Required,
+				schema:   schema,
+			}
+		}
+
+		return nil
+	}
+
+	if err := addParameters(pathParameters, jsonPointer("paths", path)); err != nil {
+		return nil, err
+	}
+
+	if err := addParameters(spec.Parameters, pointer); err != nil {
+		return nil, err
+	}
+
+	for _, key := range order {
+		operation.parameters = append(operation.parameters, parameters[key])
+	}
+
+	if spec.RequestBody != nil {
+		content, err := b.content(spec.RequestBody.Content, pointer+"/requestBody")
+		if err != nil {
+			return nil, err
+		}
+
+		operation.body = &validatedBody{
+			required: spec.RequestBody.Required,
+			content:  content,
+		}
+	}
+
+	if len(spec.Responses) == 0 {
+		return nil, errors.New("no responses are documented")
+	}
+
+	for status, response := range spec.Responses {
+		responsePointer := pointer + jsonPointer("responses", status)
+
+		if response.Ref != "" {
+			name, err := referenceName(response.Ref, "responses")
+			if err != nil {
+				return nil, err
+			}
+
+			response = b.spec.Components.Responses[name]
+			responsePointer = jsonPointer("components", "responses", name)
+		}
+
+		content, err := b.content(response.Content, responsePointer)
+		if err != nil {
+			return nil, err
+		}
+
+		operation.responses[status] = content
+	}
+
+	return operation, nil
+}
+
+func (b *operationBuilder) content(content map[string]json.RawMessage, pointer string) (openAPIContent, error) {
+	compiled := openAPIContent{}
+
+	for mediaType, raw := range content {
+		mediaTypeObject := struct {
+			Schema json.RawMessage `json:"schema"`
+		}{}
+		if err := json.Unmarshal(raw, &mediaTypeObject); err != nil {
+			return nil, err
+		}
+
+		compiled[mediaType] = nil
+
+		if mediaTypeObject.Schema == nil {
+			continue
+		}
+
+		schema, err := b.compile(pointer + jsonPointer("content", mediaType, "schema"))
+		if err != nil {
+			return nil, err
+		}
+
+		compiled[mediaType] = schema
+	}
+
+	return compiled, nil
+}
+
+func (b *operationBuilder) compile(pointer string) (*jsonschema.Schema, error) {
+	return b.compiler.Compile(openAPIDocumentURL + "#" + pointer)
+}
+
+func referenceName(ref, kind string) (string, error) {
+	name, ok := strings.CutPrefix(ref, "#/components/"+kind+"/")
+	if !ok {
+		return "", fmt.Errorf("unsupported reference %s", ref)
+	}
+
+	return name, nil
+}
+
+// jsonPointer joins tokens into a JSON pointer, escaping the / in paths
+// and media types.
+func jsonPointer(tokens ...string) string {
+	pointer := ""
+	for _, token := range tokens {
+		token = strings.ReplaceAll(token, "~", "~0")
+		token = strings.ReplaceAll(token, "/", "~1")
+		pointer += "/" + token
+	}
+
+	return pointer
+}
+
+// bufferedResponse holds a response back until it has been validated.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+
+	maps.Copy(w.Header(), b.header)
+	w.WriteHeader(b.status)
+
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
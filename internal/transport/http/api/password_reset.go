@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type passwordResetHandler struct {
+	passwordResetService service.PasswordResetService
+}
+
+func NewPasswordResetHandler(s service.PasswordResetService) *passwordResetHandler {
+	return &passwordResetHandler{
+		passwordResetService: s,
+	}
+}
+
+type requestPasswordResetHTTPRequestBody struct {
+	Email string `json:"email"`
+}
+
+type requestPasswordResetHTTPResponseBody struct {
+	Message string `json:"message"`
+}
+
+// RequestPasswordReset responds the same way whether or not the email belongs
+// to a user.
+func (h *passwordResetHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	payload := requestPasswordResetHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	passwordResetRequest, err := user.NewPasswordResetRequest(payload.Email, clientIP(r))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = h.passwordResetService.RequestPasswordReset(r.Context(), *passwordResetRequest)
+	if err == user.ErrTooManyPasswordResetRequests {
+		respondWithError(w, err)
+		return
+	}
+	if err != nil {
+		// failures are logged rather than returned, they would reveal that the email belongs to a user
+		logError(r, err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, requestPasswordResetHTTPResponseBody{
+		Message: "if the email belongs to an account a password reset link has been sent to it",
+	})
+}
+
+type confirmPasswordResetHTTPRequestBody struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *passwordResetHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	payload := confirmPasswordResetHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	confirmRequest, err := user.NewConfirmPasswordResetRequest(payload.Token, payload.Password)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = h.passwordResetService.ConfirmPasswordReset(r.Context(), *confirmRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
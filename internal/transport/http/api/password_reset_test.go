@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/password"
+)
+
+var resetTokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	passwordResets := NewPasswordResetHandler(app.PasswordResetService)
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	requestReset := func(email string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email": %q}`, email)
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/password-reset", bytes.NewBufferString(body))
+		request.RemoteAddr = "192.0.2.1:1234"
+
+		response := httptest.NewRecorder()
+		passwordResets.RequestPasswordReset(response, request)
+
+		return response
+	}
+
+	confirmReset := func(token, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"token": %q, "password": %q}`, token, password)
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/password-reset/confirm", bytes.NewBufferString(body))
+
+		response := httptest.NewRecorder()
+		passwordResets.ConfirmPasswordReset(response, request)
+
+		return response
+	}
+
+	t.Run("test unknown and known emails get the same response", func(t *testing.T) {
+		unknown := requestReset("nobody@mail.com")
+		known := requestReset("test@mail.com")
+
+		if unknown.Result().StatusCode != http.StatusAccepted || known.Result().StatusCode != http.StatusAccepted {
+			t.Errorf(
+				"expected both requests to be accepted got %d and %d",
+				unknown.Result().StatusCode,
+				known.Result().StatusCode,
+			)
+		}
+
+		if unknown.Body.String() != known.Body.String() {
+			t.Errorf("responses reveal whether an email exists got %q and %q", unknown.Body, known.Body)
+		}
+	})
+
+	t.Run("test reset token sets a new password and can only be used once", func(t *testing.T) {
+		if err := app.Background.Wait(t.Context()); err != nil {
+			t.Fatalf("reset email was not sent %q", err)
+		}
+
+		match := resetTokenPattern.FindStringSubmatch(app.Mailbox.String())
+		if match == nil {
+			t.Fatalf("no reset link was sent got %q", app.Mailbox.String())
+		}
+
+		if response := confirmReset(match[1], "short"); response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("expected a password that is too short to be rejected got status %d", response.Result().StatusCode)
+		}
+
+		// the rejected password must not have spent the token
+		response := confirmReset(match[1], "reset-password")
+		if response.Result().StatusCode != http.StatusNoContent {
+			t.Errorf("could not confirm password reset got status %d", response.Result().StatusCode)
+		}
+
+		updatedUser, err := app.DB.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Error("could not get user post password reset")
+		}
+
+		matches, err := password.NewHasher(password.DefaultArgon2idParams).Verify("reset-password", updatedUser.Password)
+		if err != nil || !matches {
+			t.Errorf("hashed password did not match reset password got error %v", err)
+		}
+
+		reused := confirmReset(match[1], "another-password")
+
+		got := problemHTTPResponseBody{}
+		err = json.NewDecoder(reused.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("could not parse response %q", err)
+		}
+
+		want := "password reset token is invalid or has expired"
+		if got.Detail != want {
+			t.Errorf("reset token could be used twice got %q want %q", got.Detail, want)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+
+	"url-short/internal/database"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/password"
+	"url-short/internal/service"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	breachedDir := t.TempDir()
+
+	sum := sha1.Sum([]byte("password123"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	err := os.WriteFile(filepath.Join(breachedDir, hash[:5]+".txt"), []byte(hash[5:]+":2254650\r\n"), 0o600)
+	if err != nil {
+		t.Fatalf("could not write breached password file %q", err)
+	}
+
+	breached, err := password.NewBreachedPasswordDirectory(breachedDir)
+	if err != nil {
+		t.Fatalf("could not open breached password directory %q", err)
+	}
+
+	passwords, err := userDomain.NewPasswords(
+		password.NewHasher(password.DefaultArgon2idParams),
+		userDomain.NewPasswordPolicy(10, breached),
+	)
+	if err != nil {
+		t.Fatalf("could not create passwords %q", err)
+	}
+
+	// the policy is applied before anything is stored
+	userService := service.NewUserServiceImpl(nil, nil, nil, nil, nil, nil, nil, passwords, nil, userDomain.UnverifiedUsersCanLogin, nil)
+	userHandler := NewUserHandler(userService)
+
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"test short passwords are refused", `{"email": "test@mail.com", "password": "too-short"}`, userDomain.ErrPasswordTooShort.Error()},
+		{"test breached passwords are refused", `{"email": "test@mail.com", "password": "password123"}`, userDomain.ErrPasswordBreached.Error()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBufferString(c.body))
+			response := httptest.NewRecorder()
+			userHandler.CreateUser(response, request)
+
+			got := problemHTTPResponseBody{}
+			err := json.NewDecoder(response.Body).Decode(&got)
+			if err != nil {
+				t.Fatalf("could not parse response %q", err)
+			}
+
+			if response.Result().StatusCode != http.StatusBadRequest || got.Detail != c.want {
+				t.Errorf("got status %d and %q want %q", response.Result().StatusCode, got.Detail, c.want)
+			}
+		})
+	}
+}
+
+func TestPasswordRehashOnLogin(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("test-password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("could not hash password %q", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = app.DB.CreateUser(t.Context(), database.CreateUserParams{
+		Email:     "test@mail.com",
+		Password:  string(bcryptHash),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("could not create user %q", err)
+	}
+
+	t.Run("test bcrypt hashes still log in and are upgraded to argon2id", func(t *testing.T) {
+		userOne, err := loginUserOne(app)
+		if err != nil || userOne.Token == "" {
+			t.Fatalf("user with a bcrypt hash could not log in %v", err)
+		}
+
+		rehashedUser, err := app.DB.SelectUser(t.Context(), "test@mail.com")
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		if !strings.HasPrefix(rehashedUser.Password, "$argon2id$v=19$m=65536,t=3,p=2$") {
+			t.Errorf("password was not rehashed got %q", rehashedUser.Password)
+		}
+
+		userOne, err = loginUserOne(app)
+		if err != nil || userOne.Token == "" {
+			t.Errorf("user could not log in with the rehashed password %v", err)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"url-short/internal/domain/ratelimit"
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type rateLimitHandler struct {
+	limiter *service.RateLimiter
+}
+
+func NewRateLimitHandler(limiter *service.RateLimiter) *rateLimitHandler {
+	return &rateLimitHandler{
+		limiter: limiter,
+	}
+}
+
+// GlobalRateLimitMiddleware limits every request per client address with the
+// default group's limit.
+func (handler *rateLimitHandler) GlobalRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler.take(w, r, ratelimit.GroupDefault, ratelimit.IPKey(clientIP(r))) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// RateLimitMiddleware limits requests to the group's routes per client
+// address.
+func (handler *rateLimitHandler) RateLimitMiddleware(group ratelimit.Group, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if handler.take(w, r, group, ratelimit.IPKey(clientIP(r))) {
+			next(w, r)
+		}
+	}
+}
+
+// UserRateLimitMiddleware limits requests to the group's routes per user, so
+// users share their limit across every address they use.
+func (handler *rateLimitHandler) UserRateLimitMiddleware(group ratelimit.Group, next authedHandeler) authedHandeler {
+	return func(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+		if handler.take(w, r, group, ratelimit.UserKey(authUser.Id)) {
+			next(w, r, authUser)
+		}
+	}
+}
+
+// take counts the request and sets the RateLimit headers, responding with
+// 429 Too Many Requests when it is over the limit.
+func (handler *rateLimitHandler) take(w http.ResponseWriter, r *http.Request, group ratelimit.Group, key string) bool {
+	decision := handler.limiter.Take(r.Context(), group, key, clientIP(r))
+
+	if decision.Limit.Enabled() {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+		w.Header().Set(
+			"RateLimit-Policy",
+			strconv.Itoa(decision.Limit.Requests)+";w="+strconv.Itoa(ceilSeconds(decision.Limit.Period)),
+		)
+	}
+
+	if !decision.Allowed {
+		respondWithError(w, &ratelimit.LimitedError{Decision: decision})
+		return false
+	}
+
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"url-short/internal/domain/ratelimit"
+	"url-short/internal/domain/user"
+	"url-short/internal/repository"
+	"url-short/internal/service"
+)
+
+// unavailableRateLimiter fails like Redis does while it is down.
+type unavailableRateLimiter struct{}
+
+func (unavailableRateLimiter) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	return ratelimit.Decision{}, errors.New("connection refused")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	allowlist, err := ratelimit.NewAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("could not parse allowlist %q", err)
+	}
+
+	limits := map[ratelimit.Group]ratelimit.Limit{
+		ratelimit.GroupAuth: {Requests: 2, Period: time.Minute},
+		ratelimit.GroupURLs: {Requests: 1, Period: time.Minute},
+	}
+
+	newHandler := func(shared repository.RateLimitRepository) *rateLimitHandler {
+		return NewRateLimitHandler(service.NewRateLimiter(shared, repository.NewLocalRateLimiter(), limits, allowlist))
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	send := func(handler http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/login", http.NoBody)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+		handler(response, request)
+
+		return response
+	}
+
+	t.Run("test clients over the limit get too many requests", func(t *testing.T) {
+		handler := newHandler(repository.NewLocalRateLimiter()).RateLimitMiddleware(ratelimit.GroupAuth, ok)
+
+		for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			response := send(handler, "192.0.2.1:4242")
+
+			if response.Result().StatusCode != want {
+				t.Errorf("got status %d for request %d want %d", response.Result().StatusCode, i, want)
+			}
+		}
+
+		response := send(handler, "192.0.2.1:4242")
+		if response.Header().Get("Retry-After") != "30" {
+			t.Errorf("got Retry-After %q want 30", response.Header().Get("Retry-After"))
+		}
+
+		if response.Header().Get("RateLimit-Remaining") != "0" || response.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("got headers %v want the auth limit", response.Header())
+		}
+
+		if send(handler, "192.0.2.2:4242").Result().StatusCode != http.StatusOK {
+			t.Errorf("got a client limited by another client's requests")
+		}
+	})
+
+	t.Run("test allowlisted clients are never limited", func(t *testing.T) {
+		handler := newHandler(repository.NewLocalRateLimiter()).RateLimitMiddleware(ratelimit.GroupAuth, ok)
+
+		for range 5 {
+			response := send(handler, "10.1.2.3:4242")
+
+			if response.Result().StatusCode != http.StatusOK || response.Header().Get("RateLimit-Limit") != "" {
+				t.Fatalf("got status %d with headers %v want an unlimited request", response.Result().StatusCode, response.Header())
+			}
+		}
+	})
+
+	t.Run("test requests are limited locally while the shared limiter is down", func(t *testing.T) {
+		handler := newHandler(unavailableRateLimiter{}).RateLimitMiddleware(ratelimit.GroupAuth, ok)
+
+		send(handler, "192.0.2.1:4242")
+		send(handler, "192.0.2.1:4242")
+
+		if send(handler, "192.0.2.1:4242").Result().StatusCode != http.StatusTooManyRequests {
+			t.Errorf("got the request through while the shared limiter was down")
+		}
+	})
+
+	t.Run("test users share their limit across addresses", func(t *testing.T) {
+		handler := newHandler(repository.NewLocalRateLimiter()).UserRateLimitMiddleware(
+			ratelimit.GroupURLs,
+			func(w http.ResponseWriter, r *http.Request, u *user.User) {
+				w.WriteHeader(http.StatusOK)
+			},
+		)
+
+		authUser := &user.User{Id: 7}
+		for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			request, _ := http.NewRequest(http.MethodPost, "/api/v1/urls", http.NoBody)
+			request.RemoteAddr = []string{"192.0.2.1:4242", "192.0.2.2:4242"}[i]
+			response := httptest.NewRecorder()
+			handler(response, request, authUser)
+
+			if response.Result().StatusCode != want {
+				t.Errorf("got status %d for request %d want %d", response.Result().StatusCode, i, want)
+			}
+		}
+	})
+
+	t.Run("test groups without a limit are not limited", func(t *testing.T) {
+		handler := newHandler(repository.NewLocalRateLimiter()).RateLimitMiddleware(ratelimit.GroupRedirect, ok)
+
+		for range 5 {
+			if send(handler, "192.0.2.1:4242").Result().StatusCode != http.StatusOK {
+				t.Fatalf("got a request limited by a group without a limit")
+			}
+		}
+	})
+}
@@ -0,0 +1,866 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-short/internal/domain/scim"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/service"
+)
+
+const (
+	scimContentType        = "application/scim+json"
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimConfigSchema       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// removing a single member is sent as a remove with a members[value eq "id"]
+// path
+var scimMemberPathPattern = regexp.MustCompile(`^(?i:members)\[\s*(?i:value)\s+(?i:eq)\s+"([^"]*)"\s*\]$`)
+
+type scimHandler struct {
+	scimService service.SCIMService
+}
+
+func NewSCIMHandler(scimService service.SCIMService) *scimHandler {
+	return &scimHandler{
+		scimService: scimService,
+	}
+}
+
+type scimAuthedHandler func(http.ResponseWriter, *http.Request, *scim.Token)
+
+// SCIMAuthenticationMiddleware authenticates directories by their workspace
+// SCIM token, user access tokens are not accepted.
+func (handler *scimHandler) SCIMAuthenticationMiddleware(nextHandler scimAuthedHandler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestToken, err := ExtractAuthTokenFromRequest(r)
+		if err != nil {
+			respondWithSCIMError(w, scim.ErrInvalidToken)
+			return
+		}
+
+		token, err := handler.scimService.Authenticate(r.Context(), requestToken)
+		if err != nil {
+			logError(r, err)
+			respondWithSCIMError(w, scim.ErrInvalidToken)
+			return
+		}
+
+		nextHandler(w, r, token)
+	})
+}
+
+type scimTokenHTTPResponseBody struct {
+	ID          int32     `json:"id"`
+	WorkspaceID int32     `json:"workspace_id"`
+	Token       string    `json:"token"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateToken returns the new SCIM token, it is not shown again.
+func (handler *scimHandler) CreateToken(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	token, err := handler.scimService.CreateToken(r.Context(), authUser.Id, workspaceID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, scimTokenHTTPResponseBody{
+		ID:          token.ID,
+		WorkspaceID: token.WorkspaceID,
+		Token:       token.Token,
+		CreatedAt:   token.CreatedAt,
+	})
+}
+
+func (handler *scimHandler) RevokeToken(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	tokenID, err := scim.NewTokenID(r.PathValue("tokenId"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = handler.scimService.RevokeToken(r.Context(), authUser.Id, workspaceID, tokenID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type scimMetaHTTPResponseBody struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type scimEmailHTTPBody struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary"`
+}
+
+type scimReferenceHTTPBody struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimUserHTTPResponseBody struct {
+	Schemas    []string                 `json:"schemas"`
+	ID         string                   `json:"id"`
+	ExternalID string                   `json:"externalId,omitempty"`
+	UserName   string                   `json:"userName"`
+	Active     bool                     `json:"active"`
+	Emails     []scimEmailHTTPBody      `json:"emails"`
+	Groups     []scimReferenceHTTPBody  `json:"groups"`
+	Meta       scimMetaHTTPResponseBody `json:"meta"`
+}
+
+func newSCIMUserHTTPResponseBody(u *scim.User) scimUserHTTPResponseBody {
+	id := strconv.Itoa(int(u.ID))
+
+	groups := []scimReferenceHTTPBody{}
+	if u.Role != "" {
+		groups = append(groups, scimReferenceHTTPBody{
+			Value:   string(u.Role),
+			Display: string(u.Role),
+			Ref:     "/scim/v2/Groups/" + string(u.Role),
+		})
+	}
+
+	return scimUserHTTPResponseBody{
+		Schemas:    []string{scimUserSchema},
+		ID:         id,
+		ExternalID: u.ExternalID,
+		UserName:   u.UserName,
+		Active:     u.Active,
+		Emails:     []scimEmailHTTPBody{{Value: u.UserName, Type: "work", Primary: true}},
+		Groups:     groups,
+		Meta: scimMetaHTTPResponseBody{
+			ResourceType: "User",
+			Created:      &u.CreatedAt,
+			LastModified: &u.UpdatedAt,
+			Location:     "/scim/v2/Users/" + id,
+		},
+	}
+}
+
+type scimGroupHTTPResponseBody struct {
+	Schemas     []string                 `json:"schemas"`
+	ID          string                   `json:"id"`
+	DisplayName string                   `json:"displayName"`
+	Members     []scimReferenceHTTPBody  `json:"members"`
+	Meta        scimMetaHTTPResponseBody `json:"meta"`
+}
+
+func newSCIMGroupHTTPResponseBody(g *scim.Group) scimGroupHTTPResponseBody {
+	members := []scimReferenceHTTPBody{}
+	for _, member := range g.Members {
+		id := strconv.Itoa(int(member.ID))
+
+		members = append(members, scimReferenceHTTPBody{
+			Value:   id,
+			Display: member.UserName,
+			Ref:     "/scim/v2/Users/" + id,
+		})
+	}
+
+	return scimGroupHTTPResponseBody{
+		Schemas:     []string{scimGroupSchema},
+		ID:          string(g.ID),
+		DisplayName: string(g.ID),
+		Members:     members,
+		Meta: scimMetaHTTPResponseBody{
+			ResourceType: "Group",
+			Location:     "/scim/v2/Groups/" + string(g.ID),
+		},
+	}
+}
+
+type scimListHTTPResponseBody struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+type scimErrorHTTPResponseBody struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func respondWithSCIM(w http.ResponseWriter, status int, payload any) {
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		slog.Error("could not marshal payload", "error", err)
+		return
+	}
+
+	w.Header().Set("content-type", scimContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+
+	if err != nil {
+		slog.Error("could not write data to response writer", "error", err)
+	}
+}
+
+// respondWithSCIMError answers with the error schema of RFC 7644, directories
+// act on the scimType.
+func respondWithSCIMError(w http.ResponseWriter, err error) {
+	var code int
+	var scimType string
+
+	detail := err.Error()
+
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	if errors.As(err, &syntaxError) || errors.As(err, &unmarshalTypeError) || errors.Is(err, io.EOF) {
+		code = http.StatusBadRequest
+		scimType = "invalidSyntax"
+		detail = "could not parse request"
+	} else {
+		switch err {
+		case scim.ErrInvalidToken:
+			code = http.StatusUnauthorized
+		case scim.ErrUserNotFound,
+			scim.ErrGroupNotFound:
+			code = http.StatusNotFound
+		case scim.ErrInvalidFilter:
+			code = http.StatusBadRequest
+			scimType = "invalidFilter"
+		case scim.ErrInvalidPage,
+			scim.ErrInvalidUserName,
+			scim.ErrInvalidExternal,
+			scim.ErrInvalidMember,
+			user.ErrInvalidEmail,
+			user.ErrEmptyEmail:
+			code = http.StatusBadRequest
+			scimType = "invalidValue"
+		case scim.ErrInvalidPatch:
+			code = http.StatusBadRequest
+			scimType = "invalidPath"
+		case scim.ErrMutability:
+			code = http.StatusBadRequest
+			scimType = "mutability"
+		case scim.ErrUniqueness,
+			user.ErrDuplicateUSer:
+			code = http.StatusConflict
+			scimType = "uniqueness"
+		case workspace.ErrLastOwner:
+			code = http.StatusConflict
+		case user.ErrUserDisabledByAdmin:
+			code = http.StatusForbidden
+		case scim.ErrUnsupported:
+			code = http.StatusNotImplemented
+		default:
+			code = http.StatusInternalServerError
+			detail = scim.ErrUnexpectedError.Error()
+		}
+	}
+
+	respondWithSCIM(w, code, scimErrorHTTPResponseBody{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(code),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+type scimSupportedHTTPBody struct {
+	Supported bool `json:"supported"`
+}
+
+type scimFilterSupportHTTPBody struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type scimBulkSupportHTTPBody struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type scimAuthenticationSchemeHTTPBody struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type scimServiceProviderConfigHTTPResponseBody struct {
+	Schemas               []string                           `json:"schemas"`
+	Patch                 scimSupportedHTTPBody              `json:"patch"`
+	Bulk                  scimBulkSupportHTTPBody            `json:"bulk"`
+	Filter                scimFilterSupportHTTPBody          `json:"filter"`
+	ChangePassword        scimSupportedHTTPBody              `json:"changePassword"`
+	Sort                  scimSupportedHTTPBody              `json:"sort"`
+	Etag                  scimSupportedHTTPBody              `json:"etag"`
+	AuthenticationSchemes []scimAuthenticationSchemeHTTPBody `json:"authenticationSchemes"`
+}
+
+// GetServiceProviderConfig tells directories which parts of SCIM are
+// supported.
+func (handler *scimHandler) GetServiceProviderConfig(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	respondWithSCIM(w, http.StatusOK, scimServiceProviderConfigHTTPResponseBody{
+		Schemas: []string{scimConfigSchema},
+		Patch:   scimSupportedHTTPBody{Supported: true},
+		Bulk:    scimBulkSupportHTTPBody{Supported: false},
+		Filter:  scimFilterSupportHTTPBody{Supported: true, MaxResults: 200},
+		AuthenticationSchemes: []scimAuthenticationSchemeHTTPBody{{
+			Type:        "oauthbearertoken",
+			Name:        "Workspace SCIM token",
+			Description: "A token created by a workspace owner, sent as a bearer token",
+		}},
+	})
+}
+
+// ListUsers lists the users the directory provisioned, filtered by the
+// filter query parameter and paged by startIndex and count.
+func (handler *scimHandler) ListUsers(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	query := r.URL.Query()
+
+	listRequest, err := scim.NewListUsersRequest(
+		token.WorkspaceID,
+		query.Get("filter"),
+		query.Get("startIndex"),
+		query.Get("count"),
+	)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	list, err := handler.scimService.ListUsers(r.Context(), *listRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	resources := []scimUserHTTPResponseBody{}
+	for _, u := range list.Resources {
+		resources = append(resources, newSCIMUserHTTPResponseBody(&u))
+	}
+
+	respondWithSCIM(w, http.StatusOK, scimListHTTPResponseBody{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: list.TotalResults,
+		StartIndex:   list.StartIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (handler *scimHandler) GetUser(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithSCIMError(w, scim.ErrUserNotFound)
+		return
+	}
+
+	res, err := handler.scimService.GetUser(r.Context(), token.WorkspaceID, userID)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusOK, newSCIMUserHTTPResponseBody(res))
+}
+
+type scimUserHTTPRequestBody struct {
+	UserName   string              `json:"userName"`
+	ExternalID string              `json:"externalId"`
+	Active     *bool               `json:"active"`
+	Emails     []scimEmailHTTPBody `json:"emails"`
+}
+
+// userName returns the userName, falling back to the primary email for
+// directories that only send emails.
+func (body *scimUserHTTPRequestBody) userName() string {
+	if body.UserName != "" {
+		return body.UserName
+	}
+
+	for _, email := range body.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+
+	return ""
+}
+
+func (body *scimUserHTTPRequestBody) active() bool {
+	return body.Active == nil || *body.Active
+}
+
+func (handler *scimHandler) CreateUser(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	payload := scimUserHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	createRequest, err := scim.NewCreateUserRequest(
+		token.WorkspaceID,
+		payload.userName(),
+		payload.ExternalID,
+		payload.active(),
+	)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	res, err := handler.scimService.CreateUser(r.Context(), *createRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusCreated, newSCIMUserHTTPResponseBody(res))
+}
+
+// ReplaceUser sets every attribute of the user, a missing externalId is
+// cleared and a missing active means the user is active.
+func (handler *scimHandler) ReplaceUser(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	payload := scimUserHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	userName := payload.userName()
+	active := payload.active()
+
+	patchRequest, err := scim.NewPatchUserRequest(
+		token.WorkspaceID,
+		r.PathValue("id"),
+		&userName,
+		&payload.ExternalID,
+		&active,
+	)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	res, err := handler.scimService.PatchUser(r.Context(), *patchRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusOK, newSCIMUserHTTPResponseBody(res))
+}
+
+type scimPatchHTTPRequestBody struct {
+	Schemas    []string                     `json:"schemas"`
+	Operations []scimPatchOperationHTTPBody `json:"Operations"`
+}
+
+type scimPatchOperationHTTPBody struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimUserPatch collects the attributes a PATCH sets, nil attributes are
+// left unchanged.
+type scimUserPatch struct {
+	UserName   *string
+	ExternalID *string
+	Active     *bool
+}
+
+// parseSCIMUserPatch reads user PATCH operations. Directories differ in how
+// they send them, some name the attribute in the path and others send an
+// object of attributes without a path, some capitalize the operation and
+// some send booleans as strings. Attributes the service does not store are
+// ignored.
+func parseSCIMUserPatch(operations []scimPatchOperationHTTPBody) (*scimUserPatch, error) {
+	patch := &scimUserPatch{}
+
+	for _, operation := range operations {
+		switch strings.ToLower(operation.Op) {
+		case "add", "replace":
+			if operation.Path != "" {
+				if err := patch.set(operation.Path, operation.Value); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			attributes := map[string]json.RawMessage{}
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return nil, scim.ErrInvalidPatch
+			}
+
+			for attribute, value := range attributes {
+				if err := patch.set(attribute, value); err != nil {
+					return nil, err
+				}
+			}
+		case "remove":
+			switch strings.ToLower(operation.Path) {
+			case "externalid":
+				cleared := ""
+				patch.ExternalID = &cleared
+			case "username", "active", "":
+				return nil, scim.ErrInvalidPatch
+			}
+		default:
+			return nil, scim.ErrInvalidPatch
+		}
+	}
+
+	return patch, nil
+}
+
+func (patch *scimUserPatch) set(attribute string, value json.RawMessage) error {
+	switch strings.ToLower(attribute) {
+	case "username":
+		userName := ""
+		if err := json.Unmarshal(value, &userName); err != nil {
+			return scim.ErrInvalidPatch
+		}
+
+		patch.UserName = &userName
+	case "externalid":
+		externalID := ""
+		if err := json.Unmarshal(value, &externalID); err != nil {
+			return scim.ErrInvalidPatch
+		}
+
+		patch.ExternalID = &externalID
+	case "active":
+		active, err := parseSCIMBool(value)
+		if err != nil {
+			return err
+		}
+
+		patch.Active = &active
+	}
+
+	return nil
+}
+
+// parseSCIMBool accepts JSON booleans and the "True" and "False" strings
+// some directories send instead.
+func parseSCIMBool(value json.RawMessage) (bool, error) {
+	parsed := false
+	if err := json.Unmarshal(value, &parsed); err == nil {
+		return parsed, nil
+	}
+
+	text := ""
+	if err := json.Unmarshal(value, &text); err != nil {
+		return false, scim.ErrInvalidPatch
+	}
+
+	parsed, err := strconv.ParseBool(strings.ToLower(text))
+	if err != nil {
+		return false, scim.ErrInvalidPatch
+	}
+
+	return parsed, nil
+}
+
+// PatchUser changes the user's attributes, setting active to false
+// deprovisions the user.
+func (handler *scimHandler) PatchUser(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	payload := scimPatchHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	patch, err := parseSCIMUserPatch(payload.Operations)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	patchRequest, err := scim.NewPatchUserRequest(
+		token.WorkspaceID,
+		r.PathValue("id"),
+		patch.UserName,
+		patch.ExternalID,
+		patch.Active,
+	)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	res, err := handler.scimService.PatchUser(r.Context(), *patchRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusOK, newSCIMUserHTTPResponseBody(res))
+}
+
+// DeleteUser deprovisions the user and takes them out of the workspace, the
+// account and its links are kept.
+func (handler *scimHandler) DeleteUser(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	userID, err := user.NewUserID(r.PathValue("id"))
+	if err != nil {
+		respondWithSCIMError(w, scim.ErrUserNotFound)
+		return
+	}
+
+	err = handler.scimService.DeleteUser(r.Context(), token.WorkspaceID, userID)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListGroups lists the workspace roles as groups of the users holding them.
+func (handler *scimHandler) ListGroups(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	query := r.URL.Query()
+
+	listRequest, err := scim.NewListGroupsRequest(
+		token.WorkspaceID,
+		query.Get("filter"),
+		query.Get("startIndex"),
+		query.Get("count"),
+	)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	list, err := handler.scimService.ListGroups(r.Context(), *listRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	resources := []scimGroupHTTPResponseBody{}
+	for _, g := range list.Resources {
+		resources = append(resources, newSCIMGroupHTTPResponseBody(&g))
+	}
+
+	respondWithSCIM(w, http.StatusOK, scimListHTTPResponseBody{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: list.TotalResults,
+		StartIndex:   list.StartIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (handler *scimHandler) GetGroup(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	role, err := scim.NewGroupID(r.PathValue("id"))
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	res, err := handler.scimService.GetGroup(r.Context(), token.WorkspaceID, role)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusOK, newSCIMGroupHTTPResponseBody(res))
+}
+
+// CreateGroup and DeleteGroup are refused, the groups are the fixed set of
+// workspace roles.
+func (handler *scimHandler) CreateGroup(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	respondWithSCIMError(w, scim.ErrUnsupported)
+}
+
+func (handler *scimHandler) DeleteGroup(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	respondWithSCIMError(w, scim.ErrUnsupported)
+}
+
+type scimGroupHTTPRequestBody struct {
+	DisplayName string                  `json:"displayName"`
+	Members     []scimReferenceHTTPBody `json:"members"`
+}
+
+// ReplaceGroup sets the group's members to exactly the ones given.
+func (handler *scimHandler) ReplaceGroup(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	payload := scimGroupHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	if payload.DisplayName != "" && payload.DisplayName != r.PathValue("id") {
+		respondWithSCIMError(w, scim.ErrMutability)
+		return
+	}
+
+	change, err := scim.NewMemberChange(string(scim.MemberOperationReplace), scimMemberIDs(payload.Members))
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	handler.patchGroup(w, r, token, []scim.MemberChange{*change})
+}
+
+// parseSCIMGroupPatch reads group PATCH operations into member changes,
+// members are either the path of the operation or a members attribute of an
+// operation without a path.
+func parseSCIMGroupPatch(operations []scimPatchOperationHTTPBody) ([]scim.MemberChange, error) {
+	changes := []scim.MemberChange{}
+
+	for _, operation := range operations {
+		var members []scimReferenceHTTPBody
+
+		match := scimMemberPathPattern.FindStringSubmatch(operation.Path)
+		switch {
+		case match != nil && strings.EqualFold(operation.Op, "remove"):
+			members = []scimReferenceHTTPBody{{Value: match[1]}}
+		case strings.EqualFold(operation.Path, "members"):
+			// removing every member may come without a value
+			if len(operation.Value) > 0 {
+				if err := json.Unmarshal(operation.Value, &members); err != nil {
+					return nil, scim.ErrInvalidPatch
+				}
+			}
+		case operation.Path == "":
+			attributes := struct {
+				Members *[]scimReferenceHTTPBody `json:"members"`
+			}{}
+			if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+				return nil, scim.ErrInvalidPatch
+			}
+
+			// only displayName and id are left, which can not change
+			if attributes.Members == nil {
+				continue
+			}
+			members = *attributes.Members
+		case strings.EqualFold(operation.Path, "displayName"):
+			return nil, scim.ErrMutability
+		default:
+			return nil, scim.ErrInvalidPatch
+		}
+
+		operationName := operation.Op
+		if strings.EqualFold(operation.Op, "remove") && len(members) == 0 {
+			// a remove without members empties the group
+			operationName = string(scim.MemberOperationReplace)
+		}
+
+		change, err := scim.NewMemberChange(operationName, scimMemberIDs(members))
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, *change)
+	}
+
+	return changes, nil
+}
+
+func scimMemberIDs(members []scimReferenceHTTPBody) []string {
+	ids := []string{}
+	for _, member := range members {
+		ids = append(ids, member.Value)
+	}
+
+	return ids
+}
+
+// PatchGroup adds members to the group, removes them from it or replaces its
+// members. Adding a user gives them the group's role and removing them drops
+// them back to viewer.
+func (handler *scimHandler) PatchGroup(w http.ResponseWriter, r *http.Request, token *scim.Token) {
+	payload := scimPatchHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	changes, err := parseSCIMGroupPatch(payload.Operations)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	handler.patchGroup(w, r, token, changes)
+}
+
+func (handler *scimHandler) patchGroup(
+	w http.ResponseWriter,
+	r *http.Request,
+	token *scim.Token,
+	changes []scim.MemberChange,
+) {
+	patchRequest, err := scim.NewPatchGroupRequest(token.WorkspaceID, r.PathValue("id"), changes)
+	if err != nil {
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	res, err := handler.scimService.PatchGroup(r.Context(), *patchRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithSCIMError(w, err)
+		return
+	}
+
+	respondWithSCIM(w, http.StatusOK, newSCIMGroupHTTPResponseBody(res))
+}
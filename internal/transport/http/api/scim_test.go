@@ -0,0 +1,388 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/scim"
+	"url-short/internal/domain/shorturl"
+	"url-short/internal/domain/workspace"
+)
+
+func TestSCIMPatchParsing(t *testing.T) {
+	parse := func(t *testing.T, body string) []scimPatchOperationHTTPBody {
+		payload := scimPatchHTTPRequestBody{}
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatalf("could not parse patch %q", err)
+		}
+
+		return payload.Operations
+	}
+
+	t.Run("test deactivating with a path and a string value", func(t *testing.T) {
+		patch, err := parseSCIMUserPatch(parse(t, `{
+			"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+			"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+		}`))
+		if err != nil {
+			t.Fatalf("could not parse patch %q", err)
+		}
+
+		if patch.Active == nil || *patch.Active {
+			t.Errorf("got active %v want false", patch.Active)
+		}
+	})
+
+	t.Run("test deactivating without a path", func(t *testing.T) {
+		patch, err := parseSCIMUserPatch(parse(t, `{
+			"Operations": [{"op": "replace", "value": {"active": false, "externalId": "00u1", "displayName": "Jane"}}]
+		}`))
+		if err != nil {
+			t.Fatalf("could not parse patch %q", err)
+		}
+
+		if patch.Active == nil || *patch.Active || patch.ExternalID == nil || *patch.ExternalID != "00u1" {
+			t.Errorf("got patch %+v want inactive with external id 00u1", patch)
+		}
+	})
+
+	t.Run("test unknown operations are refused", func(t *testing.T) {
+		_, err := parseSCIMUserPatch(parse(t, `{"Operations": [{"op": "move", "path": "active", "value": true}]}`))
+		if err != scim.ErrInvalidPatch {
+			t.Errorf("got error %v want %v", err, scim.ErrInvalidPatch)
+		}
+	})
+
+	t.Run("test removing a single group member by path", func(t *testing.T) {
+		changes, err := parseSCIMGroupPatch(parse(t, `{
+			"Operations": [
+				{"op": "add", "path": "members", "value": [{"value": "3"}, {"value": "4"}]},
+				{"op": "remove", "path": "members[value eq \"3\"]"}
+			]
+		}`))
+		if err != nil {
+			t.Fatalf("could not parse patch %q", err)
+		}
+
+		if len(changes) != 2 ||
+			changes[0].Operation != scim.MemberOperationAdd ||
+			len(changes[0].UserIDs) != 2 ||
+			changes[1].Operation != scim.MemberOperationRemove ||
+			changes[1].UserIDs[0] != 3 {
+			t.Errorf("got changes %+v want an add of 3 and 4 and a remove of 3", changes)
+		}
+	})
+
+	t.Run("test groups can not be renamed", func(t *testing.T) {
+		_, err := parseSCIMGroupPatch(parse(t, `{"Operations": [{"op": "replace", "path": "displayName", "value": "x"}]}`))
+		if err != scim.ErrMutability {
+			t.Errorf("got error %v want %v", err, scim.ErrMutability)
+		}
+	})
+}
+
+func TestSCIMProvisioning(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	owner, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	createWorkspace, _ := workspace.NewCreateWorkspaceRequest("Engineering", owner.Id)
+	shared, err := app.WorkspaceService.CreateWorkspace(context.Background(), *createWorkspace)
+	if err != nil {
+		t.Fatalf("could not create workspace %q", err)
+	}
+
+	workspaceID := strconv.Itoa(int(shared.ID))
+	handler := NewSCIMHandler(app.SCIMService)
+
+	request, _ := http.NewRequest(http.MethodPost, "/api/v1/workspaces/"+workspaceID+"/scim-tokens", nil)
+	request.SetPathValue("id", workspaceID)
+	response := httptest.NewRecorder()
+	handler.CreateToken(response, request, owner)
+
+	if response.Result().StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+	}
+
+	token := scimTokenHTTPResponseBody{}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		t.Fatalf("could not parse response %q", err)
+	}
+
+	call := func(
+		next scimAuthedHandler,
+		bearer string,
+		method string,
+		target string,
+		id string,
+		body string,
+	) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		request.Header.Set("Authorization", "Bearer "+bearer)
+		request.SetPathValue("id", id)
+		response := httptest.NewRecorder()
+		handler.SCIMAuthenticationMiddleware(next)(response, request)
+
+		return response
+	}
+
+	decodeUser := func(t *testing.T, response *httptest.ResponseRecorder) scimUserHTTPResponseBody {
+		got := scimUserHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		return got
+	}
+
+	response = call(handler.CreateUser, token.Token, http.MethodPost, "/scim/v2/Users", "", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "Jane@Example.com",
+		"externalId": "00u1"
+	}`)
+	if response.Result().StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+	}
+
+	jane := decodeUser(t, response)
+	janeID, _ := strconv.Atoi(jane.ID)
+
+	t.Run("test provisioned users join the workspace as viewers", func(t *testing.T) {
+		if jane.UserName != "jane@example.com" || !jane.Active || len(jane.Groups) != 1 || jane.Groups[0].Value != "viewer" {
+			t.Errorf("got user %+v want an active viewer named jane@example.com", jane)
+		}
+
+		if response.Header().Get("content-type") != scimContentType {
+			t.Errorf("got content type %q want %q", response.Header().Get("content-type"), scimContentType)
+		}
+	})
+
+	t.Run("test directories can not verify emails", func(t *testing.T) {
+		provisioned, err := app.UserRepo.SelectUserByID(context.Background(), int32(janeID))
+		if err != nil {
+			t.Fatalf("could not find provisioned user %q", err)
+		}
+
+		if provisioned.IsEmailVerified() {
+			t.Errorf("email of provisioned user %q is verified", provisioned.Email)
+		}
+	})
+
+	t.Run("test other tokens are refused", func(t *testing.T) {
+		response := call(handler.ListUsers, "not-a-token", http.MethodGet, "/scim/v2/Users", "", "")
+
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("test existing accounts can not be provisioned", func(t *testing.T) {
+		for _, userName := range []string{"jane@example.com", "test@mail.com"} {
+			response := call(
+				handler.CreateUser,
+				token.Token,
+				http.MethodPost,
+				"/scim/v2/Users",
+				"",
+				fmt.Sprintf(`{"userName": %q}`, userName),
+			)
+
+			got := scimErrorHTTPResponseBody{}
+			if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+				t.Fatalf("could not parse response %q", err)
+			}
+
+			if response.Result().StatusCode != http.StatusConflict || got.ScimType != "uniqueness" || got.Status != "409" {
+				t.Errorf("got status %d and %+v want a uniqueness conflict", response.Result().StatusCode, got)
+			}
+		}
+	})
+
+	t.Run("test users can be filtered and paged", func(t *testing.T) {
+		response := call(handler.CreateUser, token.Token, http.MethodPost, "/scim/v2/Users", "", `{
+			"emails": [{"value": "john@example.com", "primary": true}]
+		}`)
+		if response.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+		}
+
+		john := decodeUser(t, response)
+
+		list := func(t *testing.T, query string) scimListHTTPResponseBody {
+			response := call(handler.ListUsers, token.Token, http.MethodGet, "/scim/v2/Users?"+query, "", "")
+			if response.Result().StatusCode != http.StatusOK {
+				t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+			}
+
+			got := scimListHTTPResponseBody{}
+			if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+				t.Fatalf("could not parse response %q", err)
+			}
+
+			return got
+		}
+
+		got := list(t, "filter="+`userName+eq+"JANE@example.com"`)
+		if got.TotalResults != 1 {
+			t.Errorf("got %d users want 1", got.TotalResults)
+		}
+
+		got = list(t, "filter="+`externalId+eq+"00u2"`)
+		if got.TotalResults != 0 {
+			t.Errorf("got %d users want 0", got.TotalResults)
+		}
+
+		got = list(t, "startIndex=2&count=1")
+		resources, _ := got.Resources.([]any)
+		if got.TotalResults != 2 || got.StartIndex != 2 || got.ItemsPerPage != 1 || len(resources) != 1 {
+			t.Errorf("got page %+v want the second of 2 users", got)
+		}
+		if len(resources) == 1 && resources[0].(map[string]any)["id"] != john.ID {
+			t.Errorf("got user %v want %s", resources[0], john.ID)
+		}
+
+		response = call(handler.ListUsers, token.Token, http.MethodGet, "/scim/v2/Users?filter=userName+sw+%22j%22", "", "")
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test groups set the workspace role", func(t *testing.T) {
+		response := call(handler.PatchGroup, token.Token, http.MethodPatch, "/scim/v2/Groups/editor", "editor", fmt.Sprintf(`{
+			"Operations": [{"op": "add", "path": "members", "value": [{"value": %q}]}]
+		}`, jane.ID))
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := scimGroupHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if len(got.Members) != 1 || got.Members[0].Value != jane.ID {
+			t.Errorf("got members %v want %s", got.Members, jane.ID)
+		}
+
+		member, err := app.WorkspaceRepo.SelectMember(context.Background(), shared.ID, int32(janeID))
+		if err != nil || member.Role != workspace.RoleEditor {
+			t.Errorf("got member %v with err %v want an editor", member, err)
+		}
+
+		// the owner was not provisioned, so the directory can not change them
+		response = call(handler.PatchGroup, token.Token, http.MethodPatch, "/scim/v2/Groups/viewer", "viewer", fmt.Sprintf(`{
+			"Operations": [{"op": "add", "path": "members", "value": [{"value": "%d"}]}]
+		}`, owner.Id))
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test directories can not enable users an administrator disabled", func(t *testing.T) {
+		if _, err := app.UserRepo.SetUserDisabled(context.Background(), int32(janeID), true); err != nil {
+			t.Fatalf("could not disable user %q", err)
+		}
+
+		response := call(handler.PatchUser, token.Token, http.MethodPatch, "/scim/v2/Users/"+jane.ID, jane.ID, `{
+			"Operations": [{"op": "Replace", "path": "active", "value": true}]
+		}`)
+		if response.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusForbidden)
+		}
+
+		account, err := app.UserRepo.SelectUserByID(context.Background(), int32(janeID))
+		if err != nil || !account.IsDisabled() {
+			t.Errorf("got account %v with err %v want a disabled account", account, err)
+		}
+
+		if _, err := app.UserRepo.SetUserDisabled(context.Background(), int32(janeID), false); err != nil {
+			t.Fatalf("could not enable user %q", err)
+		}
+	})
+
+	t.Run("test deprovisioning disables the user and keeps their links", func(t *testing.T) {
+		createURL, _ := shorturl.NewCreateURLRequest(int32(janeID), "https://www.google.com")
+		createURL.WorkspaceID = shared.ID
+		link, err := app.URLService.CreateShortURL(context.Background(), *createURL)
+		if err != nil {
+			t.Fatalf("could not create link %q", err)
+		}
+
+		session, err := app.UserService.LoginExternalUser(context.Background(), int32(janeID))
+		if err != nil {
+			t.Fatalf("could not log in provisioned user %q", err)
+		}
+
+		response := call(handler.PatchUser, token.Token, http.MethodPatch, "/scim/v2/Users/"+jane.ID, jane.ID, `{
+			"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+		}`)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		if got := decodeUser(t, response); got.Active {
+			t.Errorf("got active user want inactive")
+		}
+
+		if _, err := app.UserService.ValidateUserJWT(context.Background(), session.Token); err == nil {
+			t.Errorf("deprovisioned user's access token is still valid")
+		}
+
+		response = call(handler.DeleteUser, token.Token, http.MethodDelete, "/scim/v2/Users/"+jane.ID, jane.ID, "")
+		if response.Result().StatusCode != http.StatusNoContent {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusNoContent)
+		}
+
+		response = call(handler.GetUser, token.Token, http.MethodGet, "/scim/v2/Users/"+jane.ID, jane.ID, "")
+		if response.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusNotFound)
+		}
+
+		account, err := app.UserRepo.SelectUserByID(context.Background(), int32(janeID))
+		if err != nil || !account.IsDisabled() {
+			t.Errorf("got account %v with err %v want a disabled account", account, err)
+		}
+
+		if _, err := app.URLRepo.GetURLByHash(context.Background(), link.ShortURL); err != nil {
+			t.Errorf("deprovisioned user's link was deleted %q", err)
+		}
+	})
+
+	t.Run("test revoked tokens are refused", func(t *testing.T) {
+		tokenID := strconv.Itoa(int(token.ID))
+
+		request, _ := http.NewRequest(http.MethodDelete, "/api/v1/workspaces/"+workspaceID+"/scim-tokens/"+tokenID, nil)
+		request.SetPathValue("id", workspaceID)
+		request.SetPathValue("tokenId", tokenID)
+		response := httptest.NewRecorder()
+		handler.RevokeToken(response, request, owner)
+
+		if response.Result().StatusCode != http.StatusNoContent {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusNoContent)
+		}
+
+		response = call(handler.ListUsers, token.Token, http.MethodGet, "/scim/v2/Users", "", "")
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusUnauthorized)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
@@ -22,13 +21,15 @@ func NewShortUrlHandler(s service.URLService) *shorturlHandler {
 }
 
 type createShortURLHTTPRequestBody struct {
-	LongURL string `json:"long_url"`
+	LongURL     string `json:"long_url"`
+	WorkspaceID int32  `json:"workspace_id"`
 }
 
 type createShortURLHTTPResponseBody struct {
-	ShortURL  string    `json:"short_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ShortURL    string    `json:"short_url"`
+	WorkspaceID int32     `json:"workspace_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 func (h *shorturlHandler) CreateShortURL(w http.ResponseWriter, r *http.Request, user *user.User) {
@@ -36,29 +37,31 @@ func (h *shorturlHandler) CreateShortURL(w http.ResponseWriter, r *http.Request,
 
 	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	createURLRequest, err := shorturl.NewCreateURLRequest(user.Id, payload.LongURL)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
+	createURLRequest.WorkspaceID = payload.WorkspaceID
 
 	createURLResponse, err := h.urlService.CreateShortURL(r.Context(), *createURLRequest)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, createShortURLHTTPResponseBody{
-		ShortURL:  createURLResponse.ShortURL,
-		CreatedAt: createURLResponse.CreatedAt,
-		UpdatedAt: createURLResponse.UpdatedAt,
+		ShortURL:    createURLResponse.ShortURL,
+		WorkspaceID: createURLResponse.WorkspaceID,
+		CreatedAt:   createURLResponse.CreatedAt,
+		UpdatedAt:   createURLResponse.UpdatedAt,
 	})
 }
 
@@ -96,7 +99,7 @@ func (h *shorturlHandler) DeleteShortURL(w http.ResponseWriter, r *http.Request,
 	err = h.urlService.DeleteShortURL(r.Context(), *req)
 
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
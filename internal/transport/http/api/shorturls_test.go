@@ -94,7 +94,7 @@ func TestGetShortURL(t *testing.T) {
 
 	postLongURLRequest := httptest.NewRequest(
 		http.MethodPost,
-		"/api/v1/data/shorten",
+		"/api/v1/urls",
 		bytes.NewBuffer(LongUrl),
 	)
 
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"url-short/internal/tracing"
+)
+
+// fakeDB answers every statement without a database.
+type fakeDB struct{}
+
+func (fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	db := tracing.NewDB(fakeDB{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/urls/{shortUrl}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "URLService.GetLongURL")
+		defer span.End()
+
+		db.ExecContext(ctx, "-- name: RecordClick :exec\nUPDATE urls SET clicks = clicks + 1")
+
+		w.WriteHeader(http.StatusMovedPermanently)
+	})
+
+	request, _ := http.NewRequest(http.MethodGet, "/api/v1/urls/abc", http.NoBody)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	TracingMiddleware(mux, mux).ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans want 3", len(spans))
+	}
+
+	query, service, server := spans[0], spans[1], spans[2]
+
+	if server.Name() != "GET /api/v1/urls/{shortUrl}" {
+		t.Errorf("got server span %q want it named after the route", server.Name())
+	}
+
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("got trace %s want the incoming trace to continue", server.SpanContext().TraceID())
+	}
+
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("got parent %s want the incoming span", server.Parent().SpanID())
+	}
+
+	statusFound := false
+	for _, attr := range server.Attributes() {
+		if attr == attribute.Int("http.response.status_code", http.StatusMovedPermanently) {
+			statusFound = true
+		}
+	}
+	if !statusFound {
+		t.Errorf("got attributes %v want the response status", server.Attributes())
+	}
+
+	if service.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("got service span outside the request span")
+	}
+
+	if query.Name() != "db RecordClick" || query.Parent().SpanID() != service.SpanContext().SpanID() {
+		t.Errorf("got query span %q want db RecordClick inside the service span", query.Name())
+	}
+}
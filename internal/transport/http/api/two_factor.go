@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/service"
+)
+
+type twoFactorHandler struct {
+	twoFactorService service.TwoFactorService
+}
+
+func NewTwoFactorHandler(s service.TwoFactorService) *twoFactorHandler {
+	return &twoFactorHandler{
+		twoFactorService: s,
+	}
+}
+
+type enrollTOTPHTTPResponseBody struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+func (h *twoFactorHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	enrollment, err := h.twoFactorService.EnrollTOTP(r.Context(), authUser)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, enrollTOTPHTTPResponseBody{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+type confirmTOTPHTTPRequestBody struct {
+	Code string `json:"code"`
+}
+
+type confirmTOTPHTTPResponseBody struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *twoFactorHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := confirmTOTPHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	confirmRequest, err := user.NewConfirmTwoFactorRequest(authUser.Id, payload.Code)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorService.ConfirmTOTP(r.Context(), *confirmRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, confirmTOTPHTTPResponseBody{
+		RecoveryCodes: recoveryCodes,
+	})
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/totp"
+)
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	userHandler := NewUserHandler(app.UserService)
+	twoFactor := NewTwoFactorHandler(app.TwoFactorService)
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	userOne, err := app.UserRepo.SelectUser(t.Context(), "test@mail.com")
+	if err != nil {
+		t.Fatal("could not find user that was expected to exist")
+	}
+
+	login := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(UserOne))
+		response := httptest.NewRecorder()
+		userHandler.LoginUser(response, request)
+
+		return response
+	}
+
+	loginWithTwoFactor := func(mfaToken, code string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, mfaToken, code)
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/login/2fa", bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		userHandler.LoginUserWithTwoFactor(response, request)
+
+		return response
+	}
+
+	challenge := func(t *testing.T) string {
+		response := login()
+
+		got := loginUserChallengeHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusAccepted || !got.MFARequired || got.MFAToken == "" {
+			t.Fatalf("login did not ask for a second factor got status %d and %+v", response.Result().StatusCode, got)
+		}
+
+		return got.MFAToken
+	}
+
+	enrollment := enrollTOTPHTTPResponseBody{}
+	recoveryCodes := confirmTOTPHTTPResponseBody{}
+	confirmCode := ""
+
+	t.Run("test enrolling returns a secret and an otpauth uri", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/users/2fa", nil)
+		response := httptest.NewRecorder()
+		twoFactor.EnrollTOTP(response, request, userOne)
+
+		err := json.NewDecoder(response.Body).Decode(&enrollment)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusCreated || enrollment.Secret == "" {
+			t.Errorf("enrollment failed got status %d", response.Result().StatusCode)
+		}
+
+		if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, enrollment.Secret) {
+			t.Errorf("unexpected otpauth uri got %q", enrollment.URI)
+		}
+	})
+
+	t.Run("test login does not need a code until enrollment is confirmed", func(t *testing.T) {
+		response := login()
+		if response.Result().StatusCode != http.StatusFound {
+			t.Errorf("unconfirmed enrollment changed login got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test confirming with a wrong code is refused", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/users/2fa/confirm", bytes.NewBufferString(`{"code": "000000"}`))
+		response := httptest.NewRecorder()
+		twoFactor.ConfirmTOTP(response, request, userOne)
+
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("wrong code was accepted got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test confirming returns recovery codes", func(t *testing.T) {
+		confirmCode, err = totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatalf("could not generate code %q", err)
+		}
+
+		body := fmt.Sprintf(`{"code": %q}`, confirmCode)
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1/users/2fa/confirm", bytes.NewBufferString(body))
+		response := httptest.NewRecorder()
+		twoFactor.ConfirmTOTP(response, request, userOne)
+
+		err := json.NewDecoder(response.Body).Decode(&recoveryCodes)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if response.Result().StatusCode != http.StatusOK || len(recoveryCodes.RecoveryCodes) != 10 {
+			t.Errorf("confirmation failed got status %d and %+v", response.Result().StatusCode, recoveryCodes)
+		}
+	})
+
+	t.Run("test challenge token is not an access token", func(t *testing.T) {
+		mfaToken := challenge(t)
+
+		_, err := app.UserService.ValidateUserJWT(t.Context(), mfaToken)
+		if err == nil {
+			t.Error("challenge token was accepted as an access token")
+		}
+	})
+
+	t.Run("test the code used to confirm can not be used again", func(t *testing.T) {
+		response := loginWithTwoFactor(challenge(t), confirmCode)
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("reused code was accepted got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test recovery code completes the login once", func(t *testing.T) {
+		mfaToken := challenge(t)
+		recoveryCode := recoveryCodes.RecoveryCodes[0]
+
+		response := loginWithTwoFactor(mfaToken, recoveryCode)
+
+		got := loginUserHTTPResponseBody{}
+		err := json.NewDecoder(response.Body).Decode(&got)
+		if err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if got.Token == "" || got.RefreshToken == "" {
+			t.Errorf("login was not completed got status %d", response.Result().StatusCode)
+		}
+
+		response = loginWithTwoFactor(mfaToken, recoveryCodes.RecoveryCodes[1])
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("challenge token was accepted twice got status %d", response.Result().StatusCode)
+		}
+
+		response = loginWithTwoFactor(challenge(t), recoveryCode)
+		if response.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("recovery code was accepted twice got status %d", response.Result().StatusCode)
+		}
+	})
+
+	t.Run("test guessing codes is rate limited", func(t *testing.T) {
+		var err error
+		for range 5 {
+			err = app.TwoFactorService.VerifyCode(t.Context(), userOne.Id, "000000")
+		}
+
+		if err != userDomain.ErrTooManyTwoFactorAttempts {
+			t.Errorf("code guessing was not limited got %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/service"
+)
+
+type usageHandler struct {
+	quotaService service.QuotaService
+}
+
+func NewUsageHandler(quotaService service.QuotaService) *usageHandler {
+	return &usageHandler{
+		quotaService: quotaService,
+	}
+}
+
+// planLimitsHTTPResponseBody holds the plan's limits, zero is unlimited.
+type planLimitsHTTPResponseBody struct {
+	MaxActiveLinks   int64 `json:"max_active_links"`
+	MaxCustomAliases int64 `json:"max_custom_aliases"`
+	MaxMonthlyClicks int64 `json:"max_monthly_clicks"`
+	MaxAPIKeys       int64 `json:"max_api_keys"`
+	MaxBatchSize     int64 `json:"max_batch_size"`
+}
+
+type usageCountersHTTPResponseBody struct {
+	ActiveLinks   int64 `json:"active_links"`
+	MonthlyClicks int64 `json:"monthly_clicks"`
+	TrackedClicks int64 `json:"tracked_clicks"`
+}
+
+type usageHTTPResponseBody struct {
+	Plan        string                        `json:"plan"`
+	WorkspaceID int32                         `json:"workspace_id"`
+	PeriodStart time.Time                     `json:"period_start"`
+	PeriodEnd   time.Time                     `json:"period_end"`
+	Limits      planLimitsHTTPResponseBody    `json:"limits"`
+	Usage       usageCountersHTTPResponseBody `json:"usage"`
+}
+
+func newUsageHTTPResponseBody(u *plan.Usage) usageHTTPResponseBody {
+	return usageHTTPResponseBody{
+		Plan:        u.Plan.Name,
+		WorkspaceID: u.WorkspaceID,
+		PeriodStart: u.PeriodStart,
+		PeriodEnd:   u.PeriodEnd,
+		Limits: planLimitsHTTPResponseBody{
+			MaxActiveLinks:   u.Plan.Limits.MaxActiveLinks,
+			MaxCustomAliases: u.Plan.Limits.MaxCustomAliases,
+			MaxMonthlyClicks: u.Plan.Limits.MaxMonthlyClicks,
+			MaxAPIKeys:       u.Plan.Limits.MaxAPIKeys,
+			MaxBatchSize:     u.Plan.Limits.MaxBatchSize,
+		},
+		Usage: usageCountersHTTPResponseBody{
+			ActiveLinks:   u.ActiveLinks,
+			MonthlyClicks: u.MonthlyClicks,
+			TrackedClicks: u.TrackedClicks(),
+		},
+	}
+}
+
+// GetUserUsage shows the user's plan and what their personal workspace uses
+// of it this month.
+func (handler *usageHandler) GetUserUsage(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	usage, err := handler.quotaService.GetUserUsage(r.Context(), authUser.Id)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUsageHTTPResponseBody(usage))
+}
+
+func (handler *usageHandler) GetWorkspaceUsage(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	usage, err := handler.quotaService.GetMemberWorkspaceUsage(r.Context(), authUser.Id, workspaceID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newUsageHTTPResponseBody(usage))
+}
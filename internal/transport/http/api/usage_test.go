@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/audit"
+	"url-short/internal/domain/plan"
+	"url-short/internal/domain/shorturl"
+	userDomain "url-short/internal/domain/user"
+)
+
+func TestQuotaExceededResponse(t *testing.T) {
+	response := httptest.NewRecorder()
+	respondWithError(response, &plan.QuotaExceededError{Plan: "starter", Quota: plan.QuotaActiveLinks, Limit: 1})
+
+	if response.Result().StatusCode != http.StatusPaymentRequired {
+		t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusPaymentRequired)
+	}
+
+	got := problemHTTPResponseBody{}
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("could not parse response %q", err)
+	}
+
+	want := "your plan does not allow this: the starter plan allows at most 1 active_links"
+	if got.Detail != want {
+		t.Errorf("got error %q want %q", got.Detail, want)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	user, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	usage := NewUsageHandler(app.QuotaService)
+	admin := NewAdminHandler(app.AdminService)
+	adminUser := &userDomain.User{Id: user.Id + 100, Role: userDomain.RoleAdmin}
+
+	getUsage := func() usageHTTPResponseBody {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me/usage", http.NoBody)
+		response := httptest.NewRecorder()
+		usage.GetUserUsage(response, request, user)
+
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		got := usageHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		return got
+	}
+
+	setUserPlan := func(planName string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(setPlanHTTPRequestBody{Plan: planName})
+		request, _ := http.NewRequest(http.MethodPut, "/api/v1/admin/users/{id}/plan", bytes.NewBuffer(body))
+		request.SetPathValue("id", strconv.Itoa(int(user.Id)))
+		response := httptest.NewRecorder()
+		admin.SetUserPlan(response, request, adminUser)
+
+		return response
+	}
+
+	createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.google.com")
+	link, err := app.URLService.CreateShortURL(context.Background(), *createRequest)
+	if err != nil {
+		t.Fatalf("could not create short url %q", err)
+	}
+
+	t.Run("test new users are on the default plan", func(t *testing.T) {
+		got := getUsage()
+
+		if got.Plan != "free" || got.Limits.MaxActiveLinks != 0 {
+			t.Errorf("got plan %q with limits %+v want the unlimited free plan", got.Plan, got.Limits)
+		}
+
+		if got.Usage.ActiveLinks != 1 {
+			t.Errorf("got %d active links want 1", got.Usage.ActiveLinks)
+		}
+
+		if got.PeriodStart.Day() != 1 || !got.PeriodEnd.Equal(got.PeriodStart.AddDate(0, 1, 0)) {
+			t.Errorf("got period %s to %s want the current month", got.PeriodStart, got.PeriodEnd)
+		}
+	})
+
+	t.Run("test admins can not move users to unknown plans", func(t *testing.T) {
+		response := setUserPlan("enterprise")
+
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test links over the plan's limit are refused", func(t *testing.T) {
+		response := setUserPlan("starter")
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		createRequest, _ := shorturl.NewCreateURLRequest(user.Id, "https://www.example.com")
+		_, err := app.URLService.CreateShortURL(context.Background(), *createRequest)
+		if !errors.Is(err, plan.ErrQuotaExceeded) {
+			t.Errorf("got error %v want the quota to be exceeded", err)
+		}
+
+		events, err := app.AuditService.ListUserEvents(context.Background(), user.Id, 1, 0)
+		if err != nil || len(events) != 1 || events[0].Type != audit.EventAdminUserPlanSet {
+			t.Fatalf("got events %+v want the plan change", events)
+		}
+
+		if change := events[0].Diff["plan"]; change.From != "free" || change.To != "starter" {
+			t.Errorf("got diff %+v want free to starter", events[0].Diff)
+		}
+	})
+
+	t.Run("test deleted links free up the quota", func(t *testing.T) {
+		deleteRequest := shorturl.NewDeleteURLRequest(user.Id, link.ShortURL)
+		if err := app.URLService.DeleteShortURL(context.Background(), *deleteRequest); err != nil {
+			t.Fatalf("could not delete short url %q", err)
+		}
+
+		if got := getUsage(); got.Usage.ActiveLinks != 0 {
+			t.Errorf("got %d active links want 0", got.Usage.ActiveLinks)
+		}
+
+		link, err = app.URLService.CreateShortURL(context.Background(), *createRequest)
+		if err != nil {
+			t.Fatalf("could not create short url %q", err)
+		}
+	})
+
+	t.Run("test clicks over the plan's limit are not tracked", func(t *testing.T) {
+		for range 3 {
+			if _, err := app.URLService.GetLongURL(context.Background(), link.ShortURL); err != nil {
+				t.Fatalf("could not resolve short url %q", err)
+			}
+		}
+
+		if _, err := app.Clicks.Flush(context.Background()); err != nil {
+			t.Fatalf("could not store clicks %q", err)
+		}
+
+		got := getUsage()
+		if got.Usage.MonthlyClicks != 3 || got.Usage.TrackedClicks != 1 {
+			t.Errorf("got %d clicks with %d tracked want 3 with 1 tracked", got.Usage.MonthlyClicks, got.Usage.TrackedClicks)
+		}
+
+		clicks, err := app.URLRepo.ListUserURLClicks(context.Background(), user.Id)
+		if err != nil {
+			t.Fatalf("could not list clicks %q", err)
+		}
+
+		if len(clicks) != 1 || clicks[0].Clicks != 1 {
+			t.Errorf("got clicks %+v want one tracked click", clicks)
+		}
+	})
+
+	t.Run("test only members see a workspace's usage", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/api/v1/workspaces/{id}/usage", http.NoBody)
+		request.SetPathValue("id", "1")
+		response := httptest.NewRecorder()
+		usage.GetWorkspaceUsage(response, request, adminUser)
+
+		if response.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("test links created at the same moment stay within the limit", func(t *testing.T) {
+		deleteRequest := shorturl.NewDeleteURLRequest(user.Id, link.ShortURL)
+		if err := app.URLService.DeleteShortURL(context.Background(), *deleteRequest); err != nil {
+			t.Fatalf("could not delete short url %q", err)
+		}
+
+		errs := make([]error, 5)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				createRequest, _ := shorturl.NewCreateURLRequest(user.Id, fmt.Sprintf("https://www.example.com/%d", i))
+				_, errs[i] = app.URLService.CreateShortURL(context.Background(), *createRequest)
+			}()
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+
+			if !errors.Is(err, plan.ErrQuotaExceeded) {
+				t.Errorf("got error %v want the quota to be exceeded", err)
+			}
+		}
+
+		if created != 1 {
+			t.Errorf("got %d links created want 1", created)
+		}
+
+		if got := getUsage(); got.Usage.ActiveLinks != 1 {
+			t.Errorf("got %d active links want 1", got.Usage.ActiveLinks)
+		}
+	})
+}
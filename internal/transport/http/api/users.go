@@ -2,7 +2,8 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
@@ -37,21 +38,21 @@ func (handler *userHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	createUserRequest, err := user.NewCreateUserRequest(payload.Email, payload.Password)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	res, err := handler.userService.CreateUser(r.Context(), *createUserRequest)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
@@ -85,7 +86,7 @@ func (handler *userHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loginUserRequest, err := user.NewLoginUserRequest(payload.Email, payload.Password)
+	loginUserRequest, err := user.NewLoginUserRequest(payload.Email, payload.Password, clientIP(r))
 	if err != nil {
 		respondWithError(w, err)
 		return
@@ -97,6 +98,60 @@ func (handler *userHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if res.MFAChallengeToken != "" {
+		respondWithJSON(w, http.StatusAccepted, loginUserChallengeHTTPResponseBody{
+			ID:          res.Id,
+			Email:       res.Email,
+			MFARequired: true,
+			MFAToken:    res.MFAChallengeToken,
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusFound, loginUserHTTPResponseBody{
+		ID:           res.Id,
+		Email:        res.Email,
+		Token:        res.Token,
+		RefreshToken: res.RefreshToken,
+	})
+}
+
+// loginUserChallengeHTTPResponseBody is sent instead of tokens when the user
+// has two factor authentication enabled.
+type loginUserChallengeHTTPResponseBody struct {
+	ID          int32  `json:"id"`
+	Email       string `json:"email"`
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type loginUserWithTwoFactorHTTPRequestBody struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (handler *userHandler) LoginUserWithTwoFactor(w http.ResponseWriter, r *http.Request) {
+	payload := loginUserWithTwoFactorHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	loginRequest, err := user.NewLoginWithTwoFactorRequest(payload.MFAToken, payload.Code)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.userService.LoginUserWithTwoFactor(r.Context(), *loginRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusFound, loginUserHTTPResponseBody{
 		ID:           res.Id,
 		Email:        res.Email,
@@ -106,7 +161,8 @@ func (handler *userHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 }
 
 type refreshAccessTokenHTTPResponseBody struct {
-	AccessToken string `json:"token"`
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 func (handler *userHandler) RefreshAccessToken(w http.ResponseWriter, r *http.Request) {
@@ -125,21 +181,29 @@ func (handler *userHandler) RefreshAccessToken(w http.ResponseWriter, r *http.Re
 	}
 
 	respondWithJSON(w, http.StatusCreated, refreshAccessTokenHTTPResponseBody{
-		AccessToken: user.Token,
+		AccessToken:  user.Token,
+		RefreshToken: user.RefreshToken,
 	})
 }
 
 type updateUserHTTPRequestBody struct {
-	Email    string `json:"email"`
-	Password string `json:"Password"`
+	Email           string `json:"email"`
+	Password        string `json:"Password"`
+	CurrentPassword string `json:"current_password"`
+	TwoFactorCode   string `json:"two_factor_code"`
 }
 
-// TODO: User needs proper response with updated at and created at
 type updateUserHTTPResponseBody struct {
-	ID    int32  `json:"id"`
-	Email string `json:"email"`
+	ID        int32     `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// UpdateUser is deprecated in favour of PATCH /api/v1/users/me and makes the
+// same checks. It always sends the email and the password, a password equal
+// to the current one is left as it is so changing only the email does not
+// log the user out.
 func (handler *userHandler) UpdateUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
 	payload := updateUserHTTPRequestBody{}
 
@@ -150,22 +214,68 @@ func (handler *userHandler) UpdateUser(w http.ResponseWriter, r *http.Request, a
 		return
 	}
 
-	updateUserRequest, err := user.NewUpdateUserRequest(payload.Email, payload.Password, authUser.Id)
+	newPassword := &payload.Password
+	if payload.Password == payload.CurrentPassword {
+		newPassword = nil
+	}
+
+	updateUserRequest, err := user.NewUpdateProfileRequest(
+		authUser.Id,
+		&payload.Email,
+		newPassword,
+		payload.CurrentPassword,
+		payload.TwoFactorCode,
+		clientIP(r),
+	)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	user, err := handler.userService.UpdateUser(r.Context(), *updateUserRequest)
 	if err != nil {
-		log.Println(err)
+		logError(r, err)
 		respondWithError(w, err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, updateUserHTTPResponseBody{
-		Email: user.Email,
-		ID:    user.Id,
+		Email:     user.Email,
+		ID:        user.Id,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
 	})
 }
+
+type logoutUserHTTPRequestBody struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (handler *userHandler) LogoutUser(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	accessToken, err := ExtractAuthTokenFromRequest(r)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := logoutUserHTTPRequestBody{}
+
+	// the body is optional, without a refresh token only the access token is revoked
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, err)
+		return
+	}
+
+	logoutUserRequest := user.NewLogoutUserRequest(authUser.Id, accessToken, payload.RefreshToken)
+
+	err = handler.userService.LogoutUser(r.Context(), *logoutUserRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
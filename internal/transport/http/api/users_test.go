@@ -10,7 +10,8 @@ import (
 
 	_ "github.com/lib/pq"
 
-	"golang.org/x/crypto/bcrypt"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/password"
 )
 
 func TestPostUser(t *testing.T) {
@@ -41,7 +42,7 @@ func TestPostUser(t *testing.T) {
 
 		userHandler.CreateUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -50,8 +51,8 @@ func TestPostUser(t *testing.T) {
 		}
 
 		want := "empty email"
-		if got.Error != want {
-			t.Errorf("incorrect error when invalid json used got %q wanted %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when invalid json used got %q wanted %q", got.Detail, want)
 		}
 	})
 
@@ -63,7 +64,7 @@ func TestPostUser(t *testing.T) {
 
 		userHandler.CreateUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -72,8 +73,8 @@ func TestPostUser(t *testing.T) {
 		}
 
 		want := "could not parse request"
-		if got.Error != want {
-			t.Errorf("incorrect error when invalid json used got %q wanted %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when invalid json used got %q wanted %q", got.Detail, want)
 		}
 
 	})
@@ -86,7 +87,7 @@ func TestPostUser(t *testing.T) {
 
 		userHandler.CreateUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -95,8 +96,8 @@ func TestPostUser(t *testing.T) {
 		}
 
 		want := "invalid email"
-		if got.Error != want {
-			t.Errorf("incorrect error when passing invalid email address %q wanted %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when passing invalid email address %q wanted %q", got.Detail, want)
 		}
 	})
 
@@ -108,7 +109,7 @@ func TestPostUser(t *testing.T) {
 
 		userHandler.CreateUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 		err := json.NewDecoder(response.Body).Decode(&got)
 
 		if err != nil {
@@ -116,8 +117,8 @@ func TestPostUser(t *testing.T) {
 		}
 
 		want := "user already exists"
-		if got.Error != want {
-			t.Errorf("expected duplicate user to fail got %q wanted %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("expected duplicate user to fail got %q wanted %q", got.Detail, want)
 		}
 	})
 }
@@ -144,7 +145,7 @@ func TestPostLogin(t *testing.T) {
 
 		userHandler.LoginUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -153,8 +154,8 @@ func TestPostLogin(t *testing.T) {
 		}
 
 		want := "email and password must not be empty"
-		if got.Error != want {
-			t.Errorf("incorrect error when passing invalid login parameters got %q want %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when passing invalid login parameters got %q want %q", got.Detail, want)
 		}
 	})
 
@@ -166,7 +167,7 @@ func TestPostLogin(t *testing.T) {
 
 		userHandler.LoginUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -175,8 +176,8 @@ func TestPostLogin(t *testing.T) {
 		}
 
 		want := "user could not be found"
-		if got.Error != want {
-			t.Errorf("incorrect error when non existent user attempts to login got %q want %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when non existent user attempts to login got %q want %q", got.Detail, want)
 		}
 	})
 
@@ -188,7 +189,7 @@ func TestPostLogin(t *testing.T) {
 
 		userHandler.LoginUser(response, request)
 
-		got := errorHTTPResponseBody{}
+		got := problemHTTPResponseBody{}
 
 		err := json.NewDecoder(response.Body).Decode(&got)
 
@@ -197,8 +198,8 @@ func TestPostLogin(t *testing.T) {
 		}
 
 		want := "invalid password"
-		if got.Error != want {
-			t.Errorf("incorrect error when incorrect password is supplied got %q want %q", got.Error, want)
+		if got.Detail != want {
+			t.Errorf("incorrect error when incorrect password is supplied got %q want %q", got.Detail, want)
 		}
 	})
 
@@ -265,6 +266,56 @@ func TestRefreshEndpoint(t *testing.T) {
 		if refreshGot.AccessToken == "" {
 			t.Errorf("no token was returned from refresh endpoint got %q", refreshGot.AccessToken)
 		}
+
+		if refreshGot.RefreshToken == "" || refreshGot.RefreshToken == userOne.RefreshToken {
+			t.Errorf("refresh token was not rotated got %q", refreshGot.RefreshToken)
+		}
+	})
+
+	t.Run("test reusing a rotated refresh token revokes the token family", func(t *testing.T) {
+		loginGot, err := loginUserOne(app)
+		if err != nil {
+			t.Errorf("can not login user one for test case with err %q", err)
+		}
+
+		refresh := func(refreshToken string) *httptest.ResponseRecorder {
+			refreshRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/refresh", http.NoBody)
+			refreshRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", refreshToken))
+
+			refreshResponse := httptest.NewRecorder()
+			userHandler.RefreshAccessToken(refreshResponse, refreshRequest)
+
+			return refreshResponse
+		}
+
+		firstRefresh := refresh(loginGot.RefreshToken)
+
+		rotated := refreshAccessTokenHTTPResponseBody{}
+		err = json.NewDecoder(firstRefresh.Body).Decode(&rotated)
+		if err != nil {
+			t.Error("could not decode refreshResponse")
+		}
+
+		reuseResponse := refresh(loginGot.RefreshToken)
+		if reuseResponse.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("reused refresh token was accepted got status %d", reuseResponse.Result().StatusCode)
+		}
+
+		got := problemHTTPResponseBody{}
+		err = json.NewDecoder(reuseResponse.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("could not parse response %q", err)
+		}
+
+		want := "refresh token has already been used, please login again"
+		if got.Detail != want {
+			t.Errorf("incorrect error when reusing a refresh token got %q want %q", got.Detail, want)
+		}
+
+		revokedResponse := refresh(rotated.RefreshToken)
+		if revokedResponse.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("token family was not revoked after reuse got status %d", revokedResponse.Result().StatusCode)
+		}
 	})
 }
 
@@ -322,10 +373,132 @@ func TestPutUser(t *testing.T) {
 			t.Error("could not get user post password change")
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(userPostUpdate.Password), []byte("new-password"))
+		matches, err := password.NewHasher(password.DefaultArgon2idParams).Verify("new-password", userPostUpdate.Password)
+
+		if err != nil || !matches {
+			t.Errorf("hashed password did not match new password got error %v", err)
+		}
+	})
+
+	t.Run("test updating the user needs the current password", func(t *testing.T) {
+		user, err := app.UserRepo.SelectUser(t.Context(), userOne.Email)
+		if err != nil {
+			t.Fatal("could not find user that was expected to exist")
+		}
+
+		for body, want := range map[string]string{
+			`{"email": "test@mail.com", "password": "stolen-password"}`:                                       userDomain.ErrCurrentPasswordRequired.Code,
+			`{"email": "test@mail.com", "password": "stolen-password", "current_password": "wrong-password"}`: userDomain.ErrInvalidPassword.Code,
+		} {
+			putUserRequest, _ := http.NewRequest(http.MethodPut, "/api/v1/users", bytes.NewBufferString(body))
+			putUserResponse := httptest.NewRecorder()
+
+			userHandler.UpdateUser(putUserResponse, putUserRequest, user)
+
+			got := problemHTTPResponseBody{}
+			if err := json.NewDecoder(putUserResponse.Body).Decode(&got); err != nil {
+				t.Fatalf("could not parse response %q", err)
+			}
+
+			if got.Code != want {
+				t.Errorf("got code %q want %q", got.Code, want)
+			}
+		}
+
+		unchanged, err := app.DB.SelectUser(t.Context(), userOne.Email)
+		if err != nil {
+			t.Fatal("could not get user after the rejected updates")
+		}
+
+		matches, err := password.NewHasher(password.DefaultArgon2idParams).Verify("new-password", unchanged.Password)
+		if err != nil || !matches {
+			t.Errorf("password was changed without the current password got error %v", err)
+		}
+	})
+
+	t.Run("test updating the user revokes existing tokens", func(t *testing.T) {
+		loginGot, err := loginUserOne(app)
+		if err != nil {
+			t.Errorf("can not login user one for test case with err %q", err)
+		}
+
+		body := []byte(`{"email": "test@mail.com", "password": "test-password", "current_password": "new-password"}`)
+		putUserRequest, _ := http.NewRequest(http.MethodPut, "/api/v1/users", bytes.NewBuffer(body))
+		putUserResponse := httptest.NewRecorder()
 
+		user, err := app.UserRepo.SelectUser(putUserRequest.Context(), loginGot.Email)
 		if err != nil {
-			t.Errorf("hashed password did not match new password got error %q", err)
+			t.Error("could not find user that was expected to exist")
+		}
+
+		userHandler.UpdateUser(putUserResponse, putUserRequest, user)
+
+		_, err = app.UserService.ValidateUserJWT(putUserRequest.Context(), loginGot.Token)
+		if err != userDomain.ErrTokenRevoked {
+			t.Errorf("access token issued before the update was not revoked got %v", err)
+		}
+
+		refreshRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/refresh", http.NoBody)
+		refreshRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginGot.RefreshToken))
+
+		refreshResponse := httptest.NewRecorder()
+		userHandler.RefreshAccessToken(refreshResponse, refreshRequest)
+
+		if refreshResponse.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("refresh token issued before the update was not revoked got status %d", refreshResponse.Result().StatusCode)
+		}
+	})
+}
+
+func TestLogoutEndpoint(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Errorf("could not create test app %q", err)
+	}
+
+	userHandler := NewUserHandler(app.UserService)
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	userOne, err := loginUserOne(app)
+	if err != nil {
+		t.Errorf("can not login user one for test case with err %q", err)
+	}
+
+	t.Run("test logout revokes the access and refresh token", func(t *testing.T) {
+		logoutBody := fmt.Sprintf(`{"refresh_token": %q}`, userOne.RefreshToken)
+		logoutRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/logout", bytes.NewBufferString(logoutBody))
+		logoutRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", userOne.Token))
+
+		logoutResponse := httptest.NewRecorder()
+
+		user, err := app.UserService.ValidateUserJWT(logoutRequest.Context(), userOne.Token)
+		if err != nil {
+			t.Fatalf("could not validate token before logout %q", err)
+		}
+
+		userHandler.LogoutUser(logoutResponse, logoutRequest, user)
+
+		if logoutResponse.Result().StatusCode != http.StatusNoContent {
+			t.Errorf("logout failed got status %d", logoutResponse.Result().StatusCode)
+		}
+
+		_, err = app.UserService.ValidateUserJWT(logoutRequest.Context(), userOne.Token)
+		if err != userDomain.ErrTokenRevoked {
+			t.Errorf("access token was not revoked on logout got %v", err)
+		}
+
+		refreshRequest, _ := http.NewRequest(http.MethodPost, "/api/v1/refresh", http.NoBody)
+		refreshRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", userOne.RefreshToken))
+
+		refreshResponse := httptest.NewRecorder()
+		userHandler.RefreshAccessToken(refreshResponse, refreshRequest)
+
+		if refreshResponse.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("refresh token was not revoked on logout got status %d", refreshResponse.Result().StatusCode)
 		}
 	})
 }
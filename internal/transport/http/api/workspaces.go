@@ -0,0 +1,318 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+	"url-short/internal/service"
+)
+
+type workspaceHandler struct {
+	workspaceService service.WorkspaceService
+}
+
+func NewWorkspaceHandler(workspaceService service.WorkspaceService) *workspaceHandler {
+	return &workspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+type workspaceHTTPResponseBody struct {
+	ID        int32          `json:"id"`
+	Name      string         `json:"name"`
+	Personal  bool           `json:"personal"`
+	Role      workspace.Role `json:"role"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func newWorkspaceHTTPResponseBody(w *workspace.Workspace, role workspace.Role) workspaceHTTPResponseBody {
+	return workspaceHTTPResponseBody{
+		ID:        w.ID,
+		Name:      w.Name,
+		Personal:  w.IsPersonal(),
+		Role:      role,
+		CreatedAt: w.CreatedAt,
+		UpdatedAt: w.UpdatedAt,
+	}
+}
+
+type memberHTTPResponseBody struct {
+	UserID      int32          `json:"user_id"`
+	WorkspaceID int32          `json:"workspace_id"`
+	Email       string         `json:"email"`
+	Role        workspace.Role `json:"role"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func newMemberHTTPResponseBody(m *workspace.Member) memberHTTPResponseBody {
+	return memberHTTPResponseBody{
+		UserID:      m.UserID,
+		WorkspaceID: m.WorkspaceID,
+		Email:       m.Email,
+		Role:        m.Role,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
+type workspaceURLHTTPResponseBody struct {
+	ShortURL       string    `json:"short_url"`
+	LongURL        string    `json:"long_url"`
+	CreatedBy      *int32    `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+}
+
+type createWorkspaceHTTPRequestBody struct {
+	Name string `json:"name"`
+}
+
+func (handler *workspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := createWorkspaceHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	createRequest, err := workspace.NewCreateWorkspaceRequest(payload.Name, authUser.Id)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.workspaceService.CreateWorkspace(r.Context(), *createRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newWorkspaceHTTPResponseBody(res, workspace.RoleOwner))
+}
+
+// ListWorkspaces lists the workspaces the user is a member of together with
+// their role in each.
+func (handler *workspaceHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	memberships, err := handler.workspaceService.ListWorkspaces(r.Context(), authUser.Id)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	response := []workspaceHTTPResponseBody{}
+	for _, m := range memberships {
+		response = append(response, newWorkspaceHTTPResponseBody(&m.Workspace, m.Role))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (handler *workspaceHandler) ListMembers(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	members, err := handler.workspaceService.ListMembers(r.Context(), authUser.Id, workspaceID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	response := []memberHTTPResponseBody{}
+	for _, m := range members {
+		response = append(response, newMemberHTTPResponseBody(&m))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+type setMemberRoleHTTPRequestBody struct {
+	Role string `json:"role"`
+}
+
+func (handler *workspaceHandler) SetMemberRole(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	userID, err := user.NewUserID(r.PathValue("userId"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := setMemberRoleHTTPRequestBody{}
+
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	setRoleRequest, err := workspace.NewSetMemberRoleRequest(workspaceID, userID, payload.Role)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.workspaceService.SetMemberRole(r.Context(), authUser.Id, *setRoleRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newMemberHTTPResponseBody(res))
+}
+
+// RemoveMember takes a member out of the workspace, members remove
+// themselves to leave.
+func (handler *workspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	userID, err := user.NewUserID(r.PathValue("userId"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	err = handler.workspaceService.RemoveMember(r.Context(), authUser.Id, workspaceID, userID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type inviteMemberHTTPRequestBody struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type inviteMemberHTTPResponseBody struct {
+	ID          int32          `json:"id"`
+	WorkspaceID int32          `json:"workspace_id"`
+	Email       string         `json:"email"`
+	Role        workspace.Role `json:"role"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+}
+
+func (handler *workspaceHandler) InviteMember(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	payload := inviteMemberHTTPRequestBody{}
+
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	inviteRequest, err := workspace.NewInviteMemberRequest(workspaceID, payload.Email, payload.Role, authUser.Id)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.workspaceService.InviteMember(r.Context(), *inviteRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, inviteMemberHTTPResponseBody{
+		ID:          res.ID,
+		WorkspaceID: res.WorkspaceID,
+		Email:       res.Email,
+		Role:        res.Role,
+		ExpiresAt:   res.ExpiresAt,
+	})
+}
+
+type acceptInviteHTTPRequestBody struct {
+	Token string `json:"token"`
+}
+
+// AcceptInvite joins the logged in user to the workspace they were invited
+// to, the invite must have been sent to their email.
+func (handler *workspaceHandler) AcceptInvite(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	payload := acceptInviteHTTPRequestBody{}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	acceptRequest, err := workspace.NewAcceptInviteRequest(payload.Token, authUser.Id, authUser.Email)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := handler.workspaceService.AcceptInvite(r.Context(), *acceptRequest)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newMemberHTTPResponseBody(res))
+}
+
+func (handler *workspaceHandler) ListURLs(w http.ResponseWriter, r *http.Request, authUser *user.User) {
+	workspaceID, err := workspace.NewWorkspaceID(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	urls, err := handler.workspaceService.ListURLs(r.Context(), authUser.Id, workspaceID)
+	if err != nil {
+		logError(r, err)
+		respondWithError(w, err)
+		return
+	}
+
+	response := []workspaceURLHTTPResponseBody{}
+	for _, u := range urls {
+		var createdBy *int32
+		if u.UserID != 0 {
+			createdBy = &u.UserID
+		}
+
+		response = append(response, workspaceURLHTTPResponseBody{
+			ShortURL:       u.ShortURL,
+			LongURL:        u.LongURL,
+			CreatedBy:      createdBy,
+			CreatedAt:      u.CreatedAt,
+			UpdatedAt:      u.UpdatedAt,
+			DisabledReason: string(u.DisabledReason),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq"
+
+	"url-short/internal/domain/shorturl"
+	userDomain "url-short/internal/domain/user"
+	"url-short/internal/domain/workspace"
+)
+
+var workspaceInviteTokenPattern = regexp.MustCompile(`workspace-invite\?token=([0-9a-f]+)`)
+
+func TestWorkspaces(t *testing.T) {
+	app, err := withTestApplication()
+	if err != nil {
+		t.Fatalf("could not create test app %q", err)
+	}
+
+	_, err = setupUserOne(app)
+	if err != nil {
+		t.Errorf("can not set up user for test case with err %q", err)
+	}
+
+	owner, err := app.UserRepo.SelectUser(context.Background(), "test@mail.com")
+	if err != nil {
+		t.Fatalf("could not find user that was expected to exist %q", err)
+	}
+
+	createMember, _ := userDomain.NewCreateUserRequest("member@mail.com", "member-password")
+	member, err := app.UserService.CreateUser(context.Background(), *createMember)
+	if err != nil {
+		t.Fatalf("could not create member %q", err)
+	}
+
+	workspaces := NewWorkspaceHandler(app.WorkspaceService)
+	urls := NewShortUrlHandler(app.URLService)
+
+	call := func(
+		handler authedHandeler,
+		u *userDomain.User,
+		method string,
+		target string,
+		pathValues map[string]string,
+		body string,
+	) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		for key, value := range pathValues {
+			request.SetPathValue(key, value)
+		}
+		response := httptest.NewRecorder()
+		handler(response, request, u)
+
+		return response
+	}
+
+	response := call(workspaces.CreateWorkspace, owner, http.MethodPost, "/api/v1/workspaces", nil, `{"name": "Marketing"}`)
+	if response.Result().StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+	}
+
+	shared := workspaceHTTPResponseBody{}
+	if err := json.NewDecoder(response.Body).Decode(&shared); err != nil {
+		t.Fatalf("could not parse response %q", err)
+	}
+
+	workspaceID := strconv.Itoa(int(shared.ID))
+	memberID := strconv.Itoa(int(member.Id))
+	ownerID := strconv.Itoa(int(owner.Id))
+
+	t.Run("test every user has a personal workspace", func(t *testing.T) {
+		response := call(workspaces.ListWorkspaces, owner, http.MethodGet, "/api/v1/workspaces", nil, "")
+
+		got := []workspaceHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if len(got) != 2 || !got[0].Personal || got[0].Role != workspace.RoleOwner || got[1].ID != shared.ID {
+			t.Errorf("got workspaces %v want a personal and the shared workspace", got)
+		}
+	})
+
+	t.Run("test personal workspaces can not be shared", func(t *testing.T) {
+		personal, err := app.WorkspaceRepo.SelectPersonalWorkspace(context.Background(), owner.Id)
+		if err != nil {
+			t.Fatalf("could not find personal workspace %q", err)
+		}
+
+		personalID := strconv.Itoa(int(personal.ID))
+		response := call(
+			workspaces.InviteMember,
+			owner,
+			http.MethodPost,
+			"/api/v1/workspaces/"+personalID+"/invites",
+			map[string]string{"id": personalID},
+			`{"email": "member@mail.com", "role": "editor"}`,
+		)
+
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("test invited members can add links to the workspace", func(t *testing.T) {
+		app.Mailbox.Reset()
+
+		response := call(
+			workspaces.InviteMember,
+			owner,
+			http.MethodPost,
+			"/api/v1/workspaces/"+workspaceID+"/invites",
+			map[string]string{"id": workspaceID},
+			`{"email": "member@mail.com", "role": "viewer"}`,
+		)
+		if response.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+		}
+
+		match := workspaceInviteTokenPattern.FindStringSubmatch(app.Mailbox.String())
+		if match == nil {
+			t.Fatalf("no invite link was sent got %q", app.Mailbox.String())
+		}
+
+		accept := fmt.Sprintf(`{"token": %q}`, match[1])
+
+		// the invite was sent to the member, not the owner
+		response = call(workspaces.AcceptInvite, owner, http.MethodPost, "/api/v1/workspaces/invites/accept", nil, accept)
+		if response.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusBadRequest)
+		}
+
+		response = call(workspaces.AcceptInvite, member, http.MethodPost, "/api/v1/workspaces/invites/accept", nil, accept)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		shorten := fmt.Sprintf(`{"long_url": "https://www.google.com", "workspace_id": %d}`, shared.ID)
+
+		response = call(urls.CreateShortURL, member, http.MethodPost, "/api/v1/urls", nil, shorten)
+		if response.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("viewer got status %d want %d", response.Result().StatusCode, http.StatusForbidden)
+		}
+
+		response = call(
+			workspaces.SetMemberRole,
+			owner,
+			http.MethodPut,
+			"/api/v1/workspaces/"+workspaceID+"/members/"+memberID,
+			map[string]string{"id": workspaceID, "userId": memberID},
+			`{"role": "editor"}`,
+		)
+		if response.Result().StatusCode != http.StatusOK {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusOK)
+		}
+
+		response = call(urls.CreateShortURL, member, http.MethodPost, "/api/v1/urls", nil, shorten)
+		if response.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("editor got status %d want %d", response.Result().StatusCode, http.StatusCreated)
+		}
+	})
+
+	t.Run("test links stay in the workspace when their creator leaves", func(t *testing.T) {
+		response := call(
+			workspaces.RemoveMember,
+			member,
+			http.MethodDelete,
+			"/api/v1/workspaces/"+workspaceID+"/members/"+memberID,
+			map[string]string{"id": workspaceID, "userId": memberID},
+			"",
+		)
+		if response.Result().StatusCode != http.StatusNoContent {
+			t.Fatalf("got status %d want %d", response.Result().StatusCode, http.StatusNoContent)
+		}
+
+		response = call(
+			workspaces.ListURLs,
+			owner,
+			http.MethodGet,
+			"/api/v1/workspaces/"+workspaceID+"/urls",
+			map[string]string{"id": workspaceID},
+			"",
+		)
+
+		got := []workspaceURLHTTPResponseBody{}
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("could not parse response %q", err)
+		}
+
+		if len(got) != 1 || got[0].CreatedBy == nil || *got[0].CreatedBy != member.Id {
+			t.Errorf("got links %v want the link created by %d", got, member.Id)
+		}
+
+		// former members can no longer change the workspace's links
+		request := shorturl.NewDeleteURLRequest(member.Id, got[0].ShortURL)
+		if err := app.URLService.DeleteShortURL(context.Background(), *request); err != nil {
+			t.Fatalf("could not delete link %q", err)
+		}
+
+		if _, err := app.URLRepo.GetURLByHash(context.Background(), got[0].ShortURL); err != nil {
+			t.Errorf("former member deleted a workspace link %q", err)
+		}
+	})
+
+	t.Run("test the last owner can not leave", func(t *testing.T) {
+		response := call(
+			workspaces.RemoveMember,
+			owner,
+			http.MethodDelete,
+			"/api/v1/workspaces/"+workspaceID+"/members/"+ownerID,
+			map[string]string{"id": workspaceID, "userId": ownerID},
+			"",
+		)
+
+		if response.Result().StatusCode != http.StatusConflict {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusConflict)
+		}
+	})
+
+	t.Run("test non members can not see the workspace", func(t *testing.T) {
+		response := call(
+			workspaces.ListMembers,
+			member,
+			http.MethodGet,
+			"/api/v1/workspaces/"+workspaceID+"/members",
+			map[string]string{"id": workspaceID},
+			"",
+		)
+
+		if response.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("got status %d want %d", response.Result().StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("test two owners leaving at the same time leave one owner", func(t *testing.T) {
+		if err := app.WorkspaceRepo.CreateMember(context.Background(), shared.ID, member.Id, workspace.RoleOwner); err != nil {
+			t.Fatalf("could not make member an owner %q", err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i, leaving := range []int32{owner.Id, member.Id} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = app.WorkspaceService.RemoveMember(context.Background(), leaving, shared.ID, leaving)
+			}()
+		}
+		wg.Wait()
+
+		left := 0
+		for _, err := range errs {
+			switch err {
+			case nil:
+				left++
+			case workspace.ErrLastOwner:
+			default:
+				t.Errorf("got unexpected error %q", err)
+			}
+		}
+
+		if left != 1 {
+			t.Errorf("got %d owners leaving want 1", left)
+		}
+	})
+}
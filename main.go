@@ -1,7 +1,12 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/lib/pq"
 
@@ -12,14 +17,45 @@ import (
 func main() {
 	appSettings, err := configuration.NewApplicationSettings()
 	if err != nil {
-		log.Fatal("could not build application settings", err)
+		slog.Error("could not build application settings", "error", err)
+		os.Exit(1)
 	}
 
-	application, err := application.NewApplication(appSettings)
+	schema, err := fs.Sub(migrations, "sql/schema")
 	if err != nil {
-		log.Fatal("could not build application", err)
+		slog.Error("could not read schema migrations", "error", err)
+		os.Exit(1)
 	}
 
-	log.Printf("Serving port: %v \n", appSettings.Server.Port)
-	log.Fatal(application.Server.ListenAndServe())
+	application, err := application.NewApplication(appSettings, schema)
+	if err != nil {
+		slog.Error("could not build application", "error", err)
+		os.Exit(1)
+	}
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exitCode := 0
+
+	select {
+	case <-signals.Done():
+	case err := <-application.Start():
+		slog.Error("server stopped", "error", err)
+		exitCode = 1
+	}
+
+	// a second signal kills the process without waiting for the shutdown
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), appSettings.Server.ShutdownTimeout)
+	err = application.Shutdown(ctx)
+	cancel()
+
+	if err != nil {
+		slog.Error("could not shut down cleanly", "error", err)
+		exitCode = 1
+	}
+
+	os.Exit(exitCode)
 }
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"embed"
+)
+
+// migrations are built into the binary so the readiness probe can tell
+// whether the database schema is at the version this build expects.
+//
+//go:embed sql/schema/*.sql
+var migrations embed.FS
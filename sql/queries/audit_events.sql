@@ -0,0 +1,37 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (
+	event_type, user_id, actor_id, ip_address, user_agent, target_type, target_id, details, diff, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: SearchAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (sqlc.narg(user_id)::int IS NULL OR user_id = sqlc.narg(user_id)::int) AND
+(sqlc.narg(actor_id)::int IS NULL OR actor_id = sqlc.narg(actor_id)::int) AND
+(sqlc.arg(event_type)::text = '' OR event_type = sqlc.arg(event_type)::text) AND
+(sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since)::timestamp) AND
+(sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until)::timestamp)
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SelectUserAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE user_id = $1
+ORDER BY id DESC
+LIMIT $2 OFFSET $3;
+
+-- name: VerifyAuditChain :one
+-- walks the whole chain and reports the first event that does not link to
+-- the one before it or whose hash does not match its contents
+WITH chain AS (
+	SELECT e.id, e.hash,
+	e.prev_hash = lag(e.hash, 1, '') OVER (ORDER BY e.id) AND e.hash = audit_event_hash(e) AS intact
+	FROM audit_events e
+)
+SELECT count(*) AS events,
+coalesce((SELECT hash FROM chain ORDER BY id DESC LIMIT 1), '')::text AS head_hash,
+coalesce(min(id) FILTER (WHERE NOT intact), 0)::bigint AS first_broken_id
+FROM chain;
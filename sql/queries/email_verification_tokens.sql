@@ -0,0 +1,12 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (user_id, email, token_hash, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = $1
+WHERE token_hash = $2 AND
+used_at IS NULL AND
+expires_at > $1
+RETURNING *;
@@ -0,0 +1,35 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: SelectRefreshTokenByHash :one
+SELECT *
+FROM refresh_tokens
+WHERE token_hash = $1;
+
+-- name: MarkRefreshTokenUsed :one
+UPDATE refresh_tokens
+SET used_at = $1
+WHERE id = $2 AND
+used_at IS NULL AND
+revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = $1
+WHERE family_id = $2 AND
+revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = $1
+WHERE user_id = $2 AND
+revoked_at IS NULL;
+
+-- name: SelectUserRefreshTokens :many
+SELECT *
+FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at;
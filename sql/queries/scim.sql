@@ -0,0 +1,103 @@
+-- name: CreateSCIMToken :one
+INSERT INTO scim_tokens (workspace_id, token_hash, created_by, created_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: SelectActiveSCIMToken :one
+SELECT *
+FROM scim_tokens
+WHERE token_hash = $1 AND
+revoked_at IS NULL;
+
+-- name: RevokeSCIMToken :execrows
+UPDATE scim_tokens
+SET revoked_at = $1
+WHERE id = $2 AND
+workspace_id = $3 AND
+revoked_at IS NULL;
+
+-- name: ProvisionSCIMUser :one
+-- creates a user managed by the workspace's directory with a personal
+-- workspace like every other user and a viewer membership in the workspace,
+-- the email is unverified until its owner verifies it
+WITH new_user AS (
+	INSERT INTO users (email, password, created_at, updated_at, disabled_at, disabled_by)
+	VALUES (
+		sqlc.arg(email),
+		sqlc.arg(password),
+		sqlc.arg(created_at),
+		sqlc.arg(created_at),
+		sqlc.narg(disabled_at),
+		sqlc.narg(disabled_by)
+	)
+	RETURNING *
+), personal_workspace AS (
+	INSERT INTO workspaces (name, personal_user_id, created_at, updated_at)
+	SELECT 'Personal', id, created_at, created_at
+	FROM new_user
+	RETURNING id, personal_user_id, created_at
+), personal_membership AS (
+	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+	SELECT id, personal_user_id, 'owner', created_at
+	FROM personal_workspace
+), workspace_membership AS (
+	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+	SELECT sqlc.arg(workspace_id)::int, id, 'viewer', created_at
+	FROM new_user
+), directory_user AS (
+	INSERT INTO scim_users (user_id, workspace_id, external_id, created_at)
+	SELECT id, sqlc.arg(workspace_id)::int, sqlc.narg(external_id)::text, created_at
+	FROM new_user
+)
+SELECT id
+FROM new_user;
+
+-- name: SelectSCIMUsers :many
+SELECT users.id, users.email, users.created_at, users.updated_at, users.disabled_at,
+scim_users.external_id, workspace_members.role
+FROM scim_users
+JOIN users ON users.id = scim_users.user_id
+LEFT JOIN workspace_members ON workspace_members.workspace_id = scim_users.workspace_id AND
+workspace_members.user_id = scim_users.user_id
+WHERE scim_users.workspace_id = $1
+ORDER BY users.id;
+
+-- name: SelectSCIMUser :one
+SELECT users.id, users.email, users.created_at, users.updated_at, users.disabled_at,
+scim_users.external_id, workspace_members.role
+FROM scim_users
+JOIN users ON users.id = scim_users.user_id
+LEFT JOIN workspace_members ON workspace_members.workspace_id = scim_users.workspace_id AND
+workspace_members.user_id = scim_users.user_id
+WHERE scim_users.workspace_id = $1 AND
+scim_users.user_id = $2;
+
+-- name: UpdateSCIMUser :one
+UPDATE scim_users
+SET external_id = $1
+WHERE user_id = $2 AND
+workspace_id = $3
+RETURNING *;
+
+-- name: UpdateSCIMUserEmail :execrows
+UPDATE users
+SET email = $1, email_verified_at = NULL, updated_at = $2
+WHERE id = $3 AND
+EXISTS (
+	SELECT 1
+	FROM scim_users
+	WHERE user_id = $3 AND
+	workspace_id = $4
+);
+
+-- name: IsSCIMUser :one
+SELECT EXISTS (
+	SELECT 1
+	FROM scim_users
+	WHERE user_id = $1
+);
+
+-- name: DeleteSCIMUser :execrows
+DELETE FROM scim_users
+WHERE user_id = $1 AND
+workspace_id = $2;
@@ -0,0 +1,42 @@
+-- name: UpsertPendingTOTP :one
+INSERT INTO user_totp (user_id, encrypted_secret, created_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET encrypted_secret = EXCLUDED.encrypted_secret, created_at = EXCLUDED.created_at, last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: SelectTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTP :one
+UPDATE user_totp
+SET confirmed_at = $1, last_used_step = $2
+WHERE user_id = $3 AND
+confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseTOTPStep :one
+UPDATE user_totp
+SET last_used_step = $1
+WHERE user_id = $2 AND
+last_used_step < $1
+RETURNING *;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM user_recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+VALUES ($1, $2, $3);
+
+-- name: ConsumeRecoveryCode :one
+UPDATE user_recovery_codes
+SET used_at = $1
+WHERE user_id = $2 AND
+code_hash = $3 AND
+used_at IS NULL
+RETURNING *;
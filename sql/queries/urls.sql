@@ -1,6 +1,19 @@
 -- name: CreateURL :one
-INSERT INTO urls (short_url, long_url, created_at, updated_at, user_id)
-VALUES ($1, $2, $3, $4, $5)
+WITH quota AS (
+	SELECT workspace_id
+	FROM workspace_quotas
+	WHERE workspace_id = sqlc.arg(workspace_id) AND
+	(sqlc.arg(max_active_links)::bigint = 0 OR active_links < sqlc.arg(max_active_links)::bigint)
+	FOR UPDATE
+)
+INSERT INTO urls (short_url, long_url, created_at, updated_at, user_id, workspace_id)
+SELECT sqlc.arg(short_url)::text, sqlc.arg(long_url)::text, sqlc.arg(created_at)::timestamp,
+sqlc.arg(updated_at)::timestamp, workspace_members.user_id, workspace_members.workspace_id
+FROM workspace_members
+JOIN quota ON quota.workspace_id = workspace_members.workspace_id
+WHERE workspace_members.workspace_id = sqlc.arg(workspace_id) AND
+workspace_members.user_id = sqlc.arg(user_id) AND
+workspace_members.role IN ('owner', 'admin', 'editor')
 RETURNING *;
 
 -- name: SelectURL :one
@@ -8,14 +21,78 @@ SELECT *
 FROM urls
 WHERE short_url = $1;
 
--- name: DeleteURL :exec
+-- name: DeleteURL :one
 DELETE FROM urls
-WHERE user_id = $1 AND 
-short_url = $2;
+WHERE short_url = $1 AND
+workspace_id IN (
+	SELECT workspace_id
+	FROM workspace_members
+	WHERE user_id = $2 AND
+	role IN ('owner', 'admin', 'editor')
+)
+RETURNING *;
 
 -- name: UpdateShortURL :one
 UPDATE urls
 SET long_url = $1, updated_at = $2
-WHERE user_id = $3 AND 
-short_url = $4
+WHERE short_url = $3 AND
+workspace_id IN (
+	SELECT workspace_id
+	FROM workspace_members
+	WHERE user_id = $4 AND
+	role IN ('owner', 'admin', 'editor')
+)
 RETURNING *;
+
+-- name: SelectUserURLs :many
+SELECT *
+FROM urls
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountUserURLs :one
+SELECT COUNT(*) AS links, COUNT(disabled_at) AS disabled_links
+FROM urls
+WHERE user_id = $1;
+
+-- name: RecordURLClicks :exec
+INSERT INTO url_clicks (url_id, day, clicks)
+SELECT id, sqlc.arg(day)::date, sqlc.arg(clicks)::bigint
+FROM urls
+WHERE short_url = sqlc.arg(short_url)
+ON CONFLICT (url_id, day) DO UPDATE
+SET clicks = url_clicks.clicks + EXCLUDED.clicks;
+
+-- name: SelectUserURLClicks :many
+SELECT urls.short_url, url_clicks.day, url_clicks.clicks
+FROM url_clicks
+JOIN urls ON urls.id = url_clicks.url_id
+WHERE urls.user_id = $1
+ORDER BY urls.short_url, url_clicks.day;
+
+-- name: SearchURLs :many
+SELECT *
+FROM urls
+WHERE sqlc.arg(query)::text = '' OR
+short_url ILIKE '%' || sqlc.arg(query)::text || '%' OR
+long_url ILIKE '%' || sqlc.arg(query)::text || '%'
+ORDER BY id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SetURLDisabled :one
+UPDATE urls
+SET disabled_at = $1, disabled_reason = $2
+WHERE short_url = $3
+RETURNING *;
+
+-- name: SelectWorkspaceURLs :many
+SELECT *
+FROM urls
+WHERE workspace_id = $1 AND
+EXISTS (
+	SELECT 1
+	FROM workspace_members
+	WHERE workspace_id = $1 AND
+	user_id = $2
+)
+ORDER BY created_at;
@@ -0,0 +1,27 @@
+-- name: ScheduleUserDeletion :one
+INSERT INTO user_deletions (user_id, requested_at, purge_after)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET requested_at = EXCLUDED.requested_at, purge_after = EXCLUDED.purge_after
+RETURNING *;
+
+-- name: DeleteUserDeletion :execrows
+DELETE FROM user_deletions
+WHERE user_id = $1;
+
+-- name: PurgeUser :execrows
+DELETE FROM users
+WHERE id = $1 AND
+EXISTS (
+	SELECT 1
+	FROM user_deletions
+	WHERE user_id = $1 AND
+	purge_after <= $2
+);
+
+-- name: SelectDueUserDeletions :many
+SELECT *
+FROM user_deletions
+WHERE purge_after <= $1
+ORDER BY purge_after
+LIMIT $2;
@@ -1,7 +1,21 @@
 -- name: CreateUser :one
-INSERT INTO users (email, password, created_at, updated_at)
-VALUES ($1, $2, $3, $4)
-RETURNING *;
+-- every user is created with a personal workspace they own
+WITH new_user AS (
+	INSERT INTO users (email, password, created_at, updated_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING *
+), personal_workspace AS (
+	INSERT INTO workspaces (name, personal_user_id, created_at, updated_at)
+	SELECT 'Personal', id, created_at, created_at
+	FROM new_user
+	RETURNING id, personal_user_id, created_at
+), personal_membership AS (
+	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+	SELECT id, personal_user_id, 'owner', created_at
+	FROM personal_workspace
+)
+SELECT *
+FROM new_user;
 
 -- name: SelectUser :one
 SELECT *
@@ -13,18 +27,59 @@ SELECT *
 FROM users
 WHERE id = $1;
 
--- name: UpdateUser :one
+-- name: UpdateUserEmail :one
 UPDATE users
-SET email = $1, password = $2, updated_at = $3
-WHERE id = $4
+SET email = $1, updated_at = $2,
+email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END
+WHERE id = $3
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users
+SET password = $1, updated_at = $2
+WHERE id = $3
 RETURNING *;
 
--- name: UserTokenRefresh :exec
+-- name: MarkUserEmailVerified :one
 UPDATE users
-SET refresh_token = $1, refresh_token_revoke_date = $2
-WHERE id = $3;
+SET email_verified_at = $1
+WHERE id = $2 AND
+email = $3
+RETURNING *;
 
--- name: SelectUserByRefreshToken :one
+-- name: SearchUsers :many
 SELECT *
 FROM users
-WHERE refresh_token = $1;
+WHERE sqlc.arg(query)::text = '' OR
+email ILIKE '%' || sqlc.arg(query)::text || '%'
+ORDER BY id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SetUserDisabledAt :one
+UPDATE users
+SET disabled_at = $1, disabled_by = $2, updated_at = $3
+WHERE id = $4
+RETURNING *;
+
+-- name: DisableUserBy :one
+-- users who are already disabled stay disabled by whoever disabled them
+UPDATE users
+SET disabled_at = COALESCE(disabled_at, sqlc.arg(disabled_at)),
+disabled_by = COALESCE(disabled_by, sqlc.arg(disabled_by)),
+updated_at = sqlc.arg(disabled_at)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: EnableUserDisabledBy :one
+-- users disabled by someone else stay disabled
+UPDATE users
+SET disabled_at = NULL, disabled_by = NULL, updated_at = sqlc.arg(updated_at)
+WHERE id = sqlc.arg(id) AND
+(disabled_by IS NULL OR disabled_by = sqlc.arg(disabled_by))
+RETURNING *;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = $2
+WHERE id = $3
+RETURNING *;
@@ -0,0 +1,27 @@
+-- name: SelectWorkspaceQuota :one
+SELECT workspaces.id AS workspace_id,
+COALESCE(workspace_quotas.plan, '')::text AS plan,
+COALESCE(workspace_quotas.active_links, 0)::bigint AS active_links,
+COALESCE(workspace_monthly_clicks.clicks, 0)::bigint AS monthly_clicks
+FROM workspaces
+LEFT JOIN workspace_quotas ON workspace_quotas.workspace_id = workspaces.id
+LEFT JOIN workspace_monthly_clicks ON workspace_monthly_clicks.workspace_id = workspaces.id AND
+workspace_monthly_clicks.month = sqlc.arg(month)::date
+WHERE workspaces.id = sqlc.arg(workspace_id);
+
+-- name: SetWorkspacePlan :exec
+INSERT INTO workspace_quotas (workspace_id, plan)
+VALUES ($1, $2)
+ON CONFLICT (workspace_id) DO UPDATE
+SET plan = EXCLUDED.plan;
+
+-- name: SelectURLWorkspace :one
+SELECT workspace_id
+FROM urls
+WHERE short_url = $1;
+
+-- name: StoreWorkspaceMonthlyClicks :exec
+INSERT INTO workspace_monthly_clicks (workspace_id, month, clicks)
+VALUES (sqlc.arg(workspace_id), sqlc.arg(month)::date, sqlc.arg(clicks)::bigint)
+ON CONFLICT (workspace_id, month) DO UPDATE
+SET clicks = GREATEST(workspace_monthly_clicks.clicks, EXCLUDED.clicks);
@@ -0,0 +1,127 @@
+-- name: CreateWorkspace :one
+WITH new_workspace AS (
+	INSERT INTO workspaces (name, created_at, updated_at)
+	VALUES (sqlc.arg(name), sqlc.arg(created_at), sqlc.arg(created_at))
+	RETURNING *
+), owner_membership AS (
+	INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+	SELECT id, sqlc.arg(owner_id)::int, 'owner', created_at
+	FROM new_workspace
+)
+SELECT *
+FROM new_workspace;
+
+-- name: SelectWorkspace :one
+SELECT *
+FROM workspaces
+WHERE id = $1;
+
+-- name: SelectPersonalWorkspace :one
+SELECT *
+FROM workspaces
+WHERE personal_user_id = $1;
+
+-- name: SelectUserWorkspaces :many
+SELECT workspaces.*, workspace_members.role
+FROM workspaces
+JOIN workspace_members ON workspace_members.workspace_id = workspaces.id
+WHERE workspace_members.user_id = $1
+ORDER BY workspaces.id;
+
+-- name: SelectWorkspaceMember :one
+SELECT workspace_members.*, users.email
+FROM workspace_members
+JOIN users ON users.id = workspace_members.user_id
+WHERE workspace_members.workspace_id = $1 AND
+workspace_members.user_id = $2;
+
+-- name: SelectWorkspaceMembers :many
+SELECT workspace_members.*, users.email
+FROM workspace_members
+JOIN users ON users.id = workspace_members.user_id
+WHERE workspace_members.workspace_id = $1
+ORDER BY workspace_members.created_at, workspace_members.user_id;
+
+-- name: CreateWorkspaceMember :one
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: UpdateWorkspaceMemberRole :one
+-- the last owner is not demoted, the workspace's owners are locked so two
+-- owners demoting each other at the same time can not both succeed
+WITH owners AS (
+	SELECT user_id
+	FROM workspace_members
+	WHERE workspace_id = sqlc.arg(workspace_id) AND
+	role = 'owner'
+	ORDER BY user_id
+	FOR UPDATE
+), other_owners AS (
+	SELECT COUNT(*) AS count
+	FROM owners
+	WHERE user_id <> sqlc.arg(user_id)
+)
+UPDATE workspace_members
+SET role = sqlc.arg(role)
+FROM other_owners
+WHERE workspace_members.workspace_id = sqlc.arg(workspace_id) AND
+workspace_members.user_id = sqlc.arg(user_id) AND
+(workspace_members.role <> 'owner' OR sqlc.arg(role) = 'owner' OR other_owners.count > 0)
+RETURNING workspace_members.*;
+
+-- name: DeleteWorkspaceMember :execrows
+-- the last owner is not removed, the workspace's owners are locked so two
+-- owners leaving at the same time can not both succeed
+WITH owners AS (
+	SELECT user_id
+	FROM workspace_members
+	WHERE workspace_id = sqlc.arg(workspace_id) AND
+	role = 'owner'
+	ORDER BY user_id
+	FOR UPDATE
+), other_owners AS (
+	SELECT COUNT(*) AS count
+	FROM owners
+	WHERE user_id <> sqlc.arg(user_id)
+)
+DELETE FROM workspace_members
+USING other_owners
+WHERE workspace_members.workspace_id = sqlc.arg(workspace_id) AND
+workspace_members.user_id = sqlc.arg(user_id) AND
+(workspace_members.role <> 'owner' OR other_owners.count > 0);
+
+-- name: CountSoleOwnedWorkspaces :one
+-- counts the workspaces that would be left without an owner but with
+-- members if the user left
+SELECT COUNT(*)
+FROM workspace_members AS owner
+WHERE owner.user_id = $1 AND
+owner.role = 'owner' AND
+NOT EXISTS (
+	SELECT 1
+	FROM workspace_members AS other_owner
+	WHERE other_owner.workspace_id = owner.workspace_id AND
+	other_owner.user_id <> owner.user_id AND
+	other_owner.role = 'owner'
+) AND
+EXISTS (
+	SELECT 1
+	FROM workspace_members AS other_member
+	WHERE other_member.workspace_id = owner.workspace_id AND
+	other_member.user_id <> owner.user_id
+);
+
+-- name: CreateWorkspaceInvite :one
+INSERT INTO workspace_invites (workspace_id, email, role, token_hash, invited_by, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ConsumeWorkspaceInvite :one
+UPDATE workspace_invites
+SET accepted_at = sqlc.arg(accepted_at)
+WHERE token_hash = sqlc.arg(token_hash) AND
+LOWER(email) = LOWER(sqlc.arg(email)::text) AND
+accepted_at IS NULL AND
+expires_at > sqlc.arg(accepted_at)
+RETURNING *;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id int NOT NULL,
+	family_id VARCHAR(64) NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+ALTER TABLE users
+DROP COLUMN refresh_token,
+DROP COLUMN refresh_token_revoke_date;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN refresh_token varchar(250),
+ADD COLUMN refresh_token_revoke_date TIMESTAMP;
+
+DROP TABLE refresh_tokens;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id int NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
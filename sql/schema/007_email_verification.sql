@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE users
+SET email_verified_at = created_at;
+
+CREATE TABLE email_verification_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id int NOT NULL,
+	email VARCHAR(250) NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE user_totp (
+	user_id int PRIMARY KEY,
+	encrypted_secret VARCHAR(250) NOT NULL,
+	last_used_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL,
+	confirmed_at TIMESTAMP,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE TABLE user_recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id int NOT NULL,
+	code_hash VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE INDEX user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE user_recovery_codes;
+
+DROP TABLE user_totp;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE user_identities (
+	id SERIAL PRIMARY KEY,
+	user_id int NOT NULL,
+	provider VARCHAR(50) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(250) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (provider, subject),
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_identities;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- events outlive the users they are about, so user_id is not a foreign key
+CREATE TABLE audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	event_type VARCHAR(100) NOT NULL,
+	user_id int,
+	ip_address VARCHAR(64) NOT NULL,
+	details JSONB NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE user_deletions (
+	user_id int PRIMARY KEY,
+	requested_at TIMESTAMP NOT NULL,
+	purge_after TIMESTAMP NOT NULL,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE INDEX user_deletions_purge_after_idx ON user_deletions (purge_after);
+
+CREATE TABLE url_clicks (
+	url_id int NOT NULL,
+	day DATE NOT NULL,
+	clicks BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (url_id, day),
+	CONSTRAINT fk_url
+		FOREIGN KEY (url_id)
+			REFERENCES urls(id)
+				ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE url_clicks;
+
+DROP TABLE user_deletions;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+ADD COLUMN disabled_at TIMESTAMP;
+
+ALTER TABLE urls
+ADD COLUMN disabled_at TIMESTAMP,
+ADD COLUMN disabled_reason VARCHAR(20);
+
+-- +goose Down
+ALTER TABLE urls
+DROP COLUMN disabled_reason,
+DROP COLUMN disabled_at;
+
+ALTER TABLE users
+DROP COLUMN disabled_at,
+DROP COLUMN role;
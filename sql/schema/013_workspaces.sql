@@ -0,0 +1,106 @@
+-- +goose Up
+CREATE TABLE workspaces (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	personal_user_id int UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	CONSTRAINT fk_personal_user
+		FOREIGN KEY (personal_user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE TABLE workspace_members (
+	workspace_id int NOT NULL,
+	user_id int NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (workspace_id, user_id),
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE
+);
+
+CREATE INDEX workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE workspace_invites (
+	id SERIAL PRIMARY KEY,
+	workspace_id int NOT NULL,
+	email VARCHAR(250) NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	invited_by int,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP,
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE,
+	CONSTRAINT fk_invited_by
+		FOREIGN KEY (invited_by)
+			REFERENCES users(id)
+				ON DELETE SET NULL
+);
+
+-- every existing user gets a personal workspace holding the links they own
+INSERT INTO workspaces (name, personal_user_id, created_at, updated_at)
+SELECT 'Personal', id, NOW(), NOW()
+FROM users;
+
+INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+SELECT id, personal_user_id, 'owner', created_at
+FROM workspaces;
+
+ALTER TABLE urls
+ADD COLUMN workspace_id int;
+
+UPDATE urls
+SET workspace_id = workspaces.id
+FROM workspaces
+WHERE workspaces.personal_user_id = urls.user_id;
+
+ALTER TABLE urls
+ALTER COLUMN workspace_id SET NOT NULL,
+ADD CONSTRAINT fk_workspace
+	FOREIGN KEY (workspace_id)
+		REFERENCES workspaces(id)
+			ON DELETE CASCADE;
+
+CREATE INDEX urls_workspace_id_idx ON urls (workspace_id);
+
+-- links belong to their workspace, user_id only records who created them
+ALTER TABLE urls
+DROP CONSTRAINT fk_user,
+ALTER COLUMN user_id DROP NOT NULL,
+ADD CONSTRAINT fk_user
+	FOREIGN KEY (user_id)
+		REFERENCES users(id)
+			ON DELETE SET NULL;
+
+-- +goose Down
+DELETE FROM urls
+WHERE user_id IS NULL;
+
+ALTER TABLE urls
+DROP CONSTRAINT fk_user,
+ALTER COLUMN user_id SET NOT NULL,
+ADD CONSTRAINT fk_user
+	FOREIGN KEY (user_id)
+		REFERENCES users(id)
+			ON DELETE CASCADE;
+
+ALTER TABLE urls
+DROP COLUMN workspace_id;
+
+DROP TABLE workspace_invites;
+
+DROP TABLE workspace_members;
+
+DROP TABLE workspaces;
@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE scim_tokens (
+	id SERIAL PRIMARY KEY,
+	workspace_id int NOT NULL,
+	token_hash VARCHAR(64) UNIQUE NOT NULL,
+	created_by int,
+	created_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE,
+	CONSTRAINT fk_created_by
+		FOREIGN KEY (created_by)
+			REFERENCES users(id)
+				ON DELETE SET NULL
+);
+
+-- users provisioned through SCIM are managed by the directory of one
+-- workspace, only that workspace's tokens can change or deprovision them
+CREATE TABLE scim_users (
+	user_id int PRIMARY KEY,
+	workspace_id int NOT NULL,
+	external_id VARCHAR(250),
+	created_at TIMESTAMP NOT NULL,
+	CONSTRAINT fk_user
+		FOREIGN KEY (user_id)
+			REFERENCES users(id)
+				ON DELETE CASCADE,
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE
+);
+
+CREATE INDEX scim_users_workspace_id_idx ON scim_users (workspace_id);
+
+-- +goose Down
+DROP TABLE scim_users;
+
+DROP TABLE scim_tokens;
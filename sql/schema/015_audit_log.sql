@@ -0,0 +1,106 @@
+-- +goose Up
+-- user_id is who the event is about and actor_id who caused it, actor_id is
+-- null for the system and for directories
+ALTER TABLE audit_events
+ADD COLUMN actor_id int,
+ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+ADD COLUMN target_type VARCHAR(50) NOT NULL DEFAULT '',
+ADD COLUMN target_id VARCHAR(100) NOT NULL DEFAULT '',
+ADD COLUMN diff JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, created_at);
+
+-- the hash covers every column but itself, including the hash of the event
+-- before, so changing or removing an event breaks the chain after it
+-- +goose StatementBegin
+CREATE FUNCTION audit_event_hash(e audit_events) RETURNS VARCHAR(64) AS $$
+	SELECT encode(sha256(convert_to(jsonb_build_array(
+		e.prev_hash,
+		e.id,
+		e.event_type,
+		e.user_id,
+		e.actor_id,
+		e.ip_address,
+		e.user_agent,
+		e.target_type,
+		e.target_id,
+		e.details,
+		e.diff,
+		e.created_at
+	)::text, 'UTF8')), 'hex');
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+	e audit_events;
+	previous VARCHAR(64) := '';
+BEGIN
+	FOR e IN SELECT * FROM audit_events ORDER BY id LOOP
+		e.prev_hash := previous;
+		previous := audit_event_hash(e);
+
+		UPDATE audit_events
+		SET prev_hash = e.prev_hash, hash = previous
+		WHERE id = e.id;
+	END LOOP;
+END;
+$$;
+-- +goose StatementEnd
+
+-- inserts are serialized and take their id once they hold the lock, so the
+-- chain follows the order of the ids
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_chain() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_advisory_xact_lock(hashtext('audit_events'));
+
+	NEW.id := nextval(pg_get_serial_sequence('audit_events', 'id'));
+	NEW.prev_hash := coalesce((SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1), '');
+	NEW.hash := audit_event_hash(NEW);
+
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_chain
+BEFORE INSERT ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_chain();
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TRIGGER audit_events_no_truncate ON audit_events;
+DROP TRIGGER audit_events_append_only ON audit_events;
+DROP TRIGGER audit_events_chain ON audit_events;
+DROP FUNCTION audit_events_append_only();
+DROP FUNCTION audit_events_chain();
+DROP FUNCTION audit_event_hash(audit_events);
+DROP INDEX audit_events_actor_id_idx;
+
+ALTER TABLE audit_events
+DROP COLUMN hash,
+DROP COLUMN prev_hash,
+DROP COLUMN diff,
+DROP COLUMN target_id,
+DROP COLUMN target_type,
+DROP COLUMN user_agent,
+DROP COLUMN actor_id;
@@ -0,0 +1,63 @@
+-- +goose Up
+-- plan names one of the plans in the configuration, an empty plan is the
+-- default plan. active_links is kept up to date by a trigger on urls so
+-- creating a link does not have to count the workspace's links.
+CREATE TABLE workspace_quotas (
+	workspace_id int PRIMARY KEY,
+	plan VARCHAR(50) NOT NULL DEFAULT '',
+	active_links bigint NOT NULL DEFAULT 0,
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE
+);
+
+-- clicks counted towards the plan, per workspace and calendar month in UTC
+CREATE TABLE workspace_monthly_clicks (
+	workspace_id int NOT NULL,
+	month DATE NOT NULL,
+	clicks bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (workspace_id, month),
+	CONSTRAINT fk_workspace
+		FOREIGN KEY (workspace_id)
+			REFERENCES workspaces(id)
+				ON DELETE CASCADE
+);
+
+INSERT INTO workspace_quotas (workspace_id, active_links)
+SELECT workspaces.id, COUNT(urls.id) FILTER (WHERE urls.disabled_at IS NULL)
+FROM workspaces
+LEFT JOIN urls ON urls.workspace_id = workspaces.id
+GROUP BY workspaces.id;
+
+-- a link is active until it is disabled or deleted
+-- +goose StatementBegin
+CREATE FUNCTION urls_count_active_links() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.disabled_at IS NULL THEN
+		UPDATE workspace_quotas
+		SET active_links = active_links - 1
+		WHERE workspace_id = OLD.workspace_id;
+	END IF;
+
+	IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.disabled_at IS NULL THEN
+		INSERT INTO workspace_quotas (workspace_id, active_links)
+		VALUES (NEW.workspace_id, 1)
+		ON CONFLICT (workspace_id) DO UPDATE
+		SET active_links = workspace_quotas.active_links + 1;
+	END IF;
+
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER urls_count_active_links
+AFTER INSERT OR DELETE OR UPDATE OF disabled_at, workspace_id ON urls
+FOR EACH ROW EXECUTE FUNCTION urls_count_active_links();
+
+-- +goose Down
+DROP TRIGGER urls_count_active_links ON urls;
+DROP FUNCTION urls_count_active_links();
+DROP TABLE workspace_monthly_clicks;
+DROP TABLE workspace_quotas;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- every workspace has a quota row from the start, creating a link locks it
+-- so links created at the same moment can not take the workspace over its
+-- plan's limit
+INSERT INTO workspace_quotas (workspace_id)
+SELECT id
+FROM workspaces
+ON CONFLICT (workspace_id) DO NOTHING;
+
+-- +goose StatementBegin
+CREATE FUNCTION workspaces_create_quota() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO workspace_quotas (workspace_id)
+	VALUES (NEW.id)
+	ON CONFLICT (workspace_id) DO NOTHING;
+
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER workspaces_create_quota
+AFTER INSERT ON workspaces
+FOR EACH ROW EXECUTE FUNCTION workspaces_create_quota();
+
+-- +goose Down
+DROP TRIGGER workspaces_create_quota ON workspaces;
+DROP FUNCTION workspaces_create_quota();
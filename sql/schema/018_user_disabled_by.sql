@@ -0,0 +1,15 @@
+-- +goose Up
+-- records whether an administrator or a workspace's directory disabled a
+-- user, a directory can only enable users it disabled itself. Users who are
+-- already disabled are left to administrators as it is not known who
+-- disabled them.
+ALTER TABLE users
+ADD COLUMN disabled_by VARCHAR(20);
+
+UPDATE users
+SET disabled_by = 'admin'
+WHERE disabled_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN disabled_by;